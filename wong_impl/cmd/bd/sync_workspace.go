@@ -16,11 +16,9 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -185,43 +183,21 @@ func syncWorkspaceCleanup(ctx context.Context, repoRoot string, syncName string)
 
 // runJJFromDir runs a jj command from the given directory.
 func runJJFromDir(ctx context.Context, dir string, args ...string) error {
-	cmd := exec.CommandContext(ctx, "jj", args...)
-	cmd.Dir = dir
-	cmd.Env = os.Environ()
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return &vcs.CommandError{
-			VCS:     vcs.VCSTypeJujutsu,
-			Command: "jj",
-			Args:    args,
-			Stderr:  stderr.String(),
-			Err:     err,
-		}
-	}
-	return nil
+	_, err := runJJFromDirOutput(ctx, dir, args...)
+	return err
 }
 
 // runJJFromDirOutput runs a jj command from the given directory and returns stdout.
 func runJJFromDirOutput(ctx context.Context, dir string, args ...string) (string, error) {
-	cmd := exec.CommandContext(ctx, "jj", args...)
-	cmd.Dir = dir
-	cmd.Env = os.Environ()
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
+	res, err := vcs.DefaultRunner.Run(ctx, vcs.Invocation{Bin: "jj", Args: args, Dir: dir})
+	if err != nil {
 		return "", &vcs.CommandError{
 			VCS:     vcs.VCSTypeJujutsu,
 			Command: "jj",
 			Args:    args,
-			Stderr:  stderr.String(),
+			Stderr:  string(res.Stderr),
 			Err:     err,
 		}
 	}
-	return strings.TrimSpace(stdout.String()), nil
+	return strings.TrimSpace(string(res.Stdout)), nil
 }
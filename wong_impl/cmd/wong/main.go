@@ -0,0 +1,126 @@
+// Command wong runs wong-db tools outside of bd.
+//
+// Usage:
+//
+//	wong serve [-addr 127.0.0.1:7433] [-repo .]
+//	wong close-landed [-repo .] [-trunk revset]
+//	wong jj <jj arguments>
+//
+// serve exposes the repository's issue store over the HTTP/JSON API
+// described in internal/wongdb/server.go. An addr of the form
+// "unix:/path/to/sock" listens on a unix socket.
+//
+// close-landed closes the open issues whose linked changes are ancestors of
+// trunk (default: jj's trunk()).
+//
+// jj runs jj with its arguments, then syncs wong-db after commands that
+// write and closes landed issues after commands that can move trunk().
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/steveyegge/beads/internal/vcs"
+	"github.com/steveyegge/beads/internal/wongdb"
+)
+
+// defaultServeAddr is the loopback address "wong serve" listens on by default.
+const defaultServeAddr = "127.0.0.1:7433"
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "serve":
+		err = runServe(os.Args[2:])
+	case "close-landed":
+		err = runCloseLanded(os.Args[2:])
+	case "jj":
+		err = runJJ(os.Args[2:])
+	case "help", "-h", "--help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "wong: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// jj has already reported the failure; keep its exit code.
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "wong: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: wong serve [-addr host:port|unix:/path] [-repo dir]")
+	fmt.Fprintln(os.Stderr, "       wong close-landed [-repo dir] [-trunk revset]")
+	fmt.Fprintln(os.Stderr, "       wong jj <jj arguments>")
+}
+
+// runServe parses the serve flags and serves until SIGINT or SIGTERM.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", defaultServeAddr, "address to listen on, or unix:/path for a unix socket")
+	repo := fs.String("repo", ".", "repository whose issues to serve")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("serve: unexpected arguments %q", fs.Args())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "wong: serving %s on %s\n", *repo, *addr)
+	return wongdb.Serve(ctx, *repo, *addr)
+}
+
+// runCloseLanded parses the close-landed flags and closes landed issues.
+func runCloseLanded(args []string) error {
+	fs := flag.NewFlagSet("close-landed", flag.ContinueOnError)
+	repo := fs.String("repo", ".", "jj repository whose issues to close")
+	trunk := fs.String("trunk", "", "revset the changes must have landed in (default trunk())")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("close-landed: unexpected arguments %q", fs.Args())
+	}
+
+	root, err := vcs.GetJJRoot(*repo)
+	if err != nil {
+		return err
+	}
+	closed, err := wongdb.New(root).CloseLandedIssues(context.Background(), *trunk)
+	for _, id := range closed {
+		fmt.Println(id)
+	}
+	return err
+}
+
+// runJJ runs jj through the wong-db decorator for the repository containing
+// the current directory.
+func runJJ(args []string) error {
+	root, err := vcs.GetJJRoot(".")
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return wongdb.NewDecorator(wongdb.New(root)).Run(ctx, args)
+}
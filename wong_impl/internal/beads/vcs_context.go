@@ -112,6 +112,12 @@ func (vc *VCSContext) VcsStatus(ctx context.Context) ([]vcs.StatusEntry, error)
 	return vc.VCS.Status(ctx)
 }
 
+// VcsStatusWithOptions returns the working copy status, with untracked and
+// ignored files as opts asks.
+func (vc *VCSContext) VcsStatusWithOptions(ctx context.Context, opts *vcs.StatusOptions) ([]vcs.StatusEntry, error) {
+	return vc.VCS.StatusWithOptions(ctx, opts)
+}
+
 // VcsStatusPath returns the status of a specific path.
 func (vc *VCSContext) VcsStatusPath(ctx context.Context, path string) (*vcs.StatusEntry, error) {
 	return vc.VCS.StatusPath(ctx, path)
@@ -314,6 +320,29 @@ func (vc *VCSContext) VcsLogBetween(ctx context.Context, from, to string) ([]vcs
 	return vc.VCS.LogBetween(ctx, from, to)
 }
 
+// VcsQuery returns the changes matching a jj-style revset. On git only the
+// subset documented on vcs.EvalRevset is available.
+func (vc *VCSContext) VcsQuery(ctx context.Context, revset string) ([]vcs.ChangeInfo, error) {
+	return vc.VCS.Query(ctx, revset)
+}
+
+// VcsDiffStructured returns the parsed diff between two refs, limited to
+// paths if any are given.
+func (vc *VCSContext) VcsDiffStructured(ctx context.Context, from, to string, paths []string) (*vcs.DiffResult, error) {
+	return vc.VCS.DiffStructured(ctx, from, to, paths)
+}
+
+// VcsEvolog returns the versions a change has had, newest first.
+func (vc *VCSContext) VcsEvolog(ctx context.Context, changeID string) ([]vcs.ChangeInfo, error) {
+	return vc.VCS.Evolog(ctx, changeID)
+}
+
+// VcsAnnotate returns each line of path at rev with the change that last
+// modified it. An empty rev annotates the working copy.
+func (vc *VCSContext) VcsAnnotate(ctx context.Context, rev, path string) ([]vcs.AnnotatedLine, error) {
+	return vc.VCS.Annotate(ctx, rev, path)
+}
+
 // VcsDiffPath returns the diff of a specific file between two refs.
 func (vc *VCSContext) VcsDiffPath(ctx context.Context, from, to, path string) (string, error) {
 	return vc.VCS.DiffPath(ctx, from, to, path)
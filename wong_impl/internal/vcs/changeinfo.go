@@ -0,0 +1,286 @@
+package vcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// changeTimeFormat is the layout of ChangeInfo.Timestamp (git's %ai).
+const changeTimeFormat = "2006-01-02 15:04:05 -0700"
+
+// emptyTreeSHA1 is git's well-known empty tree, used to detect empty root
+// commits.
+const emptyTreeSHA1 = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// --- jj ---
+
+// jjChangeFields are the members of the JSON object jjChangeTemplate emits,
+// as (key, template expression producing a JSON value) pairs. Strings go
+// through escape_json(), so descriptions with newlines, quotes or NULs
+// survive intact.
+var jjChangeFields = [][2]string{
+	{"change_id", `stringify(change_id).escape_json()`},
+	{"short_id", `stringify(change_id.short()).escape_json()`},
+	{"commit_id", `stringify(commit_id).escape_json()`},
+	{"parents", `"[" ++ parents.map(|p| stringify(p.commit_id()).escape_json()).join(",") ++ "]"`},
+	{"bookmarks", `"[" ++ local_bookmarks.map(|b| stringify(b.name()).escape_json()).join(",") ++ "]"`},
+	{"tags", `"[" ++ tags.map(|t| stringify(t.name()).escape_json()).join(",") ++ "]"`},
+	{"description", `description.escape_json()`},
+	{"author_name", `author.name().escape_json()`},
+	{"author_email", `stringify(author.email()).escape_json()`},
+	{"committer_email", `stringify(committer.email()).escape_json()`},
+	{"time", `author.timestamp().format("%Y-%m-%dT%H:%M:%S%:z").escape_json()`},
+	{"working", `if(self.contained_in("@"), "true", "false")`},
+	{"empty", `if(empty, "true", "false")`},
+	{"conflict", `if(conflict, "true", "false")`},
+	{"immutable", `if(immutable, "true", "false")`},
+	{"divergent", `if(divergent, "true", "false")`},
+}
+
+// jjChangeTemplate renders each commit as one JSON object per line.
+var jjChangeTemplate = func() string {
+	parts := make([]string, 0, len(jjChangeFields))
+	for i, f := range jjChangeFields {
+		sep := ","
+		if i == 0 {
+			sep = "{"
+		}
+		parts = append(parts, fmt.Sprintf("%q ++ %s", sep+`"`+f[0]+`":`, f[1]))
+	}
+	return strings.Join(parts, " ++ ") + ` ++ "}\n"`
+}()
+
+// jjChange is the decoded form of one jjChangeTemplate object.
+type jjChange struct {
+	ChangeID       string   `json:"change_id"`
+	ShortID        string   `json:"short_id"`
+	CommitID       string   `json:"commit_id"`
+	Parents        []string `json:"parents"`
+	Bookmarks      []string `json:"bookmarks"`
+	Tags           []string `json:"tags"`
+	Description    string   `json:"description"`
+	AuthorName     string   `json:"author_name"`
+	AuthorEmail    string   `json:"author_email"`
+	CommitterEmail string   `json:"committer_email"`
+	Time           string   `json:"time"`
+	Working        bool     `json:"working"`
+	Empty          bool     `json:"empty"`
+	Conflict       bool     `json:"conflict"`
+	Immutable      bool     `json:"immutable"`
+	Divergent      bool     `json:"divergent"`
+}
+
+// parseJJChanges decodes the output of jj log -T jjChangeTemplate.
+func parseJJChanges(output []byte) ([]ChangeInfo, error) {
+	var changes []ChangeInfo
+	dec := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var c jjChange
+		if err := dec.Decode(&c); err != nil {
+			if errors.Is(err, io.EOF) {
+				return changes, nil
+			}
+			return nil, &CommandError{VCS: VCSTypeJujutsu, Command: "log", Stderr: err.Error(), Err: ErrCommandFailed}
+		}
+		t, _ := time.Parse(time.RFC3339, c.Time)
+		changes = append(changes, ChangeInfo{
+			ID:              c.ChangeID,
+			ShortID:         c.ShortID,
+			Description:     firstLine(c.Description),
+			Author:          c.AuthorName,
+			Timestamp:       formatChangeTime(t, c.Time),
+			IsWorking:       c.Working,
+			CommitID:        c.CommitID,
+			Parents:         c.Parents,
+			Bookmarks:       c.Bookmarks,
+			Tags:            c.Tags,
+			FullDescription: strings.TrimRight(c.Description, "\n"),
+			AuthorEmail:     c.AuthorEmail,
+			CommitterEmail:  c.CommitterEmail,
+			Time:            t,
+			IsEmpty:         c.Empty,
+			IsConflicted:    c.Conflict,
+			IsImmutable:     c.Immutable,
+			IsDivergent:     c.Divergent,
+		})
+	}
+}
+
+// logChanges runs jj log with jjChangeTemplate and the given extra args.
+func (j *JujutsuVCS) logChanges(ctx context.Context, args ...string) ([]ChangeInfo, error) {
+	fullArgs := append([]string{"log", "--no-graph", "-T", jjChangeTemplate}, args...)
+	output, err := j.runJJJSON(ctx, fullArgs...)
+	if err != nil {
+		return nil, err
+	}
+	return parseJJChanges(output)
+}
+
+// showChange returns the single change rev resolves to.
+func (j *JujutsuVCS) showChange(ctx context.Context, rev string) (*ChangeInfo, error) {
+	changes, err := j.logChanges(ctx, "-r", rev, "--limit", "1")
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, &CommandError{VCS: VCSTypeJujutsu, Command: "log", Args: []string{"-r", rev}, Err: ErrCommandFailed}
+	}
+	return &changes[0], nil
+}
+
+// --- git ---
+
+// gitChangeFields is the number of fields in gitChangeFormat.
+const gitChangeFields = 10
+
+// gitChangeFormat separates fields with the ASCII unit separator and puts
+// the raw body last, so it can hold anything but a NUL; git log -z
+// terminates each record with a NUL.
+const gitChangeFormat = "%H%x1f%h%x1f%P%x1f%D%x1f%an%x1f%ae%x1f%ce%x1f%aI%x1f%T%x1f%B"
+
+// gitChange is a parsed gitChangeFormat record plus its tree hash, which is
+// needed to compute IsEmpty.
+type gitChange struct {
+	ChangeInfo
+	tree string
+}
+
+// parseGitChanges decodes the output of git log -z --format=gitChangeFormat.
+func parseGitChanges(output string) []gitChange {
+	var changes []gitChange
+	for _, record := range strings.Split(output, "\x00") {
+		record = strings.TrimLeft(record, "\n")
+		if record == "" {
+			continue
+		}
+		f := strings.SplitN(record, "\x1f", gitChangeFields)
+		if len(f) < gitChangeFields {
+			continue
+		}
+		t, _ := time.Parse(time.RFC3339, f[7])
+		body := strings.TrimRight(f[9], "\n")
+		bookmarks, tags := parseGitDecorations(f[3])
+		changes = append(changes, gitChange{
+			ChangeInfo: ChangeInfo{
+				ID:              f[0],
+				ShortID:         f[1],
+				Description:     firstLine(body),
+				Author:          f[4],
+				Timestamp:       formatChangeTime(t, f[7]),
+				CommitID:        f[0],
+				Parents:         strings.Fields(f[2]),
+				Bookmarks:       bookmarks,
+				Tags:            tags,
+				FullDescription: body,
+				AuthorEmail:     f[5],
+				CommitterEmail:  f[6],
+				Time:            t,
+			},
+			tree: f[8],
+		})
+	}
+	return changes
+}
+
+// parseGitDecorations splits a %D string restricted to heads and tags into
+// branch and tag names.
+func parseGitDecorations(decorations string) (branches, tags []string) {
+	for _, d := range strings.Split(decorations, ", ") {
+		d = strings.TrimSpace(d)
+		switch {
+		case d == "" || d == "HEAD":
+		case strings.HasPrefix(d, "tag: "):
+			tags = append(tags, strings.TrimPrefix(d, "tag: "))
+		case strings.HasPrefix(d, "HEAD -> "):
+			branches = append(branches, strings.TrimPrefix(d, "HEAD -> "))
+		default:
+			branches = append(branches, d)
+		}
+	}
+	return branches, tags
+}
+
+// logChanges runs git log -z with gitChangeFormat and the given extra args,
+// then resolves parent trees in one extra call to fill in IsEmpty.
+func (g *GitVCS) logChanges(ctx context.Context, args ...string) ([]ChangeInfo, error) {
+	fullArgs := append([]string{"log", "-z", "--format=" + gitChangeFormat,
+		"--decorate-refs=refs/heads/", "--decorate-refs=refs/tags/"}, args...)
+	output, err := g.runGit(ctx, fullArgs...)
+	if err != nil {
+		return nil, err
+	}
+	parsed := parseGitChanges(output)
+
+	trees := make(map[string]string, len(parsed))
+	for _, c := range parsed {
+		trees[c.ID] = c.tree
+	}
+	var missing []string
+	for _, c := range parsed {
+		if len(c.Parents) > 0 && trees[c.Parents[0]] == "" {
+			missing = append(missing, c.Parents[0])
+			trees[c.Parents[0]] = "?"
+		}
+	}
+	if len(missing) > 0 {
+		revs := make([]string, len(missing))
+		for i, p := range missing {
+			revs[i] = p + "^{tree}"
+		}
+		out, err := g.runGit(ctx, append([]string{"rev-parse"}, revs...)...)
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range strings.Split(out, "\n") {
+			if i < len(missing) {
+				trees[missing[i]] = strings.TrimSpace(line)
+			}
+		}
+	}
+
+	changes := make([]ChangeInfo, len(parsed))
+	for i, c := range parsed {
+		if len(c.Parents) == 0 {
+			c.IsEmpty = c.tree == emptyTreeSHA1
+		} else {
+			c.IsEmpty = c.tree == trees[c.Parents[0]]
+		}
+		changes[i] = c.ChangeInfo
+	}
+	return changes, nil
+}
+
+// showChange returns the commit rev resolves to.
+func (g *GitVCS) showChange(ctx context.Context, rev string) (*ChangeInfo, error) {
+	changes, err := g.logChanges(ctx, "-1", "--end-of-options", rev, "--")
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, &CommandError{VCS: VCSTypeGit, Command: "log", Args: []string{rev}, Err: ErrCommandFailed}
+	}
+	return &changes[0], nil
+}
+
+// --- shared ---
+
+// firstLine returns the first line of a description.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimLeft(s, "\n"), "\n")
+	return line
+}
+
+// formatChangeTime renders t for ChangeInfo.Timestamp, falling back to the
+// raw string if it didn't parse.
+func formatChangeTime(t time.Time, raw string) string {
+	if t.IsZero() {
+		return raw
+	}
+	return t.Format(changeTimeFormat)
+}
@@ -0,0 +1,148 @@
+package vcs
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJJChangeTemplate_WellFormed(t *testing.T) {
+	if !strings.HasPrefix(jjChangeTemplate, `"{\"change_id\":" ++ `) {
+		t.Errorf("template does not open the object: %s", jjChangeTemplate[:40])
+	}
+	if !strings.HasSuffix(jjChangeTemplate, `++ "}\n"`) {
+		t.Errorf("template does not close the object")
+	}
+	for _, f := range jjChangeFields {
+		if !strings.Contains(jjChangeTemplate, `"`+f[0]+`\":`) {
+			t.Errorf("template missing key %s", f[0])
+		}
+	}
+}
+
+func TestParseJJChanges(t *testing.T) {
+	output := `{"change_id":"qpvuntsmwlqt","short_id":"qpvuntsmwlqt","commit_id":"3a2c8d1e4f1b","parents":["9be04f17a2c0"],"bookmarks":["main","wong-db"],"tags":["v1"],"description":"Subject \"quoted\"\n\nBody\u0000with NUL\n","author_name":"Alice","author_email":"alice@example.com","committer_email":"bot@example.com","time":"2024-01-02T03:04:05+01:00","working":true,"empty":false,"conflict":true,"immutable":false,"divergent":true}
+{"change_id":"zzzzzzzzzzzz","short_id":"zzzzzzzzzzzz","commit_id":"0000","parents":[],"bookmarks":[],"tags":[],"description":"","author_name":"","author_email":"","committer_email":"","time":"1970-01-01T00:00:00+00:00","working":false,"empty":true,"conflict":false,"immutable":true,"divergent":false}
+`
+	changes, err := parseJJChanges([]byte(output))
+	if err != nil {
+		t.Fatalf("parseJJChanges: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+	c := changes[0]
+	if c.ID != "qpvuntsmwlqt" || c.CommitID != "3a2c8d1e4f1b" || c.Author != "Alice" {
+		t.Errorf("ids/author = %+v", c)
+	}
+	if c.Description != `Subject "quoted"` {
+		t.Errorf("Description = %q", c.Description)
+	}
+	if c.FullDescription != "Subject \"quoted\"\n\nBody\x00with NUL" {
+		t.Errorf("FullDescription = %q", c.FullDescription)
+	}
+	if !reflect.DeepEqual(c.Parents, []string{"9be04f17a2c0"}) ||
+		!reflect.DeepEqual(c.Bookmarks, []string{"main", "wong-db"}) ||
+		!reflect.DeepEqual(c.Tags, []string{"v1"}) {
+		t.Errorf("refs = %v %v %v", c.Parents, c.Bookmarks, c.Tags)
+	}
+	if c.AuthorEmail != "alice@example.com" || c.CommitterEmail != "bot@example.com" {
+		t.Errorf("emails = %q %q", c.AuthorEmail, c.CommitterEmail)
+	}
+	want := time.Date(2024, 1, 2, 2, 4, 5, 0, time.UTC)
+	if !c.Time.Equal(want) || c.Timestamp != "2024-01-02 03:04:05 +0100" {
+		t.Errorf("time = %v / %q", c.Time, c.Timestamp)
+	}
+	if !c.IsWorking || c.IsEmpty || !c.IsConflicted || c.IsImmutable || !c.IsDivergent {
+		t.Errorf("flags = %+v", c)
+	}
+	if !changes[1].IsEmpty || !changes[1].IsImmutable {
+		t.Errorf("root flags = %+v", changes[1])
+	}
+
+	if _, err := parseJJChanges([]byte("not json")); err == nil {
+		t.Error("expected error for malformed output")
+	}
+}
+
+func TestParseGitChanges(t *testing.T) {
+	rec := func(fields ...string) string { return strings.Join(fields, "\x1f") }
+	output := rec("aaa", "a", "bbb ccc", "HEAD -> main, tag: v1.0, feature", "Alice", "alice@example.com",
+		"bob@example.com", "2024-01-02T03:04:05+01:00", "tree1", "Merge stuff\n\nLong body\n\x1fwith separator\n") +
+		"\x00" + rec("bbb", "b", "", "", "Bob", "bob@example.com", "bob@example.com",
+		"2024-01-01T00:00:00Z", "tree0", "Root\n")
+
+	changes := parseGitChanges(output)
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+	c := changes[0]
+	if c.ID != "aaa" || c.CommitID != "aaa" || c.ShortID != "a" || c.tree != "tree1" {
+		t.Errorf("ids = %+v", c)
+	}
+	if !reflect.DeepEqual(c.Parents, []string{"bbb", "ccc"}) {
+		t.Errorf("Parents = %v", c.Parents)
+	}
+	if !reflect.DeepEqual(c.Bookmarks, []string{"main", "feature"}) || !reflect.DeepEqual(c.Tags, []string{"v1.0"}) {
+		t.Errorf("refs = %v %v", c.Bookmarks, c.Tags)
+	}
+	if c.Description != "Merge stuff" || c.FullDescription != "Merge stuff\n\nLong body\n\x1fwith separator" {
+		t.Errorf("descriptions = %q / %q", c.Description, c.FullDescription)
+	}
+	if c.Time.IsZero() || c.Timestamp != "2024-01-02 03:04:05 +0100" {
+		t.Errorf("time = %v / %q", c.Time, c.Timestamp)
+	}
+	if len(changes[1].Parents) != 0 || changes[1].Description != "Root" {
+		t.Errorf("root = %+v", changes[1])
+	}
+}
+
+func TestGitVCS_RichChangeInfo(t *testing.T) {
+	h := NewTestHelper(t)
+	repoPath := h.CreateGitRepo("rich")
+	g, err := NewGitVCS(repoPath)
+	if err != nil {
+		t.Fatalf("NewGitVCS: %v", err)
+	}
+	ctx := context.Background()
+
+	h.WriteFile(repoPath, "a.txt", "one")
+	h.runCmd(repoPath, "git", "add", "a.txt")
+	h.runCmd(repoPath, "git", "commit", "-m", "first")
+	h.runCmd(repoPath, "git", "commit", "--allow-empty", "-m", "empty one\n\nwith body")
+	h.runCmd(repoPath, "git", "tag", "v1")
+	h.runCmd(repoPath, "git", "branch", "side")
+
+	head, err := g.CurrentChange(ctx)
+	if err != nil {
+		t.Fatalf("CurrentChange: %v", err)
+	}
+	if head.Description != "empty one" || head.FullDescription != "empty one\n\nwith body" {
+		t.Errorf("descriptions = %q / %q", head.Description, head.FullDescription)
+	}
+	if !head.IsEmpty {
+		t.Error("empty commit not reported empty")
+	}
+	if !reflect.DeepEqual(head.Tags, []string{"v1"}) {
+		t.Errorf("Tags = %v", head.Tags)
+	}
+	if len(head.Bookmarks) != 2 {
+		t.Errorf("Bookmarks = %v, want the current branch and side", head.Bookmarks)
+	}
+	if head.AuthorEmail != "test@example.com" {
+		t.Errorf("AuthorEmail = %q", head.AuthorEmail)
+	}
+
+	log, err := g.Log(ctx, 0)
+	if err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+	if len(log) != 2 || log[1].IsEmpty || len(log[1].Parents) != 0 {
+		t.Errorf("Log = %+v", log)
+	}
+	if len(log[0].Parents) != 1 || log[0].Parents[0] != log[1].CommitID {
+		t.Errorf("parent of head = %v, want %s", log[0].Parents, log[1].CommitID)
+	}
+}
@@ -0,0 +1,77 @@
+package vcs
+
+import (
+	"regexp"
+)
+
+// stderrRule maps a stderr pattern to one of the classification sentinels.
+type stderrRule struct {
+	kind    error
+	pattern *regexp.Regexp
+}
+
+// jjRules classify jj stderr. Patterns cover the wording of every jj release
+// with fixtures under testdata/stderr/jj; jj renamed branches to bookmarks in
+// 0.22, so both spellings are matched. Rules are tried in order.
+var jjRules = []stderrRule{
+	{ErrStaleWorkingCopy, regexp.MustCompile(`(?i)working copy is stale`)},
+	{ErrImmutableRevision, regexp.MustCompile(`(?i)\bis immutable\b|immutable commits`)},
+	{ErrDivergentChange, regexp.MustCompile(`(?i)\bis divergent\b|have the same change id`)},
+	{ErrConflictedBookmark, regexp.MustCompile(`(?i)(bookmark|branch) \S+ is conflicted|because it's conflicted`)},
+	{ErrNewRemoteBookmark, regexp.MustCompile(`(?i)refusing to create new remote (bookmark|branch)`)},
+	{ErrNonFastForward, regexp.MustCompile(`(?i)unexpectedly moved on the remote|not fast-forwardable|non-fast-forward`)},
+	{ErrAuthFailed, regexp.MustCompile(`(?i)failed to authenticate|authentication failed|permission denied \(publickey`)},
+	{ErrNothingChanged, regexp.MustCompile(`(?i)nothing changed|no changes`)},
+}
+
+// gitRules classify git stderr, matching the messages git has printed since
+// 2.20 with LANG=C.
+var gitRules = []stderrRule{
+	{ErrNonFastForward, regexp.MustCompile(`(?i)non-fast-forward|\(fetch first\)|updates were rejected because`)},
+	{ErrAuthFailed, regexp.MustCompile(`(?i)authentication failed|permission denied \(publickey|could not read username|terminal prompts disabled`)},
+}
+
+// gitStdoutRules classify git stdout. git reports merge conflicts and empty
+// commits there rather than on stderr; fixtures are under testdata/stdout/git.
+var gitStdoutRules = []stderrRule{
+	{ErrMergeConflict, regexp.MustCompile(`(?m)^CONFLICT \(|(?i:automatic merge failed)`)},
+	{ErrNothingToCommit, regexp.MustCompile(`(?i)nothing to commit|nothing added to commit`)},
+}
+
+// ClassifyStderr maps the stderr of a failed vcsType command to a sentinel
+// error such as ErrStaleWorkingCopy or ErrNonFastForward. It returns nil when
+// the failure is not recognized.
+func ClassifyStderr(vcsType VCSType, stderr string) error {
+	var rules []stderrRule
+	switch vcsType {
+	case VCSTypeJujutsu:
+		// jj shells out to git for remote operations in newer releases, so
+		// fall back to git's wording.
+		rules = append(jjRules[:len(jjRules):len(jjRules)], gitRules...)
+	case VCSTypeGit:
+		rules = gitRules
+	default:
+		return nil
+	}
+	return classify(rules, stderr)
+}
+
+// ClassifyStdout maps the stdout of a failed vcsType command to a sentinel
+// error such as ErrMergeConflict, for the failures a tool reports on stdout.
+// It returns nil when the failure is not recognized.
+func ClassifyStdout(vcsType VCSType, stdout string) error {
+	if vcsType != VCSTypeGit {
+		return nil
+	}
+	return classify(gitStdoutRules, stdout)
+}
+
+// classify returns the kind of the first rule matching output, or nil.
+func classify(rules []stderrRule, output string) error {
+	for _, r := range rules {
+		if r.pattern.MatchString(output) {
+			return r.kind
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixtureKinds maps stderr fixture names to the sentinel they must classify
+// as. "unclassified" fixtures must not match anything.
+var fixtureKinds = map[string]error{
+	"stale_working_copy":  ErrStaleWorkingCopy,
+	"immutable_revision":  ErrImmutableRevision,
+	"conflicted_bookmark": ErrConflictedBookmark,
+	"divergent_change":    ErrDivergentChange,
+	"new_remote_bookmark": ErrNewRemoteBookmark,
+	"non_fast_forward":    ErrNonFastForward,
+	"auth_failed":         ErrAuthFailed,
+	"nothing_changed":     ErrNothingChanged,
+	"merge_conflict":      ErrMergeConflict,
+	"nothing_to_commit":   ErrNothingToCommit,
+	"unclassified":        nil,
+}
+
+// jjFixtureKinds must be present for every recorded jj release, so adding
+// a release directory forces the whole taxonomy to be re-checked.
+var jjFixtureKinds = []string{
+	"stale_working_copy", "immutable_revision", "conflicted_bookmark",
+	"divergent_change", "new_remote_bookmark", "non_fast_forward",
+	"auth_failed", "nothing_changed", "unclassified",
+}
+
+func TestClassifyStderr_Fixtures(t *testing.T) {
+	for _, tool := range []VCSType{VCSTypeJujutsu, VCSTypeGit} {
+		releases, err := os.ReadDir(filepath.Join("testdata", "stderr", string(tool)))
+		if err != nil {
+			t.Fatalf("reading %s fixtures: %v", tool, err)
+		}
+		if len(releases) == 0 {
+			t.Fatalf("no %s fixtures", tool)
+		}
+		for _, rel := range releases {
+			dir := filepath.Join("testdata", "stderr", string(tool), rel.Name())
+			files, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := make(map[string]bool)
+			for _, f := range files {
+				name := strings.TrimSuffix(f.Name(), ".txt")
+				seen[name] = true
+				want, ok := fixtureKinds[name]
+				if !ok {
+					t.Errorf("%s/%s: unknown fixture kind", dir, f.Name())
+					continue
+				}
+				data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := ClassifyStderr(tool, string(data)); got != want {
+					t.Errorf("%s %s/%s: classified as %v, want %v", tool, rel.Name(), name, got, want)
+				}
+			}
+			if tool == VCSTypeJujutsu {
+				for _, name := range jjFixtureKinds {
+					if !seen[name] {
+						t.Errorf("jj %s: missing fixture %s.txt", rel.Name(), name)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestClassifyStdout_Fixtures checks the git failures reported on stdout,
+// and that stderr classification doesn't claim them.
+func TestClassifyStdout_Fixtures(t *testing.T) {
+	releases, err := os.ReadDir(filepath.Join("testdata", "stdout", "git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range releases {
+		dir := filepath.Join("testdata", "stdout", "git", rel.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			name := strings.TrimSuffix(f.Name(), ".txt")
+			want, ok := fixtureKinds[name]
+			if !ok {
+				t.Errorf("%s/%s: unknown fixture kind", dir, f.Name())
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ClassifyStdout(VCSTypeGit, string(data)); got != want {
+				t.Errorf("git %s/%s: classified as %v, want %v", rel.Name(), name, got, want)
+			}
+			if got := ClassifyStderr(VCSTypeGit, string(data)); got != nil {
+				t.Errorf("git %s/%s: stdout classified as stderr %v", rel.Name(), name, got)
+			}
+		}
+	}
+}
+
+// TestGitVCS_StdoutFailures runs real git so the classification can't drift
+// from where git actually prints these messages.
+func TestGitVCS_StdoutFailures(t *testing.T) {
+	h := NewTestHelper(t)
+	repo := h.CreateGitRepo("repo")
+	h.runCmd(repo, "git", "checkout", "-q", "-b", "main")
+	h.WriteFile(repo, "a.txt", "base\n")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-q", "-m", "base")
+	g, err := NewGitVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := g.Commit(ctx, "empty", nil); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("Commit with nothing staged = %v; want ErrNothingToCommit", err)
+	}
+
+	h.runCmd(repo, "git", "checkout", "-q", "-b", "other")
+	h.WriteFile(repo, "a.txt", "other\n")
+	h.runCmd(repo, "git", "commit", "-q", "-am", "other")
+	h.runCmd(repo, "git", "checkout", "-q", "main")
+	h.WriteFile(repo, "a.txt", "main\n")
+	h.runCmd(repo, "git", "commit", "-q", "-am", "main")
+	if err := g.Merge(ctx, "other", ""); !errors.Is(err, ErrMergeConflict) {
+		t.Errorf("conflicting Merge = %v; want ErrMergeConflict", err)
+	}
+}
+
+func TestCommandError_Is(t *testing.T) {
+	err := &CommandError{
+		VCS:     VCSTypeJujutsu,
+		Command: "jj",
+		Args:    []string{"status"},
+		Stderr:  "Error: The working copy is stale (not updated since operation abc).\n",
+		Err:     errors.New("exit status 1"),
+	}
+	if !errors.Is(err, ErrStaleWorkingCopy) {
+		t.Error("errors.Is(err, ErrStaleWorkingCopy) = false")
+	}
+	if errors.Is(err, ErrImmutableRevision) {
+		t.Error("errors.Is(err, ErrImmutableRevision) = true")
+	}
+
+	wrapped := errors.Join(errors.New("context"), err)
+	if !errors.Is(wrapped, ErrStaleWorkingCopy) {
+		t.Error("classification lost through wrapping")
+	}
+
+	other := &CommandError{VCS: VCSTypeMercurial, Stderr: "working copy is stale", Err: ErrCommandFailed}
+	if errors.Is(other, ErrStaleWorkingCopy) {
+		t.Error("hg errors should not be classified with jj rules")
+	}
+	if !errors.Is(other, ErrCommandFailed) {
+		t.Error("Unwrap chain broken")
+	}
+}
@@ -0,0 +1,81 @@
+package vcs_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/vcs"
+	"github.com/steveyegge/beads/internal/vcs/vcstest"
+)
+
+// diskRepo wraps a VCS backed by a real directory for the conformance suite.
+func diskRepo(t *testing.T, h *vcs.TestHelper, v vcs.VCS) *vcstest.Repo {
+	root := v.RepoRoot()
+	return &vcstest.Repo{
+		VCS: v,
+		WriteFile: func(t *testing.T, path, content string) {
+			t.Helper()
+			full := filepath.Join(root, path)
+			if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+				t.Fatalf("failed to create dir: %v", err)
+			}
+			h.WriteFile(root, path, content)
+		},
+		RemoveFile: func(t *testing.T, path string) {
+			t.Helper()
+			if err := os.Remove(filepath.Join(root, path)); err != nil {
+				t.Fatalf("failed to remove file: %v", err)
+			}
+		},
+		WorkspacePath: func(t *testing.T, name string) string {
+			return filepath.Join(filepath.Dir(root), filepath.Base(root)+"-"+name)
+		},
+	}
+}
+
+func TestConformance_Git(t *testing.T) {
+	vcstest.Run(t, func(t *testing.T) *vcstest.Repo {
+		h := vcs.NewTestHelper(t)
+		v, err := vcs.NewGitVCS(h.CreateGitRepo("repo"))
+		if err != nil {
+			t.Fatalf("NewGitVCS: %v", err)
+		}
+		return diskRepo(t, h, v)
+	})
+}
+
+func TestConformance_Jujutsu(t *testing.T) {
+	if _, err := exec.LookPath("jj"); err != nil {
+		t.Skip("jj not installed, skipping")
+	}
+	vcstest.Run(t, func(t *testing.T) *vcstest.Repo {
+		h := vcs.NewTestHelper(t)
+		v, err := vcs.NewJujutsuVCS(h.CreateJJRepo("repo"))
+		if err != nil {
+			t.Fatalf("NewJujutsuVCS: %v", err)
+		}
+		return diskRepo(t, h, v)
+	})
+}
+
+func TestConformance_Fake(t *testing.T) {
+	vcstest.Run(t, func(t *testing.T) *vcstest.Repo {
+		f := vcs.NewFakeVCS(t.TempDir())
+		f.SetConfig(context.Background(), "user.name", "Test User")
+		return &vcstest.Repo{
+			VCS: f,
+			WriteFile: func(t *testing.T, path, content string) {
+				f.WriteFile(path, []byte(content))
+			},
+			RemoveFile: func(t *testing.T, path string) {
+				f.RemoveFile(path)
+			},
+			WorkspacePath: func(t *testing.T, name string) string {
+				return filepath.Join(f.RepoRoot(), "..", name)
+			},
+		}
+	})
+}
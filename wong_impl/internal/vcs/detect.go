@@ -5,76 +5,23 @@ import (
 	"path/filepath"
 )
 
-// detectVCSType detects the VCS type for the given path.
-// It prefers jj over git in colocated repositories.
+// detectVCSType detects the VCS type for the given path using the registered
+// backends. It prefers jj over git in colocated repositories.
 func detectVCSType(path string) (VCSType, error) {
-	// Start from the given path and walk up to find VCS directories
-	absPath, err := filepath.Abs(path)
+	_, b, err := detectBackend(path)
 	if err != nil {
 		return VCSTypeUnknown, err
 	}
-
-	current := absPath
-	for {
-		jjPath := filepath.Join(current, ".jj")
-		gitPath := filepath.Join(current, ".git")
-
-		hasJJ := isDirectory(jjPath)
-		hasGit := isDirectoryOrFile(gitPath) // .git can be a file for worktrees
-
-		// Prefer jj in colocated repos (user chose jj-first workflow)
-		if hasJJ {
-			return VCSTypeJujutsu, nil
-		}
-
-		if hasGit {
-			return VCSTypeGit, nil
-		}
-
-		// Move to parent directory
-		parent := filepath.Dir(current)
-		if parent == current {
-			// Reached root without finding VCS
-			break
-		}
-		current = parent
-	}
-
-	return VCSTypeUnknown, ErrNoVCSFound
+	return b.Type, nil
 }
 
 // FindRepoRoot finds the repository root for the given path.
 func FindRepoRoot(path string) (string, VCSType, error) {
-	absPath, err := filepath.Abs(path)
+	root, b, err := detectBackend(path)
 	if err != nil {
 		return "", VCSTypeUnknown, err
 	}
-
-	current := absPath
-	for {
-		jjPath := filepath.Join(current, ".jj")
-		gitPath := filepath.Join(current, ".git")
-
-		hasJJ := isDirectory(jjPath)
-		hasGit := isDirectoryOrFile(gitPath)
-
-		// Prefer jj
-		if hasJJ {
-			return current, VCSTypeJujutsu, nil
-		}
-
-		if hasGit {
-			return current, VCSTypeGit, nil
-		}
-
-		parent := filepath.Dir(current)
-		if parent == current {
-			break
-		}
-		current = parent
-	}
-
-	return "", VCSTypeUnknown, ErrNoVCSFound
+	return root, b.Type, nil
 }
 
 // IsColocatedRepo checks if a path has both .jj and .git directories.
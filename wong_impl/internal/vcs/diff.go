@@ -0,0 +1,336 @@
+package vcs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DiffResult is a parsed diff between two revisions.
+type DiffResult struct {
+	Files []FileDiff
+	Stats DiffStats // Totals over Files
+}
+
+// FileDiff is the change to a single file.
+type FileDiff struct {
+	Status     FileStatus // Added, Modified, Deleted, Renamed or Copied
+	OldPath    string     // Empty for added files
+	NewPath    string     // Empty for deleted files
+	OldMode    string     // e.g. "100644"; empty if unknown
+	NewMode    string
+	Similarity int  // Percent, for renames and copies
+	Binary     bool // No hunks are available for binary files
+	Hunks      []DiffHunk
+	Stats      DiffStats
+}
+
+// Path returns the file's path after the change, or before it for
+// deletions.
+func (f *FileDiff) Path() string {
+	if f.NewPath != "" {
+		return f.NewPath
+	}
+	return f.OldPath
+}
+
+// DiffHunk is one @@ section of a file diff.
+type DiffHunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Section            string // Text after the closing @@, usually a function name
+	Lines              []DiffLine
+}
+
+// DiffOp is the kind of a diff line.
+type DiffOp byte
+
+const (
+	DiffContext DiffOp = ' '
+	DiffAdd     DiffOp = '+'
+	DiffDelete  DiffOp = '-'
+)
+
+// DiffLine is one line of a hunk. OldLine and NewLine are 1-based line
+// numbers, or 0 where the line doesn't exist on that side.
+type DiffLine struct {
+	Op        DiffOp
+	Text      string // Without the op prefix or trailing newline
+	OldLine   int
+	NewLine   int
+	NoNewline bool // The line has no trailing newline in the file
+}
+
+// DiffStats counts changed lines.
+type DiffStats struct {
+	FilesChanged int // Only set on DiffResult.Stats
+	Additions    int
+	Deletions    int
+}
+
+// ParseGitDiff parses diff output in git's extended format, as produced by
+// git diff, jj diff --git and hg diff --git.
+func ParseGitDiff(text string) (*DiffResult, error) {
+	p := &diffParser{lines: strings.Split(text, "\n")}
+	// A trailing newline leaves an empty last element that isn't a line.
+	if n := len(p.lines); n > 0 && p.lines[n-1] == "" {
+		p.lines = p.lines[:n-1]
+	}
+	result := &DiffResult{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if !strings.HasPrefix(line, "diff --git ") {
+			p.pos++ // preamble, e.g. jj's or hg's own headers
+			continue
+		}
+		f, err := p.file()
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, *f)
+		result.Stats.Additions += f.Stats.Additions
+		result.Stats.Deletions += f.Stats.Deletions
+	}
+	result.Stats.FilesChanged = len(result.Files)
+	return result, nil
+}
+
+type diffParser struct {
+	lines []string
+	pos   int
+}
+
+func (p *diffParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("diff line %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// file parses one "diff --git" section.
+func (p *diffParser) file() (*FileDiff, error) {
+	f := &FileDiff{Status: FileStatusModified}
+	f.OldPath, f.NewPath = parseDiffHeaderPaths(strings.TrimPrefix(p.lines[p.pos], "diff --git "))
+	p.pos++
+
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			return f, nil
+		case strings.HasPrefix(line, "@@ "):
+			h, err := p.hunk()
+			if err != nil {
+				return nil, err
+			}
+			for _, l := range h.Lines {
+				switch l.Op {
+				case DiffAdd:
+					f.Stats.Additions++
+				case DiffDelete:
+					f.Stats.Deletions++
+				}
+			}
+			f.Hunks = append(f.Hunks, *h)
+			continue
+		case strings.HasPrefix(line, "old mode "):
+			f.OldMode = strings.TrimPrefix(line, "old mode ")
+		case strings.HasPrefix(line, "new mode "):
+			f.NewMode = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "new file mode "):
+			f.Status = FileStatusAdded
+			f.NewMode = strings.TrimPrefix(line, "new file mode ")
+			f.OldPath = ""
+		case strings.HasPrefix(line, "deleted file mode "):
+			f.Status = FileStatusDeleted
+			f.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+			f.NewPath = ""
+		case strings.HasPrefix(line, "rename from "):
+			f.Status = FileStatusRenamed
+			f.OldPath = unquoteDiffPath(strings.TrimPrefix(line, "rename from "))
+		case strings.HasPrefix(line, "rename to "):
+			f.NewPath = unquoteDiffPath(strings.TrimPrefix(line, "rename to "))
+		case strings.HasPrefix(line, "copy from "):
+			f.Status = FileStatusCopied
+			f.OldPath = unquoteDiffPath(strings.TrimPrefix(line, "copy from "))
+		case strings.HasPrefix(line, "copy to "):
+			f.NewPath = unquoteDiffPath(strings.TrimPrefix(line, "copy to "))
+		case strings.HasPrefix(line, "similarity index "):
+			f.Similarity, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%"))
+		case strings.HasPrefix(line, "index "):
+			// index <old>..<new> [<mode>]
+			if _, mode, ok := strings.Cut(strings.TrimPrefix(line, "index "), " "); ok {
+				f.OldMode, f.NewMode = mode, mode
+			}
+		case strings.HasPrefix(line, "Binary file") || line == "GIT binary patch":
+			// git and jj: "Binary files a/x and b/x differ"; hg: "Binary file x has changed"
+			f.Binary = true
+		case strings.HasPrefix(line, "--- "):
+			if path := diffSidePath(strings.TrimPrefix(line, "--- "), "a/"); path != "" {
+				f.OldPath = path
+			}
+		case strings.HasPrefix(line, "+++ "):
+			if path := diffSidePath(strings.TrimPrefix(line, "+++ "), "b/"); path != "" {
+				f.NewPath = path
+			}
+		}
+		p.pos++
+	}
+	return f, nil
+}
+
+// hunk parses an @@ header and the lines it covers.
+func (p *diffParser) hunk() (*DiffHunk, error) {
+	h := &DiffHunk{}
+	header := p.lines[p.pos]
+	rest := strings.TrimPrefix(header, "@@ ")
+	ranges, section, ok := strings.Cut(rest, " @@")
+	if !ok {
+		return nil, p.errorf("malformed hunk header %q", header)
+	}
+	h.Section = strings.TrimPrefix(section, " ")
+	oldRange, newRange, ok := strings.Cut(ranges, " ")
+	if !ok || !strings.HasPrefix(oldRange, "-") || !strings.HasPrefix(newRange, "+") {
+		return nil, p.errorf("malformed hunk header %q", header)
+	}
+	var err1, err2 error
+	h.OldStart, h.OldLines, err1 = parseHunkRange(oldRange[1:])
+	h.NewStart, h.NewLines, err2 = parseHunkRange(newRange[1:])
+	if err1 != nil || err2 != nil {
+		return nil, p.errorf("malformed hunk header %q", header)
+	}
+	p.pos++
+
+	oldLine, newLine := h.OldStart, h.NewStart
+	oldLeft, newLeft := h.OldLines, h.NewLines
+	for p.pos < len(p.lines) && (oldLeft > 0 || newLeft > 0) {
+		line := p.lines[p.pos]
+		if line == "" {
+			// Some tools strip the space from blank context lines.
+			line = " "
+		}
+		l := DiffLine{Op: DiffOp(line[0]), Text: line[1:]}
+		switch l.Op {
+		case DiffContext:
+			l.OldLine, l.NewLine = oldLine, newLine
+			oldLine++
+			newLine++
+			oldLeft--
+			newLeft--
+		case DiffDelete:
+			l.OldLine = oldLine
+			oldLine++
+			oldLeft--
+		case DiffAdd:
+			l.NewLine = newLine
+			newLine++
+			newLeft--
+		case '\\':
+			p.markNoNewline(h)
+			p.pos++
+			continue
+		default:
+			return nil, p.errorf("unexpected line in hunk: %q", line)
+		}
+		h.Lines = append(h.Lines, l)
+		p.pos++
+	}
+	// Trimming the output drops blank context lines at the very end; any
+	// other shortfall means the diff was cut off.
+	for p.pos == len(p.lines) && oldLeft > 0 && oldLeft == newLeft {
+		h.Lines = append(h.Lines, DiffLine{Op: DiffContext, OldLine: oldLine, NewLine: newLine})
+		oldLine++
+		newLine++
+		oldLeft--
+		newLeft--
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, p.errorf("hunk %q is truncated", header)
+	}
+	// "\ No newline at end of file" may follow the last line.
+	if p.pos < len(p.lines) && strings.HasPrefix(p.lines[p.pos], `\`) {
+		p.markNoNewline(h)
+		p.pos++
+	}
+	return h, nil
+}
+
+// markNoNewline flags the last line of h as lacking a trailing newline.
+func (p *diffParser) markNoNewline(h *DiffHunk) {
+	if n := len(h.Lines); n > 0 {
+		h.Lines[n-1].NoNewline = true
+	}
+}
+
+// parseHunkRange parses "start,count" or "start" (count 1).
+func parseHunkRange(s string) (start, count int, err error) {
+	startStr, countStr, hasCount := strings.Cut(s, ",")
+	if start, err = strconv.Atoi(startStr); err != nil {
+		return 0, 0, err
+	}
+	count = 1
+	if hasCount {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, count, nil
+}
+
+// diffSidePath returns the path from a ---/+++ line, or "" for /dev/null.
+func diffSidePath(s, prefix string) string {
+	// git appends a tab when the path contains spaces.
+	s = strings.TrimSuffix(s, "\t")
+	if s == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(unquoteDiffPath(s), prefix)
+}
+
+// parseDiffHeaderPaths splits the "a/old b/new" part of a diff --git line.
+// Unquoted paths containing " b/" are ambiguous; the ---/+++ and rename
+// lines that follow, when present, take precedence.
+func parseDiffHeaderPaths(s string) (oldPath, newPath string) {
+	if strings.HasPrefix(s, `"`) {
+		if end := quotedEnd(s); end > 0 {
+			oldPath = unquoteDiffPath(s[:end])
+			newPath = unquoteDiffPath(strings.TrimPrefix(s[end:], " "))
+			return strings.TrimPrefix(oldPath, "a/"), strings.TrimPrefix(newPath, "b/")
+		}
+	}
+	if strings.HasSuffix(s, `"`) {
+		if i := strings.LastIndex(s, ` "`); i >= 0 {
+			return strings.TrimPrefix(s[:i], "a/"), strings.TrimPrefix(unquoteDiffPath(s[i+1:]), "b/")
+		}
+	}
+	// Same path on both sides: "a/X b/X" splits evenly.
+	if n := len(s); n >= 5 && n%2 == 1 && strings.HasPrefix(s, "a/") && strings.HasPrefix(s[n/2:], " b/") && s[2:n/2] == s[n/2+3:] {
+		return s[2 : n/2], s[n/2+3:]
+	}
+	if i := strings.Index(s, " b/"); i >= 0 {
+		return strings.TrimPrefix(s[:i], "a/"), s[i+3:]
+	}
+	return s, s
+}
+
+// quotedEnd returns the index just past the closing quote of the C-style
+// quoted string at the start of s, or -1.
+func quotedEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// unquoteDiffPath undoes git's C-style quoting of unusual paths.
+func unquoteDiffPath(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
@@ -0,0 +1,202 @@
+package vcs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// summarizeDiff renders the parts of a DiffResult that every dialect
+// reports, one file per line.
+func summarizeDiff(d *DiffResult) string {
+	var b strings.Builder
+	for _, f := range d.Files {
+		fmt.Fprintf(&b, "%s %q -> %q binary=%v +%d -%d hunks=%d\n",
+			f.Status, f.OldPath, f.NewPath, f.Binary, f.Stats.Additions, f.Stats.Deletions, len(f.Hunks))
+	}
+	fmt.Fprintf(&b, "total %d files +%d -%d", d.Stats.FilesChanged, d.Stats.Additions, d.Stats.Deletions)
+	return b.String()
+}
+
+func TestParseGitDiff_Dialects(t *testing.T) {
+	want := strings.Join([]string{
+		`modified "blob.bin" -> "blob.bin" binary=true +0 -0 hunks=0`,
+		`deleted "gone.txt" -> "" binary=false +0 -1 hunks=1`,
+		`modified "mod.txt" -> "mod.txt" binary=false +2 -1 hunks=1`,
+		`renamed "old.txt" -> "new.txt" binary=false +0 -0 hunks=0`,
+		`modified "script.sh" -> "script.sh" binary=false +0 -0 hunks=0`,
+		`added "" -> "sp ace é.txt" binary=false +1 -0 hunks=1`,
+		`modified "tail.txt" -> "tail.txt" binary=false +1 -1 hunks=1`,
+		`total 7 files +4 -3`,
+	}, "\n")
+	for _, dialect := range []string{"git", "jj", "hg"} {
+		t.Run(dialect, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "diff", dialect+".diff"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := ParseGitDiff(string(data))
+			if err != nil {
+				t.Fatalf("ParseGitDiff: %v", err)
+			}
+			if got := summarizeDiff(d); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+
+			byPath := make(map[string]FileDiff)
+			for _, f := range d.Files {
+				byPath[f.Path()] = f
+			}
+			if f := byPath["script.sh"]; f.OldMode != "100644" || f.NewMode != "100755" {
+				t.Errorf("script.sh modes = %q -> %q", f.OldMode, f.NewMode)
+			}
+			if f := byPath["gone.txt"]; f.OldMode != "100644" {
+				t.Errorf("gone.txt mode = %q", f.OldMode)
+			}
+
+			h := byPath["mod.txt"].Hunks[0]
+			if h.OldStart != 1 || h.OldLines != 3 || h.NewStart != 1 || h.NewLines != 4 {
+				t.Errorf("mod.txt hunk ranges = %+v", h)
+			}
+			wantLines := []DiffLine{
+				{Op: DiffContext, Text: "one", OldLine: 1, NewLine: 1},
+				{Op: DiffDelete, Text: "two", OldLine: 2},
+				{Op: DiffAdd, Text: "2", NewLine: 2},
+				{Op: DiffContext, Text: "three", OldLine: 3, NewLine: 3},
+				{Op: DiffAdd, Text: "four", NewLine: 4},
+			}
+			if fmt.Sprint(h.Lines) != fmt.Sprint(wantLines) {
+				t.Errorf("mod.txt lines = %+v\nwant %+v", h.Lines, wantLines)
+			}
+
+			tail := byPath["tail.txt"].Hunks[0].Lines
+			if len(tail) != 2 || tail[0].NoNewline || !tail[1].NoNewline {
+				t.Errorf("tail.txt lines = %+v; want only the added line without a newline", tail)
+			}
+		})
+	}
+}
+
+func TestParseGitDiff_Edges(t *testing.T) {
+	// Empty output is an empty diff.
+	d, err := ParseGitDiff("")
+	if err != nil || len(d.Files) != 0 || d.Stats != (DiffStats{}) {
+		t.Errorf("ParseGitDiff(\"\") = %+v, %v", d, err)
+	}
+
+	// Output trimmed by the caller loses the space of a blank last context line.
+	trimmed := "diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@ func main() {\n-x\n+y\n \n"
+	d, err = ParseGitDiff(strings.TrimSpace(trimmed))
+	if err != nil {
+		t.Fatalf("trimmed: %v", err)
+	}
+	h := d.Files[0].Hunks[0]
+	if h.Section != "func main() {" || len(h.Lines) != 3 || h.Lines[2] != (DiffLine{Op: DiffContext, OldLine: 2, NewLine: 2}) {
+		t.Errorf("trimmed hunk = %+v", h)
+	}
+
+	// Paths containing " b/" are taken from the ---/+++ lines.
+	d, err = ParseGitDiff("diff --git a/x b/y b/x b/y\n--- a/x b/y\n+++ b/x b/y\n@@ -1 +1 @@\n-a\n+b\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := d.Files[0]; f.OldPath != "x b/y" || f.NewPath != "x b/y" {
+		t.Errorf("ambiguous paths = %q, %q", f.OldPath, f.NewPath)
+	}
+
+	for name, bad := range map[string]string{
+		"truncated": "diff --git a/f b/f\n@@ -1,3 +1,3 @@\n-a\n",
+		"header":    "diff --git a/f b/f\n@@ -1,x +1 @@\n",
+		"line":      "diff --git a/f b/f\n@@ -1 +1 @@\n*a\n",
+	} {
+		if _, err := ParseGitDiff(bad); err == nil {
+			t.Errorf("%s: ParseGitDiff succeeded", name)
+		}
+	}
+}
+
+func FuzzParseGitDiff(f *testing.F) {
+	for _, dialect := range []string{"git", "jj", "hg"} {
+		if data, err := os.ReadFile(filepath.Join("testdata", "diff", dialect+".diff")); err == nil {
+			f.Add(string(data))
+		}
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		d, err := ParseGitDiff(text)
+		if err != nil {
+			return
+		}
+		var adds, dels int
+		for _, file := range d.Files {
+			adds += file.Stats.Additions
+			dels += file.Stats.Deletions
+		}
+		if d.Stats.FilesChanged != len(d.Files) || d.Stats.Additions != adds || d.Stats.Deletions != dels {
+			t.Errorf("totals %+v don't match files", d.Stats)
+		}
+	})
+}
+
+func TestGitVCS_DiffStructured(t *testing.T) {
+	h := NewTestHelper(t)
+	repo := h.CreateGitRepo("diff")
+	h.WriteFile(repo, "mod.txt", "one\ntwo\nthree\n")
+	h.WriteFile(repo, "old.txt", "keep\nthis\ncontent\nhere\nfor\nrename\n")
+	h.WriteFile(repo, "blob.bin", "\x00\x01bin")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-m", "base")
+	h.WriteFile(repo, "mod.txt", "one\n2\nthree\nfour\n")
+	h.runCmd(repo, "git", "mv", "old.txt", "new.txt")
+	h.WriteFile(repo, "blob.bin", "\x00\x02bin")
+	h.WriteFile(repo, "sp ace é.txt", "hi\n")
+	h.runCmd(repo, "git", "add", "-A")
+	h.runCmd(repo, "git", "commit", "-m", "change")
+
+	g, err := NewGitVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	d, err := g.DiffStructured(ctx, "HEAD~1", "HEAD", nil)
+	if err != nil {
+		t.Fatalf("DiffStructured: %v", err)
+	}
+	want := strings.Join([]string{
+		`modified "blob.bin" -> "blob.bin" binary=true +0 -0 hunks=0`,
+		`modified "mod.txt" -> "mod.txt" binary=false +2 -1 hunks=1`,
+		`renamed "old.txt" -> "new.txt" binary=false +0 -0 hunks=0`,
+		`added "" -> "sp ace é.txt" binary=false +1 -0 hunks=1`,
+		`total 4 files +3 -1`,
+	}, "\n")
+	if got := summarizeDiff(d); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Prefix settings in the user's config must not change what is parsed.
+	for _, setting := range []string{"diff.noprefix", "diff.mnemonicPrefix"} {
+		h.runCmd(repo, "git", "config", setting, "true")
+		d, err := g.DiffStructured(ctx, "HEAD~1", "HEAD", nil)
+		if err != nil {
+			t.Fatalf("DiffStructured with %s: %v", setting, err)
+		}
+		if got := summarizeDiff(d); got != want {
+			t.Errorf("with %s got:\n%s\nwant:\n%s", setting, got, want)
+		}
+		h.runCmd(repo, "git", "config", "--unset", setting)
+	}
+
+	d, err = g.DiffStructured(ctx, "HEAD~1", "HEAD", []string{"sp ace é.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Files) != 1 || d.Files[0].Path() != "sp ace é.txt" {
+		t.Errorf("path-limited diff = %s", summarizeDiff(d))
+	}
+
+	if _, err := g.DiffStructured(ctx, "--output=x", "HEAD", nil); err == nil {
+		t.Error("DiffStructured accepted an option as a revision")
+	}
+}
@@ -32,6 +32,55 @@ var (
 
 	// ErrCommandFailed is returned when a VCS command fails.
 	ErrCommandFailed = errors.New("vcs command failed")
+
+	// ErrInvalidRef is returned, before running anything, when a ref name or
+	// revision could be mistaken for a command-line option or revset
+	// expression.
+	ErrInvalidRef = errors.New("invalid ref name or revision")
+
+	// ErrUnsupportedJJVersion is returned when the installed jj is older than
+	// MinJJVersion, or lacks a feature an operation needs.
+	ErrUnsupportedJJVersion = errors.New("unsupported jj version")
+
+	// ErrInvalidArgument is returned, before running anything, when a path,
+	// remote, workspace name or config key could be mistaken for an option.
+	ErrInvalidArgument = errors.New("invalid argument")
+
+	// ErrCommandTimeout is returned when a command outlives Runner.Timeout.
+	ErrCommandTimeout = errors.New("vcs command timed out")
+
+	// ErrNotRecorded is returned by a replaying Runner when the transcript has
+	// no unused entry for the requested command.
+	ErrNotRecorded = errors.New("command not in transcript")
+
+	// The errors below classify CommandError failures by their stderr. They
+	// are never returned directly; use errors.Is on the CommandError.
+
+	// ErrStaleWorkingCopy means another workspace rewrote the working-copy
+	// commit; jj workspace update-stale recovers.
+	ErrStaleWorkingCopy = errors.New("working copy is stale")
+
+	// ErrImmutableRevision means the operation would rewrite an immutable commit.
+	ErrImmutableRevision = errors.New("revision is immutable")
+
+	// ErrConflictedBookmark means a bookmark points at several commits.
+	ErrConflictedBookmark = errors.New("bookmark is conflicted")
+
+	// ErrDivergentChange means a change ID resolves to several visible commits.
+	ErrDivergentChange = errors.New("change is divergent")
+
+	// ErrNonFastForward means a push was rejected because the remote moved.
+	ErrNonFastForward = errors.New("push rejected: not a fast-forward")
+
+	// ErrAuthFailed means the remote rejected our credentials.
+	ErrAuthFailed = errors.New("authentication failed")
+
+	// ErrNothingChanged means the command had nothing to do.
+	ErrNothingChanged = errors.New("nothing changed")
+
+	// ErrNewRemoteBookmark means jj refused to create a bookmark on the remote
+	// without --allow-new or tracking.
+	ErrNewRemoteBookmark = errors.New("refusing to create new remote bookmark")
 )
 
 // CommandError wraps an error from a VCS command with additional context.
@@ -40,7 +89,10 @@ type CommandError struct {
 	Command string
 	Args    []string
 	Stderr  string
-	Err     error
+	// Stdout is kept for the failures git reports on stdout, such as merge
+	// conflicts; see ClassifyStdout.
+	Stdout string
+	Err    error
 }
 
 func (e *CommandError) Error() string {
@@ -51,6 +103,17 @@ func (e *CommandError) Unwrap() error {
 	return e.Err
 }
 
+// Is reports whether the command's stderr or stdout classifies as target, so
+// callers can write errors.Is(err, ErrStaleWorkingCopy) instead of matching
+// strings.
+func (e *CommandError) Is(target error) bool {
+	kind := ClassifyStderr(e.VCS, e.Stderr)
+	if kind == nil {
+		kind = ClassifyStdout(e.VCS, e.Stdout)
+	}
+	return kind != nil && kind == target
+}
+
 // String returns the string representation of VCSType.
 func (v VCSType) String() string {
 	return string(v)
@@ -0,0 +1,2567 @@
+package vcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeCall records a single method invocation on a FakeVCS.
+type FakeCall struct {
+	Method string
+	Args   []string
+}
+
+const (
+	// defaultWorkspace is the name of the workspace created by NewFakeVCS.
+	defaultWorkspace = "default"
+
+	// defaultBranch is the bookmark created with the root commit.
+	defaultBranch = "main"
+
+	// rootCommitID is the ID of the empty root commit.
+	rootCommitID = "0000000000000000000000000000000000000000"
+
+	// shortIDLen is the length of ChangeInfo.ShortID.
+	shortIDLen = 12
+)
+
+// fakeCommit is a node in the DAG. Trees are complete snapshots.
+type fakeCommit struct {
+	id          string
+	seq         int
+	parents     []string
+	description string
+	author      string
+	email       string
+	time        time.Time
+	tree        map[string][]byte
+	predecessor string // The commit this one amended, if any
+}
+
+// fakeConflict records the three sides of an unresolved file merge.
+type fakeConflict struct {
+	base, ours, theirs []byte
+}
+
+// fakeWorkspace is a working copy attached to the shared repo.
+type fakeWorkspace struct {
+	name   string
+	path   string
+	head   string // commit ID
+	branch string // current bookmark, empty if detached
+
+	files map[string][]byte // working tree
+	index map[string][]byte // staged tree
+
+	conflicts map[string]*fakeConflict
+	mergeHead string // non-empty while a merge is in progress
+}
+
+// fakeRemote is a configured remote repository.
+type fakeRemote struct {
+	url  string
+	repo *fakeRepo
+}
+
+// fakeRepo is the state shared by every workspace.
+type fakeRepo struct {
+	mu sync.Mutex
+
+	root       string
+	vcsType    VCSType
+	commits    map[string]*fakeCommit
+	nextSeq    int
+	bookmarks  map[string]string // name -> commit ID
+	tracking   map[string]string // "name@remote" -> commit ID
+	upstreams  map[string]string // bookmark -> "remote/name"
+	config     map[string]string
+	remotes    map[string]*fakeRemote
+	workspaces map[string]*fakeWorkspace
+
+	calls []FakeCall
+	errs  map[string]error
+}
+
+// FakeVCS is an in-memory VCS for tests. It keeps a commit DAG, bookmarks,
+// workspaces, remotes and merge conflicts in memory, records every call, and
+// can be told to fail specific methods. It never spawns processes.
+//
+// The model follows git: each workspace has a working tree, an index and a
+// HEAD commit, and Commit records the index. Remotes are other FakeVCS
+// repositories. A FakeVCS value is a handle on one workspace; Workspace
+// returns handles on the others.
+//
+// To have DetectVCS return it, register its Backend:
+//
+//	fake := vcs.NewFakeVCS(dir)
+//	vcs.RegisterBackend(fake.Backend())
+//	defer vcs.UnregisterBackend(vcs.VCSTypeFake)
+type FakeVCS struct {
+	repo *fakeRepo
+	ws   string
+}
+
+// NewFakeVCS creates an in-memory repository rooted at root (used only for
+// paths reported by RepoRoot and workspace listings). The repository starts
+// with an empty root commit and a "main" bookmark checked out.
+func NewFakeVCS(root string) *FakeVCS {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	r := &fakeRepo{
+		root:       root,
+		vcsType:    VCSTypeFake,
+		commits:    make(map[string]*fakeCommit),
+		bookmarks:  make(map[string]string),
+		tracking:   make(map[string]string),
+		upstreams:  make(map[string]string),
+		config:     make(map[string]string),
+		remotes:    make(map[string]*fakeRemote),
+		workspaces: make(map[string]*fakeWorkspace),
+		errs:       make(map[string]error),
+	}
+	// Every repository shares the same root commit, as in jj, so histories
+	// created in separate repos are related and can be pushed between them.
+	c := &fakeCommit{id: rootCommitID, tree: map[string][]byte{}}
+	r.commits[c.id] = c
+	r.bookmarks[defaultBranch] = c.id
+	r.workspaces[defaultWorkspace] = &fakeWorkspace{
+		name:      defaultWorkspace,
+		path:      root,
+		head:      c.id,
+		branch:    defaultBranch,
+		files:     map[string][]byte{},
+		index:     map[string][]byte{},
+		conflicts: map[string]*fakeConflict{},
+	}
+	return &FakeVCS{repo: r, ws: defaultWorkspace}
+}
+
+// Backend returns a registry entry that detects this fake at its root. Its
+// priority is above every built-in backend so it wins over a real .git/.jj.
+func (f *FakeVCS) Backend() Backend {
+	return Backend{
+		Type:     VCSTypeFake,
+		Priority: 1000,
+		Probe:    func(dir string) bool { return dir == f.repo.root },
+		New:      func(path string) (VCS, error) { return f, nil },
+	}
+}
+
+// SetType makes the fake report a different VCSType, so code that branches on
+// git vs jj can be exercised.
+func (f *FakeVCS) SetType(t VCSType) {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	f.repo.vcsType = t
+}
+
+// FailOn makes every later call to method return err. A nil err clears it.
+func (f *FakeVCS) FailOn(method string, err error) {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	if err == nil {
+		delete(f.repo.errs, method)
+		return
+	}
+	f.repo.errs[method] = err
+}
+
+// Calls returns the recorded calls in order.
+func (f *FakeVCS) Calls() []FakeCall {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	return append([]FakeCall(nil), f.repo.calls...)
+}
+
+// record logs a call and returns any error configured for the method.
+// Callers must not hold repo.mu.
+func (f *FakeVCS) record(method string, args ...string) error {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	f.repo.calls = append(f.repo.calls, FakeCall{Method: method, Args: args})
+	return f.repo.errs[method]
+}
+
+// Workspace returns a handle on another workspace of the same repository.
+func (f *FakeVCS) Workspace(name string) (*FakeVCS, error) {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	if _, ok := f.repo.workspaces[name]; !ok {
+		return nil, ErrWorkspaceNotFound
+	}
+	return &FakeVCS{repo: f.repo, ws: name}, nil
+}
+
+// AddRemote configures other as a remote named name. Its RepoRoot is used as
+// the remote URL.
+func (f *FakeVCS) AddRemote(name string, other *FakeVCS) {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	f.repo.remotes[name] = &fakeRemote{url: other.repo.root, repo: other.repo}
+}
+
+// WriteFile writes a file in the working tree.
+func (f *FakeVCS) WriteFile(p string, content []byte) {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	f.workspace().files[cleanPath(p)] = append([]byte(nil), content...)
+}
+
+// ReadFile reads a file from the working tree.
+func (f *FakeVCS) ReadFile(p string) ([]byte, bool) {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	data, ok := f.workspace().files[cleanPath(p)]
+	return append([]byte(nil), data...), ok
+}
+
+// RemoveFile deletes a file from the working tree.
+func (f *FakeVCS) RemoveFile(p string) {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	delete(f.workspace().files, cleanPath(p))
+}
+
+// workspace returns this handle's workspace. Callers must hold repo.mu.
+func (f *FakeVCS) workspace() *fakeWorkspace {
+	return f.repo.workspaces[f.ws]
+}
+
+// cleanPath normalizes a repo-relative path.
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// --- DAG helpers (callers hold repo.mu) ---
+
+// newCommit adds a commit to the DAG.
+func (r *fakeRepo) newCommit(parents []string, description, author string, tree map[string][]byte) *fakeCommit {
+	r.nextSeq++
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d\x00%s\x00%s\x00%s", r.nextSeq, strings.Join(parents, ","), description, r.root)))
+	c := &fakeCommit{
+		id:          hex.EncodeToString(sum[:]),
+		seq:         r.nextSeq,
+		parents:     parents,
+		description: description,
+		author:      author,
+		time:        time.Now(),
+		tree:        copyTree(tree),
+	}
+	r.commits[c.id] = c
+	return c
+}
+
+// resolve maps a revision expression to a commit ID. Supported forms:
+// "", "@", "HEAD", bookmark, "name@remote", "remote/name", full or
+// abbreviated (4+ chars) commit ID, each optionally followed by "~N" or "^".
+func (r *fakeRepo) resolve(ws *fakeWorkspace, ref string) (string, error) {
+	base, steps := splitAncestry(ref)
+
+	var id string
+	switch {
+	case base == "" || base == "@" || base == "HEAD":
+		id = ws.head
+	case r.bookmarks[base] != "":
+		id = r.bookmarks[base]
+	case r.tracking[base] != "":
+		id = r.tracking[base]
+	default:
+		if rem, name, ok := strings.Cut(base, "/"); ok && r.tracking[name+"@"+rem] != "" {
+			// remote/name form as used by git
+			id = r.tracking[name+"@"+rem]
+			break
+		}
+		if c, ok := r.commits[base]; ok {
+			id = c.id
+			break
+		}
+		if len(base) >= 4 {
+			var matches []string
+			for cid := range r.commits {
+				if strings.HasPrefix(cid, base) {
+					matches = append(matches, cid)
+				}
+			}
+			if len(matches) == 1 {
+				id = matches[0]
+				break
+			}
+		}
+		return "", fmt.Errorf("fake: unknown revision %q: %w", ref, ErrBranchNotFound)
+	}
+
+	for i := 0; i < steps; i++ {
+		c := r.commits[id]
+		if len(c.parents) == 0 {
+			return "", fmt.Errorf("fake: revision %q has no parent", ref)
+		}
+		id = c.parents[0]
+	}
+	return id, nil
+}
+
+// splitAncestry splits "ref~N" or "ref^" into the base ref and the number of
+// first-parent steps.
+func splitAncestry(ref string) (string, int) {
+	steps := 0
+	for {
+		switch {
+		case strings.HasSuffix(ref, "^") || strings.HasSuffix(ref, "-"):
+			ref = ref[:len(ref)-1]
+			steps++
+			continue
+		}
+		if i := strings.LastIndex(ref, "~"); i >= 0 {
+			n := 0
+			if _, err := fmt.Sscanf(ref[i+1:], "%d", &n); err == nil && fmt.Sprint(n) == ref[i+1:] {
+				ref = ref[:i]
+				steps += n
+				continue
+			}
+		}
+		return ref, steps
+	}
+}
+
+// ancestors returns the set of commits reachable from id, including id.
+func (r *fakeRepo) ancestors(id string) map[string]bool {
+	seen := make(map[string]bool)
+	stack := []string{id}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[cur] {
+			continue
+		}
+		seen[cur] = true
+		stack = append(stack, r.commits[cur].parents...)
+	}
+	return seen
+}
+
+// isAncestor reports whether a is an ancestor of (or equal to) d.
+func (r *fakeRepo) isAncestor(a, d string) bool {
+	return r.ancestors(d)[a]
+}
+
+// only returns commits reachable from to but not from from, newest first.
+func (r *fakeRepo) only(to, from string) []*fakeCommit {
+	exclude := map[string]bool{}
+	if from != "" {
+		exclude = r.ancestors(from)
+	}
+	var result []*fakeCommit
+	for id := range r.ancestors(to) {
+		if !exclude[id] {
+			result = append(result, r.commits[id])
+		}
+	}
+	sortNewestFirst(result)
+	return result
+}
+
+// mergeBase returns the best common ancestor of a and b.
+func (r *fakeRepo) mergeBase(a, b string) string {
+	ancA := r.ancestors(a)
+	var best *fakeCommit
+	for id := range r.ancestors(b) {
+		if !ancA[id] {
+			continue
+		}
+		if c := r.commits[id]; best == nil || c.seq > best.seq {
+			best = c
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.id
+}
+
+// children returns the commits whose first parent is id, oldest first.
+func (r *fakeRepo) children(id string) []*fakeCommit {
+	var result []*fakeCommit
+	for _, c := range r.commits {
+		for _, p := range c.parents {
+			if p == id {
+				result = append(result, c)
+				break
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].seq < result[j].seq })
+	return result
+}
+
+// sortNewestFirst orders commits by creation sequence, newest first.
+func sortNewestFirst(commits []*fakeCommit) {
+	sort.Slice(commits, func(i, j int) bool { return commits[i].seq > commits[j].seq })
+}
+
+// importCommits copies every commit reachable from id in src into r.
+func (r *fakeRepo) importCommits(src *fakeRepo, id string) {
+	for cid := range src.ancestors(id) {
+		if _, ok := r.commits[cid]; ok {
+			continue
+		}
+		c := *src.commits[cid]
+		c.tree = copyTree(c.tree)
+		r.commits[cid] = &c
+		if c.seq > r.nextSeq {
+			r.nextSeq = c.seq
+		}
+	}
+}
+
+// --- Tree helpers ---
+
+// copyTree returns a deep copy of a tree.
+func copyTree(tree map[string][]byte) map[string][]byte {
+	out := make(map[string][]byte, len(tree))
+	for p, data := range tree {
+		out[p] = append([]byte(nil), data...)
+	}
+	return out
+}
+
+// treesEqual reports whether two trees have identical contents.
+func treesEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, data := range a {
+		other, ok := b[p]
+		if !ok || !bytes.Equal(data, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// changedPaths returns the sorted paths whose content differs between trees.
+func changedPaths(a, b map[string][]byte) []string {
+	seen := make(map[string]bool)
+	for p := range a {
+		seen[p] = true
+	}
+	for p := range b {
+		seen[p] = true
+	}
+	var paths []string
+	for p := range seen {
+		da, okA := a[p]
+		db, okB := b[p]
+		if okA != okB || !bytes.Equal(da, db) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// mergeTrees performs a file-level three-way merge. Files changed on only one
+// side take that side; files changed identically on both sides merge cleanly;
+// anything else is a conflict, written with conflict markers.
+func mergeTrees(base, ours, theirs map[string][]byte) (map[string][]byte, map[string]*fakeConflict) {
+	merged := copyTree(ours)
+	conflicts := make(map[string]*fakeConflict)
+	for _, p := range changedPaths(base, theirs) {
+		b, inBase := base[p]
+		o, inOurs := ours[p]
+		t, inTheirs := theirs[p]
+		oursChanged := inBase != inOurs || !bytes.Equal(b, o)
+
+		switch {
+		case !oursChanged:
+			if inTheirs {
+				merged[p] = append([]byte(nil), t...)
+			} else {
+				delete(merged, p)
+			}
+		case inOurs == inTheirs && bytes.Equal(o, t):
+			// Same change on both sides.
+		default:
+			conflicts[p] = &fakeConflict{base: b, ours: o, theirs: t}
+			merged[p] = conflictMarkers(o, t)
+		}
+	}
+	return merged, conflicts
+}
+
+// conflictMarkers renders a git-style conflicted file.
+func conflictMarkers(ours, theirs []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<<<<<<< ours\n")
+	buf.Write(withTrailingNewline(ours))
+	buf.WriteString("=======\n")
+	buf.Write(withTrailingNewline(theirs))
+	buf.WriteString(">>>>>>> theirs\n")
+	return buf.Bytes()
+}
+
+func withTrailingNewline(data []byte) []byte {
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		return append(append([]byte(nil), data...), '\n')
+	}
+	return data
+}
+
+// unifiedDiff renders a whole-file diff in git format for the given paths.
+func unifiedDiff(from, to map[string][]byte, paths []string) string {
+	var buf strings.Builder
+	for _, p := range paths {
+		old, inOld := from[p]
+		cur, inNew := to[p]
+		fmt.Fprintf(&buf, "diff --git a/%s b/%s\n", p, p)
+		switch {
+		case !inOld:
+			buf.WriteString("new file mode 100644\n")
+		case !inNew:
+			buf.WriteString("deleted file mode 100644\n")
+		}
+		oldName, newName := "a/"+p, "b/"+p
+		if !inOld {
+			oldName = "/dev/null"
+		}
+		if !inNew {
+			newName = "/dev/null"
+		}
+		fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+		oldLines, newLines := splitLines(old), splitLines(cur)
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(len(oldLines)), hunkRange(len(newLines)))
+		for _, l := range oldLines {
+			buf.WriteString("-" + l + "\n")
+		}
+		for _, l := range newLines {
+			buf.WriteString("+" + l + "\n")
+		}
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// matchLines returns, for each line of b, the index of the line of a it is
+// kept from in a longest common subsequence of a and b, or -1 for lines
+// that b adds.
+func matchLines(a, b []string) []int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	match := make([]int, len(b))
+	i, j := 0, 0
+	for j < len(b) {
+		switch {
+		case i < len(a) && a[i] == b[j]:
+			match[j] = i
+			i++
+			j++
+		case i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			match[j] = -1
+			j++
+		}
+	}
+	return match
+}
+
+func hunkRange(n int) string {
+	if n == 0 {
+		return "0,0"
+	}
+	return fmt.Sprintf("1,%d", n)
+}
+
+// isIgnored matches p against the working tree's .gitignore. Supports plain
+// names, globs, "dir/" patterns and leading "/" anchors.
+func isIgnored(files map[string][]byte, p string) bool {
+	data, ok := files[".gitignore"]
+	if !ok {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		pattern := strings.TrimSpace(line)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if dir, isDir := strings.CutSuffix(pattern, "/"); isDir {
+			dir = strings.TrimPrefix(dir, "/")
+			if p == dir || strings.HasPrefix(p, dir+"/") || strings.Contains(p, "/"+dir+"/") {
+				return true
+			}
+			continue
+		}
+		if anchored, ok := strings.CutPrefix(pattern, "/"); ok {
+			if m, _ := path.Match(anchored, p); m {
+				return true
+			}
+			continue
+		}
+		if m, _ := path.Match(pattern, path.Base(p)); m {
+			return true
+		}
+		if m, _ := path.Match(pattern, p); m {
+			return true
+		}
+	}
+	return false
+}
+
+// Compile-time check that FakeVCS implements VCS.
+var _ VCS = (*FakeVCS)(nil)
+
+// lock acquires the repo lock and returns the repo and this handle's
+// workspace. The workspace is nil if it has been removed.
+func (f *FakeVCS) lock() (*fakeRepo, *fakeWorkspace) {
+	f.repo.mu.Lock()
+	return f.repo, f.repo.workspaces[f.ws]
+}
+
+func (f *FakeVCS) unlock() {
+	f.repo.mu.Unlock()
+}
+
+// info converts a commit to a ChangeInfo. Callers hold repo.mu.
+func (r *fakeRepo) info(ws *fakeWorkspace, c *fakeCommit) ChangeInfo {
+	full := strings.TrimSpace(c.description)
+	subject, _, _ := strings.Cut(full, "\n")
+	var bookmarks []string
+	for name, id := range r.bookmarks {
+		if id == c.id {
+			bookmarks = append(bookmarks, name)
+		}
+	}
+	sort.Strings(bookmarks)
+	empty := len(c.parents) == 0 && len(c.tree) == 0 ||
+		len(c.parents) > 0 && treesEqual(c.tree, r.commits[c.parents[0]].tree)
+	return ChangeInfo{
+		ID:              c.id,
+		ShortID:         c.id[:shortIDLen],
+		Description:     subject,
+		Author:          c.author,
+		Timestamp:       c.time.Format("2006-01-02 15:04:05 -0700"),
+		IsWorking:       ws != nil && ws.head == c.id,
+		CommitID:        c.id,
+		Parents:         append([]string(nil), c.parents...),
+		Bookmarks:       bookmarks,
+		FullDescription: full,
+		AuthorEmail:     c.email,
+		CommitterEmail:  c.email,
+		Time:            c.time,
+		IsEmpty:         empty,
+	}
+}
+
+// tree resolves ref to a tree. An empty ref means the working tree.
+func (r *fakeRepo) tree(ws *fakeWorkspace, ref string) (map[string][]byte, error) {
+	if ref == "" {
+		return ws.files, nil
+	}
+	id, err := r.resolve(ws, ref)
+	if err != nil {
+		return nil, err
+	}
+	return r.commits[id].tree, nil
+}
+
+// checkout moves ws to id, replacing the working tree and index. Uncommitted
+// changes are discarded, as with git checkout --force.
+func (r *fakeRepo) checkout(ws *fakeWorkspace, id, branch string) {
+	ws.head = id
+	ws.branch = branch
+	ws.files = copyTree(r.commits[id].tree)
+	ws.index = copyTree(r.commits[id].tree)
+	ws.conflicts = map[string]*fakeConflict{}
+	ws.mergeHead = ""
+}
+
+// dirty reports whether ws has uncommitted tracked changes.
+func (r *fakeRepo) dirty(ws *fakeWorkspace) bool {
+	head := r.commits[ws.head].tree
+	if !treesEqual(ws.index, head) {
+		return true
+	}
+	for p, data := range ws.index {
+		if cur, ok := ws.files[p]; !ok || string(cur) != string(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// advance moves ws to a new commit and drags its bookmark along.
+func (r *fakeRepo) advance(ws *fakeWorkspace, id string) {
+	ws.head = id
+	if ws.branch != "" {
+		r.bookmarks[ws.branch] = id
+	}
+}
+
+// matchPaths expands pathspecs against the union of the given trees. "." and
+// "" match everything; a directory matches every file under it.
+func matchPaths(specs []string, trees ...map[string][]byte) []string {
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		spec = cleanPath(spec)
+		for _, t := range trees {
+			for p := range t {
+				if spec == "" || spec == "." || p == spec || strings.HasPrefix(p, spec+"/") {
+					seen[p] = true
+				}
+			}
+		}
+	}
+	paths := make([]string, 0, len(seen))
+	for p := range seen {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// stage copies the working tree state of paths into the index.
+func (r *fakeRepo) stage(ws *fakeWorkspace, paths []string) error {
+	for _, spec := range paths {
+		matched := matchPaths([]string{spec}, ws.files, ws.index)
+		if len(matched) == 0 {
+			return fmt.Errorf("fake: pathspec %q did not match any files", spec)
+		}
+		for _, p := range matched {
+			if data, ok := ws.files[p]; ok {
+				if _, tracked := ws.index[p]; !tracked && isIgnored(ws.files, p) && cleanPath(spec) != p {
+					continue
+				}
+				ws.index[p] = append([]byte(nil), data...)
+			} else {
+				delete(ws.index, p)
+			}
+		}
+	}
+	return nil
+}
+
+// commit records the index as a new commit on ws.
+func (r *fakeRepo) commit(ws *fakeWorkspace, message string, opts *CommitOptions) error {
+	if opts == nil {
+		opts = &CommitOptions{}
+	}
+	if len(ws.conflicts) > 0 {
+		return fmt.Errorf("fake: cannot commit with unresolved conflicts: %w", ErrMergeConflict)
+	}
+	if len(opts.Paths) > 0 {
+		if err := r.stage(ws, opts.Paths); err != nil {
+			return err
+		}
+	}
+
+	head := r.commits[ws.head]
+	parents := []string{ws.head}
+	if opts.Amend {
+		if len(head.parents) == 0 {
+			return fmt.Errorf("fake: nothing to amend")
+		}
+		parents = head.parents
+		if message == "" {
+			message = head.description
+		}
+	} else if ws.mergeHead != "" {
+		parents = append(parents, ws.mergeHead)
+	}
+
+	if !opts.Amend && !opts.AllowEmpty && ws.mergeHead == "" && treesEqual(ws.index, head.tree) {
+		return ErrNothingToCommit
+	}
+
+	author := opts.Author
+	if author == "" {
+		author = r.config["user.name"]
+	}
+	c := r.newCommit(parents, message, author, ws.index)
+	c.email = r.config["user.email"]
+	if opts.Amend {
+		c.predecessor = head.id
+	}
+	r.advance(ws, c.id)
+	ws.mergeHead = ""
+	return nil
+}
+
+// --- Identity ---
+
+// Type returns VCSTypeFake unless overridden with SetType.
+func (f *FakeVCS) Type() VCSType {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	return f.repo.vcsType
+}
+
+// RepoRoot returns the path of this handle's workspace.
+func (f *FakeVCS) RepoRoot() string {
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return f.repo.root
+	}
+	return ws.path
+}
+
+// IsColocated always returns false.
+func (f *FakeVCS) IsColocated() bool {
+	return false
+}
+
+// Command returns a command whose Run, Output and Start fail with
+// ErrNotSupported without starting a process; there is no CLI behind an
+// in-memory repository.
+func (f *FakeVCS) Command(ctx context.Context, args ...string) *exec.Cmd {
+	err := f.record("Command", args...)
+	if err == nil {
+		err = fmt.Errorf("%w: the fake VCS has no command line", ErrNotSupported)
+	}
+	return &exec.Cmd{
+		Path: "fake",
+		Args: append([]string{"fake"}, args...),
+		Dir:  f.RepoRoot(),
+		Err:  err,
+	}
+}
+
+// --- Repository State ---
+
+// CurrentBranch returns the checked-out bookmark, or the short commit ID if
+// HEAD is detached.
+func (f *FakeVCS) CurrentBranch(ctx context.Context) (string, error) {
+	if err := f.record("CurrentBranch"); err != nil {
+		return "", err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return "", ErrWorkspaceNotFound
+	}
+	if ws.branch != "" {
+		return ws.branch, nil
+	}
+	return ws.head[:shortIDLen], nil
+}
+
+// CurrentChange returns the HEAD commit.
+func (f *FakeVCS) CurrentChange(ctx context.Context) (*ChangeInfo, error) {
+	if err := f.record("CurrentChange"); err != nil {
+		return nil, err
+	}
+	return f.currentChange(ctx)
+}
+
+// currentChange is CurrentChange without recording the call.
+func (f *FakeVCS) currentChange(ctx context.Context) (*ChangeInfo, error) {
+	return f.show(ctx, "@")
+}
+
+// Status compares the index with HEAD (staged entries) and the working tree
+// with the index (unstaged entries), as git status does.
+func (f *FakeVCS) Status(ctx context.Context) ([]StatusEntry, error) {
+	if err := f.record("Status"); err != nil {
+		return nil, err
+	}
+	return f.status(ctx)
+}
+
+// status is Status without recording the call.
+func (f *FakeVCS) status(ctx context.Context) ([]StatusEntry, error) {
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	return r.status(ws, &StatusOptions{Untracked: true}), nil
+}
+
+// StatusWithOptions reports untracked and ignored files as opts asks.
+func (f *FakeVCS) StatusWithOptions(ctx context.Context, opts *StatusOptions) ([]StatusEntry, error) {
+	if opts == nil {
+		opts = &StatusOptions{}
+	}
+	if err := f.record("StatusWithOptions", fmt.Sprint(opts.Untracked), fmt.Sprint(opts.Ignored)); err != nil {
+		return nil, err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	return r.status(ws, opts), nil
+}
+
+func (r *fakeRepo) status(ws *fakeWorkspace, opts *StatusOptions) []StatusEntry {
+	head := r.commits[ws.head].tree
+	var entries []StatusEntry
+	done := make(map[string]bool)
+
+	for p := range ws.conflicts {
+		entries = append(entries, StatusEntry{Path: p, Status: FileStatusConflicted, Conflicted: true})
+		done[p] = true
+	}
+	for _, p := range changedPaths(head, ws.index) {
+		if done[p] {
+			continue
+		}
+		_, inHead := head[p]
+		_, inIndex := ws.index[p]
+		status := FileStatusModified
+		switch {
+		case !inHead:
+			status = FileStatusAdded
+		case !inIndex:
+			status = FileStatusDeleted
+		}
+		entries = append(entries, StatusEntry{Path: p, Status: status, Staged: true})
+		done[p] = true
+	}
+	for _, p := range changedPaths(ws.index, ws.files) {
+		if done[p] {
+			continue
+		}
+		_, inIndex := ws.index[p]
+		_, inFiles := ws.files[p]
+		switch {
+		case !inIndex:
+			switch {
+			case isIgnored(ws.files, p):
+				if opts.Ignored {
+					entries = append(entries, StatusEntry{Path: p, Status: FileStatusIgnored})
+				}
+			case opts.Untracked:
+				entries = append(entries, StatusEntry{Path: p, Status: FileStatusUntracked})
+			}
+		case !inFiles:
+			entries = append(entries, StatusEntry{Path: p, Status: FileStatusDeleted})
+		default:
+			entries = append(entries, StatusEntry{Path: p, Status: FileStatusModified})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// StatusPath returns the status of one path, FileStatusUnmodified if clean.
+func (f *FakeVCS) StatusPath(ctx context.Context, p string) (*StatusEntry, error) {
+	if err := f.record("StatusPath", p); err != nil {
+		return nil, err
+	}
+	entries, err := f.status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p = cleanPath(p)
+	for _, e := range entries {
+		if e.Path == p {
+			return &e, nil
+		}
+	}
+	return &StatusEntry{Path: p, Status: FileStatusUnmodified}, nil
+}
+
+// HasRemote returns true if a remote is configured.
+func (f *FakeVCS) HasRemote(ctx context.Context) (bool, error) {
+	if err := f.record("HasRemote"); err != nil {
+		return false, err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+	return len(r.remotes) > 0, nil
+}
+
+// GetRemote returns "origin" if configured, else the first remote by name.
+func (f *FakeVCS) GetRemote(ctx context.Context) (string, error) {
+	if err := f.record("GetRemote"); err != nil {
+		return "", err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+	return r.defaultRemote()
+}
+
+func (r *fakeRepo) defaultRemote() (string, error) {
+	if _, ok := r.remotes["origin"]; ok {
+		return "origin", nil
+	}
+	names := make([]string, 0, len(r.remotes))
+	for name := range r.remotes {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", ErrNoRemote
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// --- Staging & Committing ---
+
+// Stage copies the working tree state of paths into the index. Deleted files
+// are removed from the index.
+func (f *FakeVCS) Stage(ctx context.Context, paths ...string) error {
+	if err := f.record("Stage", paths...); err != nil {
+		return err
+	}
+	return f.stage(ctx, paths...)
+}
+
+// stage is Stage without recording the call.
+func (f *FakeVCS) stage(ctx context.Context, paths ...string) error {
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	return r.stage(ws, paths)
+}
+
+// Commit records the index as a new commit and advances the current bookmark.
+func (f *FakeVCS) Commit(ctx context.Context, message string, opts *CommitOptions) error {
+	if err := f.record("Commit", message); err != nil {
+		return err
+	}
+	return f.commit(ctx, message, opts)
+}
+
+// commit is Commit without recording the call.
+func (f *FakeVCS) commit(ctx context.Context, message string, opts *CommitOptions) error {
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	return r.commit(ws, message, opts)
+}
+
+// --- Sync Operations ---
+
+// remoteRepo returns the named remote, defaulting to GetRemote's choice.
+func (r *fakeRepo) remoteRepo(name string) (string, *fakeRemote, error) {
+	if name == "" {
+		var err error
+		if name, err = r.defaultRemote(); err != nil {
+			return "", nil, err
+		}
+	}
+	rem, ok := r.remotes[name]
+	if !ok {
+		return "", nil, fmt.Errorf("fake: remote %q: %w", name, ErrNoRemote)
+	}
+	return name, rem, nil
+}
+
+// Fetch copies the remote's bookmarks (or just branch) into tracking refs.
+func (f *FakeVCS) Fetch(ctx context.Context, remoteName, branch string) error {
+	if err := f.record("Fetch", remoteName, branch); err != nil {
+		return err
+	}
+	return f.fetch(ctx, remoteName, branch)
+}
+
+// fetch is Fetch without recording the call.
+func (f *FakeVCS) fetch(ctx context.Context, remoteName, branch string) error {
+	f.repo.mu.Lock()
+	name, rem, err := f.repo.remoteRepo(remoteName)
+	f.repo.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if rem.repo == f.repo {
+		return fmt.Errorf("fake: remote %q is this repository", name)
+	}
+
+	// Lock the two repos one at a time so two repos fetching from each
+	// other cannot deadlock.
+	rem.repo.mu.Lock()
+	snapshot := &fakeRepo{commits: make(map[string]*fakeCommit)}
+	heads := make(map[string]string)
+	for b, id := range rem.repo.bookmarks {
+		if branch == "" || b == branch {
+			heads[b] = id
+			snapshot.importCommits(rem.repo, id)
+		}
+	}
+	rem.repo.mu.Unlock()
+
+	if branch != "" && heads[branch] == "" {
+		return fmt.Errorf("fake: remote %s has no branch %q: %w", name, branch, ErrBranchNotFound)
+	}
+
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	for b, id := range heads {
+		f.repo.importCommits(snapshot, id)
+		f.repo.tracking[b+"@"+name] = id
+	}
+	return nil
+}
+
+// Pull fetches branch (default: the current bookmark) and merges it.
+func (f *FakeVCS) Pull(ctx context.Context, remoteName, branch string) error {
+	if err := f.record("Pull", remoteName, branch); err != nil {
+		return err
+	}
+	f.repo.mu.Lock()
+	name, _, err := f.repo.remoteRepo(remoteName)
+	ws := f.workspace()
+	if err == nil && branch == "" && ws != nil {
+		branch = ws.branch
+	}
+	f.repo.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if branch == "" {
+		return fmt.Errorf("fake: pull with detached HEAD needs a branch")
+	}
+	if err := f.fetch(ctx, name, branch); err != nil {
+		return err
+	}
+	return f.merge(ctx, branch+"@"+name, "")
+}
+
+// Push updates branch (default: the current bookmark) on the remote. It is
+// rejected unless the remote branch is an ancestor of the local one.
+func (f *FakeVCS) Push(ctx context.Context, remoteName, branch string) error {
+	if err := f.record("Push", remoteName, branch); err != nil {
+		return err
+	}
+	return f.push(remoteName, branch, false, false)
+}
+
+func (f *FakeVCS) push(remoteName, branch string, force, setUpstream bool) error {
+	f.repo.mu.Lock()
+	name, rem, err := f.repo.remoteRepo(remoteName)
+	if err != nil {
+		f.repo.mu.Unlock()
+		return err
+	}
+	if branch == "" {
+		if ws := f.workspace(); ws != nil {
+			branch = ws.branch
+		}
+	}
+	id := f.repo.bookmarks[branch]
+	if id == "" {
+		f.repo.mu.Unlock()
+		return fmt.Errorf("fake: no branch %q to push: %w", branch, ErrBranchNotFound)
+	}
+	snapshot := &fakeRepo{commits: make(map[string]*fakeCommit)}
+	snapshot.importCommits(f.repo, id)
+	f.repo.mu.Unlock()
+
+	rem.repo.mu.Lock()
+	if old := rem.repo.bookmarks[branch]; old != "" && !force {
+		rem.repo.importCommits(snapshot, id)
+		if !rem.repo.isAncestor(old, id) {
+			rem.repo.mu.Unlock()
+			return fmt.Errorf("fake: push %s to %s rejected (non-fast-forward)", branch, name)
+		}
+	}
+	rem.repo.importCommits(snapshot, id)
+	rem.repo.bookmarks[branch] = id
+	rem.repo.mu.Unlock()
+
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	f.repo.tracking[branch+"@"+name] = id
+	if setUpstream {
+		f.repo.upstreams[branch] = name + "/" + branch
+	}
+	return nil
+}
+
+// --- Branch/Bookmark Operations ---
+
+// ListBranches lists bookmarks followed by remote tracking refs.
+func (f *FakeVCS) ListBranches(ctx context.Context) ([]BranchInfo, error) {
+	if err := f.record("ListBranches"); err != nil {
+		return nil, err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+
+	var branches []BranchInfo
+	for name := range r.bookmarks {
+		branches = append(branches, BranchInfo{
+			Name:      name,
+			IsCurrent: ws != nil && ws.branch == name,
+			Upstream:  r.upstreams[name],
+		})
+	}
+	for ref := range r.tracking {
+		name, remoteName, _ := strings.Cut(ref, "@")
+		branches = append(branches, BranchInfo{Name: name, RemoteName: remoteName})
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		if branches[i].RemoteName != branches[j].RemoteName {
+			return branches[i].RemoteName < branches[j].RemoteName
+		}
+		return branches[i].Name < branches[j].Name
+	})
+	return branches, nil
+}
+
+// CreateBranch creates a bookmark at HEAD without switching to it.
+func (f *FakeVCS) CreateBranch(ctx context.Context, name string) error {
+	if err := f.record("CreateBranch", name); err != nil {
+		return err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	if _, ok := r.bookmarks[name]; ok {
+		return fmt.Errorf("fake: branch %q already exists", name)
+	}
+	r.bookmarks[name] = ws.head
+	return nil
+}
+
+// SwitchBranch checks out a bookmark.
+func (f *FakeVCS) SwitchBranch(ctx context.Context, name string) error {
+	if err := f.record("SwitchBranch", name); err != nil {
+		return err
+	}
+	return f.checkout(ctx, name)
+}
+
+// --- Workspace Operations ---
+
+// ListWorkspaces lists the default workspace followed by the rest by name.
+func (f *FakeVCS) ListWorkspaces(ctx context.Context) ([]WorkspaceInfo, error) {
+	if err := f.record("ListWorkspaces"); err != nil {
+		return nil, err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+
+	var list []WorkspaceInfo
+	for _, ws := range r.workspaces {
+		list = append(list, WorkspaceInfo{Name: ws.name, Path: ws.path, ChangeID: ws.head})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if (list[i].Name == defaultWorkspace) != (list[j].Name == defaultWorkspace) {
+			return list[i].Name == defaultWorkspace
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// CreateWorkspace adds a workspace at HEAD on a new bookmark named name, like
+// git worktree add -b.
+func (f *FakeVCS) CreateWorkspace(ctx context.Context, name, p string) error {
+	if err := f.record("CreateWorkspace", name, p); err != nil {
+		return err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	if _, ok := r.workspaces[name]; ok {
+		return ErrWorkspaceExists
+	}
+	if _, ok := r.bookmarks[name]; ok {
+		return fmt.Errorf("fake: branch %q already exists", name)
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(r.root, p)
+	}
+	r.bookmarks[name] = ws.head
+	nws := &fakeWorkspace{name: name, path: p}
+	r.checkout(nws, ws.head, name)
+	r.workspaces[name] = nws
+	return nil
+}
+
+// RemoveWorkspace removes a workspace. The default workspace cannot be
+// removed.
+func (f *FakeVCS) RemoveWorkspace(ctx context.Context, name string) error {
+	if err := f.record("RemoveWorkspace", name); err != nil {
+		return err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+	if _, ok := r.workspaces[name]; !ok {
+		return ErrWorkspaceNotFound
+	}
+	if name == defaultWorkspace {
+		return fmt.Errorf("fake: cannot remove the default workspace")
+	}
+	delete(r.workspaces, name)
+	return nil
+}
+
+// UpdateStaleWorkspace is a no-op; in-memory workspaces are never stale.
+func (f *FakeVCS) UpdateStaleWorkspace(ctx context.Context, name string) error {
+	if err := f.record("UpdateStaleWorkspace", name); err != nil {
+		return err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+	if name != "" {
+		if _, ok := r.workspaces[name]; !ok {
+			return ErrWorkspaceNotFound
+		}
+	}
+	return nil
+}
+
+// IsWorktreeRepo returns true for any workspace other than the default.
+func (f *FakeVCS) IsWorktreeRepo(ctx context.Context) (bool, error) {
+	if err := f.record("IsWorktreeRepo"); err != nil {
+		return false, err
+	}
+	return f.ws != defaultWorkspace, nil
+}
+
+// --- Merge & Conflict Operations ---
+
+// HasMergeConflicts returns true if a merge left unresolved files.
+func (f *FakeVCS) HasMergeConflicts(ctx context.Context) (bool, error) {
+	if err := f.record("HasMergeConflicts"); err != nil {
+		return false, err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return false, ErrWorkspaceNotFound
+	}
+	return len(ws.conflicts) > 0, nil
+}
+
+// GetConflicts returns the unresolved files with the three sides inline.
+func (f *FakeVCS) GetConflicts(ctx context.Context) ([]MergeConflict, error) {
+	if err := f.record("GetConflicts"); err != nil {
+		return nil, err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	var list []MergeConflict
+	for p, c := range ws.conflicts {
+		list = append(list, MergeConflict{
+			Path:       p,
+			BaseBlob:   string(c.base),
+			OursBlob:   string(c.ours),
+			TheirsBlob: string(c.theirs),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list, nil
+}
+
+// GetFileVersion returns stage 1 (base), 2 (ours) or 3 (theirs) of a
+// conflicted file, or the file at a revision otherwise.
+func (f *FakeVCS) GetFileVersion(ctx context.Context, p, version string) ([]byte, error) {
+	if err := f.record("GetFileVersion", p, version); err != nil {
+		return nil, err
+	}
+	_, ws := f.lock()
+	var data []byte
+	found := false
+	if ws == nil {
+		f.unlock()
+		return nil, ErrWorkspaceNotFound
+	}
+	if c, ok := ws.conflicts[cleanPath(p)]; ok {
+		switch version {
+		case "1", "base":
+			data, found = c.base, true
+		case "2", "ours":
+			data, found = c.ours, true
+		case "3", "theirs":
+			data, found = c.theirs, true
+		}
+	}
+	f.unlock()
+	if found {
+		return append([]byte(nil), data...), nil
+	}
+	return f.showFile(ctx, version, p)
+}
+
+// MarkResolved stages the working copy of a conflicted file.
+func (f *FakeVCS) MarkResolved(ctx context.Context, p string) error {
+	if err := f.record("MarkResolved", p); err != nil {
+		return err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	p = cleanPath(p)
+	delete(ws.conflicts, p)
+	return r.stage(ws, []string{p})
+}
+
+// Merge merges branch into HEAD. It fast-forwards when possible, otherwise
+// performs a three-way merge and commits the result. On conflict, the
+// conflicted files get markers, the merge stays in progress and an error
+// wrapping ErrMergeConflict is returned.
+func (f *FakeVCS) Merge(ctx context.Context, branch, message string) error {
+	if err := f.record("Merge", branch, message); err != nil {
+		return err
+	}
+	return f.merge(ctx, branch, message)
+}
+
+// merge is Merge without recording the call.
+func (f *FakeVCS) merge(ctx context.Context, branch, message string) error {
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	if ws.mergeHead != "" {
+		return fmt.Errorf("fake: a merge is already in progress")
+	}
+	theirs, err := r.resolve(ws, branch)
+	if err != nil {
+		return err
+	}
+	if r.isAncestor(theirs, ws.head) {
+		return nil
+	}
+	if r.dirty(ws) {
+		return fmt.Errorf("fake: uncommitted changes would be overwritten by merge")
+	}
+	if r.isAncestor(ws.head, theirs) {
+		r.checkout(ws, theirs, ws.branch)
+		r.advance(ws, theirs)
+		return nil
+	}
+
+	base := r.mergeBase(ws.head, theirs)
+	var baseTree map[string][]byte
+	if base != "" {
+		baseTree = r.commits[base].tree
+	}
+	merged, conflicts := mergeTrees(baseTree, r.commits[ws.head].tree, r.commits[theirs].tree)
+	ws.files = copyTree(merged)
+	ws.index = copyTree(merged)
+	ws.mergeHead = theirs
+	if len(conflicts) > 0 {
+		ws.conflicts = conflicts
+		paths := make([]string, 0, len(conflicts))
+		for p := range conflicts {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		return fmt.Errorf("fake: merge %s: conflicts in %s: %w", branch, strings.Join(paths, ", "), ErrMergeConflict)
+	}
+	if message == "" {
+		message = fmt.Sprintf("Merge %s", branch)
+	}
+	return r.commit(ws, message, &CommitOptions{AllowEmpty: true})
+}
+
+// IsMerging returns true while a conflicted merge is in progress.
+func (f *FakeVCS) IsMerging(ctx context.Context) (bool, error) {
+	if err := f.record("IsMerging"); err != nil {
+		return false, err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return false, ErrWorkspaceNotFound
+	}
+	return ws.mergeHead != "", nil
+}
+
+// --- History Operations ---
+
+// Log returns commits reachable from HEAD, newest first. The synthetic root
+// fakeCommit is omitted.
+func (f *FakeVCS) Log(ctx context.Context, limit int) ([]ChangeInfo, error) {
+	if err := f.record("Log"); err != nil {
+		return nil, err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	return r.infos(ws, r.only(ws.head, ""), limit), nil
+}
+
+// infos converts commits to ChangeInfos, skipping root commits.
+func (r *fakeRepo) infos(ws *fakeWorkspace, commits []*fakeCommit, limit int) []ChangeInfo {
+	var list []ChangeInfo
+	for _, c := range commits {
+		if len(c.parents) == 0 {
+			continue
+		}
+		if limit > 0 && len(list) >= limit {
+			break
+		}
+		list = append(list, r.info(ws, c))
+	}
+	return list
+}
+
+// Show returns one commit.
+func (f *FakeVCS) Show(ctx context.Context, id string) (*ChangeInfo, error) {
+	if err := f.record("Show", id); err != nil {
+		return nil, err
+	}
+	return f.show(ctx, id)
+}
+
+// show is Show without recording the call.
+func (f *FakeVCS) show(ctx context.Context, id string) (*ChangeInfo, error) {
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	cid, err := r.resolve(ws, id)
+	if err != nil {
+		return nil, err
+	}
+	info := r.info(ws, r.commits[cid])
+	return &info, nil
+}
+
+// Diff returns a git-format diff between two revisions. An empty to compares
+// with the working tree.
+func (f *FakeVCS) Diff(ctx context.Context, from, to string) (string, error) {
+	if err := f.record("Diff", from, to); err != nil {
+		return "", err
+	}
+	return f.diff(from, to, nil)
+}
+
+// DiffStructured parses the output of Diff limited to paths.
+func (f *FakeVCS) DiffStructured(ctx context.Context, from, to string, paths []string) (*DiffResult, error) {
+	if err := f.record("DiffStructured", append([]string{from, to}, paths...)...); err != nil {
+		return nil, err
+	}
+	out, err := f.diff(from, to, paths)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGitDiff(out)
+}
+
+func (f *FakeVCS) diff(from, to string, only []string) (string, error) {
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return "", ErrWorkspaceNotFound
+	}
+	if from == "" {
+		from = "@"
+	}
+	a, err := r.tree(ws, from)
+	if err != nil {
+		return "", err
+	}
+	b, err := r.tree(ws, to)
+	if err != nil {
+		return "", err
+	}
+	paths := changedPaths(a, b)
+	if to == "" {
+		// Untracked files don't show up in git diff.
+		var tracked []string
+		for _, cp := range paths {
+			if _, ok := ws.index[cp]; ok || a[cp] != nil {
+				tracked = append(tracked, cp)
+			}
+		}
+		paths = tracked
+	}
+	if len(only) > 0 {
+		paths = matchPaths(only, pick(a, paths), pick(b, paths))
+		if len(paths) == 0 {
+			return "", nil
+		}
+	}
+	return unifiedDiff(a, b, paths), nil
+}
+
+// pick returns a tree containing just paths (values may be nil).
+func pick(tree map[string][]byte, paths []string) map[string][]byte {
+	out := make(map[string][]byte, len(paths))
+	for _, p := range paths {
+		out[p] = tree[p]
+	}
+	return out
+}
+
+// DiffPath returns the diff of path between the merge base of from and to
+// and to, like git diff from...to -- path.
+func (f *FakeVCS) DiffPath(ctx context.Context, from, to, p string) (string, error) {
+	if err := f.record("DiffPath", from, to, p); err != nil {
+		return "", err
+	}
+	r, ws := f.lock()
+	if ws == nil {
+		f.unlock()
+		return "", ErrWorkspaceNotFound
+	}
+	a, err := r.resolve(ws, from)
+	if err == nil {
+		var b string
+		if b, err = r.resolve(ws, to); err == nil {
+			from = r.mergeBase(a, b)
+		}
+	}
+	f.unlock()
+	if err != nil {
+		return "", err
+	}
+	if to == "" {
+		to = "@"
+	}
+	var only []string
+	if p != "" {
+		only = []string{p}
+	}
+	return f.diff(from, to, only)
+}
+
+// DiffHasChanges returns true if the working copy of path differs from ref.
+func (f *FakeVCS) DiffHasChanges(ctx context.Context, ref, p string) (bool, error) {
+	if err := f.record("DiffHasChanges", ref, p); err != nil {
+		return false, err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return false, ErrWorkspaceNotFound
+	}
+	tree, err := r.tree(ws, ref)
+	if err != nil {
+		return false, err
+	}
+	paths := changedPaths(tree, ws.files)
+	return len(matchPaths([]string{p}, pick(tree, paths), pick(ws.files, paths))) > 0, nil
+}
+
+// HasStagedChanges returns true if the index differs from HEAD.
+func (f *FakeVCS) HasStagedChanges(ctx context.Context) (bool, error) {
+	if err := f.record("HasStagedChanges"); err != nil {
+		return false, err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return false, ErrWorkspaceNotFound
+	}
+	return !treesEqual(ws.index, r.commits[ws.head].tree), nil
+}
+
+// StageAndCommit stages paths and commits. It is a no-op if nothing ends up
+// staged.
+func (f *FakeVCS) StageAndCommit(ctx context.Context, paths []string, message string, opts *CommitOptions) error {
+	if err := f.record("StageAndCommit", append([]string{message}, paths...)...); err != nil {
+		return err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	if len(paths) > 0 {
+		if err := r.stage(ws, paths); err != nil {
+			return fmt.Errorf("staging: %w", err)
+		}
+	}
+	if treesEqual(ws.index, r.commits[ws.head].tree) && (opts == nil || !opts.AllowEmpty) {
+		return nil
+	}
+	return r.commit(ws, message, opts)
+}
+
+// --- Stacked Changes ---
+
+// StackInfo returns commits on HEAD not yet on any remote tracking ref.
+func (f *FakeVCS) StackInfo(ctx context.Context) ([]ChangeInfo, error) {
+	if err := f.record("StackInfo"); err != nil {
+		return nil, err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	pushed := make(map[string]bool)
+	for _, id := range r.tracking {
+		for a := range r.ancestors(id) {
+			pushed[a] = true
+		}
+	}
+	var stack []*fakeCommit
+	for _, c := range r.only(ws.head, "") {
+		if !pushed[c.id] {
+			stack = append(stack, c)
+		}
+	}
+	return r.infos(ws, stack, 0), nil
+}
+
+// Query evaluates revset with QueryChanges over the commits reachable
+// from any bookmark, remote tracking ref or workspace.
+func (f *FakeVCS) Query(ctx context.Context, revset string) ([]ChangeInfo, error) {
+	if err := f.record("Query", revset); err != nil {
+		return nil, err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	visible := make(map[string]bool)
+	var heads []string
+	for _, id := range r.bookmarks {
+		heads = append(heads, id)
+	}
+	for _, id := range r.tracking {
+		heads = append(heads, id)
+	}
+	for _, w := range r.workspaces {
+		heads = append(heads, w.head)
+	}
+	var commits []*fakeCommit
+	for _, h := range heads {
+		for id := range r.ancestors(h) {
+			if !visible[id] {
+				visible[id] = true
+				commits = append(commits, r.commits[id])
+			}
+		}
+	}
+	sortNewestFirst(commits)
+	return QueryChanges(revset, r.infos(ws, commits, 0), ws.head)
+}
+
+// Evolog follows the chain of commits each amend replaced.
+func (f *FakeVCS) Evolog(ctx context.Context, changeID string) ([]ChangeInfo, error) {
+	if err := f.record("Evolog", changeID); err != nil {
+		return nil, err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	id, err := r.resolve(ws, changeID)
+	if err != nil {
+		return nil, err
+	}
+	var versions []*fakeCommit
+	for c := r.commits[id]; c != nil; c = r.commits[c.predecessor] {
+		versions = append(versions, c)
+	}
+	return r.infos(ws, versions, 0), nil
+}
+
+// Annotate attributes each line of p at rev to the first-parent commit that
+// introduced it. An empty rev annotates the working tree, whose uncommitted
+// lines have an empty ChangeID.
+func (f *FakeVCS) Annotate(ctx context.Context, rev, p string) ([]AnnotatedLine, error) {
+	if err := f.record("Annotate", rev, p); err != nil {
+		return nil, err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	p = cleanPath(p)
+	data, ok := ws.files[p]
+	id := ws.head
+	if rev != "" {
+		var err error
+		if id, err = r.resolve(ws, rev); err != nil {
+			return nil, err
+		}
+		data, ok = r.commits[id].tree[p]
+	}
+	if !ok {
+		return nil, fmt.Errorf("fake: path %q does not exist in %s", p, rev)
+	}
+
+	lines := splitLines(data)
+	owners := make([]*fakeCommit, len(lines))
+	// at maps each line of the version being examined to its result line,
+	// or -1 once that has been attributed.
+	cur, at := lines, make([]int, len(lines))
+	for i := range at {
+		at[i] = i
+	}
+	var c *fakeCommit // nil while examining the working tree
+	if rev != "" {
+		c = r.commits[id]
+	}
+	for left := len(lines); left > 0; {
+		parent := r.commits[id]
+		if c != nil {
+			parent = nil
+			if len(c.parents) > 0 {
+				parent = r.commits[c.parents[0]]
+			}
+		}
+		var prev []string
+		if parent != nil {
+			prev = splitLines(parent.tree[p])
+		}
+		match := matchLines(prev, cur)
+		next := make([]int, len(prev))
+		for i := range next {
+			next[i] = -1
+		}
+		for i, line := range at {
+			switch {
+			case line < 0:
+			case parent == nil || match[i] < 0:
+				owners[line] = c
+				left--
+			default:
+				next[match[i]] = line
+			}
+		}
+		cur, at, c = prev, next, parent
+	}
+
+	out := make([]AnnotatedLine, len(lines))
+	for i, text := range lines {
+		out[i] = AnnotatedLine{Line: i + 1, Text: text}
+		if c := owners[i]; c != nil {
+			out[i].ChangeID, out[i].CommitID = c.id, c.id
+			out[i].Author, out[i].Time = c.author, c.time
+		}
+	}
+	return out, nil
+}
+
+// Squash amends HEAD with the staged changes, like git commit --amend.
+func (f *FakeVCS) Squash(ctx context.Context, sourceID string) error {
+	if err := f.record("Squash", sourceID); err != nil {
+		return err
+	}
+	return f.commit(ctx, "", &CommitOptions{Amend: true})
+}
+
+// New is a no-op, matching GitVCS; commits are created with Commit.
+func (f *FakeVCS) New(ctx context.Context, message string) error {
+	if err := f.record("New", message); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Edit checks out a revision.
+func (f *FakeVCS) Edit(ctx context.Context, id string) error {
+	if err := f.record("Edit", id); err != nil {
+		return err
+	}
+	return f.checkout(ctx, id)
+}
+
+// Next checks out the child of HEAD on the way to the current bookmark's tip,
+// or the only child if HEAD is detached.
+func (f *FakeVCS) Next(ctx context.Context) (*ChangeInfo, error) {
+	if err := f.record("Next"); err != nil {
+		return nil, err
+	}
+	r, ws := f.lock()
+	if ws == nil {
+		f.unlock()
+		return nil, ErrWorkspaceNotFound
+	}
+	var next string
+	for _, c := range r.children(ws.head) {
+		if tip := r.bookmarks[ws.branch]; ws.branch == "" || r.isAncestor(c.id, tip) {
+			next = c.id
+			break
+		}
+	}
+	if next == "" {
+		f.unlock()
+		return nil, fmt.Errorf("fake: no child commit to move to")
+	}
+	r.checkout(ws, next, ws.branch)
+	f.unlock()
+	return f.currentChange(ctx)
+}
+
+// Prev checks out the first parent of HEAD, detaching it.
+func (f *FakeVCS) Prev(ctx context.Context) (*ChangeInfo, error) {
+	if err := f.record("Prev"); err != nil {
+		return nil, err
+	}
+	if err := f.checkout(ctx, "@-"); err != nil {
+		return nil, err
+	}
+	return f.currentChange(ctx)
+}
+
+// --- Ref Resolution & Branch Queries ---
+
+// BranchExists returns true if the bookmark exists.
+func (f *FakeVCS) BranchExists(ctx context.Context, name string) (bool, error) {
+	if err := f.record("BranchExists", name); err != nil {
+		return false, err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+	_, ok := r.bookmarks[name]
+	return ok, nil
+}
+
+// ResolveRef resolves a revision to a full commit ID.
+func (f *FakeVCS) ResolveRef(ctx context.Context, ref string) (string, error) {
+	if err := f.record("ResolveRef", ref); err != nil {
+		return "", err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return "", ErrWorkspaceNotFound
+	}
+	return r.resolve(ws, ref)
+}
+
+// IsAncestor returns true if ancestor is reachable from descendant.
+func (f *FakeVCS) IsAncestor(ctx context.Context, ancestor, descendant string) (bool, error) {
+	if err := f.record("IsAncestor", ancestor, descendant); err != nil {
+		return false, err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return false, ErrWorkspaceNotFound
+	}
+	a, err := r.resolve(ws, ancestor)
+	if err != nil {
+		return false, err
+	}
+	d, err := r.resolve(ws, descendant)
+	if err != nil {
+		return false, err
+	}
+	return r.isAncestor(a, d), nil
+}
+
+// --- Configuration ---
+
+// GetConfig reads a config value. Unset keys return an empty string.
+func (f *FakeVCS) GetConfig(ctx context.Context, key string) (string, error) {
+	if err := f.record("GetConfig", key); err != nil {
+		return "", err
+	}
+	return f.getConfig(ctx, key)
+}
+
+// getConfig is GetConfig without recording the call.
+func (f *FakeVCS) getConfig(ctx context.Context, key string) (string, error) {
+	r, _ := f.lock()
+	defer f.unlock()
+	return r.config[key], nil
+}
+
+// SetConfig writes a config value.
+func (f *FakeVCS) SetConfig(ctx context.Context, key, value string) error {
+	if err := f.record("SetConfig", key, value); err != nil {
+		return err
+	}
+	return f.setConfig(ctx, key, value)
+}
+
+// setConfig is SetConfig without recording the call.
+func (f *FakeVCS) setConfig(ctx context.Context, key, value string) error {
+	r, _ := f.lock()
+	defer f.unlock()
+	r.config[key] = value
+	return nil
+}
+
+// --- Remote Operations ---
+
+// GetRemoteURL returns the URL of a remote.
+func (f *FakeVCS) GetRemoteURL(ctx context.Context, name string) (string, error) {
+	if err := f.record("GetRemoteURL", name); err != nil {
+		return "", err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+	rem, ok := r.remotes[name]
+	if !ok {
+		return "", fmt.Errorf("fake: remote %q: %w", name, ErrNoRemote)
+	}
+	return rem.url, nil
+}
+
+// GetRemoteURLs returns all remote URLs.
+func (f *FakeVCS) GetRemoteURLs(ctx context.Context) (map[string]string, error) {
+	if err := f.record("GetRemoteURLs"); err != nil {
+		return nil, err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+	urls := make(map[string]string, len(r.remotes))
+	for name, rem := range r.remotes {
+		urls[name] = rem.url
+	}
+	return urls, nil
+}
+
+// PushWithUpstream pushes and records the upstream of the branch.
+func (f *FakeVCS) PushWithUpstream(ctx context.Context, remoteName, branch string) error {
+	if err := f.record("PushWithUpstream", remoteName, branch); err != nil {
+		return err
+	}
+	return f.push(remoteName, branch, false, true)
+}
+
+// ForcePush pushes without the fast-forward check.
+func (f *FakeVCS) ForcePush(ctx context.Context, remoteName, branch string) error {
+	if err := f.record("ForcePush", remoteName, branch); err != nil {
+		return err
+	}
+	return f.push(remoteName, branch, true, false)
+}
+
+// GetUpstream returns the upstream ("remote/branch") of the current bookmark.
+func (f *FakeVCS) GetUpstream(ctx context.Context) (string, error) {
+	if err := f.record("GetUpstream"); err != nil {
+		return "", err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return "", ErrWorkspaceNotFound
+	}
+	up := r.upstreams[ws.branch]
+	if up == "" {
+		return "", fmt.Errorf("fake: no upstream configured for %q: %w", ws.branch, ErrBranchNotFound)
+	}
+	return up, nil
+}
+
+// --- File-Level Operations ---
+
+// CheckoutFile restores a file in the working tree and index from ref.
+func (f *FakeVCS) CheckoutFile(ctx context.Context, ref, p string) error {
+	if err := f.record("CheckoutFile", ref, p); err != nil {
+		return err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	tree, err := r.tree(ws, ref)
+	if err != nil {
+		return err
+	}
+	matched := matchPaths([]string{p}, tree)
+	if len(matched) == 0 {
+		return fmt.Errorf("fake: path %q not in %s", p, ref)
+	}
+	for _, mp := range matched {
+		ws.files[mp] = append([]byte(nil), tree[mp]...)
+		ws.index[mp] = append([]byte(nil), tree[mp]...)
+	}
+	return nil
+}
+
+// Clean removes untracked files that are not ignored.
+func (f *FakeVCS) Clean(ctx context.Context) error {
+	if err := f.record("Clean"); err != nil {
+		return err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	for p := range ws.files {
+		if _, tracked := ws.index[p]; !tracked && !isIgnored(ws.files, p) {
+			delete(ws.files, p)
+		}
+	}
+	return nil
+}
+
+// RestoreFile discards working tree changes to path.
+func (f *FakeVCS) RestoreFile(ctx context.Context, p string) error {
+	if err := f.record("RestoreFile", p); err != nil {
+		return err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	matched := matchPaths([]string{p}, ws.index)
+	if len(matched) == 0 {
+		return fmt.Errorf("fake: path %q is not tracked", p)
+	}
+	for _, mp := range matched {
+		ws.files[mp] = append([]byte(nil), ws.index[mp]...)
+	}
+	return nil
+}
+
+// ResetHard points HEAD (and the current bookmark) at ref and discards all
+// changes.
+func (f *FakeVCS) ResetHard(ctx context.Context, ref string) error {
+	if err := f.record("ResetHard", ref); err != nil {
+		return err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	id, err := r.resolve(ws, ref)
+	if err != nil {
+		return err
+	}
+	r.checkout(ws, id, ws.branch)
+	r.advance(ws, id)
+	return nil
+}
+
+// Checkout switches to a bookmark, or detaches HEAD at a revision.
+func (f *FakeVCS) Checkout(ctx context.Context, ref string) error {
+	if err := f.record("Checkout", ref); err != nil {
+		return err
+	}
+	return f.checkout(ctx, ref)
+}
+
+// checkout is Checkout without recording the call.
+func (f *FakeVCS) checkout(ctx context.Context, ref string) error {
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	id, err := r.resolve(ws, ref)
+	if err != nil {
+		return err
+	}
+	if r.dirty(ws) {
+		return fmt.Errorf("fake: uncommitted changes would be overwritten by checkout")
+	}
+	branch := ""
+	if _, ok := r.bookmarks[ref]; ok {
+		branch = ref
+	}
+	untracked := make(map[string][]byte)
+	for p, data := range ws.files {
+		if _, ok := ws.index[p]; !ok {
+			untracked[p] = data
+		}
+	}
+	r.checkout(ws, id, branch)
+	for p, data := range untracked {
+		if _, ok := ws.files[p]; !ok {
+			ws.files[p] = data
+		}
+	}
+	return nil
+}
+
+// SymbolicRef returns the current bookmark, or "" if HEAD is detached.
+func (f *FakeVCS) SymbolicRef(ctx context.Context) (string, error) {
+	if err := f.record("SymbolicRef"); err != nil {
+		return "", err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return "", ErrWorkspaceNotFound
+	}
+	return ws.branch, nil
+}
+
+// --- Sync-branch operations ---
+
+// LogBetween returns commits in to that are not in from, newest first.
+func (f *FakeVCS) LogBetween(ctx context.Context, from, to string) ([]ChangeInfo, error) {
+	if err := f.record("LogBetween", from, to); err != nil {
+		return nil, err
+	}
+	return f.logBetween(ctx, from, to)
+}
+
+// logBetween is LogBetween without recording the call.
+func (f *FakeVCS) logBetween(ctx context.Context, from, to string) ([]ChangeInfo, error) {
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	a, err := r.resolve(ws, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.resolve(ws, to)
+	if err != nil {
+		return nil, err
+	}
+	return r.infos(ws, r.only(b, a), 0), nil
+}
+
+// RevListCount returns the number of commits in to that are not in from.
+func (f *FakeVCS) RevListCount(ctx context.Context, from, to string) (int, error) {
+	if err := f.record("RevListCount", from, to); err != nil {
+		return 0, err
+	}
+	changes, err := f.logBetween(ctx, from, to)
+	return len(changes), err
+}
+
+// MergeBase returns the best common ancestor of two revisions.
+func (f *FakeVCS) MergeBase(ctx context.Context, ref1, ref2 string) (string, error) {
+	if err := f.record("MergeBase", ref1, ref2); err != nil {
+		return "", err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return "", ErrWorkspaceNotFound
+	}
+	a, err := r.resolve(ws, ref1)
+	if err != nil {
+		return "", err
+	}
+	b, err := r.resolve(ws, ref2)
+	if err != nil {
+		return "", err
+	}
+	base := r.mergeBase(a, b)
+	if base == "" {
+		return "", fmt.Errorf("fake: %s and %s have no common ancestor", ref1, ref2)
+	}
+	return base, nil
+}
+
+// Rebase replays the commits on HEAD that are not in onto on top of onto. On
+// conflict the rebase is abandoned and an error wrapping
+// ErrMergeConflict is returned.
+func (f *FakeVCS) Rebase(ctx context.Context, onto string) error {
+	if err := f.record("Rebase", onto); err != nil {
+		return err
+	}
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	target, err := r.resolve(ws, onto)
+	if err != nil {
+		return err
+	}
+	if r.dirty(ws) {
+		return fmt.Errorf("fake: cannot rebase with uncommitted changes")
+	}
+
+	pending := r.only(ws.head, target)
+	head := target
+	for i := len(pending) - 1; i >= 0; i-- {
+		c := pending[i]
+		if len(c.parents) != 1 {
+			continue // merges are dropped, as git rebase does
+		}
+		merged, conflicts := mergeTrees(r.commits[c.parents[0]].tree, r.commits[head].tree, c.tree)
+		if len(conflicts) > 0 {
+			return fmt.Errorf("fake: rebasing %s onto %s: %w", c.id[:shortIDLen], onto, ErrMergeConflict)
+		}
+		if treesEqual(merged, r.commits[head].tree) {
+			continue // already applied upstream
+		}
+		replayed := r.newCommit([]string{head}, c.description, c.author, merged)
+		replayed.email = c.email
+		head = replayed.id
+	}
+	r.checkout(ws, head, ws.branch)
+	r.advance(ws, head)
+	return nil
+}
+
+// RebaseAbort is a no-op; Rebase never leaves a rebase in progress.
+func (f *FakeVCS) RebaseAbort(ctx context.Context) error {
+	if err := f.record("RebaseAbort"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// --- Hook integration ---
+
+// IsFileTracked returns true if path is in the index.
+func (f *FakeVCS) IsFileTracked(ctx context.Context, p string) (bool, error) {
+	if err := f.record("IsFileTracked", p); err != nil {
+		return false, err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return false, ErrWorkspaceNotFound
+	}
+	_, ok := ws.index[cleanPath(p)]
+	return ok, nil
+}
+
+// ConfigureHooksPath stores core.hooksPath.
+func (f *FakeVCS) ConfigureHooksPath(ctx context.Context, p string) error {
+	if err := f.record("ConfigureHooksPath", p); err != nil {
+		return err
+	}
+	return f.setConfig(ctx, "core.hooksPath", p)
+}
+
+// GetHooksPath returns core.hooksPath.
+func (f *FakeVCS) GetHooksPath(ctx context.Context) (string, error) {
+	if err := f.record("GetHooksPath"); err != nil {
+		return "", err
+	}
+	return f.getConfig(ctx, "core.hooksPath")
+}
+
+// ConfigureMergeDriver stores the merge driver config keys.
+func (f *FakeVCS) ConfigureMergeDriver(ctx context.Context, driverCmd, driverName string) error {
+	if err := f.record("ConfigureMergeDriver", driverCmd, driverName); err != nil {
+		return err
+	}
+	if err := f.setConfig(ctx, "merge.beads.driver", driverCmd); err != nil {
+		return err
+	}
+	return f.setConfig(ctx, "merge.beads.name", driverName)
+}
+
+// --- Extended Bookmark/Branch Operations ---
+
+// DeleteBranch deletes a bookmark. The bookmark checked out in any workspace
+// cannot be deleted.
+func (f *FakeVCS) DeleteBranch(ctx context.Context, name string) error {
+	if err := f.record("DeleteBranch", name); err != nil {
+		return err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+	if _, ok := r.bookmarks[name]; !ok {
+		return fmt.Errorf("fake: branch %q: %w", name, ErrBranchNotFound)
+	}
+	for _, ws := range r.workspaces {
+		if ws.branch == name {
+			return fmt.Errorf("fake: branch %q is checked out in workspace %q", name, ws.name)
+		}
+	}
+	delete(r.bookmarks, name)
+	delete(r.upstreams, name)
+	return nil
+}
+
+// MoveBranch points a bookmark at to (default HEAD), creating it if needed.
+func (f *FakeVCS) MoveBranch(ctx context.Context, name string, to string) error {
+	if err := f.record("MoveBranch", name, to); err != nil {
+		return err
+	}
+	return f.moveBranch(ctx, name, to)
+}
+
+// moveBranch is MoveBranch without recording the call.
+func (f *FakeVCS) moveBranch(ctx context.Context, name string, to string) error {
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	id, err := r.resolve(ws, to)
+	if err != nil {
+		return err
+	}
+	r.bookmarks[name] = id
+	return nil
+}
+
+// SetBranch is the same as MoveBranch.
+func (f *FakeVCS) SetBranch(ctx context.Context, name string, to string) error {
+	if err := f.record("SetBranch", name, to); err != nil {
+		return err
+	}
+	return f.moveBranch(ctx, name, to)
+}
+
+// TrackBranch sets the upstream of a bookmark to remote/name.
+func (f *FakeVCS) TrackBranch(ctx context.Context, name string, remoteName string) error {
+	if err := f.record("TrackBranch", name, remoteName); err != nil {
+		return err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+	if remoteName == "" {
+		remoteName = "origin"
+	}
+	if _, ok := r.bookmarks[name]; !ok {
+		return fmt.Errorf("fake: branch %q: %w", name, ErrBranchNotFound)
+	}
+	if _, ok := r.tracking[name+"@"+remoteName]; !ok {
+		return fmt.Errorf("fake: no remote branch %s/%s: %w", remoteName, name, ErrBranchNotFound)
+	}
+	r.upstreams[name] = remoteName + "/" + name
+	return nil
+}
+
+// UntrackBranch clears the upstream of a bookmark.
+func (f *FakeVCS) UntrackBranch(ctx context.Context, name string, remoteName string) error {
+	if err := f.record("UntrackBranch", name, remoteName); err != nil {
+		return err
+	}
+	r, _ := f.lock()
+	defer f.unlock()
+	delete(r.upstreams, name)
+	return nil
+}
+
+// --- File Operations ---
+
+// TrackFiles stages files.
+func (f *FakeVCS) TrackFiles(ctx context.Context, paths ...string) error {
+	if err := f.record("TrackFiles", paths...); err != nil {
+		return err
+	}
+	return f.stage(ctx, paths...)
+}
+
+// UntrackFiles removes files from the index, leaving the working tree alone.
+func (f *FakeVCS) UntrackFiles(ctx context.Context, paths ...string) error {
+	if err := f.record("UntrackFiles", paths...); err != nil {
+		return err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	for _, p := range matchPaths(paths, ws.index) {
+		delete(ws.index, p)
+	}
+	return nil
+}
+
+// --- Doctor/maintenance ---
+
+// CheckIgnore returns true if path matches the working tree's .gitignore.
+func (f *FakeVCS) CheckIgnore(ctx context.Context, p string) (bool, error) {
+	if err := f.record("CheckIgnore", p); err != nil {
+		return false, err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return false, ErrWorkspaceNotFound
+	}
+	return isIgnored(ws.files, cleanPath(p)), nil
+}
+
+// GetCommonDir returns a notional .fake directory under the repo root.
+func (f *FakeVCS) GetCommonDir(ctx context.Context) (string, error) {
+	if err := f.record("GetCommonDir"); err != nil {
+		return "", err
+	}
+	return f.getCommonDir(ctx)
+}
+
+// getCommonDir is GetCommonDir without recording the call.
+func (f *FakeVCS) getCommonDir(ctx context.Context) (string, error) {
+	return filepath.Join(f.repo.root, ".fake"), nil
+}
+
+// GetVCSDir returns the same directory as GetCommonDir.
+func (f *FakeVCS) GetVCSDir(ctx context.Context) (string, error) {
+	if err := f.record("GetVCSDir"); err != nil {
+		return "", err
+	}
+	return f.getCommonDir(ctx)
+}
+
+// ListTrackedFiles returns tracked files under a path prefix.
+func (f *FakeVCS) ListTrackedFiles(ctx context.Context, p string) ([]string, error) {
+	if err := f.record("ListTrackedFiles", p); err != nil {
+		return nil, err
+	}
+	_, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	if p == "" {
+		p = "."
+	}
+	return matchPaths([]string{p}, ws.index), nil
+}
+
+// ShowFile returns a file's content at a revision.
+func (f *FakeVCS) ShowFile(ctx context.Context, ref, p string) ([]byte, error) {
+	if err := f.record("ShowFile", ref, p); err != nil {
+		return nil, err
+	}
+	return f.showFile(ctx, ref, p)
+}
+
+// showFile is ShowFile without recording the call.
+func (f *FakeVCS) showFile(ctx context.Context, ref, p string) ([]byte, error) {
+	r, ws := f.lock()
+	defer f.unlock()
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	if ref == "" {
+		ref = "@"
+	}
+	tree, err := r.tree(ws, ref)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := tree[cleanPath(p)]
+	if !ok {
+		return nil, fmt.Errorf("fake: path %q does not exist in %s", path.Clean(p), ref)
+	}
+	return append([]byte(nil), data...), nil
+}
@@ -0,0 +1,406 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFakeVCS_HistoryAndBranches(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeVCS(t.TempDir())
+
+	commitFile(t, f, "a.txt", "one", "first")
+	commitFile(t, f, "a.txt", "two", "second")
+
+	log, err := f.Log(ctx, 0)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(log) != 2 || log[0].Description != "second" || log[1].Description != "first" {
+		t.Fatalf("Log = %+v", log)
+	}
+
+	// main follows commits; a new branch stays where it was created.
+	mainID, _ := f.ResolveRef(ctx, "main")
+	if mainID != log[0].ID {
+		t.Errorf("main = %s, want %s", mainID, log[0].ID)
+	}
+	if err := f.SetBranch(ctx, "release", log[1].ID); err != nil {
+		t.Fatalf("SetBranch failed: %v", err)
+	}
+	if ok, _ := f.IsAncestor(ctx, "release", "main"); !ok {
+		t.Error("expected release to be an ancestor of main")
+	}
+	if n, _ := f.RevListCount(ctx, "release", "main"); n != 1 {
+		t.Errorf("RevListCount = %d, want 1", n)
+	}
+
+	if _, err := f.Prev(ctx); err != nil {
+		t.Fatalf("Prev failed: %v", err)
+	}
+	cur, _ := f.CurrentChange(ctx)
+	if cur.Description != "first" {
+		t.Errorf("after Prev, current = %q", cur.Description)
+	}
+}
+
+func TestFakeVCS_FailOnAndCalls(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeVCS(t.TempDir())
+	boom := errors.New("boom")
+
+	f.FailOn("Push", boom)
+	f.AddRemote("origin", NewFakeVCS(t.TempDir()))
+	if err := f.Push(ctx, "origin", "main"); !errors.Is(err, boom) {
+		t.Errorf("Push err = %v, want boom", err)
+	}
+	f.FailOn("Push", nil)
+	if err := f.Push(ctx, "origin", "main"); err != nil {
+		t.Errorf("Push after clear = %v", err)
+	}
+
+	calls := f.Calls()
+	if len(calls) != 2 || calls[0].Method != "Push" || calls[0].Args[0] != "origin" {
+		t.Errorf("Calls = %+v", calls)
+	}
+
+	// Calls made by other methods are not recorded separately.
+	if _, err := f.Prev(ctx); err == nil {
+		t.Error("Prev from the root commit succeeded")
+	}
+	if calls := f.Calls(); len(calls) != 3 || calls[2].Method != "Prev" {
+		t.Errorf("Calls after Prev = %+v", calls)
+	}
+}
+
+func TestFakeVCS_CommandDoesNotRun(t *testing.T) {
+	f := NewFakeVCS(t.TempDir())
+	cmd := f.Command(context.Background(), "status")
+	if _, err := cmd.Output(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Output = %v, want ErrNotSupported", err)
+	}
+	if cmd.Process != nil {
+		t.Error("Command started a process")
+	}
+}
+
+func TestFakeVCS_DetectViaBackend(t *testing.T) {
+	dir := t.TempDir()
+	f := NewFakeVCS(dir)
+	RegisterBackend(f.Backend())
+	t.Cleanup(func() { UnregisterBackend(VCSTypeFake) })
+
+	v, err := DetectVCS(dir)
+	if err != nil {
+		t.Fatalf("DetectVCS failed: %v", err)
+	}
+	if v != VCS(f) {
+		t.Fatalf("DetectVCS returned %T, want the fake", v)
+	}
+
+	commitFile(t, f, "README", "hi", "readme")
+	data, err := v.ShowFile(context.Background(), "main", "README")
+	if err != nil || string(data) != "hi" {
+		t.Errorf("ShowFile = %q, %v", data, err)
+	}
+}
+
+func TestFakeVCS_Query(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeVCS(t.TempDir())
+	commitFile(t, f, "a.txt", "one", "one")
+	if err := f.CreateBranch(ctx, "topic"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	commitFile(t, f, "a.txt", "two", "two")
+
+	changes, err := f.Query(ctx, "topic:: ~ topic")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Description != "two" || !changes[0].IsWorking {
+		t.Errorf("Query(topic:: ~ topic) = %+v, want just two", changes)
+	}
+	changes, err = f.Query(ctx, "bookmarks(exact:topic)")
+	if err != nil || len(changes) != 1 || changes[0].Description != "one" {
+		t.Errorf("Query(bookmarks(exact:topic)) = %+v, %v, want just one", changes, err)
+	}
+}
+
+// commitFile writes, stages and commits one file and returns HEAD.
+func commitFile(t *testing.T, f *FakeVCS, path, content, message string) string {
+	t.Helper()
+	ctx := context.Background()
+	f.WriteFile(path, []byte(content))
+	if err := f.Stage(ctx, path); err != nil {
+		t.Fatalf("Stage: %v", err)
+	}
+	if err := f.Commit(ctx, message, nil); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	id, err := f.ResolveRef(ctx, "@")
+	if err != nil {
+		t.Fatalf("ResolveRef: %v", err)
+	}
+	return id
+}
+
+func TestFakeVCS_CommitNothingToCommit(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeVCS("/repo")
+	commitFile(t, f, "a.txt", "one", "first")
+
+	if err := f.Commit(ctx, "empty", nil); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("Commit with clean index = %v, want ErrNothingToCommit", err)
+	}
+	if err := f.Commit(ctx, "empty", &CommitOptions{AllowEmpty: true}); err != nil {
+		t.Errorf("Commit with AllowEmpty = %v", err)
+	}
+}
+
+func TestFakeVCS_CommitAmendAndRefs(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeVCS("/repo")
+	first := commitFile(t, f, "a.txt", "one", "first")
+	second := commitFile(t, f, "a.txt", "two", "second")
+
+	if got, _ := f.ResolveRef(ctx, "main~1"); got != first {
+		t.Errorf("main~1 = %s, want %s", got, first)
+	}
+	if got, _ := f.ResolveRef(ctx, second[:6]); got != second {
+		t.Errorf("prefix %s resolved to %s", second[:6], got)
+	}
+
+	f.WriteFile("a.txt", []byte("three"))
+	f.Stage(ctx, "a.txt")
+	if err := f.Commit(ctx, "", &CommitOptions{Amend: true}); err != nil {
+		t.Fatalf("amend: %v", err)
+	}
+	head, _ := f.Show(ctx, "@")
+	if head.Description != "second" {
+		t.Errorf("amended description = %q", head.Description)
+	}
+	if got, _ := f.ResolveRef(ctx, "@-"); got != first {
+		t.Errorf("amended parent = %s, want %s", got, first)
+	}
+	if data, _ := f.ShowFile(ctx, "main", "a.txt"); string(data) != "three" {
+		t.Errorf("amended content = %q", data)
+	}
+}
+
+func TestFakeVCS_StatusStagedUnstagedIgnored(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeVCS("/repo")
+	commitFile(t, f, ".gitignore", "*.log\nbuild/\n", "ignore")
+	commitFile(t, f, "keep.txt", "keep", "keep")
+
+	f.WriteFile("keep.txt", []byte("changed"))
+	f.WriteFile("staged.txt", []byte("new"))
+	f.Stage(ctx, "staged.txt")
+	f.WriteFile("loose.txt", []byte("untracked"))
+	f.WriteFile("debug.log", []byte("ignored"))
+	f.WriteFile("build/out", []byte("ignored"))
+
+	entries, err := f.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	got := make(map[string]StatusEntry)
+	for _, e := range entries {
+		got[e.Path] = e
+	}
+	if len(got) != 3 {
+		t.Errorf("Status = %+v, want 3 entries", entries)
+	}
+	if e := got["keep.txt"]; e.Status != FileStatusModified || e.Staged {
+		t.Errorf("keep.txt = %+v", e)
+	}
+	if e := got["staged.txt"]; e.Status != FileStatusAdded || !e.Staged {
+		t.Errorf("staged.txt = %+v", e)
+	}
+	if e := got["loose.txt"]; e.Status != FileStatusUntracked {
+		t.Errorf("loose.txt = %+v", e)
+	}
+	if ok, _ := f.CheckIgnore(ctx, "build/out"); !ok {
+		t.Error("build/out should be ignored")
+	}
+}
+
+func TestFakeVCS_MergeFastForwardAndThreeWay(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeVCS("/repo")
+	base := commitFile(t, f, "a.txt", "base", "base")
+	f.CreateBranch(ctx, "feature")
+	f.Checkout(ctx, "feature")
+	feature := commitFile(t, f, "b.txt", "feature", "feature work")
+	f.Checkout(ctx, "main")
+
+	if err := f.Merge(ctx, "feature", ""); err != nil {
+		t.Fatalf("fast-forward merge: %v", err)
+	}
+	if head, _ := f.ResolveRef(ctx, "main"); head != feature {
+		t.Errorf("main = %s after fast-forward, want %s", head, feature)
+	}
+
+	commitFile(t, f, "c.txt", "main", "main work")
+	f.Checkout(ctx, "feature")
+	commitFile(t, f, "d.txt", "more", "more feature")
+	f.Checkout(ctx, "main")
+	if err := f.Merge(ctx, "feature", "merge feature"); err != nil {
+		t.Fatalf("three-way merge: %v", err)
+	}
+	head, _ := f.Show(ctx, "@")
+	if head.Description != "merge feature" {
+		t.Errorf("merge commit description = %q", head.Description)
+	}
+	for _, p := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		if _, err := f.ShowFile(ctx, "@", p); err != nil {
+			t.Errorf("merged tree missing %s", p)
+		}
+	}
+	if mb, _ := f.MergeBase(ctx, "main", base); mb != base {
+		t.Errorf("MergeBase = %s, want %s", mb, base)
+	}
+}
+
+func TestFakeVCS_MergeConflictAndResolve(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeVCS("/repo")
+	commitFile(t, f, "a.txt", "base\n", "base")
+	f.CreateBranch(ctx, "other")
+	commitFile(t, f, "a.txt", "ours\n", "ours")
+	f.Checkout(ctx, "other")
+	commitFile(t, f, "a.txt", "theirs\n", "theirs")
+	f.Checkout(ctx, "main")
+
+	err := f.Merge(ctx, "other", "")
+	if !errors.Is(err, ErrMergeConflict) {
+		t.Fatalf("Merge = %v, want ErrMergeConflict", err)
+	}
+	if ok, _ := f.HasMergeConflicts(ctx); !ok {
+		t.Error("HasMergeConflicts = false")
+	}
+	if ok, _ := f.IsMerging(ctx); !ok {
+		t.Error("IsMerging = false")
+	}
+	for version, want := range map[string]string{"1": "base\n", "2": "ours\n", "3": "theirs\n"} {
+		if got, _ := f.GetFileVersion(ctx, "a.txt", version); string(got) != want {
+			t.Errorf("stage %s = %q, want %q", version, got, want)
+		}
+	}
+	if data, _ := f.ReadFile("a.txt"); !strings.Contains(string(data), "<<<<<<<") {
+		t.Errorf("conflicted file has no markers: %q", data)
+	}
+	if err := f.Commit(ctx, "too early", nil); !errors.Is(err, ErrMergeConflict) {
+		t.Errorf("Commit during conflict = %v", err)
+	}
+
+	f.WriteFile("a.txt", []byte("resolved\n"))
+	if err := f.MarkResolved(ctx, "a.txt"); err != nil {
+		t.Fatalf("MarkResolved: %v", err)
+	}
+	if err := f.Commit(ctx, "merge", nil); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if ok, _ := f.IsAncestor(ctx, "other", "main"); !ok {
+		t.Error("merge commit should have other as a parent")
+	}
+}
+
+func TestFakeVCS_Rebase(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeVCS("/repo")
+	commitFile(t, f, "a.txt", "base", "base")
+	f.CreateBranch(ctx, "upstream")
+	commitFile(t, f, "mine.txt", "mine", "mine")
+	f.Checkout(ctx, "upstream")
+	commitFile(t, f, "theirs.txt", "theirs", "theirs")
+	f.Checkout(ctx, "main")
+
+	if err := f.Rebase(ctx, "upstream"); err != nil {
+		t.Fatalf("Rebase: %v", err)
+	}
+	if ok, _ := f.IsAncestor(ctx, "upstream", "main"); !ok {
+		t.Error("upstream is not an ancestor of main after rebase")
+	}
+	if n, _ := f.RevListCount(ctx, "upstream", "main"); n != 1 {
+		t.Errorf("RevListCount = %d, want 1", n)
+	}
+}
+
+func TestFakeVCS_PushFetchPull(t *testing.T) {
+	ctx := context.Background()
+	server := NewFakeVCS("/server")
+	alice := NewFakeVCS("/alice")
+	bob := NewFakeVCS("/bob")
+	alice.AddRemote("origin", server)
+	bob.AddRemote("origin", server)
+
+	commitFile(t, alice, "a.txt", "alice", "alice")
+	if err := alice.PushWithUpstream(ctx, "origin", "main"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if up, _ := alice.GetUpstream(ctx); up != "origin/main" {
+		t.Errorf("GetUpstream = %q", up)
+	}
+	if stack, _ := alice.StackInfo(ctx); len(stack) != 0 {
+		t.Errorf("StackInfo after push = %+v", stack)
+	}
+
+	if err := bob.Pull(ctx, "origin", "main"); err != nil {
+		t.Fatalf("Pull: %v", err)
+	}
+	if data, _ := bob.ReadFile("a.txt"); string(data) != "alice" {
+		t.Errorf("bob's a.txt = %q", data)
+	}
+
+	commitFile(t, bob, "b.txt", "bob", "bob")
+	if err := bob.Push(ctx, "origin", "main"); err != nil {
+		t.Fatalf("bob Push: %v", err)
+	}
+	commitFile(t, alice, "c.txt", "alice again", "alice again")
+	if err := alice.Push(ctx, "origin", "main"); err == nil {
+		t.Error("non-fast-forward push should be rejected")
+	}
+	if err := alice.Fetch(ctx, "origin", ""); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if n, _ := alice.RevListCount(ctx, "main", "origin/main"); n != 1 {
+		t.Errorf("origin/main is %d ahead, want 1", n)
+	}
+}
+
+func TestFakeVCS_WorkspacesIndependent(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeVCS("/repo")
+	commitFile(t, f, "a.txt", "base", "base")
+	if err := f.CreateWorkspace(ctx, "side", "/repo-side"); err != nil {
+		t.Fatalf("CreateWorkspace: %v", err)
+	}
+	if err := f.CreateWorkspace(ctx, "side", "/elsewhere"); !errors.Is(err, ErrWorkspaceExists) {
+		t.Errorf("duplicate CreateWorkspace = %v", err)
+	}
+	side, err := f.Workspace("side")
+	if err != nil {
+		t.Fatalf("Workspace: %v", err)
+	}
+	if side.RepoRoot() != "/repo-side" {
+		t.Errorf("side RepoRoot = %s", side.RepoRoot())
+	}
+	commitFile(t, side, "side.txt", "side", "side work")
+
+	if _, ok := f.ReadFile("side.txt"); ok {
+		t.Error("side workspace's file leaked into default workspace")
+	}
+	if ok, _ := f.BranchExists(ctx, "side"); !ok {
+		t.Error("workspace branch not created")
+	}
+	if ok, _ := side.IsWorktreeRepo(ctx); !ok {
+		t.Error("side IsWorktreeRepo = false")
+	}
+	if err := f.RemoveWorkspace(ctx, "nope"); !errors.Is(err, ErrWorkspaceNotFound) {
+		t.Errorf("RemoveWorkspace(nope) = %v", err)
+	}
+}
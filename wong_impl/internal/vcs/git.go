@@ -1,10 +1,8 @@
 package vcs
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
@@ -15,6 +13,9 @@ import (
 type GitVCS struct {
 	repoRoot   string
 	isColocated bool
+
+	// runner runs every git command; nil means DefaultRunner.
+	runner *Runner
 }
 
 // NewGitVCS creates a new Git VCS instance.
@@ -32,6 +33,11 @@ func NewGitVCS(path string) (*GitVCS, error) {
 	}, nil
 }
 
+// SetRunner makes g run its commands through r.
+func (g *GitVCS) SetRunner(r *Runner) {
+	g.runner = r
+}
+
 // Type returns VCSTypeGit.
 func (g *GitVCS) Type() VCSType {
 	return VCSTypeGit
@@ -49,194 +55,133 @@ func (g *GitVCS) IsColocated() bool {
 
 // Command creates an exec.Cmd for running git commands.
 func (g *GitVCS) Command(ctx context.Context, args ...string) *exec.Cmd {
-	cmd := exec.CommandContext(ctx, "git", args...)
-	cmd.Dir = g.repoRoot
-	// Security: Disable hooks and templates to prevent unexpected execution
-	cmd.Env = append(os.Environ(),
-		"GIT_HOOKS_PATH=",
-		"GIT_TEMPLATE_DIR=",
-	)
-	return cmd
+	return g.invocation(args).Command(ctx)
 }
 
-// runGit executes a git command and returns stdout.
-func (g *GitVCS) runGit(ctx context.Context, args ...string) (string, error) {
-	cmd := g.Command(ctx, args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// invocation describes a git command run from the repo root.
+func (g *GitVCS) invocation(args []string) Invocation {
+	return Invocation{
+		Bin:  "git",
+		Args: args,
+		Dir:  g.repoRoot,
+		// Security: Disable hooks and templates to prevent unexpected execution
+		Env: []string{
+			"GIT_HOOKS_PATH=",
+			"GIT_TEMPLATE_DIR=",
+		},
+	}
+}
 
-	err := cmd.Run()
+// run executes inv through g's runner and wraps a failure in a CommandError.
+func (g *GitVCS) run(ctx context.Context, inv Invocation) (Result, error) {
+	res, err := g.runner.Run(ctx, inv)
 	if err != nil {
-		return "", &CommandError{
+		return res, &CommandError{
 			VCS:     VCSTypeGit,
 			Command: "git",
-			Args:    args,
-			Stderr:  stderr.String(),
+			Args:    inv.Args,
+			Stderr:  string(res.Stderr),
+			Stdout:  string(res.Stdout),
 			Err:     err,
 		}
 	}
-	return strings.TrimSpace(stdout.String()), nil
+	return res, nil
 }
 
-// CurrentBranch returns the current branch name.
-func (g *GitVCS) CurrentBranch(ctx context.Context) (string, error) {
-	return g.runGit(ctx, "symbolic-ref", "--short", "HEAD")
+// runGit executes a git command and returns stdout.
+func (g *GitVCS) runGit(ctx context.Context, args ...string) (string, error) {
+	out, err := g.runGitRaw(ctx, args...)
+	return strings.TrimSpace(out), err
 }
 
-// CurrentChange returns info about the current commit.
-func (g *GitVCS) CurrentChange(ctx context.Context) (*ChangeInfo, error) {
-	// Get commit info with a single log command
-	format := "%H%n%h%n%s%n%an%n%ai"
-	output, err := g.runGit(ctx, "log", "-1", "--format="+format)
+// runGitRaw is runGit without trimming, for output such as diffs where
+// leading and trailing whitespace is significant.
+func (g *GitVCS) runGitRaw(ctx context.Context, args ...string) (string, error) {
+	res, err := g.run(ctx, g.invocation(args))
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return string(res.Stdout), nil
+}
 
-	lines := strings.Split(output, "\n")
-	if len(lines) < 5 {
-		return nil, &CommandError{VCS: VCSTypeGit, Command: "log", Err: ErrCommandFailed}
+// runGitInput runs a git command with extra environment variables and the
+// given stdin, and returns trimmed stdout.
+func (g *GitVCS) runGitInput(ctx context.Context, env []string, stdin string, args ...string) (string, error) {
+	inv := g.invocation(args)
+	inv.Env = append(inv.Env, env...)
+	inv.Stdin = stdin
+	res, err := g.run(ctx, inv)
+	if err != nil {
+		return "", err
 	}
+	return strings.TrimSpace(string(res.Stdout)), nil
+}
 
-	return &ChangeInfo{
-		ID:          lines[0],
-		ShortID:     lines[1],
-		Description: lines[2],
-		Author:      lines[3],
-		Timestamp:   lines[4],
-		IsWorking:   false,
-	}, nil
+// CurrentBranch returns the current branch name.
+func (g *GitVCS) CurrentBranch(ctx context.Context) (string, error) {
+	return g.runGit(ctx, "symbolic-ref", "--short", "HEAD")
 }
 
-// Status returns the working copy status.
+// CurrentChange returns info about the current commit.
+func (g *GitVCS) CurrentChange(ctx context.Context) (*ChangeInfo, error) {
+	return g.showChange(ctx, "HEAD")
+}
+
+// Status returns the working copy status, including untracked files.
 func (g *GitVCS) Status(ctx context.Context) ([]StatusEntry, error) {
-	// Use Command directly instead of runGit to avoid TrimSpace corrupting
-	// the porcelain -z output (leading spaces are significant status chars).
-	cmd := g.Command(ctx, "status", "--porcelain", "-z")
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return nil, &CommandError{
-			VCS:     VCSTypeGit,
-			Command: "git",
-			Args:    []string{"status", "--porcelain", "-z"},
-			Stderr:  stderr.String(),
-			Err:     err,
-		}
-	}
-	output := stdout.String()
+	return g.StatusWithOptions(ctx, &StatusOptions{Untracked: true})
+}
 
-	if strings.TrimSpace(output) == "" {
-		return []StatusEntry{}, nil
+// StatusWithOptions parses git status --porcelain -z. Untracked and
+// ignored files are listed individually, not by directory.
+func (g *GitVCS) StatusWithOptions(ctx context.Context, opts *StatusOptions) ([]StatusEntry, error) {
+	if opts == nil {
+		opts = &StatusOptions{}
 	}
+	return g.status(ctx, opts)
+}
 
+// status runs git status for opts, limited to paths if any are given.
+func (g *GitVCS) status(ctx context.Context, opts *StatusOptions, paths ...string) ([]StatusEntry, error) {
+	args := []string{"status", "--porcelain", "-z", "--untracked-files=no"}
+	if opts.Untracked || opts.Ignored {
+		// git only lists ignored files when it looks for untracked ones.
+		args[3] = "--untracked-files=all"
+	}
+	if opts.Ignored {
+		args = append(args, "--ignored")
+	}
+	// runGitRaw keeps the leading spaces, which are significant status chars.
+	output, err := g.runGitRaw(ctx, append(append(args, "--"), paths...)...)
+	if err != nil {
+		return nil, err
+	}
 	var entries []StatusEntry
-	// Parse NUL-delimited output
-	parts := strings.Split(output, "\x00")
-	for i := 0; i < len(parts); i++ {
-		part := parts[i]
-		if len(part) < 3 {
+	for _, e := range parseGitStatus(output) {
+		if e.Status == FileStatusUntracked && !opts.Untracked {
 			continue
 		}
-
-		indexStatus := part[0]
-		worktreeStatus := part[1]
-		path := part[3:]
-
-		entry := StatusEntry{
-			Path: path,
-		}
-
-		// Determine status from index and worktree status
-		switch {
-		case indexStatus == 'U' || worktreeStatus == 'U':
-			entry.Status = FileStatusConflicted
-			entry.Conflicted = true
-		case indexStatus == 'A':
-			entry.Status = FileStatusAdded
-			entry.Staged = true
-		case indexStatus == 'D' || worktreeStatus == 'D':
-			entry.Status = FileStatusDeleted
-			entry.Staged = indexStatus == 'D'
-		case indexStatus == 'M' || worktreeStatus == 'M':
-			entry.Status = FileStatusModified
-			entry.Staged = indexStatus == 'M'
-		case indexStatus == 'R':
-			entry.Status = FileStatusRenamed
-			entry.Staged = true
-			// Next part is the old path for renames
-			if i+1 < len(parts) {
-				entry.OldPath = parts[i+1]
-				i++
-			}
-		case indexStatus == 'C':
-			entry.Status = FileStatusCopied
-			entry.Staged = true
-			if i+1 < len(parts) {
-				entry.OldPath = parts[i+1]
-				i++
-			}
-		case indexStatus == '?' && worktreeStatus == '?':
-			entry.Status = FileStatusUntracked
-		case indexStatus == '!' && worktreeStatus == '!':
-			entry.Status = FileStatusIgnored
-		}
-
-		entries = append(entries, entry)
+		entries = append(entries, e)
 	}
-
-	return entries, nil
+	return finishStatus(entries, nil), nil
 }
 
 // StatusPath returns the status of a specific path.
 func (g *GitVCS) StatusPath(ctx context.Context, path string) (*StatusEntry, error) {
-	output, err := g.runGit(ctx, "status", "--porcelain", path)
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	entries, err := g.status(ctx, &StatusOptions{Untracked: true}, path)
 	if err != nil {
 		return nil, err
 	}
-
-	if output == "" {
+	if len(entries) == 0 {
 		return &StatusEntry{
 			Path:   path,
 			Status: FileStatusUnmodified,
 		}, nil
 	}
-
-	// Parse first line of porcelain output
-	if len(output) < 3 {
-		return nil, &CommandError{VCS: VCSTypeGit, Command: "status", Err: ErrCommandFailed}
-	}
-
-	entry := &StatusEntry{
-		Path: path,
-	}
-
-	indexStatus := output[0]
-	worktreeStatus := output[1]
-
-	switch {
-	case indexStatus == 'U' || worktreeStatus == 'U':
-		entry.Status = FileStatusConflicted
-		entry.Conflicted = true
-	case indexStatus == 'A':
-		entry.Status = FileStatusAdded
-		entry.Staged = true
-	case indexStatus == 'D' || worktreeStatus == 'D':
-		entry.Status = FileStatusDeleted
-		entry.Staged = indexStatus == 'D'
-	case indexStatus == 'M' || worktreeStatus == 'M':
-		entry.Status = FileStatusModified
-		entry.Staged = indexStatus == 'M'
-	case indexStatus == '?':
-		entry.Status = FileStatusUntracked
-	case indexStatus == '!':
-		entry.Status = FileStatusIgnored
-	default:
-		entry.Status = FileStatusModified
-	}
-
-	return entry, nil
+	return &entries[0], nil
 }
 
 // HasRemote returns true if a remote is configured.
@@ -274,7 +219,7 @@ func (g *GitVCS) Stage(ctx context.Context, paths ...string) error {
 	if len(paths) == 0 {
 		return nil
 	}
-	args := append([]string{"add"}, paths...)
+	args := append([]string{"add", "--"}, paths...)
 	_, err := g.runGit(ctx, args...)
 	return err
 }
@@ -308,40 +253,31 @@ func (g *GitVCS) Commit(ctx context.Context, message string, opts *CommitOptions
 
 // Fetch fetches from the remote without merging.
 func (g *GitVCS) Fetch(ctx context.Context, remote, branch string) error {
-	args := []string{"fetch"}
-	if remote != "" {
-		args = append(args, remote)
-	}
-	if branch != "" {
-		args = append(args, branch)
+	args, err := gitRemoteArgs([]string{"fetch"}, remote, branch)
+	if err != nil {
+		return err
 	}
-	_, err := g.runGit(ctx, args...)
+	_, err = g.runGit(ctx, args...)
 	return err
 }
 
 // Pull fetches and merges from the remote.
 func (g *GitVCS) Pull(ctx context.Context, remote, branch string) error {
-	args := []string{"pull"}
-	if remote != "" {
-		args = append(args, remote)
-	}
-	if branch != "" {
-		args = append(args, branch)
+	args, err := gitRemoteArgs([]string{"pull"}, remote, branch)
+	if err != nil {
+		return err
 	}
-	_, err := g.runGit(ctx, args...)
+	_, err = g.runGit(ctx, args...)
 	return err
 }
 
 // Push pushes to the remote.
 func (g *GitVCS) Push(ctx context.Context, remote, branch string) error {
-	args := []string{"push"}
-	if remote != "" {
-		args = append(args, remote)
-	}
-	if branch != "" {
-		args = append(args, branch)
+	args, err := gitRemoteArgs([]string{"push"}, remote, branch)
+	if err != nil {
+		return err
 	}
-	_, err := g.runGit(ctx, args...)
+	_, err = g.runGit(ctx, args...)
 	return err
 }
 
@@ -383,13 +319,21 @@ func (g *GitVCS) ListBranches(ctx context.Context) ([]BranchInfo, error) {
 
 // CreateBranch creates a new branch.
 func (g *GitVCS) CreateBranch(ctx context.Context, name string) error {
-	_, err := g.runGit(ctx, "branch", name)
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "branch", "--end-of-options", name)
 	return err
 }
 
 // SwitchBranch switches to a different branch.
 func (g *GitVCS) SwitchBranch(ctx context.Context, name string) error {
-	_, err := g.runGit(ctx, "checkout", name)
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	// checkout has no --end-of-options; the trailing "--" keeps name from
+	// being read as a path.
+	_, err := g.runGit(ctx, "checkout", name, "--")
 	return err
 }
 
@@ -427,7 +371,13 @@ func (g *GitVCS) ListWorkspaces(ctx context.Context) ([]WorkspaceInfo, error) {
 
 // CreateWorkspace creates a new worktree.
 func (g *GitVCS) CreateWorkspace(ctx context.Context, name, path string) error {
-	_, err := g.runGit(ctx, "worktree", "add", "-b", name, path)
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	if err := validatePath(path); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "worktree", "add", "-b", name, "--end-of-options", path)
 	return err
 }
 
@@ -451,7 +401,7 @@ func (g *GitVCS) RemoveWorkspace(ctx context.Context, name string) error {
 		return ErrWorkspaceNotFound
 	}
 
-	_, err = g.runGit(ctx, "worktree", "remove", path, "--force")
+	_, err = g.runGit(ctx, "worktree", "remove", "--force", "--end-of-options", path)
 	return err
 }
 
@@ -502,20 +452,23 @@ func (g *GitVCS) GetFileVersion(ctx context.Context, path string, version string
 	case "theirs", "3":
 		spec = ":3:" + path
 	default:
+		if err := validateGitRevision(version); err != nil {
+			return nil, err
+		}
 		spec = version + ":" + path
 	}
 
-	cmd := g.Command(ctx, "show", spec)
-	output, err := cmd.Output()
+	res, err := g.runner.Run(ctx, g.invocation([]string{"show", "--end-of-options", spec}))
 	if err != nil {
 		return nil, &CommandError{
 			VCS:     VCSTypeGit,
 			Command: "show",
 			Args:    []string{spec},
+			Stderr:  string(res.Stderr),
 			Err:     err,
 		}
 	}
-	return output, nil
+	return res.Stdout, nil
 }
 
 // MarkResolved marks a file as resolved.
@@ -525,58 +478,19 @@ func (g *GitVCS) MarkResolved(ctx context.Context, path string) error {
 
 // Log returns recent commits.
 func (g *GitVCS) Log(ctx context.Context, limit int) ([]ChangeInfo, error) {
-	format := "%H%x00%h%x00%s%x00%an%x00%ai%x00"
-	args := []string{"log", "--format=" + format}
+	var args []string
 	if limit > 0 {
 		args = append(args, "-n", strconv.Itoa(limit))
 	}
-
-	output, err := g.runGit(ctx, args...)
-	if err != nil {
-		return nil, err
-	}
-
-	var changes []ChangeInfo
-	for _, record := range strings.Split(output, "\n") {
-		if record == "" {
-			continue
-		}
-		parts := strings.Split(record, "\x00")
-		if len(parts) < 5 {
-			continue
-		}
-		changes = append(changes, ChangeInfo{
-			ID:          parts[0],
-			ShortID:     parts[1],
-			Description: parts[2],
-			Author:      parts[3],
-			Timestamp:   parts[4],
-		})
-	}
-
-	return changes, nil
+	return g.logChanges(ctx, args...)
 }
 
 // Show returns details of a specific commit.
 func (g *GitVCS) Show(ctx context.Context, id string) (*ChangeInfo, error) {
-	format := "%H%n%h%n%s%n%an%n%ai"
-	output, err := g.runGit(ctx, "log", "-1", "--format="+format, id)
-	if err != nil {
+	if err := validateGitRevision(id); err != nil {
 		return nil, err
 	}
-
-	lines := strings.Split(output, "\n")
-	if len(lines) < 5 {
-		return nil, &CommandError{VCS: VCSTypeGit, Command: "log", Err: ErrCommandFailed}
-	}
-
-	return &ChangeInfo{
-		ID:          lines[0],
-		ShortID:     lines[1],
-		Description: lines[2],
-		Author:      lines[3],
-		Timestamp:   lines[4],
-	}, nil
+	return g.showChange(ctx, id)
 }
 
 // Diff returns the diff between two revisions.
@@ -591,6 +505,98 @@ func (g *GitVCS) Diff(ctx context.Context, from, to string) (string, error) {
 	return g.runGit(ctx, args...)
 }
 
+// DiffStructured returns the parsed diff between two revisions. Renames
+// are detected. The a/ and b/ path prefixes ParseGitDiff expects are passed
+// explicitly, so diff.noprefix and diff.mnemonicPrefix don't change them.
+func (g *GitVCS) DiffStructured(ctx context.Context, from, to string, paths []string) (*DiffResult, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--no-textconv", "-M",
+		"--src-prefix=a/", "--dst-prefix=b/", "--end-of-options"}
+	for _, rev := range []string{from, to} {
+		if rev == "" {
+			continue
+		}
+		if err := validateGitRevision(rev); err != nil {
+			return nil, err
+		}
+		args = append(args, rev)
+	}
+	args = append(args, "--")
+	for _, p := range paths {
+		if err := validatePath(p); err != nil {
+			return nil, err
+		}
+		args = append(args, p)
+	}
+	out, err := g.runGitRaw(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGitDiff(out)
+}
+
+// Query returns the commits matching revset, newest first. git has no
+// revsets, so the history the revset can reach is loaded and the revset is
+// evaluated over that DAG; see EvalRevset for the supported subset. When
+// revsetScope bounds the revset by the symbols it names, only their
+// ancestors are walked; otherwise every ref is.
+func (g *GitVCS) Query(ctx context.Context, revset string) ([]ChangeInfo, error) {
+	head, err := g.runGit(ctx, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		// Unborn branch: nothing is reachable yet.
+		head = ""
+	}
+	var changes []ChangeInfo
+	if revs := g.queryRevs(ctx, revset); len(revs) > 0 {
+		changes, err = g.logChanges(ctx, revs...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range changes {
+		changes[i].IsWorking = changes[i].ID == head
+	}
+	return QueryChanges(revset, changes, head)
+}
+
+// queryRevs returns the git log arguments Query walks for revset: the
+// commits its symbols resolve to when revsetScope allows it, and --all
+// otherwise. A symbol git can't resolve also means --all, so that EvalRevset
+// reports it as usual.
+func (g *GitVCS) queryRevs(ctx context.Context, revset string) []string {
+	symbols, ok := revsetScope(revset)
+	if !ok {
+		return []string{"--all"}
+	}
+	revs := make([]string, 0, len(symbols))
+	for _, sym := range symbols {
+		id, err := g.resolveRevsetSymbol(ctx, sym)
+		if err != nil {
+			return []string{"--all"}
+		}
+		revs = append(revs, id)
+	}
+	return revs
+}
+
+// resolveRevsetSymbol resolves sym in the order EvalRevset does: "@" and
+// HEAD, then branches, tags and commit IDs.
+func (g *GitVCS) resolveRevsetSymbol(ctx context.Context, sym string) (string, error) {
+	candidates := []string{"refs/heads/" + sym, "refs/tags/" + sym, sym}
+	if sym == "@" || sym == "HEAD" {
+		candidates = []string{"HEAD"}
+	}
+	for _, c := range candidates {
+		if validateGitRevision(c) != nil {
+			continue
+		}
+		id, err := g.runGit(ctx, "rev-parse", "--verify", "--quiet", "--end-of-options", c+"^{commit}")
+		if err == nil && id != "" {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("revision %q doesn't exist: %w", sym, ErrBranchNotFound)
+}
+
 // StackInfo returns unpushed commits on the current branch.
 func (g *GitVCS) StackInfo(ctx context.Context) ([]ChangeInfo, error) {
 	// Get unpushed commits
@@ -606,31 +612,11 @@ func (g *GitVCS) StackInfo(ctx context.Context) ([]ChangeInfo, error) {
 	}
 
 	// Show commits not in remote
-	output, err := g.runGit(ctx, "log", "--format=%H%x00%h%x00%s%x00%an%x00%ai%x00",
-		remote+"/"+branch+"..HEAD")
+	changes, err := g.logChanges(ctx, remote+"/"+branch+"..HEAD")
 	if err != nil {
 		// Remote branch might not exist
 		return g.Log(ctx, 10)
 	}
-
-	var changes []ChangeInfo
-	for _, record := range strings.Split(output, "\n") {
-		if record == "" {
-			continue
-		}
-		parts := strings.Split(record, "\x00")
-		if len(parts) < 5 {
-			continue
-		}
-		changes = append(changes, ChangeInfo{
-			ID:          parts[0],
-			ShortID:     parts[1],
-			Description: parts[2],
-			Author:      parts[3],
-			Timestamp:   parts[4],
-		})
-	}
-
 	return changes, nil
 }
 
@@ -650,7 +636,10 @@ func (g *GitVCS) New(ctx context.Context, message string) error {
 
 // Edit checks out a specific commit.
 func (g *GitVCS) Edit(ctx context.Context, id string) error {
-	_, err := g.runGit(ctx, "checkout", id)
+	if err := validateGitRevision(id); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "checkout", id, "--")
 	return err
 }
 
@@ -658,6 +647,9 @@ func (g *GitVCS) Edit(ctx context.Context, id string) error {
 
 // BranchExists returns true if the named branch exists.
 func (g *GitVCS) BranchExists(ctx context.Context, name string) (bool, error) {
+	if err := ValidateRefName(name); err != nil {
+		return false, err
+	}
 	_, err := g.runGit(ctx, "show-ref", "--verify", "--quiet", "refs/heads/"+name)
 	if err != nil {
 		if _, ok := err.(*CommandError); ok {
@@ -670,12 +662,19 @@ func (g *GitVCS) BranchExists(ctx context.Context, name string) (bool, error) {
 
 // ResolveRef resolves a symbolic reference to a commit hash.
 func (g *GitVCS) ResolveRef(ctx context.Context, ref string) (string, error) {
-	return g.runGit(ctx, "rev-parse", ref)
+	if err := validateGitRevision(ref); err != nil {
+		return "", err
+	}
+	// Without --verify, rev-parse echoes --end-of-options to stdout.
+	return g.runGit(ctx, "rev-parse", "--verify", "--end-of-options", ref)
 }
 
 // IsAncestor returns true if ancestor is an ancestor of descendant.
 func (g *GitVCS) IsAncestor(ctx context.Context, ancestor, descendant string) (bool, error) {
-	_, err := g.runGit(ctx, "merge-base", "--is-ancestor", ancestor, descendant)
+	if err := validateGitRevisions(ancestor, descendant); err != nil {
+		return false, err
+	}
+	_, err := g.runGit(ctx, "merge-base", "--is-ancestor", "--end-of-options", ancestor, descendant)
 	if err != nil {
 		if _, ok := err.(*CommandError); ok {
 			return false, nil
@@ -689,10 +688,14 @@ func (g *GitVCS) IsAncestor(ctx context.Context, ancestor, descendant string) (b
 
 // Merge merges the named branch into the current branch.
 func (g *GitVCS) Merge(ctx context.Context, branch, message string) error {
-	args := []string{"merge", branch}
+	if err := validateGitRevision(branch); err != nil {
+		return err
+	}
+	args := []string{"merge"}
 	if message != "" {
 		args = append(args, "-m", message)
 	}
+	args = append(args, "--end-of-options", branch)
 	_, err := g.runGit(ctx, args...)
 	return err
 }
@@ -713,12 +716,18 @@ func (g *GitVCS) IsMerging(ctx context.Context) (bool, error) {
 
 // GetConfig reads a git config value.
 func (g *GitVCS) GetConfig(ctx context.Context, key string) (string, error) {
-	return g.runGit(ctx, "config", "--get", key)
+	if err := validateArg("config key", key); err != nil {
+		return "", err
+	}
+	return g.runGit(ctx, "config", "--get", "--end-of-options", key)
 }
 
 // SetConfig writes a git config value.
 func (g *GitVCS) SetConfig(ctx context.Context, key, value string) error {
-	_, err := g.runGit(ctx, "config", key, value)
+	if err := validateArg("config key", key); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "config", "--end-of-options", key, value)
 	return err
 }
 
@@ -726,19 +735,34 @@ func (g *GitVCS) SetConfig(ctx context.Context, key, value string) error {
 
 // GetRemoteURL returns the URL for a named remote.
 func (g *GitVCS) GetRemoteURL(ctx context.Context, remote string) (string, error) {
-	return g.runGit(ctx, "remote", "get-url", remote)
+	if err := validateArg("remote", remote); err != nil {
+		return "", err
+	}
+	return g.runGit(ctx, "remote", "get-url", "--end-of-options", remote)
 }
 
 // --- File-Level Operations ---
 
 // CheckoutFile checks out a specific file from a given revision.
 func (g *GitVCS) CheckoutFile(ctx context.Context, ref, path string) error {
+	if err := validateGitRevision(ref); err != nil {
+		return err
+	}
 	_, err := g.runGit(ctx, "checkout", ref, "--", path)
 	return err
 }
 
 // Clean removes untracked files from the working copy.
 func (g *GitVCS) Clean(ctx context.Context) error {
+	if plan := PlanFromContext(ctx); plan != nil {
+		out, err := g.runGit(ctx, "clean", "-n")
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(out, "\n") {
+			plan.AddFiles(strings.TrimPrefix(line, "Would remove "))
+		}
+	}
 	_, err := g.runGit(ctx, "clean", "-f")
 	return err
 }
@@ -798,7 +822,10 @@ func (g *GitVCS) UpdateStaleWorkspace(ctx context.Context, name string) error {
 
 // DeleteBranch deletes a branch.
 func (g *GitVCS) DeleteBranch(ctx context.Context, name string) error {
-	_, err := g.runGit(ctx, "branch", "-d", name)
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "branch", "-d", "--end-of-options", name)
 	return err
 }
 
@@ -807,7 +834,13 @@ func (g *GitVCS) MoveBranch(ctx context.Context, name string, to string) error {
 	if to == "" {
 		to = "HEAD"
 	}
-	_, err := g.runGit(ctx, "branch", "-f", name, to)
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	if err := validateGitRevision(to); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "branch", "-f", "--end-of-options", name, to)
 	return err
 }
 
@@ -821,13 +854,22 @@ func (g *GitVCS) TrackBranch(ctx context.Context, name string, remote string) er
 	if remote == "" {
 		remote = "origin"
 	}
-	_, err := g.runGit(ctx, "branch", "--set-upstream-to="+remote+"/"+name, name)
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	if err := ValidateRefName(remote); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "branch", "--set-upstream-to="+remote+"/"+name, "--end-of-options", name)
 	return err
 }
 
 // UntrackBranch removes tracking for a remote branch.
 func (g *GitVCS) UntrackBranch(ctx context.Context, name string, remote string) error {
-	_, err := g.runGit(ctx, "branch", "--unset-upstream", name)
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "branch", "--unset-upstream", "--end-of-options", name)
 	return err
 }
 
@@ -843,7 +885,7 @@ func (g *GitVCS) UntrackFiles(ctx context.Context, paths ...string) error {
 	if len(paths) == 0 {
 		return nil
 	}
-	args := append([]string{"rm", "--cached"}, paths...)
+	args := append([]string{"rm", "--cached", "--"}, paths...)
 	_, err := g.runGit(ctx, args...)
 	return err
 }
@@ -852,35 +894,18 @@ func (g *GitVCS) UntrackFiles(ctx context.Context, paths ...string) error {
 
 // LogBetween returns commits in 'to' that are not in 'from'.
 func (g *GitVCS) LogBetween(ctx context.Context, from, to string) ([]ChangeInfo, error) {
-	format := "%H%x00%h%x00%s%x00%an%x00%ai%x00"
-	output, err := g.runGit(ctx, "log", "--oneline", "--format="+format, from+".."+to)
-	if err != nil {
+	if err := validateGitRevisions(from, to); err != nil {
 		return nil, err
 	}
-
-	var changes []ChangeInfo
-	for _, record := range strings.Split(output, "\n") {
-		if record == "" {
-			continue
-		}
-		parts := strings.SplitN(record, "\x00", 6)
-		if len(parts) < 5 {
-			continue
-		}
-		changes = append(changes, ChangeInfo{
-			ID:          parts[0],
-			ShortID:     parts[1],
-			Description: parts[2],
-			Author:      parts[3],
-			Timestamp:   parts[4],
-		})
-	}
-	return changes, nil
+	return g.logChanges(ctx, "--end-of-options", from+".."+to, "--")
 }
 
 // DiffPath returns the diff of a specific file between two refs.
 func (g *GitVCS) DiffPath(ctx context.Context, from, to, path string) (string, error) {
-	args := []string{"diff", from + "..." + to}
+	if err := validateGitRevisions(from, to); err != nil {
+		return "", err
+	}
+	args := []string{"diff", "--end-of-options", from + "..." + to}
 	if path != "" {
 		args = append(args, "--", path)
 	}
@@ -903,7 +928,7 @@ func (g *GitVCS) HasStagedChanges(ctx context.Context) (bool, error) {
 func (g *GitVCS) StageAndCommit(ctx context.Context, paths []string, message string, opts *CommitOptions) error {
 	// Stage first
 	if len(paths) > 0 {
-		stageArgs := append([]string{"add", "--sparse"}, paths...)
+		stageArgs := append([]string{"add", "--sparse", "--"}, paths...)
 		if _, err := g.runGit(ctx, stageArgs...); err != nil {
 			return fmt.Errorf("staging: %w", err)
 		}
@@ -930,13 +955,20 @@ func (g *GitVCS) StageAndCommit(ctx context.Context, paths []string, message str
 
 // PushWithUpstream pushes with --set-upstream.
 func (g *GitVCS) PushWithUpstream(ctx context.Context, remote, branch string) error {
-	_, err := g.runGit(ctx, "push", "--set-upstream", remote, branch)
+	args, err := gitRemoteArgs([]string{"push", "--set-upstream"}, remote, branch)
+	if err != nil {
+		return err
+	}
+	_, err = g.runGit(ctx, args...)
 	return err
 }
 
 // Rebase rebases the current branch onto the given ref.
 func (g *GitVCS) Rebase(ctx context.Context, onto string) error {
-	_, err := g.runGit(ctx, "rebase", onto)
+	if err := validateGitRevision(onto); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "rebase", "--end-of-options", onto)
 	return err
 }
 
@@ -950,7 +982,10 @@ func (g *GitVCS) RebaseAbort(ctx context.Context) error {
 
 // IsFileTracked returns true if the file is tracked by git.
 func (g *GitVCS) IsFileTracked(ctx context.Context, path string) (bool, error) {
-	_, err := g.runGit(ctx, "ls-files", "--error-unmatch", path)
+	if err := validatePath(path); err != nil {
+		return false, err
+	}
+	_, err := g.runGit(ctx, "ls-files", "--error-unmatch", "--", path)
 	if err != nil {
 		if _, ok := err.(*CommandError); ok {
 			return false, nil // exit code 1 = not tracked
@@ -994,7 +1029,10 @@ func (g *GitVCS) ConfigureMergeDriver(ctx context.Context, driverCmd, driverName
 
 // DiffHasChanges returns true if the file differs from the given ref.
 func (g *GitVCS) DiffHasChanges(ctx context.Context, ref, path string) (bool, error) {
-	_, err := g.runGit(ctx, "diff", "--quiet", ref, "--", path)
+	if err := validateGitRevision(ref); err != nil {
+		return false, err
+	}
+	_, err := g.runGit(ctx, "diff", "--quiet", "--end-of-options", ref, "--", path)
 	if err != nil {
 		if _, ok := err.(*CommandError); ok {
 			return true, nil // diff --quiet exits 1 when there are changes
@@ -1006,7 +1044,10 @@ func (g *GitVCS) DiffHasChanges(ctx context.Context, ref, path string) (bool, er
 
 // RevListCount returns the number of commits between two refs.
 func (g *GitVCS) RevListCount(ctx context.Context, from, to string) (int, error) {
-	output, err := g.runGit(ctx, "rev-list", "--count", from+".."+to)
+	if err := validateGitRevisions(from, to); err != nil {
+		return 0, err
+	}
+	output, err := g.runGit(ctx, "rev-list", "--count", "--end-of-options", from+".."+to)
 	if err != nil {
 		return 0, err
 	}
@@ -1019,7 +1060,10 @@ func (g *GitVCS) RevListCount(ctx context.Context, from, to string) (int, error)
 
 // MergeBase returns the common ancestor of two refs.
 func (g *GitVCS) MergeBase(ctx context.Context, ref1, ref2 string) (string, error) {
-	output, err := g.runGit(ctx, "merge-base", ref1, ref2)
+	if err := validateGitRevisions(ref1, ref2); err != nil {
+		return "", err
+	}
+	output, err := g.runGit(ctx, "merge-base", "--end-of-options", ref1, ref2)
 	if err != nil {
 		return "", err
 	}
@@ -1037,7 +1081,10 @@ func (g *GitVCS) GetUpstream(ctx context.Context) (string, error) {
 
 // CheckIgnore returns true if the path is ignored.
 func (g *GitVCS) CheckIgnore(ctx context.Context, path string) (bool, error) {
-	_, err := g.runGit(ctx, "check-ignore", "-q", path)
+	if err := validatePath(path); err != nil {
+		return false, err
+	}
+	_, err := g.runGit(ctx, "check-ignore", "-q", "--", path)
 	if err != nil {
 		if _, ok := err.(*CommandError); ok {
 			return false, nil // check-ignore exits 1 when NOT ignored
@@ -1049,22 +1096,72 @@ func (g *GitVCS) CheckIgnore(ctx context.Context, path string) (bool, error) {
 
 // RestoreFile restores a file from git (discards working copy changes).
 func (g *GitVCS) RestoreFile(ctx context.Context, path string) error {
-	_, err := g.runGit(ctx, "restore", path)
+	_, err := g.runGit(ctx, "restore", "--", path)
 	return err
 }
 
 // ResetHard resets the working copy to match the given ref.
 func (g *GitVCS) ResetHard(ctx context.Context, ref string) error {
-	_, err := g.runGit(ctx, "reset", "--hard", ref)
+	if err := validateGitRevision(ref); err != nil {
+		return err
+	}
+	if plan := PlanFromContext(ctx); plan != nil {
+		if err := g.planOverwrite(ctx, plan, "HEAD", ref, true); err != nil {
+			return err
+		}
+	}
+	// reset has no --end-of-options; the trailing "--" keeps ref from being
+	// read as a path.
+	_, err := g.runGit(ctx, "reset", "--hard", ref, "--")
 	return err
 }
 
 // ForcePush pushes with force-with-lease semantics.
 func (g *GitVCS) ForcePush(ctx context.Context, remote, branch string) error {
-	_, err := g.runGit(ctx, "push", "--force-with-lease", remote, branch)
+	args, err := gitRemoteArgs([]string{"push", "--force-with-lease"}, remote, branch)
+	if err != nil {
+		return err
+	}
+	if plan := PlanFromContext(ctx); plan != nil && remote != "" {
+		local := branch
+		if local == "" {
+			if local, err = g.CurrentBranch(ctx); err != nil {
+				return err
+			}
+		}
+		// A branch the remote doesn't have yet overwrites nothing.
+		tracking := "refs/remotes/" + remote + "/" + local
+		if _, err := g.runGit(ctx, "rev-parse", "--verify", "--quiet", tracking); err == nil {
+			if err := g.planOverwrite(ctx, plan, tracking, local, false); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = g.runGit(ctx, args...)
 	return err
 }
 
+// planOverwrite records the commits reachable from from but not to, which
+// moving from to to would drop, and the files that differ between them. With
+// worktree set, files are compared against the working tree instead of from.
+func (g *GitVCS) planOverwrite(ctx context.Context, plan *Plan, from, to string, worktree bool) error {
+	out, err := g.runGit(ctx, "rev-list", to+".."+from, "--")
+	if err != nil {
+		return err
+	}
+	plan.AddChanges(strings.Fields(out)...)
+	args := []string{"diff", "--name-only", "--no-renames", "-z"}
+	if !worktree {
+		args = append(args, from)
+	}
+	out, err = g.runGitRaw(ctx, append(args, to, "--")...)
+	if err != nil {
+		return err
+	}
+	plan.AddFiles(splitNul(out)...)
+	return nil
+}
+
 // GetCommonDir returns the shared git directory (for worktrees).
 func (g *GitVCS) GetCommonDir(ctx context.Context) (string, error) {
 	output, err := g.runGit(ctx, "rev-parse", "--git-common-dir")
@@ -1076,7 +1173,7 @@ func (g *GitVCS) GetCommonDir(ctx context.Context) (string, error) {
 
 // ListTrackedFiles returns tracked files matching a path prefix.
 func (g *GitVCS) ListTrackedFiles(ctx context.Context, path string) ([]string, error) {
-	output, err := g.runGit(ctx, "ls-files", path)
+	output, err := g.runGit(ctx, "ls-files", "--", path)
 	if err != nil {
 		return nil, err
 	}
@@ -1091,7 +1188,10 @@ func (g *GitVCS) ListTrackedFiles(ctx context.Context, path string) ([]string, e
 
 // ShowFile reads file content from a specific ref.
 func (g *GitVCS) ShowFile(ctx context.Context, ref, path string) ([]byte, error) {
-	output, err := g.runGit(ctx, "show", fmt.Sprintf("%s:%s", ref, path))
+	if err := validateGitRevision(ref); err != nil {
+		return nil, err
+	}
+	output, err := g.runGit(ctx, "show", "--end-of-options", ref+":"+path)
 	if err != nil {
 		return nil, err
 	}
@@ -1125,8 +1225,7 @@ func (g *GitVCS) IsWorktreeRepo(ctx context.Context) (bool, error) {
 
 // Checkout switches the working copy to a different ref.
 func (g *GitVCS) Checkout(ctx context.Context, ref string) error {
-	_, err := g.runGit(ctx, "checkout", ref)
-	return err
+	return g.Edit(ctx, ref)
 }
 
 // SymbolicRef returns the symbolic ref name for HEAD, or empty if detached.
@@ -0,0 +1,1198 @@
+package vcs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// hgLogTemplate renders one NUL-separated record per line, matching the field
+// order used by the git backend's log parsing.
+const hgLogTemplate = `{node}\0{short(node)}\0{desc|firstline}\0{author|person}\0{date|isodatesec}\0\n`
+
+// MercurialVCS implements the VCS interface for Mercurial and Sapling. Both
+// share the same command set; they differ in binary name and repo directory.
+type MercurialVCS struct {
+	repoRoot string
+	bin      string
+	vcsType  VCSType
+	dotDir   string
+
+	// runner runs every hg/sl command; nil means DefaultRunner.
+	runner *Runner
+}
+
+// NewMercurialVCS creates a VCS instance for a Mercurial (.hg) repository.
+func NewMercurialVCS(path string) (*MercurialVCS, error) {
+	return newHgFamilyVCS(path, VCSTypeMercurial, "hg", ".hg")
+}
+
+// NewSaplingVCS creates a VCS instance for a Sapling (.sl) repository.
+func NewSaplingVCS(path string) (*MercurialVCS, error) {
+	return newHgFamilyVCS(path, VCSTypeSapling, "sl", ".sl")
+}
+
+func newHgFamilyVCS(path string, vcsType VCSType, bin, dotDir string) (*MercurialVCS, error) {
+	root, err := findRootWithDir(path, dotDir)
+	if err != nil {
+		return nil, err
+	}
+	return &MercurialVCS{
+		repoRoot: root,
+		bin:      bin,
+		vcsType:  vcsType,
+		dotDir:   dotDir,
+	}, nil
+}
+
+// findRootWithDir walks up from path to the first directory containing a
+// subdirectory named dotDir.
+func findRootWithDir(path, dotDir string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	current := absPath
+	for {
+		if isDirectory(filepath.Join(current, dotDir)) {
+			return current, nil
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			break
+		}
+		current = parent
+	}
+	return "", ErrNoVCSFound
+}
+
+// SetRunner makes h run its commands through r.
+func (h *MercurialVCS) SetRunner(r *Runner) {
+	h.runner = r
+}
+
+// Type returns VCSTypeMercurial or VCSTypeSapling.
+func (h *MercurialVCS) Type() VCSType {
+	return h.vcsType
+}
+
+// RepoRoot returns the repository root directory.
+func (h *MercurialVCS) RepoRoot() string {
+	return h.repoRoot
+}
+
+// IsColocated always returns false; colocation is a jj+git concept.
+func (h *MercurialVCS) IsColocated() bool {
+	return false
+}
+
+// Command creates an exec.Cmd for running hg/sl commands.
+func (h *MercurialVCS) Command(ctx context.Context, args ...string) *exec.Cmd {
+	return h.invocation(args).Command(ctx)
+}
+
+// invocation describes an hg/sl command run from the repo root.
+func (h *MercurialVCS) invocation(args []string) Invocation {
+	return Invocation{
+		Bin:  h.bin,
+		Args: args,
+		Dir:  h.repoRoot,
+		// HGPLAIN disables aliases and localized output so parsing is stable.
+		// A no-op editor keeps amend/merge commits from waiting for input.
+		Env: []string{
+			"HGPLAIN=1",
+			"HGEDITOR=true",
+		},
+	}
+}
+
+// runHg executes an hg/sl command and returns stdout.
+func (h *MercurialVCS) runHg(ctx context.Context, args ...string) (string, error) {
+	out, err := h.runHgRaw(ctx, args...)
+	return strings.TrimSpace(out), err
+}
+
+// runHgRaw is runHg without trimming, for diffs.
+func (h *MercurialVCS) runHgRaw(ctx context.Context, args ...string) (string, error) {
+	res, err := h.runner.Run(ctx, h.invocation(args))
+	if err != nil {
+		return "", &CommandError{
+			VCS:     h.vcsType,
+			Command: h.bin,
+			Args:    args,
+			Stderr:  string(res.Stderr),
+			Err:     err,
+		}
+	}
+	return string(res.Stdout), nil
+}
+
+// logChanges runs log with hgLogTemplate over the given revset.
+func (h *MercurialVCS) logChanges(ctx context.Context, revset string, limit int) ([]ChangeInfo, error) {
+	args := []string{"log", "-r", revset, "-T", hgLogTemplate}
+	if limit > 0 {
+		args = append(args, "-l", strconv.Itoa(limit))
+	}
+	output, err := h.runHg(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseHgLog(output), nil
+}
+
+// parseHgLog parses records produced by hgLogTemplate.
+func parseHgLog(output string) []ChangeInfo {
+	var changes []ChangeInfo
+	for _, record := range strings.Split(output, "\n") {
+		if record == "" {
+			continue
+		}
+		parts := strings.Split(record, "\x00")
+		if len(parts) < 5 {
+			continue
+		}
+		changes = append(changes, ChangeInfo{
+			ID:          parts[0],
+			ShortID:     parts[1],
+			Description: parts[2],
+			Author:      parts[3],
+			Timestamp:   parts[4],
+		})
+	}
+	return changes
+}
+
+// activeBookmark returns the active bookmark, or empty if none.
+func (h *MercurialVCS) activeBookmark(ctx context.Context) (string, error) {
+	return h.runHg(ctx, "log", "-r", ".", "-T", "{activebookmark}")
+}
+
+// CurrentBranch returns the active bookmark, falling back to the named branch.
+func (h *MercurialVCS) CurrentBranch(ctx context.Context) (string, error) {
+	bookmark, err := h.activeBookmark(ctx)
+	if err != nil {
+		return "", err
+	}
+	if bookmark != "" {
+		return bookmark, nil
+	}
+	return h.runHg(ctx, "log", "-r", ".", "-T", "{branch}")
+}
+
+// CurrentChange returns info about the working copy parent.
+func (h *MercurialVCS) CurrentChange(ctx context.Context) (*ChangeInfo, error) {
+	changes, err := h.logChanges(ctx, ".", 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, &CommandError{VCS: h.vcsType, Command: "log", Err: ErrCommandFailed}
+	}
+	return &changes[0], nil
+}
+
+// Status returns the working copy status, including unknown files and
+// unresolved conflicts.
+func (h *MercurialVCS) Status(ctx context.Context) ([]StatusEntry, error) {
+	return h.StatusWithOptions(ctx, &StatusOptions{Untracked: true})
+}
+
+// StatusWithOptions runs hg status --copies for tracked changes, plus
+// unknown and ignored files as requested, and marks unresolved conflicts.
+func (h *MercurialVCS) StatusWithOptions(ctx context.Context, opts *StatusOptions) ([]StatusEntry, error) {
+	if opts == nil {
+		opts = &StatusOptions{}
+	}
+	args := []string{"status", "--copies", "--modified", "--added", "--removed", "--deleted"}
+	if opts.Untracked {
+		args = append(args, "--unknown")
+	}
+	if opts.Ignored {
+		args = append(args, "--ignored")
+	}
+	output, err := h.runHg(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	conflicts, err := h.GetConflicts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		paths[i] = c.Path
+	}
+	return finishStatus(parseHgStatus(output), paths), nil
+}
+
+// parseHgStatus parses `hg status --copies` output. Copy sources appear on an
+// indented line after the destination.
+func parseHgStatus(output string) []StatusEntry {
+	var entries []StatusEntry
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "  ") {
+			// Copy source for the previous added file.
+			if n := len(entries); n > 0 {
+				entries[n-1].OldPath = strings.TrimSpace(line)
+				entries[n-1].Status = FileStatusCopied
+			}
+			continue
+		}
+		if len(line) < 3 {
+			continue
+		}
+		entry := StatusEntry{Path: line[2:]}
+		switch line[0] {
+		case 'M':
+			entry.Status = FileStatusModified
+		case 'A':
+			entry.Status = FileStatusAdded
+		case 'R', '!':
+			entry.Status = FileStatusDeleted
+		case '?':
+			entry.Status = FileStatusUntracked
+		case 'I':
+			entry.Status = FileStatusIgnored
+		case 'C':
+			entry.Status = FileStatusUnmodified
+		default:
+			continue
+		}
+		// Mercurial has no staging area: tracked changes are committed as-is.
+		entry.Staged = entry.Status != FileStatusUntracked && entry.Status != FileStatusIgnored
+		entries = append(entries, entry)
+	}
+
+	// A copy whose source was removed is a rename; drop the separate removal.
+	removed := make(map[string]bool)
+	for _, e := range entries {
+		if e.Status == FileStatusDeleted {
+			removed[e.Path] = true
+		}
+	}
+	renamedFrom := make(map[string]bool)
+	for i, e := range entries {
+		if e.Status == FileStatusCopied && removed[e.OldPath] {
+			entries[i].Status = FileStatusRenamed
+			renamedFrom[e.OldPath] = true
+		}
+	}
+	var result []StatusEntry
+	for _, e := range entries {
+		if e.Status == FileStatusDeleted && renamedFrom[e.Path] {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// StatusPath returns the status of a specific path.
+func (h *MercurialVCS) StatusPath(ctx context.Context, path string) (*StatusEntry, error) {
+	output, err := h.runHg(ctx, "status", "--copies", "--", path)
+	if err != nil {
+		return nil, err
+	}
+	entries := parseHgStatus(output)
+	if len(entries) == 0 {
+		return &StatusEntry{Path: path, Status: FileStatusUnmodified}, nil
+	}
+	return &entries[0], nil
+}
+
+// HasRemote returns true if any path (remote) is configured.
+func (h *MercurialVCS) HasRemote(ctx context.Context) (bool, error) {
+	remotes, err := h.GetRemoteURLs(ctx)
+	if err != nil {
+		return false, err
+	}
+	return len(remotes) > 0, nil
+}
+
+// GetRemote returns the default remote name, preferring "default".
+func (h *MercurialVCS) GetRemote(ctx context.Context) (string, error) {
+	remotes, err := h.GetRemoteURLs(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(remotes) == 0 {
+		return "", ErrNoRemote
+	}
+	if _, ok := remotes["default"]; ok {
+		return "default", nil
+	}
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	return minString(names), nil
+}
+
+// Stage adds untracked files and records removals for the given paths.
+// Mercurial has no staging area; modified files are always committed.
+func (h *MercurialVCS) Stage(ctx context.Context, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	args := append([]string{"addremove", "--"}, paths...)
+	_, err := h.runHg(ctx, args...)
+	return err
+}
+
+// Commit creates a new commit with the given message.
+func (h *MercurialVCS) Commit(ctx context.Context, message string, opts *CommitOptions) error {
+	args := []string{"commit", "-m", message}
+	if opts != nil {
+		if opts.Author != "" {
+			args = append(args, "--user", opts.Author)
+		}
+		if opts.Amend {
+			args = append(args, "--amend")
+		}
+		if len(opts.Paths) > 0 {
+			args = append(args, "--")
+			args = append(args, opts.Paths...)
+		}
+	}
+	_, err := h.runHg(ctx, args...)
+	return err
+}
+
+// remoteArgs appends an optional remote path and bookmark to args, after
+// validating them.
+func remoteArgs(args []string, remote, branch string) ([]string, error) {
+	if branch != "" {
+		if err := ValidateRefName(branch); err != nil {
+			return nil, err
+		}
+		args = append(args, "-B", branch)
+	}
+	if remote != "" {
+		if err := validateArg("remote", remote); err != nil {
+			return nil, err
+		}
+		args = append(args, "--", remote)
+	}
+	return args, nil
+}
+
+// runRemote runs a pull or push built by remoteArgs.
+func (h *MercurialVCS) runRemote(ctx context.Context, args []string, remote, branch string) error {
+	args, err := remoteArgs(args, remote, branch)
+	if err != nil {
+		return err
+	}
+	_, err = h.runHg(ctx, args...)
+	return err
+}
+
+// Fetch pulls from the remote without updating the working copy.
+func (h *MercurialVCS) Fetch(ctx context.Context, remote, branch string) error {
+	return h.runRemote(ctx, []string{"pull"}, remote, branch)
+}
+
+// Pull pulls from the remote and updates the working copy.
+func (h *MercurialVCS) Pull(ctx context.Context, remote, branch string) error {
+	return h.runRemote(ctx, []string{"pull", "--update"}, remote, branch)
+}
+
+// Push pushes to the remote.
+func (h *MercurialVCS) Push(ctx context.Context, remote, branch string) error {
+	return h.runRemote(ctx, []string{"push"}, remote, branch)
+}
+
+// ListBranches lists all bookmarks.
+func (h *MercurialVCS) ListBranches(ctx context.Context) ([]BranchInfo, error) {
+	output, err := h.runHg(ctx, "bookmarks", "-T", `{bookmark}\0{active}\n`)
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []BranchInfo
+	for _, line := range strings.Split(output, "\n") {
+		name, active, ok := strings.Cut(line, "\x00")
+		if !ok || name == "" {
+			continue
+		}
+		branches = append(branches, BranchInfo{
+			Name:      name,
+			IsCurrent: active == "True",
+		})
+	}
+	return branches, nil
+}
+
+// CreateBranch creates a bookmark at the working copy parent.
+func (h *MercurialVCS) CreateBranch(ctx context.Context, name string) error {
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	_, err := h.runHg(ctx, "bookmark", "--", name)
+	return err
+}
+
+// SwitchBranch updates to a bookmark or revision.
+func (h *MercurialVCS) SwitchBranch(ctx context.Context, name string) error {
+	return h.update(ctx, name)
+}
+
+// ListWorkspaces returns the single working copy; hg shares are not tracked
+// as workspaces.
+func (h *MercurialVCS) ListWorkspaces(ctx context.Context) ([]WorkspaceInfo, error) {
+	current, err := h.CurrentChange(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []WorkspaceInfo{{Name: "default", Path: h.repoRoot, ChangeID: current.ID}}, nil
+}
+
+// CreateWorkspace is not supported.
+func (h *MercurialVCS) CreateWorkspace(ctx context.Context, name, path string) error {
+	return ErrNotSupported
+}
+
+// RemoveWorkspace is not supported.
+func (h *MercurialVCS) RemoveWorkspace(ctx context.Context, name string) error {
+	return ErrNotSupported
+}
+
+// HasMergeConflicts returns true if any file is unresolved.
+func (h *MercurialVCS) HasMergeConflicts(ctx context.Context) (bool, error) {
+	conflicts, err := h.GetConflicts(ctx)
+	if err != nil {
+		return false, err
+	}
+	return len(conflicts) > 0, nil
+}
+
+// GetConflicts returns unresolved files from `hg resolve --list`.
+func (h *MercurialVCS) GetConflicts(ctx context.Context) ([]MergeConflict, error) {
+	output, err := h.runHg(ctx, "resolve", "--list")
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []MergeConflict
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "U ") {
+			conflicts = append(conflicts, MergeConflict{Path: line[2:]})
+		}
+	}
+	return conflicts, nil
+}
+
+// GetFileVersion retrieves a version of a file during a merge ("base",
+// "ours", "theirs" or stages 1-3), or at any revision.
+func (h *MercurialVCS) GetFileVersion(ctx context.Context, path string, version string) ([]byte, error) {
+	var rev string
+	switch version {
+	case "base", "1":
+		rev = "ancestor(p1(), p2())"
+	case "ours", "2":
+		rev = "p1()"
+	case "theirs", "3":
+		rev = "p2()"
+	default:
+		var err error
+		if rev, err = hgRevision(version); err != nil {
+			return nil, err
+		}
+	}
+	return h.cat(ctx, rev, path)
+}
+
+// MarkResolved marks a file as resolved.
+func (h *MercurialVCS) MarkResolved(ctx context.Context, path string) error {
+	_, err := h.runHg(ctx, "resolve", "--mark", "--", path)
+	return err
+}
+
+// Log returns recent changesets, newest first.
+func (h *MercurialVCS) Log(ctx context.Context, limit int) ([]ChangeInfo, error) {
+	return h.logChanges(ctx, "reverse(::.)", limit)
+}
+
+// Show returns details of a specific changeset.
+func (h *MercurialVCS) Show(ctx context.Context, id string) (*ChangeInfo, error) {
+	rev, err := hgRevision(id)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := h.logChanges(ctx, rev, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, &CommandError{VCS: h.vcsType, Command: "log", Err: ErrCommandFailed}
+	}
+	return &changes[0], nil
+}
+
+// Diff returns the git-format diff between two revisions.
+func (h *MercurialVCS) Diff(ctx context.Context, from, to string) (string, error) {
+	args := []string{"diff", "--git"}
+	for _, rev := range []string{from, to} {
+		if rev == "" {
+			continue
+		}
+		q, err := hgRevision(rev)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "-r", q)
+	}
+	return h.runHg(ctx, args...)
+}
+
+// DiffStructured returns the parsed output of hg diff --git.
+func (h *MercurialVCS) DiffStructured(ctx context.Context, from, to string, paths []string) (*DiffResult, error) {
+	args := []string{"diff", "--git"}
+	for _, rev := range []string{from, to} {
+		if rev == "" {
+			continue
+		}
+		q, err := hgRevision(rev)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-r", q)
+	}
+	args = append(args, "--")
+	for _, p := range paths {
+		if err := validatePath(p); err != nil {
+			return nil, err
+		}
+		args = append(args, p)
+	}
+	out, err := h.runHgRaw(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGitDiff(out)
+}
+
+// Query returns the changesets matching revset, newest first. The revset is
+// passed to hg unchanged, so it must use hg revset syntax.
+func (h *MercurialVCS) Query(ctx context.Context, revset string) ([]ChangeInfo, error) {
+	return h.logChanges(ctx, "reverse(sort("+revset+", rev))", 0)
+}
+
+// StackInfo returns the unpublished (draft) ancestors of the working copy.
+func (h *MercurialVCS) StackInfo(ctx context.Context) ([]ChangeInfo, error) {
+	return h.logChanges(ctx, "reverse(draft() & ::.)", 0)
+}
+
+// Squash amends the working copy parent with pending changes.
+func (h *MercurialVCS) Squash(ctx context.Context, sourceID string) error {
+	_, err := h.runHg(ctx, "commit", "--amend")
+	return err
+}
+
+// New is a no-op; changesets are created with Commit.
+func (h *MercurialVCS) New(ctx context.Context, message string) error {
+	return nil
+}
+
+// Edit updates the working copy to a specific revision.
+func (h *MercurialVCS) Edit(ctx context.Context, id string) error {
+	return h.update(ctx, id)
+}
+
+// update runs hg update to a caller-supplied revision.
+func (h *MercurialVCS) update(ctx context.Context, rev string, flags ...string) error {
+	q, err := hgRevision(rev)
+	if err != nil {
+		return err
+	}
+	args := append(append([]string{"update"}, flags...), "-r", q)
+	_, err = h.runHg(ctx, args...)
+	return err
+}
+
+// --- Ref Resolution & Branch Queries ---
+
+// BranchExists returns true if the named bookmark exists.
+func (h *MercurialVCS) BranchExists(ctx context.Context, name string) (bool, error) {
+	branches, err := h.ListBranches(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, b := range branches {
+		if b.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ResolveRef resolves a revision to a full changeset hash.
+func (h *MercurialVCS) ResolveRef(ctx context.Context, ref string) (string, error) {
+	rev, err := hgRevision(ref)
+	if err != nil {
+		return "", err
+	}
+	return h.runHg(ctx, "log", "-r", rev, "-T", "{node}")
+}
+
+// IsAncestor returns true if ancestor is an ancestor of descendant.
+func (h *MercurialVCS) IsAncestor(ctx context.Context, ancestor, descendant string) (bool, error) {
+	revs, err := hgRevisions(ancestor, descendant)
+	if err != nil {
+		return false, err
+	}
+	output, err := h.runHg(ctx, "log", "-r", fmt.Sprintf("%s & ::%s", revs[0], revs[1]), "-T", "{node}")
+	if err != nil {
+		return false, err
+	}
+	return output != "", nil
+}
+
+// --- Merge Operations ---
+
+// Merge merges the named revision and commits the result.
+func (h *MercurialVCS) Merge(ctx context.Context, branch, message string) error {
+	rev, err := hgRevision(branch)
+	if err != nil {
+		return err
+	}
+	if _, err := h.runHg(ctx, "merge", "-r", rev); err != nil {
+		return err
+	}
+	if message == "" {
+		message = "Merge " + branch
+	}
+	_, err = h.runHg(ctx, "commit", "-m", message)
+	return err
+}
+
+// IsMerging returns true if the working copy has two parents.
+func (h *MercurialVCS) IsMerging(ctx context.Context) (bool, error) {
+	output, err := h.runHg(ctx, "log", "-r", "p2()", "-T", "{node}")
+	if err != nil {
+		return false, err
+	}
+	return output != "", nil
+}
+
+// --- Configuration ---
+
+// GetConfig reads a config value ("section.name").
+func (h *MercurialVCS) GetConfig(ctx context.Context, key string) (string, error) {
+	return h.runHg(ctx, "config", key)
+}
+
+// SetConfig writes a config value to the repository config file.
+func (h *MercurialVCS) SetConfig(ctx context.Context, key, value string) error {
+	section, name, ok := strings.Cut(key, ".")
+	if !ok || section == "" || name == "" {
+		return fmt.Errorf("invalid config key %q: expected section.name", key)
+	}
+	path := filepath.Join(h.repoRoot, h.dotDir, h.repoConfigName())
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	updated := setINIValue(string(data), section, name, value)
+	return os.WriteFile(path, []byte(updated), 0644)
+}
+
+// repoConfigName returns the per-repo config file name inside the dot dir.
+func (h *MercurialVCS) repoConfigName() string {
+	if h.vcsType == VCSTypeSapling {
+		return "config"
+	}
+	return "hgrc"
+}
+
+// setINIValue sets name=value in [section] of an hgrc-style file, adding the
+// section or key if missing.
+func setINIValue(content, section, name, value string) string {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+	header := "[" + section + "]"
+	entry := name + " = " + value
+
+	inSection := false
+	sectionEnd := -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if inSection {
+				break
+			}
+			inSection = trimmed == header
+			if inSection {
+				sectionEnd = i + 1
+			}
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if k, _, ok := strings.Cut(trimmed, "="); ok && strings.TrimSpace(k) == name {
+			lines[i] = entry
+			return strings.Join(lines, "\n") + "\n"
+		}
+		if trimmed != "" {
+			sectionEnd = i + 1
+		}
+	}
+
+	if sectionEnd < 0 {
+		lines = append(lines, header, entry)
+	} else {
+		lines = append(lines[:sectionEnd], append([]string{entry}, lines[sectionEnd:]...)...)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// --- Remote Operations ---
+
+// GetRemoteURL returns the URL for a named path.
+func (h *MercurialVCS) GetRemoteURL(ctx context.Context, remote string) (string, error) {
+	return h.runHg(ctx, "paths", "--", remote)
+}
+
+// --- File-Level Operations ---
+
+// CheckoutFile restores a file from a given revision.
+func (h *MercurialVCS) CheckoutFile(ctx context.Context, ref, path string) error {
+	rev, err := hgRevision(ref)
+	if err != nil {
+		return err
+	}
+	_, err = h.runHg(ctx, "revert", "--no-backup", "-r", rev, "--", path)
+	return err
+}
+
+// Clean removes untracked files from the working copy.
+func (h *MercurialVCS) Clean(ctx context.Context) error {
+	if plan := PlanFromContext(ctx); plan != nil {
+		out, err := h.runHg(ctx, "status", "--unknown", "--no-status")
+		if err != nil {
+			return err
+		}
+		plan.AddFiles(strings.Split(out, "\n")...)
+	}
+	args := []string{"purge"}
+	if h.vcsType == VCSTypeMercurial {
+		args = append([]string{"--config", "extensions.purge="}, args...)
+	}
+	_, err := h.runHg(ctx, args...)
+	return err
+}
+
+// --- Stack Navigation ---
+
+// Next updates to the first child of the working copy parent.
+func (h *MercurialVCS) Next(ctx context.Context) (*ChangeInfo, error) {
+	child, err := h.runHg(ctx, "log", "-r", "first(children(.))", "-T", "{node}")
+	if err != nil {
+		return nil, err
+	}
+	if child == "" {
+		return nil, &CommandError{VCS: h.vcsType, Command: "next",
+			Err: ErrCommandFailed, Stderr: "no next commit in stack"}
+	}
+	if err := h.Edit(ctx, child); err != nil {
+		return nil, err
+	}
+	return h.CurrentChange(ctx)
+}
+
+// Prev updates to the parent of the working copy parent.
+func (h *MercurialVCS) Prev(ctx context.Context) (*ChangeInfo, error) {
+	if _, err := h.runHg(ctx, "update", "-r", ".^"); err != nil {
+		return nil, err
+	}
+	return h.CurrentChange(ctx)
+}
+
+// --- Extended Workspace Operations ---
+
+// UpdateStaleWorkspace is a no-op; hg working copies can't go stale.
+func (h *MercurialVCS) UpdateStaleWorkspace(ctx context.Context, name string) error {
+	return nil
+}
+
+// --- Extended Bookmark/Branch Operations ---
+
+// DeleteBranch deletes a bookmark.
+func (h *MercurialVCS) DeleteBranch(ctx context.Context, name string) error {
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	_, err := h.runHg(ctx, "bookmark", "--delete", "--", name)
+	return err
+}
+
+// MoveBranch moves a bookmark to a revision (default: working copy parent).
+func (h *MercurialVCS) MoveBranch(ctx context.Context, name string, to string) error {
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	if to == "" {
+		to = "."
+	}
+	rev, err := hgRevision(to)
+	if err != nil {
+		return err
+	}
+	_, err = h.runHg(ctx, "bookmark", "--force", "-r", rev, "--", name)
+	return err
+}
+
+// SetBranch sets a bookmark to a revision (same as MoveBranch).
+func (h *MercurialVCS) SetBranch(ctx context.Context, name string, to string) error {
+	return h.MoveBranch(ctx, name, to)
+}
+
+// TrackBranch is not supported; hg bookmarks have no upstream tracking.
+func (h *MercurialVCS) TrackBranch(ctx context.Context, name string, remote string) error {
+	return ErrNotSupported
+}
+
+// UntrackBranch is not supported; hg bookmarks have no upstream tracking.
+func (h *MercurialVCS) UntrackBranch(ctx context.Context, name string, remote string) error {
+	return ErrNotSupported
+}
+
+// --- File Operations ---
+
+// TrackFiles starts tracking files (hg add).
+func (h *MercurialVCS) TrackFiles(ctx context.Context, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	args := append([]string{"add", "--"}, paths...)
+	_, err := h.runHg(ctx, args...)
+	return err
+}
+
+// UntrackFiles stops tracking files without deleting them (hg forget).
+func (h *MercurialVCS) UntrackFiles(ctx context.Context, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	args := append([]string{"forget", "--"}, paths...)
+	_, err := h.runHg(ctx, args...)
+	return err
+}
+
+// --- Phase 2: Sync-branch worktree/workspace operations ---
+
+// LogBetween returns changesets in 'to' that are not in 'from'.
+func (h *MercurialVCS) LogBetween(ctx context.Context, from, to string) ([]ChangeInfo, error) {
+	revs, err := hgRevisions(to, from)
+	if err != nil {
+		return nil, err
+	}
+	return h.logChanges(ctx, fmt.Sprintf("reverse(only(%s, %s))", revs[0], revs[1]), 0)
+}
+
+// DiffPath returns the diff of a specific file between two revisions.
+func (h *MercurialVCS) DiffPath(ctx context.Context, from, to, path string) (string, error) {
+	revs, err := hgRevisions(from, to)
+	if err != nil {
+		return "", err
+	}
+	args := []string{"diff", "--git", "-r", revs[0], "-r", revs[1]}
+	if path != "" {
+		args = append(args, "--", path)
+	}
+	return h.runHg(ctx, args...)
+}
+
+// HasStagedChanges returns true if tracked files are modified, added or removed.
+func (h *MercurialVCS) HasStagedChanges(ctx context.Context) (bool, error) {
+	output, err := h.runHg(ctx, "status", "--modified", "--added", "--removed")
+	if err != nil {
+		return false, err
+	}
+	return output != "", nil
+}
+
+// StageAndCommit records the given paths and commits them.
+func (h *MercurialVCS) StageAndCommit(ctx context.Context, paths []string, message string, opts *CommitOptions) error {
+	if err := h.Stage(ctx, paths...); err != nil {
+		return fmt.Errorf("staging: %w", err)
+	}
+
+	hasChanges, err := h.HasStagedChanges(ctx)
+	if err != nil {
+		return fmt.Errorf("checking staged changes: %w", err)
+	}
+	if !hasChanges {
+		return nil // Nothing to commit
+	}
+
+	commitOpts := &CommitOptions{Paths: paths}
+	if opts != nil {
+		commitOpts.Author = opts.Author
+	}
+	return h.Commit(ctx, message, commitOpts)
+}
+
+// PushWithUpstream pushes a bookmark, creating it on the remote if needed.
+func (h *MercurialVCS) PushWithUpstream(ctx context.Context, remote, branch string) error {
+	return h.Push(ctx, remote, branch)
+}
+
+// Rebase rebases the current stack onto the given revision.
+func (h *MercurialVCS) Rebase(ctx context.Context, onto string) error {
+	rev, err := hgRevision(onto)
+	if err != nil {
+		return err
+	}
+	_, err = h.runHg(ctx, h.withExtension("rebase", "rebase", "-d", rev)...)
+	return err
+}
+
+// RebaseAbort aborts a rebase in progress.
+func (h *MercurialVCS) RebaseAbort(ctx context.Context) error {
+	_, err := h.runHg(ctx, h.withExtension("rebase", "rebase", "--abort")...)
+	return err
+}
+
+// withExtension enables a bundled extension for Mercurial. Sapling ships these
+// commands built in.
+func (h *MercurialVCS) withExtension(ext string, args ...string) []string {
+	if h.vcsType != VCSTypeMercurial {
+		return args
+	}
+	return append([]string{"--config", "extensions." + ext + "="}, args...)
+}
+
+// --- Phase 3: Hook integration operations ---
+
+// IsFileTracked returns true if the file is tracked.
+func (h *MercurialVCS) IsFileTracked(ctx context.Context, path string) (bool, error) {
+	_, err := h.runHg(ctx, "files", "--", path)
+	if err != nil {
+		if _, ok := err.(*CommandError); ok {
+			return false, nil // exit code 1 = no matching files
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ConfigureHooksPath is not supported; hg hooks are configured per event.
+func (h *MercurialVCS) ConfigureHooksPath(ctx context.Context, path string) error {
+	return ErrNotSupported
+}
+
+// GetHooksPath returns empty; hg has no hooks directory.
+func (h *MercurialVCS) GetHooksPath(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+// ConfigureMergeDriver registers a merge tool for beads JSONL files.
+func (h *MercurialVCS) ConfigureMergeDriver(ctx context.Context, driverCmd, driverName string) error {
+	if err := h.SetConfig(ctx, "merge-tools.beads.executable", driverCmd); err != nil {
+		return fmt.Errorf("setting merge tool command: %w", err)
+	}
+	if err := h.SetConfig(ctx, "merge-patterns.**.jsonl", "beads"); err != nil {
+		return fmt.Errorf("setting merge pattern for %s: %w", driverName, err)
+	}
+	return nil
+}
+
+// --- Phase 4: Doctor/maintenance operations ---
+
+// DiffHasChanges returns true if the file differs from the given revision.
+func (h *MercurialVCS) DiffHasChanges(ctx context.Context, ref, path string) (bool, error) {
+	rev, err := hgRevision(ref)
+	if err != nil {
+		return false, err
+	}
+	output, err := h.runHg(ctx, "status", "--rev", rev, "--", path)
+	if err != nil {
+		return false, err
+	}
+	return output != "", nil
+}
+
+// RevListCount returns the number of changesets in 'to' that are not in 'from'.
+func (h *MercurialVCS) RevListCount(ctx context.Context, from, to string) (int, error) {
+	revs, err := hgRevisions(to, from)
+	if err != nil {
+		return 0, err
+	}
+	output, err := h.runHg(ctx, "log", "-r", fmt.Sprintf("only(%s, %s)", revs[0], revs[1]), "-T", "x")
+	if err != nil {
+		return 0, err
+	}
+	return len(output), nil
+}
+
+// MergeBase returns the common ancestor of two revisions.
+func (h *MercurialVCS) MergeBase(ctx context.Context, ref1, ref2 string) (string, error) {
+	revs, err := hgRevisions(ref1, ref2)
+	if err != nil {
+		return "", err
+	}
+	return h.runHg(ctx, "log", "-r", fmt.Sprintf("ancestor(%s, %s)", revs[0], revs[1]), "-T", "{node}")
+}
+
+// GetUpstream returns the default push path.
+func (h *MercurialVCS) GetUpstream(ctx context.Context) (string, error) {
+	return h.GetRemote(ctx)
+}
+
+// CheckIgnore returns true if the path is ignored.
+func (h *MercurialVCS) CheckIgnore(ctx context.Context, path string) (bool, error) {
+	output, err := h.runHg(ctx, "status", "--ignored", "--", path)
+	if err != nil {
+		return false, err
+	}
+	return output != "", nil
+}
+
+// RestoreFile discards working copy changes to a file.
+func (h *MercurialVCS) RestoreFile(ctx context.Context, path string) error {
+	_, err := h.runHg(ctx, "revert", "--no-backup", "--", path)
+	return err
+}
+
+// ResetHard updates to the given revision, discarding local changes.
+func (h *MercurialVCS) ResetHard(ctx context.Context, ref string) error {
+	if plan := PlanFromContext(ctx); plan != nil {
+		q, err := hgRevision(ref)
+		if err != nil {
+			return err
+		}
+		node, err := h.runHg(ctx, "log", "-r", q, "-T", "{node}")
+		if err != nil {
+			return err
+		}
+		plan.AddChanges(node)
+		out, err := h.runHg(ctx, "status", "--modified", "--added", "--removed", "--deleted", "--no-status", "--rev", q)
+		if err != nil {
+			return err
+		}
+		plan.AddFiles(strings.Split(out, "\n")...)
+	}
+	return h.update(ctx, ref, "--clean")
+}
+
+// ForcePush pushes even if it creates new remote heads.
+func (h *MercurialVCS) ForcePush(ctx context.Context, remote, branch string) error {
+	return h.runRemote(ctx, []string{"push", "--force"}, remote, branch)
+}
+
+// GetCommonDir returns the shared store directory (for `hg share` checkouts).
+func (h *MercurialVCS) GetCommonDir(ctx context.Context) (string, error) {
+	dir := filepath.Join(h.repoRoot, h.dotDir)
+	if data, err := os.ReadFile(filepath.Join(dir, "sharedpath")); err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	return dir, nil
+}
+
+// ListTrackedFiles returns tracked files matching a path prefix.
+func (h *MercurialVCS) ListTrackedFiles(ctx context.Context, path string) ([]string, error) {
+	output, err := h.runHg(ctx, "files", "--", path)
+	if err != nil {
+		if _, ok := err.(*CommandError); ok {
+			return nil, nil // exit code 1 = no matching files
+		}
+		return nil, err
+	}
+	if output == "" {
+		return nil, nil
+	}
+	return strings.Split(output, "\n"), nil
+}
+
+// --- Phase 5: Remaining production call site abstractions ---
+
+// ShowFile reads file content at a specific revision.
+func (h *MercurialVCS) ShowFile(ctx context.Context, ref, path string) ([]byte, error) {
+	rev, err := hgRevision(ref)
+	if err != nil {
+		return nil, err
+	}
+	return h.cat(ctx, rev, path)
+}
+
+// cat runs hg cat for an already-quoted revset.
+func (h *MercurialVCS) cat(ctx context.Context, rev, path string) ([]byte, error) {
+	res, err := h.runner.Run(ctx, h.invocation([]string{"cat", "-r", rev, "--", path}))
+	if err != nil {
+		return nil, &CommandError{
+			VCS:     h.vcsType,
+			Command: "cat",
+			Args:    []string{"-r", rev, path},
+			Stderr:  string(res.Stderr),
+			Err:     err,
+		}
+	}
+	return res.Stdout, nil
+}
+
+// GetVCSDir returns the .hg or .sl directory of this working copy.
+func (h *MercurialVCS) GetVCSDir(ctx context.Context) (string, error) {
+	return filepath.Join(h.repoRoot, h.dotDir), nil
+}
+
+// IsWorktreeRepo returns true if this working copy is an `hg share`.
+func (h *MercurialVCS) IsWorktreeRepo(ctx context.Context) (bool, error) {
+	return isDirectoryOrFile(filepath.Join(h.repoRoot, h.dotDir, "sharedpath")), nil
+}
+
+// Checkout updates the working copy to a different revision.
+func (h *MercurialVCS) Checkout(ctx context.Context, ref string) error {
+	return h.Edit(ctx, ref)
+}
+
+// SymbolicRef returns the active bookmark, or empty if none is active.
+func (h *MercurialVCS) SymbolicRef(ctx context.Context) (string, error) {
+	return h.activeBookmark(ctx)
+}
+
+// GetRemoteURLs returns all configured paths.
+func (h *MercurialVCS) GetRemoteURLs(ctx context.Context) (map[string]string, error) {
+	output, err := h.runHg(ctx, "paths")
+	if err != nil {
+		return nil, err
+	}
+	return parseHgPaths(output), nil
+}
+
+// parseHgPaths parses `hg paths` output ("name = url" per line).
+func parseHgPaths(output string) map[string]string {
+	result := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		name, url, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		result[strings.TrimSpace(name)] = strings.TrimSpace(url)
+	}
+	return result
+}
+
+// minString returns the lexically smallest string in a non-empty slice.
+func minString(values []string) string {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// Ensure MercurialVCS implements VCS.
+var _ VCS = (*MercurialVCS)(nil)
@@ -0,0 +1,115 @@
+package vcs
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestParseHgStatus(t *testing.T) {
+	output := "M changed.go\n" +
+		"A copied.go\n" +
+		"  original.go\n" +
+		"A moved.go\n" +
+		"  old.go\n" +
+		"R old.go\n" +
+		"! missing.go\n" +
+		"? new.txt\n" +
+		"I build.log"
+
+	got := parseHgStatus(output)
+	want := []StatusEntry{
+		{Path: "changed.go", Status: FileStatusModified, Staged: true},
+		{Path: "copied.go", Status: FileStatusCopied, OldPath: "original.go", Staged: true},
+		{Path: "moved.go", Status: FileStatusRenamed, OldPath: "old.go", Staged: true},
+		{Path: "missing.go", Status: FileStatusDeleted, Staged: true},
+		{Path: "new.txt", Status: FileStatusUntracked},
+		{Path: "build.log", Status: FileStatusIgnored},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHgStatus =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseHgLog(t *testing.T) {
+	output := "abc123\x00abc\x00First line\x00Alice\x002024-01-02 03:04:05 +0000\x00\n" +
+		"def456\x00def\x00Second\x00Bob\x002024-01-03 03:04:05 +0000\x00\n"
+	got := parseHgLog(output)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(got))
+	}
+	if got[0].ID != "abc123" || got[0].ShortID != "abc" || got[0].Description != "First line" || got[0].Author != "Alice" {
+		t.Errorf("unexpected first change: %+v", got[0])
+	}
+}
+
+func TestParseHgPaths(t *testing.T) {
+	got := parseHgPaths("default = https://example.com/repo\nfork = ssh://hg@example.com/fork\n")
+	want := map[string]string{
+		"default": "https://example.com/repo",
+		"fork":    "ssh://hg@example.com/fork",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHgPaths = %v, want %v", got, want)
+	}
+}
+
+func TestSetINIValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty file", "", "[ui]\nusername = test\n"},
+		{"new key in section", "[ui]\neditor = vi\n", "[ui]\neditor = vi\nusername = test\n"},
+		{"replace key", "[ui]\nusername = old\n", "[ui]\nusername = test\n"},
+		{"other section first", "[paths]\ndefault = x\n\n[ui]\neditor = vi\n\n[extensions]\n",
+			"[paths]\ndefault = x\n\n[ui]\neditor = vi\nusername = test\n\n[extensions]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := setINIValue(tt.content, "ui", "username", "test"); got != tt.want {
+				t.Errorf("setINIValue =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMercurialVCS_CommitAndLog(t *testing.T) {
+	if _, err := exec.LookPath("hg"); err != nil {
+		t.Skip("hg not installed, skipping")
+	}
+
+	h := NewTestHelper(t)
+	repoPath := h.tempDir + "/hg-repo"
+	h.runCmd(h.tempDir, "hg", "init", repoPath)
+	h.WriteFile(repoPath, "a.txt", "hello\n")
+
+	hg, err := NewMercurialVCS(repoPath)
+	if err != nil {
+		t.Fatalf("NewMercurialVCS failed: %v", err)
+	}
+	ctx := context.Background()
+	if err := hg.SetConfig(ctx, "ui.username", "Test User <test@example.com>"); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	if err := hg.Stage(ctx, "a.txt"); err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	if err := hg.Commit(ctx, "Add a.txt", nil); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	changes, err := hg.Log(ctx, 5)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Description != "Add a.txt" {
+		t.Errorf("Log = %+v", changes)
+	}
+	tracked, err := hg.IsFileTracked(ctx, "a.txt")
+	if err != nil || !tracked {
+		t.Errorf("IsFileTracked = %v, %v", tracked, err)
+	}
+}
@@ -0,0 +1,317 @@
+package vcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orderChanges returns changes in the order of ids, matching on CommitID.
+func orderChanges(changes []ChangeInfo, ids []string) []ChangeInfo {
+	byID := make(map[string]ChangeInfo, len(changes))
+	for _, c := range changes {
+		byID[c.CommitID] = c
+	}
+	out := make([]ChangeInfo, 0, len(ids))
+	for _, id := range ids {
+		if c, ok := byID[id]; ok {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// --- jj ---
+
+// Evolog lists the commits the change has been, from jj evolog. Earlier
+// versions are hidden commits, which jj log still shows by commit ID.
+func (j *JujutsuVCS) Evolog(ctx context.Context, changeID string) ([]ChangeInfo, error) {
+	rev, err := j.revision(changeID)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := `commit_id ++ "\n"`
+	if j.caps.EvologEntry {
+		tmpl = `commit.commit_id() ++ "\n"`
+	}
+	out, err := j.runJJ(ctx, "evolog", "--no-graph", "-r", rev, "-T", tmpl)
+	if err != nil {
+		return nil, err
+	}
+	ids := strings.Fields(out)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	revs := make([]string, len(ids))
+	for i, id := range ids {
+		revs[i] = quoteRevsetString(id)
+	}
+	changes, err := j.logChanges(ctx, "-r", strings.Join(revs, " | "))
+	if err != nil {
+		return nil, err
+	}
+	return orderChanges(changes, ids), nil
+}
+
+// jjAnnotateTemplate renders each AnnotationLine as a JSON object per line.
+const jjAnnotateTemplate = `"{\"change_id\":" ++ stringify(commit.change_id()).escape_json() ++ ` +
+	`",\"commit_id\":" ++ stringify(commit.commit_id()).escape_json() ++ ` +
+	`",\"author\":" ++ commit.author().name().escape_json() ++ ` +
+	`",\"time\":" ++ commit.author().timestamp().format("%Y-%m-%dT%H:%M:%S%:z").escape_json() ++ ` +
+	`",\"line\":" ++ line_number ++ ` +
+	`",\"text\":" ++ stringify(content).escape_json() ++ "}\n"`
+
+// jjAnnotatedLine is the decoded form of one jjAnnotateTemplate object.
+type jjAnnotatedLine struct {
+	ChangeID string `json:"change_id"`
+	CommitID string `json:"commit_id"`
+	Author   string `json:"author"`
+	Time     string `json:"time"`
+	Line     int    `json:"line"`
+	Text     string `json:"text"`
+}
+
+// Annotate runs jj file annotate with jjAnnotateTemplate.
+func (j *JujutsuVCS) Annotate(ctx context.Context, rev, path string) ([]AnnotatedLine, error) {
+	if !j.caps.AnnotateTemplate {
+		return nil, j.caps.unsupported("file annotate -T")
+	}
+	if rev == "" {
+		rev = "@"
+	}
+	r, file, err := j.revisionAndPath(rev, path)
+	if err != nil {
+		return nil, err
+	}
+	out, err := j.runJJJSON(ctx, "file", "annotate", "-r", r, "-T", jjAnnotateTemplate, file)
+	if err != nil {
+		return nil, err
+	}
+	var lines []AnnotatedLine
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var l jjAnnotatedLine
+		if err := dec.Decode(&l); err != nil {
+			if errors.Is(err, io.EOF) {
+				return lines, nil
+			}
+			return nil, &CommandError{VCS: VCSTypeJujutsu, Command: "file annotate", Stderr: err.Error(), Err: ErrCommandFailed}
+		}
+		t, _ := time.Parse(time.RFC3339, l.Time)
+		lines = append(lines, AnnotatedLine{
+			Line:     l.Line,
+			Text:     strings.TrimSuffix(strings.TrimSuffix(l.Text, "\n"), "\r"),
+			ChangeID: l.ChangeID,
+			CommitID: l.CommitID,
+			Author:   l.Author,
+			Time:     t,
+		})
+	}
+}
+
+// --- git ---
+
+// Evolog follows changeID back through the HEAD reflog: while the entry
+// that produced a commit is "commit (amend)", the entry before it holds the
+// commit it replaced. Rewrites by rebase aren't followed. A commit that was
+// never amended is its own only version.
+func (g *GitVCS) Evolog(ctx context.Context, changeID string) ([]ChangeInfo, error) {
+	commit, err := g.resolveCommit(ctx, changeID)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{commit}
+	// No reflog (e.g. core.logAllRefUpdates=false) means no recorded amends.
+	if out, err := g.runGit(ctx, "reflog", "show", "--format=%H%x1f%gs", "HEAD", "--"); err == nil {
+		ids = amendChain(out, commit)
+	}
+	changes, err := g.logChanges(ctx, append(append([]string{"--no-walk=unsorted", "--end-of-options"}, ids...), "--")...)
+	if err != nil {
+		return nil, err
+	}
+	return orderChanges(changes, ids), nil
+}
+
+// amendChain walks reflog records ("<hash>\x1f<subject>", newest first)
+// from commit's newest entry back through consecutive amends.
+func amendChain(reflog, commit string) []string {
+	chain := []string{commit}
+	entries := strings.Split(reflog, "\n")
+	i := 0
+	for ; i < len(entries); i++ {
+		if hash, _, _ := strings.Cut(entries[i], "\x1f"); hash == commit {
+			break
+		}
+	}
+	for ; i+1 < len(entries); i++ {
+		_, subject, _ := strings.Cut(entries[i], "\x1f")
+		if !strings.HasPrefix(subject, "commit (amend):") {
+			break
+		}
+		prev, _, _ := strings.Cut(entries[i+1], "\x1f")
+		if prev == chain[len(chain)-1] {
+			continue // an amend that changed nothing
+		}
+		chain = append(chain, prev)
+	}
+	return chain
+}
+
+// gitZeroID is the commit hash git blame gives uncommitted lines.
+const gitZeroID = "0000000000000000000000000000000000000000"
+
+// Annotate runs git blame --porcelain. Without rev, the working tree is
+// annotated and uncommitted lines have an empty ChangeID.
+func (g *GitVCS) Annotate(ctx context.Context, rev, path string) ([]AnnotatedLine, error) {
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	args := []string{"blame", "--porcelain"}
+	if rev != "" {
+		if err := validateGitRevision(rev); err != nil {
+			return nil, err
+		}
+		args = append(args, rev) // git blame rejects --end-of-options
+	}
+	out, err := g.runGitRaw(ctx, append(args, "--", path)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlamePorcelain(out)
+}
+
+// parseBlamePorcelain decodes git blame --porcelain output. Each line is
+// introduced by "<hash> <orig line> <final line> [<group size>]"; commit
+// headers follow the first line from each commit only.
+func parseBlamePorcelain(out string) ([]AnnotatedLine, error) {
+	type blameCommit struct {
+		author string
+		time   time.Time
+	}
+	commits := make(map[string]*blameCommit)
+	var lines []AnnotatedLine
+	var cur *AnnotatedLine
+	for _, row := range strings.Split(out, "\n") {
+		if text, ok := strings.CutPrefix(row, "\t"); ok {
+			if cur == nil {
+				return nil, fmt.Errorf("git blame: content line before header")
+			}
+			c := commits[cur.CommitID]
+			cur.Text, cur.Author, cur.Time = strings.TrimSuffix(text, "\r"), c.author, c.time
+			if cur.ChangeID == gitZeroID {
+				cur.ChangeID = ""
+			}
+			lines = append(lines, *cur)
+			cur = nil
+			continue
+		}
+		key, value, _ := strings.Cut(row, " ")
+		if cur == nil {
+			fields := strings.Fields(row)
+			if len(fields) < 3 || !gitObjectNameRe.MatchString(key) {
+				continue
+			}
+			n, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("git blame: bad header %q", row)
+			}
+			cur = &AnnotatedLine{Line: n, ChangeID: key, CommitID: key}
+			if commits[key] == nil {
+				commits[key] = &blameCommit{}
+			}
+			continue
+		}
+		c := commits[cur.CommitID]
+		switch key {
+		case "author":
+			c.author = value
+		case "author-time":
+			if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+				c.time = time.Unix(secs, 0).In(c.time.Location())
+			}
+		case "author-tz":
+			if t, err := time.Parse("-0700", value); err == nil {
+				c.time = c.time.In(t.Location())
+			}
+		}
+	}
+	return lines, nil
+}
+
+// --- hg ---
+
+// Evolog lists the changeset and, with obsolescence markers enabled, the
+// hidden changesets it was rewritten from.
+func (h *MercurialVCS) Evolog(ctx context.Context, changeID string) ([]ChangeInfo, error) {
+	rev, err := hgRevision(changeID)
+	if err != nil {
+		return nil, err
+	}
+	revset := fmt.Sprintf("sort(%s + allpredecessors(%s), -rev)", rev, rev)
+	out, err := h.runHg(ctx, "log", "--hidden", "-r", revset, "-T", hgLogTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return parseHgLog(out), nil
+}
+
+// hgAnnotation is one line of hg annotate -T json output.
+type hgAnnotation struct {
+	Node   string     `json:"node"`
+	User   string     `json:"user"`
+	Date   [2]float64 `json:"date"` // unix time, offset west of UTC in seconds
+	LineNo int        `json:"lineno"`
+	Line   string     `json:"line"`
+}
+
+// Annotate runs hg annotate -T json. Without rev, the working directory is
+// annotated; hg attributes uncommitted lines to the working directory's
+// parent with a "+" suffix, which is reported as an empty ChangeID.
+func (h *MercurialVCS) Annotate(ctx context.Context, rev, path string) ([]AnnotatedLine, error) {
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	args := []string{"annotate", "-T", "json", "--changeset", "--user", "--date", "--line-number"}
+	if rev != "" {
+		q, err := hgRevision(rev)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-r", q)
+	}
+	out, err := h.runHgRaw(ctx, append(args, "--", path)...)
+	if err != nil {
+		return nil, err
+	}
+	var files []struct {
+		Lines []hgAnnotation `json:"lines"`
+	}
+	if err := json.Unmarshal([]byte(out), &files); err != nil {
+		return nil, &CommandError{VCS: h.vcsType, Command: "annotate", Stderr: err.Error(), Err: ErrCommandFailed}
+	}
+	var lines []AnnotatedLine
+	for _, f := range files {
+		for i, a := range f.Lines {
+			id := a.Node
+			if strings.HasSuffix(id, "+") {
+				id = ""
+			}
+			zone := time.FixedZone("", -int(a.Date[1]))
+			lines = append(lines, AnnotatedLine{
+				Line:     i + 1,
+				Text:     strings.TrimSuffix(strings.TrimSuffix(a.Line, "\n"), "\r"),
+				ChangeID: id,
+				CommitID: id,
+				Author:   a.User,
+				Time:     time.Unix(int64(a.Date[0]), 0).In(zone),
+			})
+		}
+	}
+	return lines, nil
+}
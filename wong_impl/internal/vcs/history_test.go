@@ -0,0 +1,176 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAmendChain(t *testing.T) {
+	reflog := strings.Join([]string{
+		"ddd\x1fcommit: next",
+		"ccc\x1fcommit (amend): fix typo",
+		"ccc\x1fcommit (amend): no-op",
+		"bbb\x1fcommit (amend): more",
+		"aaa\x1fcommit: first",
+		"000\x1fcommit (initial): root",
+	}, "\n")
+	if got := strings.Join(amendChain(reflog, "ccc"), " "); got != "ccc bbb aaa" {
+		t.Errorf("amendChain(ccc) = %q", got)
+	}
+	if got := strings.Join(amendChain(reflog, "ddd"), " "); got != "ddd" {
+		t.Errorf("amendChain(ddd) = %q", got)
+	}
+	if got := strings.Join(amendChain(reflog, "zzz"), " "); got != "zzz" {
+		t.Errorf("amendChain(missing) = %q", got)
+	}
+}
+
+func TestParseBlamePorcelain(t *testing.T) {
+	a := strings.Repeat("a", 40)
+	out := strings.Join([]string{
+		a + " 1 1 2",
+		"author Ann",
+		"author-mail <ann@example.com>",
+		"author-time 1700000000",
+		"author-tz +0200",
+		"summary first",
+		"filename f.txt",
+		"\tone",
+		a + " 2 2",
+		"\ttwo",
+		gitZeroID + " 3 3 1",
+		"author Not Committed Yet",
+		"author-time 1700000100",
+		"author-tz +0000",
+		"\tthree",
+		"",
+	}, "\n")
+	lines, err := parseBlamePorcelain(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines: %+v", len(lines), lines)
+	}
+	if l := lines[1]; l.Line != 2 || l.Text != "two" || l.ChangeID != a || l.Author != "Ann" {
+		t.Errorf("line 2 = %+v", l)
+	}
+	if _, off := lines[0].Time.Zone(); off != 2*3600 || !lines[0].Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("line 1 time = %v", lines[0].Time)
+	}
+	if l := lines[2]; l.ChangeID != "" || l.CommitID != gitZeroID || l.Text != "three" {
+		t.Errorf("uncommitted line = %+v", l)
+	}
+}
+
+func TestGitVCS_EvologAndAnnotate(t *testing.T) {
+	h := NewTestHelper(t)
+	repo := h.CreateGitRepo("history")
+	h.WriteFile(repo, "f.txt", "one\ntwo\n")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-q", "-m", "first")
+	first := gitOut(h, repo, "rev-parse", "HEAD")
+	h.WriteFile(repo, "f.txt", "one\ntwo!\n")
+	h.runCmd(repo, "git", "commit", "-q", "-a", "--amend", "-m", "first")
+	amended := gitOut(h, repo, "rev-parse", "HEAD")
+	h.WriteFile(repo, "f.txt", "one\ntwo!\nthree\n")
+	h.runCmd(repo, "git", "commit", "-q", "-am", "second")
+	second := gitOut(h, repo, "rev-parse", "HEAD")
+
+	g, err := NewGitVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	versions, err := g.Evolog(ctx, "HEAD~1")
+	if err != nil {
+		t.Fatalf("Evolog: %v", err)
+	}
+	if len(versions) != 2 || versions[0].ID != amended || versions[1].ID != first {
+		t.Errorf("Evolog = %+v; want [%s %s]", versions, amended, first)
+	}
+	if versions, err := g.Evolog(ctx, "HEAD"); err != nil || len(versions) != 1 || versions[0].ID != second {
+		t.Errorf("Evolog(HEAD) = %+v, %v", versions, err)
+	}
+
+	lines, err := g.Annotate(ctx, "HEAD", "f.txt")
+	if err != nil {
+		t.Fatalf("Annotate: %v", err)
+	}
+	var got []string
+	for _, l := range lines {
+		got = append(got, l.Text+"@"+l.ChangeID)
+	}
+	if want := []string{"one@" + amended, "two!@" + amended, "three@" + second}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Annotate = %v; want %v", got, want)
+	}
+
+	// The working tree is annotated when rev is empty.
+	h.WriteFile(repo, "f.txt", "zero\none\ntwo!\nthree\n")
+	lines, err = g.Annotate(ctx, "", "f.txt")
+	if err != nil {
+		t.Fatalf("Annotate(working tree): %v", err)
+	}
+	if len(lines) != 4 || lines[0].ChangeID != "" || lines[1].ChangeID != amended {
+		t.Errorf("Annotate(working tree) = %+v", lines)
+	}
+
+	if _, err := g.Annotate(ctx, "--output=x", "f.txt"); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("Annotate accepted an option as a revision: %v", err)
+	}
+}
+
+func TestJujutsuVCS_AnnotateUnsupported(t *testing.T) {
+	repo, _ := stubJJ(t, "0.23.0")
+	j, err := NewJujutsuVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.Annotate(context.Background(), "@", "f.txt"); !errors.Is(err, ErrUnsupportedJJVersion) {
+		t.Errorf("Annotate on 0.23 = %v; want ErrUnsupportedJJVersion", err)
+	}
+}
+
+func TestJujutsuVCS_EvologAndAnnotate(t *testing.T) {
+	if _, err := exec.LookPath("jj"); err != nil {
+		t.Skip("jj not installed")
+	}
+	h := NewTestHelper(t)
+	repo := h.CreateJJRepo("history")
+	j, err := NewJujutsuVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	h.WriteFile(repo, "f.txt", "one\n")
+	h.runCmd(repo, "jj", "describe", "-m", "first")
+	h.WriteFile(repo, "f.txt", "one\ntwo\n")
+	h.runCmd(repo, "jj", "new", "-m", "second")
+
+	first, err := j.changeID(ctx, "@-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := j.Evolog(ctx, first)
+	if err != nil {
+		t.Fatalf("Evolog: %v", err)
+	}
+	if len(versions) < 2 {
+		t.Errorf("Evolog = %+v; want several versions", versions)
+	}
+
+	if !j.Capabilities().AnnotateTemplate {
+		return
+	}
+	lines, err := j.Annotate(ctx, "@-", "f.txt")
+	if err != nil {
+		t.Fatalf("Annotate: %v", err)
+	}
+	if len(lines) != 2 || lines[1].Text != "two" || lines[1].ChangeID != first {
+		t.Errorf("Annotate = %+v", lines)
+	}
+}
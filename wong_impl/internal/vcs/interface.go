@@ -1,20 +1,25 @@
 // Package vcs provides an abstraction layer for version control systems.
-// It supports both Git and Jujutsu (jj) backends, allowing beads to work
-// seamlessly with either VCS.
+// It supports Git and Jujutsu (jj) backends, plus Mercurial/Sapling and an
+// in-memory fake, allowing beads to work seamlessly with any of them.
+// Backends are pluggable; see RegisterBackend.
 package vcs
 
 import (
 	"context"
 	"os/exec"
+	"time"
 )
 
 // VCSType identifies the version control system in use.
 type VCSType string
 
 const (
-	VCSTypeGit     VCSType = "git"
-	VCSTypeJujutsu VCSType = "jj"
-	VCSTypeUnknown VCSType = "unknown"
+	VCSTypeGit       VCSType = "git"
+	VCSTypeJujutsu   VCSType = "jj"
+	VCSTypeMercurial VCSType = "hg"
+	VCSTypeSapling   VCSType = "sl"
+	VCSTypeFake      VCSType = "fake"
+	VCSTypeUnknown   VCSType = "unknown"
 )
 
 // FileStatus represents the status of a file in the working copy.
@@ -41,6 +46,12 @@ type StatusEntry struct {
 	Conflicted bool
 }
 
+// StatusOptions selects the optional entries StatusWithOptions reports.
+type StatusOptions struct {
+	Untracked bool // Files that are neither tracked nor ignored
+	Ignored   bool // Files excluded by ignore rules
+}
+
 // BranchInfo represents information about a branch or bookmark.
 type BranchInfo struct {
 	Name       string
@@ -53,10 +64,34 @@ type BranchInfo struct {
 type ChangeInfo struct {
 	ID          string // Commit hash (git) or change ID (jj)
 	ShortID     string // Short form of ID
-	Description string
+	Description string // First line of the description
 	Author      string
 	Timestamp   string
 	IsWorking   bool // True if this is the working copy (@ in jj)
+
+	CommitID        string    // Commit hash (equal to ID for git)
+	Parents         []string  // Parent commit hashes
+	Bookmarks       []string  // Local bookmarks (jj) or branches (git) pointing here
+	Tags            []string  // Tags pointing here
+	FullDescription string    // Complete description, including the body
+	AuthorEmail     string    // Author email address
+	CommitterEmail  string    // Committer email address
+	Time            time.Time // Author timestamp
+	IsEmpty         bool      // The change doesn't modify any files
+	IsConflicted    bool      // The change has unresolved conflicts (jj only)
+	IsImmutable     bool      // The change is in immutable_heads() (jj only)
+	IsDivergent     bool      // The change ID has several visible commits (jj only)
+}
+
+// AnnotatedLine is one line of a file attributed to the change that last
+// modified it.
+type AnnotatedLine struct {
+	Line     int    // 1-based line number in the annotated revision
+	Text     string // Line content without the trailing newline
+	ChangeID string // Change ID (jj) or commit hash (git); empty if uncommitted
+	CommitID string
+	Author   string
+	Time     time.Time // Author timestamp
 }
 
 // WorkspaceInfo represents a workspace (jj) or worktree (git).
@@ -105,6 +140,11 @@ type VCS interface {
 	// StatusPath returns the status of a specific path.
 	StatusPath(ctx context.Context, path string) (*StatusEntry, error)
 
+	// StatusWithOptions returns the working copy status. Tracked changes
+	// and conflicts are always included; untracked and ignored files only
+	// when opts asks for them. Status is StatusWithOptions with Untracked.
+	StatusWithOptions(ctx context.Context, opts *StatusOptions) ([]StatusEntry, error)
+
 	// HasRemote returns true if a remote is configured.
 	HasRemote(ctx context.Context) (bool, error)
 
@@ -182,6 +222,26 @@ type VCS interface {
 	// Diff returns the diff between two revisions.
 	Diff(ctx context.Context, from, to string) (string, error)
 
+	// DiffStructured returns the diff between two revisions, limited to
+	// paths if any are given, parsed into per-file hunks and stats. Empty
+	// from and to mean the same as for Diff.
+	DiffStructured(ctx context.Context, from, to string, paths []string) (*DiffResult, error)
+
+	// Query returns the changes matching a jj-style revset, newest first.
+	// For jj: passed through to jj log -r. For git and the in-memory
+	// backends: the subset documented on EvalRevset. For hg: hg revset
+	// syntax, passed through to hg log -r.
+	Query(ctx context.Context, revset string) ([]ChangeInfo, error)
+
+	// Evolog returns the successive versions of a change, newest first,
+	// starting with its current version. For jj: jj evolog. For git: the
+	// chain of amends recorded in the HEAD reflog.
+	Evolog(ctx context.Context, changeID string) ([]ChangeInfo, error)
+
+	// Annotate attributes each line of path at rev (the working copy if
+	// empty) to the change that last modified it. For git: git blame.
+	Annotate(ctx context.Context, rev, path string) ([]AnnotatedLine, error)
+
 	// --- JJ-Specific Stacked Changes ---
 
 	// These methods support jj's unique stacked changes model.
@@ -431,28 +491,25 @@ func DetectVCS(path string) (VCS, error) {
 	return detector.Create(path)
 }
 
-// DefaultDetector implements Detector with standard detection logic.
+// DefaultDetector implements Detector using the registered backends.
 type DefaultDetector struct{}
 
-// Detect checks for .jj first (jj), then .git (git), preferring jj in colocated repos.
+// Detect probes the registered backends from path upwards, preferring jj over
+// git in colocated repos.
 func (d *DefaultDetector) Detect(path string) (VCSType, error) {
 	// Implementation in detect.go
 	return detectVCSType(path)
 }
 
-// Create returns a VCS instance for the given path.
+// Create returns a VCS instance for the given path from the backend that
+// detected it.
 func (d *DefaultDetector) Create(path string) (VCS, error) {
-	vcsType, err := d.Detect(path)
+	_, b, err := detectBackend(path)
 	if err != nil {
 		return nil, err
 	}
-
-	switch vcsType {
-	case VCSTypeJujutsu:
-		return NewJujutsuVCS(path)
-	case VCSTypeGit:
-		return NewGitVCS(path)
-	default:
+	if b.New == nil {
 		return nil, ErrNoVCSFound
 	}
+	return b.New(path)
 }
@@ -0,0 +1,231 @@
+package vcs
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JJVersion is a jj release number. The zero value means the version is
+// unknown, which is treated as the newest dialect.
+type JJVersion struct {
+	Major, Minor, Patch int
+}
+
+// MinJJVersion is the oldest jj release JujutsuVCS supports. Structured log
+// output needs escape_json() in templates, which arrived in 0.22 along with
+// the rename of branches to bookmarks.
+var MinJJVersion = JJVersion{0, 22, 0}
+
+// String returns the version as "major.minor.patch", or "unknown".
+func (v JJVersion) String() string {
+	if v.IsZero() {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// IsZero reports whether the version is unknown.
+func (v JJVersion) IsZero() bool {
+	return v == JJVersion{}
+}
+
+// AtLeast reports whether v is major.minor.0 or newer. An unknown version is
+// newer than everything.
+func (v JJVersion) AtLeast(major, minor int) bool {
+	if v.IsZero() {
+		return true
+	}
+	if v.Major != major {
+		return v.Major > major
+	}
+	return v.Minor >= minor
+}
+
+// jjVersionRe matches the first line of `jj --version`, e.g. "jj 0.23.0" or
+// "jj 0.28.0-8a3c16ba4f3e7a8e23ac9e3bde5c0a5a2b1b7f2d" for source builds.
+var jjVersionRe = regexp.MustCompile(`^jj (\d+)\.(\d+)\.(\d+)`)
+
+// ParseJJVersion parses the output of `jj --version`.
+func ParseJJVersion(output string) (JJVersion, error) {
+	m := jjVersionRe.FindStringSubmatch(strings.TrimSpace(output))
+	if m == nil {
+		return JJVersion{}, fmt.Errorf("unrecognized jj version output %q", output)
+	}
+	var v JJVersion
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	return v, nil
+}
+
+// JJCapabilities describes the parts of the jj CLI that changed between the
+// releases JujutsuVCS supports, MinJJVersion and newer. Each field names the
+// newer form; when it is false, callers use the older equivalent or return
+// ErrUnsupportedJJVersion.
+type JJCapabilities struct {
+	Version JJVersion
+
+	// PushAllowNew: `jj git push --allow-new`. Older releases push new
+	// bookmarks without it.
+	PushAllowNew bool
+
+	// ChangeIDRevset: the change_id() revset function. Older releases
+	// resolve change IDs as plain symbols.
+	ChangeIDRevset bool
+
+	// Absorb: `jj absorb`.
+	Absorb bool
+
+	// EvologEntry: evolog templates render a CommitEvolutionEntry, whose
+	// commit is reached with commit. Older releases render the Commit.
+	EvologEntry bool
+
+	// AnnotateTemplate: `jj file annotate -T` with AnnotationLine templates.
+	AnnotateTemplate bool
+}
+
+// JJCapabilitiesFor returns the capability table for a jj release.
+func JJCapabilitiesFor(v JJVersion) JJCapabilities {
+	return JJCapabilities{
+		Version:          v,
+		PushAllowNew:     v.AtLeast(0, 24),
+		ChangeIDRevset:   v.AtLeast(0, 27),
+		Absorb:           v.AtLeast(0, 23),
+		EvologEntry:      v.AtLeast(0, 30),
+		AnnotateTemplate: v.AtLeast(0, 27),
+	}
+}
+
+// unsupported returns an ErrUnsupportedJJVersion error for a feature the
+// release lacks.
+func (c JJCapabilities) unsupported(feature string) error {
+	return fmt.Errorf("%w: jj %s does not support %s", ErrUnsupportedJJVersion, c.Version, feature)
+}
+
+// ProbeJJVersion runs `jj --version` using the given binary.
+func ProbeJJVersion(ctx context.Context, jjBin string) (JJVersion, error) {
+	return probeJJVersion(ctx, DefaultRunner, jjBin)
+}
+
+// probeJJVersion is ProbeJJVersion through r.
+func probeJJVersion(ctx context.Context, r *Runner, jjBin string) (JJVersion, error) {
+	res, err := r.Run(ctx, Invocation{Bin: jjBin, Args: []string{"--version"}})
+	if err != nil {
+		return JJVersion{}, &CommandError{VCS: VCSTypeJujutsu, Command: "jj", Args: []string{"--version"}, Stderr: string(res.Stderr), Err: err}
+	}
+	return ParseJJVersion(string(res.Stdout))
+}
+
+// jjCapabilityCache holds probed capabilities by resolved binary path.
+var jjCapabilityCache sync.Map
+
+// ProbeJJCapabilities probes jjBin once per process and returns its
+// capabilities. If the binary can't be run or its version isn't recognized,
+// the newest dialect is assumed. Releases older than MinJJVersion return
+// ErrUnsupportedJJVersion.
+func ProbeJJCapabilities(ctx context.Context, jjBin string) (JJCapabilities, error) {
+	key := jjBin
+	if path, err := exec.LookPath(jjBin); err == nil {
+		key = path
+	}
+	if c, ok := jjCapabilityCache.Load(key); ok {
+		return c.(JJCapabilities), checkJJVersion(c.(JJCapabilities).Version)
+	}
+	caps, err := probeJJCapabilities(ctx, DefaultRunner, jjBin)
+	if caps.Version.IsZero() {
+		return caps, err
+	}
+	jjCapabilityCache.Store(key, caps)
+	return caps, err
+}
+
+// ProbeJJCapabilitiesWithRunner is ProbeJJCapabilities with the version
+// probe going through r. A nil r means DefaultRunner and shares its cache;
+// other runners may record or replay, so their results aren't cached.
+func ProbeJJCapabilitiesWithRunner(ctx context.Context, r *Runner, jjBin string) (JJCapabilities, error) {
+	if r == nil {
+		return ProbeJJCapabilities(ctx, jjBin)
+	}
+	return probeJJCapabilities(ctx, r, jjBin)
+}
+
+// probeJJCapabilities probes jjBin through r without caching, for runners
+// that record or replay.
+func probeJJCapabilities(ctx context.Context, r *Runner, jjBin string) (JJCapabilities, error) {
+	v, err := probeJJVersion(ctx, r, jjBin)
+	if err != nil {
+		v = JJVersion{}
+	}
+	return JJCapabilitiesFor(v), checkJJVersion(v)
+}
+
+// checkJJVersion returns ErrUnsupportedJJVersion for releases older than
+// MinJJVersion.
+func checkJJVersion(v JJVersion) error {
+	if v.AtLeast(MinJJVersion.Major, MinJJVersion.Minor) {
+		return nil
+	}
+	return fmt.Errorf("%w: jj %s is older than %s", ErrUnsupportedJJVersion, v, MinJJVersion)
+}
+
+// Revision turns a caller-supplied revision into a revset that denotes
+// exactly that revision on this release, for packages that build jj command
+// lines themselves. Change IDs become change_id("...") where it exists and
+// quoted symbols otherwise, which jj also resolves as change IDs; anything
+// else is quoted as described for jjRevision.
+func (c JJCapabilities) Revision(rev string) (string, error) {
+	q, err := jjRevision(rev)
+	if err != nil || c.ChangeIDRevset {
+		return q, err
+	}
+	if inner, ok := strings.CutPrefix(q, "change_id("); ok {
+		return strings.TrimSuffix(inner, ")"), nil
+	}
+	return q, nil
+}
+
+// revision is Revision for this release.
+func (j *JujutsuVCS) revision(rev string) (string, error) {
+	return j.caps.Revision(rev)
+}
+
+// revisions applies revision to each of revs.
+func (j *JujutsuVCS) revisions(revs ...string) ([]string, error) {
+	out := make([]string, len(revs))
+	for i, r := range revs {
+		q, err := j.revision(r)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = q
+	}
+	return out, nil
+}
+
+// revisionAndPath applies revision and jjPath for commands that take both.
+func (j *JujutsuVCS) revisionAndPath(rev, path string) (string, string, error) {
+	r, err := j.revision(rev)
+	if err != nil {
+		return "", "", err
+	}
+	p, err := jjPath(path)
+	if err != nil {
+		return "", "", err
+	}
+	return r, p, nil
+}
+
+// squashArgs returns the command moving the changes in from into into
+// (default @).
+func (j *JujutsuVCS) squashArgs(from, into string) []string {
+	args := []string{"squash", "--from", from}
+	if into != "" {
+		args = append(args, "--into", into)
+	}
+	return args
+}
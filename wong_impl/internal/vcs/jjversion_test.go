@@ -0,0 +1,166 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseJJVersion(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "jjversion", "*.txt"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no recorded jj --version outputs: %v", err)
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := ParseJJVersion(string(data))
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+		if want := strings.TrimSuffix(filepath.Base(f), ".txt"); v.String() != want {
+			t.Errorf("%s: parsed %s", f, v)
+		}
+	}
+
+	for _, bad := range []string{"", "jujutsu 1.0", "jj version unknown"} {
+		if _, err := ParseJJVersion(bad); err == nil {
+			t.Errorf("ParseJJVersion(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestJJCapabilitiesFor(t *testing.T) {
+	tests := []struct {
+		version  JJVersion
+		allowNew bool
+		changeID bool
+	}{
+		{JJVersion{0, 22, 0}, false, false},
+		{JJVersion{0, 24, 0}, true, false},
+		{JJVersion{0, 28, 2}, true, true},
+		{JJVersion{1, 0, 0}, true, true},
+		{JJVersion{}, true, true},
+	}
+	for _, tt := range tests {
+		c := JJCapabilitiesFor(tt.version)
+		if c.PushAllowNew != tt.allowNew {
+			t.Errorf("%s: PushAllowNew = %v", tt.version, c.PushAllowNew)
+		}
+		if c.ChangeIDRevset != tt.changeID {
+			t.Errorf("%s: ChangeIDRevset = %v", tt.version, c.ChangeIDRevset)
+		}
+	}
+	if err := checkJJVersion(JJVersion{0, 22, 0}); err != nil {
+		t.Errorf("checkJJVersion(MinJJVersion) = %v", err)
+	}
+	if err := checkJJVersion(JJVersion{0, 21, 0}); !errors.Is(err, ErrUnsupportedJJVersion) {
+		t.Errorf("checkJJVersion(0.21) = %v, want ErrUnsupportedJJVersion", err)
+	}
+}
+
+// stubJJ installs a jj on PATH that reports the recorded version and logs
+// every other invocation, one per line, to the returned file. If a file
+// named stdout.<first argument> exists next to the log, it is printed.
+func stubJJ(t *testing.T, version string) (repo, argsLog string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("stub jj is a shell script")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	repo = filepath.Join(dir, "repo")
+	argsLog = filepath.Join(dir, "args.log")
+	for _, d := range []string{bin, filepath.Join(repo, ".jj")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorded, err := filepath.Abs(filepath.Join("testdata", "jjversion", version+".txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = --version ]; then cat '" + recorded + "'; exit 0; fi\n" +
+		"echo \"$*\" >> '" + argsLog + "'\n" +
+		"f='" + dir + "/stdout.'\"$1\"; if [ -f \"$f\" ]; then cat \"$f\"; fi\n"
+	if err := os.WriteFile(filepath.Join(bin, "jj"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return repo, argsLog
+}
+
+func TestJujutsuVCS_Dialects(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []string
+	}{
+		{"0.23.0", []string{
+			"bookmark create feat",
+			"git push --remote origin --bookmark exact:feat",
+			"file show -r \"main\" a.txt",
+			"squash --from \"qpvuntsmwlqt\"",
+			"log -r @ --no-graph -T separate(\" \", bookmarks)",
+		}},
+		{"0.28.2", []string{
+			"bookmark create feat",
+			"git push --remote origin --bookmark exact:feat",
+			"file show -r \"main\" a.txt",
+			"squash --from change_id(\"qpvuntsmwlqt\")",
+			"log -r @ --no-graph -T separate(\" \", bookmarks)",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			repo, argsLog := stubJJ(t, tt.version)
+			j, err := NewJujutsuVCS(repo)
+			if err != nil {
+				t.Fatalf("NewJujutsuVCS: %v", err)
+			}
+			if got := j.Capabilities().Version.String(); got != tt.version {
+				t.Errorf("Version = %s", got)
+			}
+			ctx := context.Background()
+			if err := j.CreateBranch(ctx, "feat"); err != nil {
+				t.Fatal(err)
+			}
+			if err := j.Push(ctx, "origin", "feat"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := j.ShowFile(ctx, "main", "a.txt"); err != nil {
+				t.Fatal(err)
+			}
+			if err := j.Squash(ctx, "qpvuntsmwlqt"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := j.SymbolicRef(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(argsLog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("invocations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestJujutsuVCS_UnsupportedVersion(t *testing.T) {
+	// Structured log output needs escape_json(), which 0.12 lacks.
+	repo, _ := stubJJ(t, "0.12.0")
+	if _, err := NewJujutsuVCS(repo); !errors.Is(err, ErrUnsupportedJJVersion) {
+		t.Errorf("NewJujutsuVCS with jj 0.12 = %v, want ErrUnsupportedJJVersion", err)
+	}
+}
@@ -1,9 +1,9 @@
 package vcs
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -16,23 +16,55 @@ import (
 type JujutsuVCS struct {
 	repoRoot    string
 	isColocated bool
+	caps        JJCapabilities
+
+	// globalArgs go before every command; a pinned read view sets
+	// --at-operation and --ignore-working-copy here.
+	globalArgs []string
+
+	// runner runs every jj and git command; nil means DefaultRunner.
+	runner *Runner
 }
 
-// NewJujutsuVCS creates a new Jujutsu VCS instance.
+// NewJujutsuVCS creates a new Jujutsu VCS instance. It probes the installed
+// jj and returns ErrUnsupportedJJVersion if it is older than MinJJVersion.
 func NewJujutsuVCS(path string) (*JujutsuVCS, error) {
+	return NewJujutsuVCSWithRunner(path, nil)
+}
+
+// NewJujutsuVCSWithRunner is NewJujutsuVCS with every command, including the
+// version probe, going through r. A nil r means DefaultRunner.
+func NewJujutsuVCSWithRunner(path string, r *Runner) (*JujutsuVCS, error) {
 	root, err := GetJJRoot(path)
 	if err != nil {
 		return nil, err
 	}
 
+	caps, err := ProbeJJCapabilitiesWithRunner(context.Background(), r, "jj")
+	if err != nil {
+		return nil, err
+	}
+
 	colocated, _ := IsColocatedRepo(root)
 
 	return &JujutsuVCS{
 		repoRoot:    root,
 		isColocated: colocated,
+		caps:        caps,
+		runner:      r,
 	}, nil
 }
 
+// SetRunner makes j run its commands through r.
+func (j *JujutsuVCS) SetRunner(r *Runner) {
+	j.runner = r
+}
+
+// Capabilities returns what the installed jj release supports.
+func (j *JujutsuVCS) Capabilities() JJCapabilities {
+	return j.caps
+}
+
 // Type returns VCSTypeJujutsu.
 func (j *JujutsuVCS) Type() VCSType {
 	return VCSTypeJujutsu
@@ -50,52 +82,63 @@ func (j *JujutsuVCS) IsColocated() bool {
 
 // Command creates an exec.Cmd for running jj commands.
 func (j *JujutsuVCS) Command(ctx context.Context, args ...string) *exec.Cmd {
-	cmd := exec.CommandContext(ctx, "jj", args...)
-	cmd.Dir = j.repoRoot
-	cmd.Env = os.Environ()
-	return cmd
+	return j.invocation(args).Command(ctx)
 }
 
-// runJJ executes a jj command and returns stdout.
-func (j *JujutsuVCS) runJJ(ctx context.Context, args ...string) (string, error) {
-	cmd := j.Command(ctx, args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// invocation describes a jj command run from the repo root.
+func (j *JujutsuVCS) invocation(args []string) Invocation {
+	if len(j.globalArgs) > 0 {
+		args = append(append([]string{}, j.globalArgs...), args...)
+	}
+	return Invocation{Bin: "jj", Args: args, Dir: j.repoRoot}
+}
 
-	err := cmd.Run()
+// run executes inv through j's runner and wraps a failure in a CommandError
+// that reports args.
+func (j *JujutsuVCS) run(ctx context.Context, vcsType VCSType, inv Invocation, args []string) (Result, error) {
+	res, err := j.runner.Run(ctx, inv)
 	if err != nil {
-		return "", &CommandError{
-			VCS:     VCSTypeJujutsu,
-			Command: "jj",
+		return res, &CommandError{
+			VCS:     vcsType,
+			Command: inv.Bin,
 			Args:    args,
-			Stderr:  stderr.String(),
+			Stderr:  string(res.Stderr),
 			Err:     err,
 		}
 	}
-	return strings.TrimSpace(stdout.String()), nil
+	return res, nil
+}
+
+// runJJ executes a jj command and returns stdout.
+func (j *JujutsuVCS) runJJ(ctx context.Context, args ...string) (string, error) {
+	res, err := j.run(ctx, VCSTypeJujutsu, j.invocation(args), args)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(res.Stdout)), nil
+}
+
+// runJJEnv is runJJ with extra environment variables. It also returns
+// stderr, where rewriting commands report what they did.
+func (j *JujutsuVCS) runJJEnv(ctx context.Context, env []string, args ...string) (string, string, error) {
+	inv := j.invocation(args)
+	inv.Env = env
+	res, err := j.run(ctx, VCSTypeJujutsu, inv, args)
+	if err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(string(res.Stdout)), string(res.Stderr), nil
 }
 
 // runJJJSON executes a jj command with JSON output and returns parsed result.
 func (j *JujutsuVCS) runJJJSON(ctx context.Context, args ...string) ([]byte, error) {
 	// Add --color=never to prevent color codes in output
 	fullArgs := append([]string{"--color=never"}, args...)
-	cmd := j.Command(ctx, fullArgs...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
-	if err != nil {
-		return nil, &CommandError{
-			VCS:     VCSTypeJujutsu,
-			Command: "jj",
-			Args:    fullArgs,
-			Stderr:  stderr.String(),
-			Err:     err,
-		}
+	res, err := j.run(ctx, VCSTypeJujutsu, j.invocation(fullArgs), fullArgs)
+	if err != nil {
+		return nil, err
 	}
-	return stdout.Bytes(), nil
+	return res.Stdout, nil
 }
 
 // CurrentBranch returns the current change ID (@ in jj).
@@ -111,26 +154,7 @@ func (j *JujutsuVCS) CurrentBranch(ctx context.Context) (string, error) {
 
 // CurrentChange returns info about the current change (@).
 func (j *JujutsuVCS) CurrentChange(ctx context.Context) (*ChangeInfo, error) {
-	// Get change info using templates
-	template := `change_id ++ "\n" ++ change_id.short() ++ "\n" ++ description.first_line() ++ "\n" ++ author.name() ++ "\n" ++ author.timestamp()`
-	output, err := j.runJJ(ctx, "log", "-r", "@", "--no-graph", "-T", template)
-	if err != nil {
-		return nil, err
-	}
-
-	lines := strings.Split(output, "\n")
-	if len(lines) < 5 {
-		return nil, &CommandError{VCS: VCSTypeJujutsu, Command: "log", Err: ErrCommandFailed}
-	}
-
-	return &ChangeInfo{
-		ID:          lines[0],
-		ShortID:     lines[1],
-		Description: lines[2],
-		Author:      lines[3],
-		Timestamp:   lines[4],
-		IsWorking:   true, // @ is always the working copy
-	}, nil
+	return j.showChange(ctx, "@")
 }
 
 // jjStatusEntry represents a file status entry from jj status.
@@ -139,101 +163,131 @@ type jjStatusEntry struct {
 	Status string `json:"status"`
 }
 
-// Status returns the working copy status.
+// Status returns the working copy status, including untracked files.
 func (j *JujutsuVCS) Status(ctx context.Context) ([]StatusEntry, error) {
-	// jj status shows file changes - use diff for more detail
-	output, err := j.runJJ(ctx, "diff", "--summary")
+	return j.StatusWithOptions(ctx, &StatusOptions{Untracked: true})
+}
+
+// StatusWithOptions combines jj diff --summary with the conflicts from jj
+// resolve --list. Untracked paths come from jj status; ignored files from
+// git ls-files against the backing git repository, since jj can't list
+// them.
+func (j *JujutsuVCS) StatusWithOptions(ctx context.Context, opts *StatusOptions) ([]StatusEntry, error) {
+	if opts == nil {
+		opts = &StatusOptions{}
+	}
+	entries, err := j.status(ctx)
 	if err != nil {
 		return nil, err
 	}
-
-	if output == "" {
-		return []StatusEntry{}, nil
-	}
-
-	var entries []StatusEntry
-	for _, line := range strings.Split(output, "\n") {
-		if line == "" {
-			continue
+	if opts.Untracked {
+		out, err := j.runJJ(ctx, "--color=never", "status")
+		if err != nil {
+			return nil, err
 		}
-
-		// jj diff --summary format: "M path" or "A path" or "D path"
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) < 2 {
-			continue
+		entries = append(entries, untrackedEntries(parseJJUntracked(out), FileStatusUntracked)...)
+	}
+	if opts.Ignored {
+		ignored, err := j.ignoredFiles(ctx)
+		if err != nil {
+			return nil, err
 		}
+		entries = append(entries, untrackedEntries(ignored, FileStatusIgnored)...)
+	}
+	return finishStatus(entries, nil), nil
+}
 
-		statusChar := parts[0]
-		path := strings.TrimSpace(parts[1])
+// status returns the tracked changes and conflicts, limited to filesets if
+// any are given.
+func (j *JujutsuVCS) status(ctx context.Context, filesets ...string) ([]StatusEntry, error) {
+	output, err := j.runJJ(ctx, append([]string{"diff", "--summary"}, filesets...)...)
+	if err != nil {
+		return nil, err
+	}
+	conflicted, err := j.conflictedPaths(ctx, filesets...)
+	if err != nil {
+		return nil, err
+	}
+	return finishStatus(parseJJSummary(output), conflicted), nil
+}
 
-		entry := StatusEntry{
-			Path:   path,
-			Staged: true, // jj auto-snapshots everything
+// conflictedPaths lists the working copy's conflicted files. jj resolve
+// --list fails when there are none.
+func (j *JujutsuVCS) conflictedPaths(ctx context.Context, filesets ...string) ([]string, error) {
+	out, err := j.runJJ(ctx, append([]string{"resolve", "--list"}, filesets...)...)
+	if err != nil {
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && strings.Contains(cmdErr.Stderr, "No conflicts") {
+			return nil, nil
 		}
+		return nil, err
+	}
+	return parseJJConflicts(out), nil
+}
 
-		switch statusChar {
-		case "M":
-			entry.Status = FileStatusModified
-		case "A":
-			entry.Status = FileStatusAdded
-		case "D":
-			entry.Status = FileStatusDeleted
-		case "R":
-			entry.Status = FileStatusRenamed
-		case "C":
-			entry.Status = FileStatusCopied
-		default:
-			entry.Status = FileStatusModified
+// gitDir returns the git repository backing the jj repo: .jj/repo/store
+// names it in git_target, and .jj/repo is itself a pointer file in
+// secondary workspaces.
+func (j *JujutsuVCS) gitDir() (string, error) {
+	jjDir := filepath.Join(j.repoRoot, ".jj")
+	repoDir := filepath.Join(jjDir, "repo")
+	if data, err := os.ReadFile(repoDir); err == nil {
+		repoDir = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(repoDir) {
+			repoDir = filepath.Join(jjDir, repoDir)
 		}
-
-		entries = append(entries, entry)
 	}
+	store := filepath.Join(repoDir, "store")
+	target, err := os.ReadFile(filepath.Join(store, "git_target"))
+	if err != nil {
+		return "", fmt.Errorf("jj repo has no git backend: %w", ErrNotSupported)
+	}
+	dir := strings.TrimSpace(string(target))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(store, dir)
+	}
+	return dir, nil
+}
 
-	return entries, nil
+// ignoredFiles lists files in the workspace excluded by .gitignore and the
+// git repository's excludes, which is what jj honours.
+func (j *JujutsuVCS) ignoredFiles(ctx context.Context) ([]string, error) {
+	gitDir, err := j.gitDir()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"--git-dir=" + gitDir, "--work-tree=" + j.repoRoot,
+		"ls-files", "-z", "--others", "--ignored", "--exclude-standard"}
+	res, err := j.run(ctx, VCSTypeGit, Invocation{Bin: "git", Args: args, Dir: j.repoRoot}, args)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range splitNul(string(res.Stdout)) {
+		if f != ".jj" && !strings.HasPrefix(f, ".jj/") && f != ".git" && !strings.HasPrefix(f, ".git/") {
+			files = append(files, f)
+		}
+	}
+	return files, nil
 }
 
 // StatusPath returns the status of a specific path.
 func (j *JujutsuVCS) StatusPath(ctx context.Context, path string) (*StatusEntry, error) {
-	output, err := j.runJJ(ctx, "diff", "--summary", path)
+	file, err := jjPath(path)
 	if err != nil {
-		// Path might not exist or no changes
-		return &StatusEntry{
-			Path:   path,
-			Status: FileStatusUnmodified,
-		}, nil
+		return nil, err
 	}
-
-	if strings.TrimSpace(output) == "" {
+	entries, err := j.status(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
 		return &StatusEntry{
 			Path:   path,
 			Status: FileStatusUnmodified,
 		}, nil
 	}
-
-	// Parse first line
-	line := strings.Split(output, "\n")[0]
-	parts := strings.SplitN(line, " ", 2)
-	if len(parts) < 2 {
-		return &StatusEntry{Path: path, Status: FileStatusUnmodified}, nil
-	}
-
-	entry := &StatusEntry{
-		Path:   path,
-		Staged: true,
-	}
-
-	switch parts[0] {
-	case "M":
-		entry.Status = FileStatusModified
-	case "A":
-		entry.Status = FileStatusAdded
-	case "D":
-		entry.Status = FileStatusDeleted
-	default:
-		entry.Status = FileStatusModified
-	}
-
-	return entry, nil
+	return &entries[0], nil
 }
 
 // HasRemote returns true if a remote is configured.
@@ -286,11 +340,15 @@ func (j *JujutsuVCS) Stage(ctx context.Context, paths ...string) error {
 
 	// Check if any paths are untracked and need tracking
 	for _, path := range paths {
+		file, err := jjPath(path)
+		if err != nil {
+			return err
+		}
 		fullPath := filepath.Join(j.repoRoot, path)
 		if _, err := os.Stat(fullPath); err == nil {
 			// File exists, jj will auto-snapshot it
 			// Use file track to ensure it's tracked
-			j.runJJ(ctx, "file", "track", path)
+			j.runJJ(ctx, "file", "track", file)
 		}
 	}
 	return nil
@@ -314,10 +372,17 @@ func (j *JujutsuVCS) Commit(ctx context.Context, message string, opts *CommitOpt
 func (j *JujutsuVCS) Fetch(ctx context.Context, remote, branch string) error {
 	args := []string{"git", "fetch"}
 	if remote != "" {
+		if err := validateArg("remote", remote); err != nil {
+			return err
+		}
 		args = append(args, "--remote", remote)
 	}
 	if branch != "" {
-		args = append(args, "--branch", branch)
+		pattern, err := jjBookmarkPattern(branch)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--branch", pattern)
 	}
 	_, err := j.runJJ(ctx, args...)
 	return err
@@ -333,10 +398,17 @@ func (j *JujutsuVCS) Pull(ctx context.Context, remote, branch string) error {
 func (j *JujutsuVCS) Push(ctx context.Context, remote, branch string) error {
 	args := []string{"git", "push"}
 	if remote != "" {
+		if err := validateArg("remote", remote); err != nil {
+			return err
+		}
 		args = append(args, "--remote", remote)
 	}
 	if branch != "" {
-		args = append(args, "--bookmark", branch)
+		pattern, err := jjBookmarkPattern(branch)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--bookmark", pattern)
 	}
 	_, err := j.runJJ(ctx, args...)
 	return err
@@ -380,14 +452,28 @@ func (j *JujutsuVCS) ListBranches(ctx context.Context) ([]BranchInfo, error) {
 
 // CreateBranch creates a new bookmark.
 func (j *JujutsuVCS) CreateBranch(ctx context.Context, name string) error {
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
 	_, err := j.runJJ(ctx, "bookmark", "create", name)
 	return err
 }
 
 // SwitchBranch edits a change that has the given bookmark.
 func (j *JujutsuVCS) SwitchBranch(ctx context.Context, name string) error {
-	// First try to find the change with this bookmark
-	_, err := j.runJJ(ctx, "edit", name)
+	rev, err := jjBookmarkRevset(name)
+	if err != nil {
+		return err
+	}
+	if plan := PlanFromContext(ctx); plan != nil {
+		if err := j.planChanges(ctx, plan, rev); err != nil {
+			return err
+		}
+		if err := j.planDiff(ctx, plan, "@", rev); err != nil {
+			return err
+		}
+	}
+	_, err = j.runJJ(ctx, "edit", rev)
 	return err
 }
 
@@ -431,13 +517,22 @@ func (j *JujutsuVCS) ListWorkspaces(ctx context.Context) ([]WorkspaceInfo, error
 
 // CreateWorkspace creates a new jj workspace.
 func (j *JujutsuVCS) CreateWorkspace(ctx context.Context, name, path string) error {
-	_, err := j.runJJ(ctx, "workspace", "add", "--name", name, path)
+	if err := validateArg("workspace", name); err != nil {
+		return err
+	}
+	if err := validatePath(path); err != nil {
+		return err
+	}
+	_, err := j.runJJ(ctx, "workspace", "add", "--name", name, "--", path)
 	return err
 }
 
 // RemoveWorkspace removes a jj workspace.
 func (j *JujutsuVCS) RemoveWorkspace(ctx context.Context, name string) error {
-	_, err := j.runJJ(ctx, "workspace", "forget", name)
+	if err := validateArg("workspace", name); err != nil {
+		return err
+	}
+	_, err := j.runJJ(ctx, "workspace", "forget", "--", name)
 	return err
 }
 
@@ -454,18 +549,14 @@ func (j *JujutsuVCS) HasMergeConflicts(ctx context.Context) (bool, error) {
 // GetConflicts returns information about conflicts.
 func (j *JujutsuVCS) GetConflicts(ctx context.Context) ([]MergeConflict, error) {
 	// jj resolve --list shows conflicted files
-	output, err := j.runJJ(ctx, "resolve", "--list")
+	paths, err := j.conflictedPaths(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	var conflicts []MergeConflict
-	for _, line := range strings.Split(output, "\n") {
-		if line == "" {
-			continue
-		}
-		// Lines are just file paths
-		conflicts = append(conflicts, MergeConflict{Path: strings.TrimSpace(line)})
+	for _, p := range paths {
+		conflicts = append(conflicts, MergeConflict{Path: p})
 	}
 
 	return conflicts, nil
@@ -475,7 +566,11 @@ func (j *JujutsuVCS) GetConflicts(ctx context.Context) ([]MergeConflict, error)
 func (j *JujutsuVCS) GetFileVersion(ctx context.Context, path string, version string) ([]byte, error) {
 	// For jj, version is a revision specifier
 	// Use jj file show
-	output, err := j.runJJJSON(ctx, "file", "show", "-r", version, path)
+	rev, file, err := j.revisionAndPath(version, path)
+	if err != nil {
+		return nil, err
+	}
+	output, err := j.runJJJSON(ctx, "file", "show", "-r", rev, file)
 	if err != nil {
 		return nil, err
 	}
@@ -485,120 +580,99 @@ func (j *JujutsuVCS) GetFileVersion(ctx context.Context, path string, version st
 // MarkResolved marks a file as resolved.
 func (j *JujutsuVCS) MarkResolved(ctx context.Context, path string) error {
 	// jj resolve without arguments resolves conflicts
-	_, err := j.runJJ(ctx, "resolve", path)
+	file, err := jjPath(path)
+	if err != nil {
+		return err
+	}
+	_, err = j.runJJ(ctx, "resolve", file)
 	return err
 }
 
 // Log returns recent changes.
 func (j *JujutsuVCS) Log(ctx context.Context, limit int) ([]ChangeInfo, error) {
-	// Use template to get structured output
-	// Note: Use self.contained_in("@") to check if this is the working copy
-	template := `change_id ++ "\x00" ++ change_id.short() ++ "\x00" ++ description.first_line() ++ "\x00" ++ author.name() ++ "\x00" ++ author.timestamp() ++ "\x00" ++ if(self.contained_in("@"), "true", "false") ++ "\n"`
-
-	args := []string{"log", "--no-graph", "-T", template}
+	var args []string
 	if limit > 0 {
 		args = append(args, "-n", strconv.Itoa(limit))
 	}
-
-	output, err := j.runJJ(ctx, args...)
-	if err != nil {
-		return nil, err
-	}
-
-	var changes []ChangeInfo
-	for _, line := range strings.Split(output, "\n") {
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, "\x00")
-		if len(parts) < 6 {
-			continue
-		}
-		changes = append(changes, ChangeInfo{
-			ID:          parts[0],
-			ShortID:     parts[1],
-			Description: parts[2],
-			Author:      parts[3],
-			Timestamp:   parts[4],
-			IsWorking:   parts[5] == "true",
-		})
-	}
-
-	return changes, nil
+	return j.logChanges(ctx, args...)
 }
 
 // Show returns details of a specific change.
 func (j *JujutsuVCS) Show(ctx context.Context, id string) (*ChangeInfo, error) {
-	template := `change_id ++ "\n" ++ change_id.short() ++ "\n" ++ description.first_line() ++ "\n" ++ author.name() ++ "\n" ++ author.timestamp() ++ "\n" ++ if(self.contained_in("@"), "true", "false")`
-	output, err := j.runJJ(ctx, "log", "-r", id, "--no-graph", "-T", template)
+	rev, err := j.revision(id)
 	if err != nil {
 		return nil, err
 	}
-
-	lines := strings.Split(output, "\n")
-	if len(lines) < 6 {
-		return nil, &CommandError{VCS: VCSTypeJujutsu, Command: "log", Err: ErrCommandFailed}
-	}
-
-	return &ChangeInfo{
-		ID:          lines[0],
-		ShortID:     lines[1],
-		Description: lines[2],
-		Author:      lines[3],
-		Timestamp:   lines[4],
-		IsWorking:   lines[5] == "true",
-	}, nil
+	return j.showChange(ctx, rev)
 }
 
 // Diff returns the diff between two revisions.
 func (j *JujutsuVCS) Diff(ctx context.Context, from, to string) (string, error) {
 	args := []string{"diff"}
 	if from != "" {
-		args = append(args, "--from", from)
+		rev, err := j.revision(from)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "--from", rev)
 	}
 	if to != "" {
-		args = append(args, "--to", to)
+		rev, err := j.revision(to)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "--to", rev)
 	}
 	return j.runJJ(ctx, args...)
 }
 
+// DiffStructured returns the parsed output of jj diff --git.
+func (j *JujutsuVCS) DiffStructured(ctx context.Context, from, to string, paths []string) (*DiffResult, error) {
+	args := []string{"diff", "--git"}
+	if from != "" {
+		rev, err := j.revision(from)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--from", rev)
+	}
+	if to != "" {
+		rev, err := j.revision(to)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--to", rev)
+	}
+	filesets, err := jjPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	out, err := j.runJJJSON(ctx, append(args, filesets...)...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGitDiff(string(out))
+}
+
+// Query returns the changes matching revset, newest first. The revset is
+// passed to jj unchanged, so unlike the other methods it must not contain
+// untrusted input.
+func (j *JujutsuVCS) Query(ctx context.Context, revset string) ([]ChangeInfo, error) {
+	return j.logChanges(ctx, "-r", revset)
+}
+
 // StackInfo returns the current change stack (mutable changes).
 // This is one of jj's unique features - the stack of changes being worked on.
 func (j *JujutsuVCS) StackInfo(ctx context.Context) ([]ChangeInfo, error) {
 	// Use revset to get the stack: mutable() is changes that can be modified
 	// Or use @:: for descendants of current change
 	// Let's show the immutable root to @ path
-	template := `change_id ++ "\x00" ++ change_id.short() ++ "\x00" ++ description.first_line() ++ "\x00" ++ author.name() ++ "\x00" ++ author.timestamp() ++ "\x00" ++ if(self.contained_in("@"), "true", "false") ++ "\n"`
-
 	// Get mutable changes (the current stack being worked on)
-	output, err := j.runJJ(ctx, "log", "-r", "mutable()", "--no-graph", "-T", template)
+	changes, err := j.logChanges(ctx, "-r", "mutable()")
 	if err != nil {
 		// Fallback to just @ and parents
-		output, err = j.runJJ(ctx, "log", "-r", "::@", "--no-graph", "-T", template, "-n", "10")
-		if err != nil {
-			return nil, err
-		}
+		return j.logChanges(ctx, "-r", "::@", "-n", "10")
 	}
-
-	var changes []ChangeInfo
-	for _, line := range strings.Split(output, "\n") {
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, "\x00")
-		if len(parts) < 6 {
-			continue
-		}
-		changes = append(changes, ChangeInfo{
-			ID:          parts[0],
-			ShortID:     parts[1],
-			Description: parts[2],
-			Author:      parts[3],
-			Timestamp:   parts[4],
-			IsWorking:   parts[5] == "true",
-		})
-	}
-
 	return changes, nil
 }
 
@@ -606,7 +680,11 @@ func (j *JujutsuVCS) StackInfo(ctx context.Context) ([]ChangeInfo, error) {
 func (j *JujutsuVCS) Squash(ctx context.Context, sourceID string) error {
 	args := []string{"squash"}
 	if sourceID != "" {
-		args = append(args, "--from", sourceID)
+		rev, err := j.revision(sourceID)
+		if err != nil {
+			return err
+		}
+		args = j.squashArgs(rev, "")
 	}
 	_, err := j.runJJ(ctx, args...)
 	return err
@@ -624,7 +702,19 @@ func (j *JujutsuVCS) New(ctx context.Context, message string) error {
 
 // Edit sets a change as the working copy target.
 func (j *JujutsuVCS) Edit(ctx context.Context, id string) error {
-	_, err := j.runJJ(ctx, "edit", id)
+	rev, err := j.revision(id)
+	if err != nil {
+		return err
+	}
+	if plan := PlanFromContext(ctx); plan != nil {
+		if err := j.planChanges(ctx, plan, rev); err != nil {
+			return err
+		}
+		if err := j.planDiff(ctx, plan, "@", rev); err != nil {
+			return err
+		}
+	}
+	_, err = j.runJJ(ctx, "edit", rev)
 	return err
 }
 
@@ -632,6 +722,9 @@ func (j *JujutsuVCS) Edit(ctx context.Context, id string) error {
 
 // BranchExists returns true if the named bookmark exists.
 func (j *JujutsuVCS) BranchExists(ctx context.Context, name string) (bool, error) {
+	if err := ValidateRefName(name); err != nil {
+		return false, err
+	}
 	output, err := j.runJJ(ctx, "bookmark", "list", "--all")
 	if err != nil {
 		return false, err
@@ -647,7 +740,11 @@ func (j *JujutsuVCS) BranchExists(ctx context.Context, name string) (bool, error
 
 // ResolveRef resolves a revision expression to a change ID.
 func (j *JujutsuVCS) ResolveRef(ctx context.Context, ref string) (string, error) {
-	output, err := j.runJJ(ctx, "log", "--no-graph", "-r", ref,
+	rev, err := j.revision(ref)
+	if err != nil {
+		return "", err
+	}
+	output, err := j.runJJ(ctx, "log", "--no-graph", "-r", rev,
 		"-T", `change_id ++ "\n"`, "--limit", "1")
 	if err != nil {
 		return "", err
@@ -658,8 +755,12 @@ func (j *JujutsuVCS) ResolveRef(ctx context.Context, ref string) (string, error)
 // IsAncestor returns true if ancestor is an ancestor of descendant.
 func (j *JujutsuVCS) IsAncestor(ctx context.Context, ancestor, descendant string) (bool, error) {
 	// Use jj revset: ancestor is in ancestors(descendant)
+	revs, err := j.revisions(ancestor, descendant)
+	if err != nil {
+		return false, err
+	}
 	output, err := j.runJJ(ctx, "log", "--no-graph", "-r",
-		ancestor+" & ancestors("+descendant+")",
+		revs[0]+" & ancestors("+revs[1]+")",
 		"-T", `change_id`, "--limit", "1")
 	if err != nil {
 		// If the revset is empty, jj may still succeed with no output
@@ -672,11 +773,15 @@ func (j *JujutsuVCS) IsAncestor(ctx context.Context, ancestor, descendant string
 
 // Merge merges the named change. For jj, this creates a merge commit.
 func (j *JujutsuVCS) Merge(ctx context.Context, branch, message string) error {
-	args := []string{"new", "@", branch}
+	rev, err := j.revision(branch)
+	if err != nil {
+		return err
+	}
+	args := []string{"new", "@", rev}
 	if message != "" {
 		args = append(args, "-m", message)
 	}
-	_, err := j.runJJ(ctx, args...)
+	_, err = j.runJJ(ctx, args...)
 	return err
 }
 
@@ -690,12 +795,18 @@ func (j *JujutsuVCS) IsMerging(ctx context.Context) (bool, error) {
 
 // GetConfig reads a jj config value.
 func (j *JujutsuVCS) GetConfig(ctx context.Context, key string) (string, error) {
+	if err := validateArg("config key", key); err != nil {
+		return "", err
+	}
 	return j.runJJ(ctx, "config", "get", key)
 }
 
 // SetConfig writes a jj config value (repo-level).
 func (j *JujutsuVCS) SetConfig(ctx context.Context, key, value string) error {
-	_, err := j.runJJ(ctx, "config", "set", "--repo", key, value)
+	if err := validateArg("config key", key); err != nil {
+		return err
+	}
+	_, err := j.runJJ(ctx, "config", "set", "--repo", "--", key, value)
 	return err
 }
 
@@ -704,16 +815,17 @@ func (j *JujutsuVCS) SetConfig(ctx context.Context, key, value string) error {
 // GetRemoteURL returns the URL for a named remote.
 func (j *JujutsuVCS) GetRemoteURL(ctx context.Context, remote string) (string, error) {
 	// jj stores remote config in .jj/repo/config - try via jj config
+	if err := validateArg("remote", remote); err != nil {
+		return "", err
+	}
 	key := "git.remotes." + remote + ".url"
 	url, err := j.runJJ(ctx, "config", "get", key)
 	if err != nil {
 		// Fallback: if colocated, try git
 		if j.isColocated {
-			cmd := exec.CommandContext(ctx, "git", "remote", "get-url", remote)
-			cmd.Dir = j.repoRoot
-			out, gitErr := cmd.Output()
-			if gitErr == nil {
-				return strings.TrimSpace(string(out)), nil
+			inv := Invocation{Bin: "git", Args: []string{"remote", "get-url", remote}, Dir: j.repoRoot}
+			if res, gitErr := j.runner.Run(ctx, inv); gitErr == nil {
+				return strings.TrimSpace(string(res.Stdout)), nil
 			}
 		}
 		return "", err
@@ -726,7 +838,11 @@ func (j *JujutsuVCS) GetRemoteURL(ctx context.Context, remote string) (string, e
 // CheckoutFile checks out a specific file from a given revision.
 func (j *JujutsuVCS) CheckoutFile(ctx context.Context, ref, path string) error {
 	// jj file show outputs file content; write it to the working copy
-	output, err := j.runJJ(ctx, "file", "show", "-r", ref, path)
+	rev, file, err := j.revisionAndPath(ref, path)
+	if err != nil {
+		return err
+	}
+	output, err := j.runJJ(ctx, "file", "show", "-r", rev, file)
 	if err != nil {
 		return err
 	}
@@ -780,21 +896,9 @@ func (j *JujutsuVCS) UpdateStaleWorkspace(ctx context.Context, name string) erro
 				_, err := j.runJJ(ctx, "workspace", "update-stale")
 				return err
 			}
-			cmd := exec.CommandContext(ctx, "jj", "workspace", "update-stale")
-			cmd.Dir = ws.Path
-			cmd.Env = os.Environ()
-			var stderr bytes.Buffer
-			cmd.Stderr = &stderr
-			if err := cmd.Run(); err != nil {
-				return &CommandError{
-					VCS:     VCSTypeJujutsu,
-					Command: "jj",
-					Args:    []string{"workspace", "update-stale"},
-					Stderr:  stderr.String(),
-					Err:     err,
-				}
-			}
-			return nil
+			args := []string{"workspace", "update-stale"}
+			_, err := j.run(ctx, VCSTypeJujutsu, Invocation{Bin: "jj", Args: args, Dir: ws.Path}, args)
+			return err
 		}
 	}
 	return ErrWorkspaceNotFound
@@ -804,15 +908,26 @@ func (j *JujutsuVCS) UpdateStaleWorkspace(ctx context.Context, name string) erro
 
 // DeleteBranch deletes a bookmark.
 func (j *JujutsuVCS) DeleteBranch(ctx context.Context, name string) error {
-	_, err := j.runJJ(ctx, "bookmark", "delete", name)
+	pattern, err := jjBookmarkPattern(name)
+	if err != nil {
+		return err
+	}
+	_, err = j.runJJ(ctx, "bookmark", "delete", pattern)
 	return err
 }
 
 // MoveBranch moves a bookmark to the specified revision.
 func (j *JujutsuVCS) MoveBranch(ctx context.Context, name string, to string) error {
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
 	args := []string{"bookmark", "move", name}
 	if to != "" {
-		args = append(args, "--to", to)
+		rev, err := j.revision(to)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--to", rev)
 	}
 	_, err := j.runJJ(ctx, args...)
 	return err
@@ -820,9 +935,16 @@ func (j *JujutsuVCS) MoveBranch(ctx context.Context, name string, to string) err
 
 // SetBranch sets a bookmark to a specific revision.
 func (j *JujutsuVCS) SetBranch(ctx context.Context, name string, to string) error {
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
 	args := []string{"bookmark", "set", name}
 	if to != "" {
-		args = append(args, "-r", to)
+		rev, err := j.revision(to)
+		if err != nil {
+			return err
+		}
+		args = append(args, "-r", rev)
 	}
 	_, err := j.runJJ(ctx, args...)
 	return err
@@ -830,24 +952,38 @@ func (j *JujutsuVCS) SetBranch(ctx context.Context, name string, to string) erro
 
 // TrackBranch starts tracking a remote bookmark.
 func (j *JujutsuVCS) TrackBranch(ctx context.Context, name string, remote string) error {
-	ref := name
-	if remote != "" {
-		ref = name + "@" + remote
+	ref, err := jjRemoteBookmark(name, remote)
+	if err != nil {
+		return err
 	}
-	_, err := j.runJJ(ctx, "bookmark", "track", ref)
+	_, err = j.runJJ(ctx, "bookmark", "track", ref)
 	return err
 }
 
 // UntrackBranch stops tracking a remote bookmark.
 func (j *JujutsuVCS) UntrackBranch(ctx context.Context, name string, remote string) error {
-	ref := name
-	if remote != "" {
-		ref = name + "@" + remote
+	ref, err := jjRemoteBookmark(name, remote)
+	if err != nil {
+		return err
 	}
-	_, err := j.runJJ(ctx, "bookmark", "untrack", ref)
+	_, err = j.runJJ(ctx, "bookmark", "untrack", ref)
 	return err
 }
 
+// jjRemoteBookmark validates name and remote and joins them as name@remote.
+func jjRemoteBookmark(name, remote string) (string, error) {
+	if err := ValidateRefName(name); err != nil {
+		return "", err
+	}
+	if remote == "" {
+		return name, nil
+	}
+	if err := ValidateRefName(remote); err != nil {
+		return "", err
+	}
+	return name + "@" + remote, nil
+}
+
 // --- File Operations ---
 
 // TrackFiles explicitly starts tracking files.
@@ -855,8 +991,12 @@ func (j *JujutsuVCS) TrackFiles(ctx context.Context, paths ...string) error {
 	if len(paths) == 0 {
 		return nil
 	}
-	args := append([]string{"file", "track"}, paths...)
-	_, err := j.runJJ(ctx, args...)
+	files, err := jjPaths(paths)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"file", "track"}, files...)
+	_, err = j.runJJ(ctx, args...)
 	return err
 }
 
@@ -865,8 +1005,12 @@ func (j *JujutsuVCS) UntrackFiles(ctx context.Context, paths ...string) error {
 	if len(paths) == 0 {
 		return nil
 	}
-	args := append([]string{"file", "untrack"}, paths...)
-	_, err := j.runJJ(ctx, args...)
+	files, err := jjPaths(paths)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"file", "untrack"}, files...)
+	_, err = j.runJJ(ctx, args...)
 	return err
 }
 
@@ -875,38 +1019,27 @@ func (j *JujutsuVCS) UntrackFiles(ctx context.Context, paths ...string) error {
 // LogBetween returns changes in 'to' that are not in 'from'.
 // Uses jj revset: 'to ~ from' (commits in to but not in from).
 func (j *JujutsuVCS) LogBetween(ctx context.Context, from, to string) ([]ChangeInfo, error) {
-	revset := fmt.Sprintf("(%s) ~ (%s)", to, from)
-	output, err := j.runJJ(ctx, "log", "--no-graph", "-r", revset,
-		"-T", `change_id ++ "\x00" ++ change_id.shortest(8) ++ "\x00" ++ description.first_line() ++ "\x00" ++ author.name() ++ "\x00" ++ author.timestamp() ++ "\n"`)
+	revs, err := j.revisions(to, from)
 	if err != nil {
 		return nil, err
 	}
-
-	var changes []ChangeInfo
-	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
-		if line == "" {
-			continue
-		}
-		parts := strings.SplitN(line, "\x00", 6)
-		if len(parts) < 5 {
-			continue
-		}
-		changes = append(changes, ChangeInfo{
-			ID:          strings.TrimSpace(parts[0]),
-			ShortID:     strings.TrimSpace(parts[1]),
-			Description: strings.TrimSpace(parts[2]),
-			Author:      strings.TrimSpace(parts[3]),
-			Timestamp:   strings.TrimSpace(parts[4]),
-		})
-	}
-	return changes, nil
+	revset := fmt.Sprintf("(%s) ~ (%s)", revs[0], revs[1])
+	return j.logChanges(ctx, "-r", revset)
 }
 
 // DiffPath returns the diff of a specific file between two refs.
 func (j *JujutsuVCS) DiffPath(ctx context.Context, from, to, path string) (string, error) {
-	args := []string{"diff", "--from", from, "--to", to}
+	revs, err := j.revisions(from, to)
+	if err != nil {
+		return "", err
+	}
+	args := []string{"diff", "--from", revs[0], "--to", revs[1]}
 	if path != "" {
-		args = append(args, path)
+		file, err := jjPath(path)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, file)
 	}
 	return j.runJJ(ctx, args...)
 }
@@ -930,13 +1063,24 @@ func (j *JujutsuVCS) StageAndCommit(ctx context.Context, paths []string, message
 
 // PushWithUpstream pushes a bookmark with tracking setup.
 func (j *JujutsuVCS) PushWithUpstream(ctx context.Context, remote, branch string) error {
-	_, err := j.runJJ(ctx, "git", "push", "--remote", remote, "--bookmark", branch)
+	if err := validateArg("remote", remote); err != nil {
+		return err
+	}
+	pattern, err := jjBookmarkPattern(branch)
+	if err != nil {
+		return err
+	}
+	_, err = j.runJJ(ctx, "git", "push", "--remote", remote, "--bookmark", pattern)
 	return err
 }
 
 // Rebase rebases the current change onto the given ref (interface method).
 func (j *JujutsuVCS) Rebase(ctx context.Context, onto string) error {
-	_, err := j.runJJ(ctx, "rebase", "-d", onto)
+	rev, err := j.revision(onto)
+	if err != nil {
+		return err
+	}
+	_, err = j.runJJ(ctx, "rebase", "-d", rev)
 	return err
 }
 
@@ -949,7 +1093,11 @@ func (j *JujutsuVCS) RebaseAbort(ctx context.Context) error {
 
 // IsFileTracked returns true if the file is tracked by jj.
 func (j *JujutsuVCS) IsFileTracked(ctx context.Context, path string) (bool, error) {
-	output, err := j.runJJ(ctx, "file", "list", path)
+	file, err := jjPath(path)
+	if err != nil {
+		return false, err
+	}
+	output, err := j.runJJ(ctx, "file", "list", file)
 	if err != nil {
 		return false, nil // Error means not tracked or jj issue
 	}
@@ -989,18 +1137,29 @@ func (j *JujutsuVCS) Describe(ctx context.Context, message string) error {
 func (j *JujutsuVCS) RebaseRevision(ctx context.Context, source, destination string) error {
 	args := []string{"rebase"}
 	if source != "" {
-		args = append(args, "-r", source)
+		rev, err := j.revision(source)
+		if err != nil {
+			return err
+		}
+		args = append(args, "-r", rev)
 	}
-	args = append(args, "-d", destination)
-	_, err := j.runJJ(ctx, args...)
+	rev, err := j.revision(destination)
+	if err != nil {
+		return err
+	}
+	args = append(args, "-d", rev)
+	_, err = j.runJJ(ctx, args...)
 	return err
 }
 
 // Abandon abandons changes (marks them as hidden).
 func (j *JujutsuVCS) Abandon(ctx context.Context, revisions ...string) error {
-	args := []string{"abandon"}
-	args = append(args, revisions...)
-	_, err := j.runJJ(ctx, args...)
+	revs, err := j.revisions(revisions...)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"abandon"}, revs...)
+	_, err = j.runJJ(ctx, args...)
 	return err
 }
 
@@ -1027,7 +1186,11 @@ func (j *JujutsuVCS) Snapshot(ctx context.Context) error {
 
 // DiffHasChanges returns true if the file differs from the given ref.
 func (j *JujutsuVCS) DiffHasChanges(ctx context.Context, ref, path string) (bool, error) {
-	output, err := j.runJJ(ctx, "diff", "-r", ref, "--stat", path)
+	rev, file, err := j.revisionAndPath(ref, path)
+	if err != nil {
+		return false, err
+	}
+	output, err := j.runJJ(ctx, "diff", "-r", rev, "--stat", file)
 	if err != nil {
 		return false, err
 	}
@@ -1036,7 +1199,11 @@ func (j *JujutsuVCS) DiffHasChanges(ctx context.Context, ref, path string) (bool
 
 // RevListCount returns the number of changes between two revsets.
 func (j *JujutsuVCS) RevListCount(ctx context.Context, from, to string) (int, error) {
-	revset := fmt.Sprintf("(%s)..(%s)", from, to)
+	revs, err := j.revisions(from, to)
+	if err != nil {
+		return 0, err
+	}
+	revset := fmt.Sprintf("(%s)..(%s)", revs[0], revs[1])
 	output, err := j.runJJ(ctx, "log", "--no-graph", "-r", revset, "-T", "change_id.short(8) ++ \"\\n\"")
 	if err != nil {
 		return 0, err
@@ -1050,7 +1217,11 @@ func (j *JujutsuVCS) RevListCount(ctx context.Context, from, to string) (int, er
 
 // MergeBase returns the common ancestor of two refs.
 func (j *JujutsuVCS) MergeBase(ctx context.Context, ref1, ref2 string) (string, error) {
-	revset := fmt.Sprintf("heads(::%s & ::%s)", ref1, ref2)
+	revs, err := j.revisions(ref1, ref2)
+	if err != nil {
+		return "", err
+	}
+	revset := fmt.Sprintf("heads(::%s & ::%s)", revs[0], revs[1])
 	output, err := j.runJJ(ctx, "log", "--no-graph", "-r", revset, "-T", "commit_id.short(12)")
 	if err != nil {
 		return "", err
@@ -1085,7 +1256,11 @@ func (j *JujutsuVCS) GetUpstream(ctx context.Context) (string, error) {
 func (j *JujutsuVCS) CheckIgnore(ctx context.Context, path string) (bool, error) {
 	// jj doesn't have a direct check-ignore command
 	// Check if the file is listed by jj file list (tracked) or exists but not listed (ignored)
-	output, err := j.runJJ(ctx, "file", "list", path)
+	file, err := jjPath(path)
+	if err != nil {
+		return false, err
+	}
+	output, err := j.runJJ(ctx, "file", "list", file)
 	if err != nil {
 		return false, err
 	}
@@ -1103,22 +1278,80 @@ func (j *JujutsuVCS) CheckIgnore(ctx context.Context, path string) (bool, error)
 
 // RestoreFile restores a file from jj (discards working copy changes).
 func (j *JujutsuVCS) RestoreFile(ctx context.Context, path string) error {
-	_, err := j.runJJ(ctx, "restore", path)
+	file, err := jjPath(path)
+	if err != nil {
+		return err
+	}
+	_, err = j.runJJ(ctx, "restore", file)
 	return err
 }
 
 // ResetHard resets the working copy by editing the given ref.
 func (j *JujutsuVCS) ResetHard(ctx context.Context, ref string) error {
-	_, err := j.runJJ(ctx, "edit", ref)
-	return err
+	return j.Edit(ctx, ref)
 }
 
 // ForcePush pushes with force semantics.
 func (j *JujutsuVCS) ForcePush(ctx context.Context, remote, branch string) error {
-	_, err := j.runJJ(ctx, "git", "push", "--remote", remote, "--bookmark", branch, "--allow-new")
+	if err := validateArg("remote", remote); err != nil {
+		return err
+	}
+	pattern, err := jjBookmarkPattern(branch)
+	if err != nil {
+		return err
+	}
+	args := []string{"git", "push", "--remote", remote, "--bookmark", pattern}
+	if j.caps.PushAllowNew {
+		args = append(args, "--allow-new")
+	}
+	if plan := PlanFromContext(ctx); plan != nil {
+		if err := j.planForcePush(ctx, plan, remote, branch); err != nil {
+			return err
+		}
+	}
+	_, err = j.runJJ(ctx, args...)
 	return err
 }
 
+// planForcePush records the changes on remote's copy of branch that pushing
+// would drop, and the files that differ from the local bookmark.
+func (j *JujutsuVCS) planForcePush(ctx context.Context, plan *Plan, remote, branch string) error {
+	local, err := jjBookmarkRevset(branch)
+	if err != nil {
+		return err
+	}
+	tracked := "present(" + quoteRevsetString(branch) + "@" + quoteRevsetString(remote) + ")"
+	out, err := j.runJJ(ctx, "log", "--no-graph", "-r", tracked, "-T", `change_id ++ "\n"`)
+	if err != nil || out == "" {
+		// A bookmark the remote doesn't have yet overwrites nothing.
+		return err
+	}
+	if err := j.planChanges(ctx, plan, "::"+tracked+" ~ ::"+local); err != nil {
+		return err
+	}
+	return j.planDiff(ctx, plan, tracked, local)
+}
+
+// planChanges records the change IDs revset resolves to.
+func (j *JujutsuVCS) planChanges(ctx context.Context, plan *Plan, revset string) error {
+	out, err := j.runJJ(ctx, "log", "--no-graph", "-r", revset, "-T", `change_id ++ "\n"`)
+	if err != nil {
+		return err
+	}
+	plan.AddChanges(strings.Fields(out)...)
+	return nil
+}
+
+// planDiff records the files that differ between two revisions.
+func (j *JujutsuVCS) planDiff(ctx context.Context, plan *Plan, from, to string) error {
+	out, err := j.runJJ(ctx, "diff", "--summary", "--from", from, "--to", to)
+	if err != nil {
+		return err
+	}
+	plan.addStatusFiles(parseJJSummary(out))
+	return nil
+}
+
 // GetCommonDir returns the .jj directory path.
 func (j *JujutsuVCS) GetCommonDir(ctx context.Context) (string, error) {
 	return filepath.Join(j.repoRoot, ".jj"), nil
@@ -1126,7 +1359,11 @@ func (j *JujutsuVCS) GetCommonDir(ctx context.Context) (string, error) {
 
 // ListTrackedFiles returns tracked files matching a path prefix.
 func (j *JujutsuVCS) ListTrackedFiles(ctx context.Context, path string) ([]string, error) {
-	output, err := j.runJJ(ctx, "file", "list", path)
+	file, err := jjPath(path)
+	if err != nil {
+		return nil, err
+	}
+	output, err := j.runJJ(ctx, "file", "list", file)
 	if err != nil {
 		return nil, err
 	}
@@ -1141,7 +1378,11 @@ func (j *JujutsuVCS) ListTrackedFiles(ctx context.Context, path string) ([]strin
 
 // ShowFile reads file content from a specific revision.
 func (j *JujutsuVCS) ShowFile(ctx context.Context, ref, path string) ([]byte, error) {
-	output, err := j.runJJ(ctx, "file", "show", "-r", ref, path)
+	rev, file, err := j.revisionAndPath(ref, path)
+	if err != nil {
+		return nil, err
+	}
+	output, err := j.runJJ(ctx, "file", "show", "-r", rev, file)
 	if err != nil {
 		return nil, err
 	}
@@ -1172,8 +1413,7 @@ func (j *JujutsuVCS) IsWorktreeRepo(ctx context.Context) (bool, error) {
 
 // Checkout switches the working copy to a different ref.
 func (j *JujutsuVCS) Checkout(ctx context.Context, ref string) error {
-	_, err := j.runJJ(ctx, "edit", ref)
-	return err
+	return j.Edit(ctx, ref)
 }
 
 // SymbolicRef returns the current bookmark name, or empty if none.
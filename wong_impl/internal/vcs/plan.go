@@ -0,0 +1,357 @@
+package vcs
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Plan mode: a context carrying a Plan turns mutating operations into a dry
+// run. The Runner still executes read-only commands, so operations can work
+// out which changes and files they would touch, but every other command is
+// appended to the Plan instead of being run and reports empty, successful
+// output. Operations that also write files or update in-memory state check
+// PlanFromContext themselves and record a PlanStep note instead.
+//
+// Reads that follow a planned command see the repository as it was, so a
+// plan for a multi-step operation is the sequence it would start with, not a
+// simulation of every branch it could take.
+
+// PlanStep is one thing a planned operation would do: either a command or,
+// for work done without one, a Note such as "remove directory /tmp/x".
+type PlanStep struct {
+	Bin  string   `json:"bin,omitempty"`
+	Args []string `json:"args,omitempty"`
+	Dir  string   `json:"dir,omitempty"`
+	Note string   `json:"note,omitempty"`
+}
+
+// String renders the step as a shell-like command line or its note.
+func (s PlanStep) String() string {
+	if s.Bin == "" {
+		return s.Note
+	}
+	parts := []string{filepath.Base(s.Bin)}
+	for _, a := range s.Args {
+		if a == "" || strings.ContainsAny(a, " \t\n\"'\\$`()|&;<>*?[]{}") {
+			a = strconv.Quote(a)
+		}
+		parts = append(parts, a)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Plan collects what a dry-run operation would do. It is safe for concurrent
+// use.
+type Plan struct {
+	mu sync.Mutex
+
+	// Steps are the commands and notes in the order they would happen.
+	Steps []PlanStep `json:"steps"`
+
+	// Changes are the change or commit IDs the operation would rewrite,
+	// abandon, move or overwrite on a remote.
+	Changes []string `json:"changes,omitempty"`
+
+	// Files are the repo-relative paths whose content would change.
+	Files []string `json:"files,omitempty"`
+}
+
+type planKey struct{}
+
+// WithPlan returns a context that puts operations into plan mode, collecting
+// into p.
+func WithPlan(ctx context.Context, p *Plan) context.Context {
+	return context.WithValue(ctx, planKey{}, p)
+}
+
+// PlanFromContext returns the Plan set by WithPlan, or nil outside plan mode.
+func PlanFromContext(ctx context.Context) *Plan {
+	p, _ := ctx.Value(planKey{}).(*Plan)
+	return p
+}
+
+// DryRun calls fn in plan mode and returns what it would have done. The
+// error is fn's, e.g. an invalid argument found before planning anything.
+func DryRun(ctx context.Context, fn func(ctx context.Context) error) (*Plan, error) {
+	p := &Plan{}
+	err := fn(WithPlan(ctx, p))
+	return p, err
+}
+
+// AddNote appends a step that is not a command.
+func (p *Plan) AddNote(note string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Steps = append(p.Steps, PlanStep{Note: note})
+}
+
+// AddChanges records affected change IDs, skipping empty and repeated ones.
+func (p *Plan) AddChanges(ids ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Changes = appendNew(p.Changes, ids)
+}
+
+// AddFiles records affected paths, skipping empty and repeated ones.
+func (p *Plan) AddFiles(paths ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Files = appendNew(p.Files, paths)
+}
+
+// String renders the plan one step per line.
+func (p *Plan) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var b strings.Builder
+	for _, s := range p.Steps {
+		b.WriteString(s.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (p *Plan) addCommand(inv Invocation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Steps = append(p.Steps, PlanStep{Bin: inv.Bin, Args: append([]string(nil), inv.Args...), Dir: inv.Dir})
+}
+
+// appendNew appends the non-empty items of add that list lacks.
+func appendNew(list, add []string) []string {
+	for _, a := range add {
+		if a == "" {
+			continue
+		}
+		found := false
+		for _, l := range list {
+			if l == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// addStatusFiles records the paths of entries, including rename sources.
+func (p *Plan) addStatusFiles(entries []StatusEntry) {
+	for _, e := range entries {
+		p.AddFiles(e.OldPath, e.Path)
+	}
+}
+
+// IsReadOnlyCommand reports whether running bin with args leaves the
+// repository unchanged. Unknown programs and subcommands are treated as
+// mutating, so plan mode errs towards not running them.
+func IsReadOnlyCommand(bin string, args []string) bool {
+	switch filepath.Base(bin) {
+	case "jj":
+		return jjReadOnly(args)
+	case "git":
+		return gitReadOnly(args)
+	case "hg", "sl":
+		return hgReadOnly(args)
+	}
+	return false
+}
+
+// planRead returns a read-only inv as plan mode runs it. jj snapshots the
+// working copy before most commands, recording an operation, so its reads
+// get --ignore-working-copy as they do in a ReadView.
+func planRead(inv Invocation) Invocation {
+	if filepath.Base(inv.Bin) != "jj" || hasAny(inv.Args, "--ignore-working-copy", "--version", "-V") {
+		return inv
+	}
+	inv.Args = append([]string{"--ignore-working-copy"}, inv.Args...)
+	return inv
+}
+
+// subcommand skips global options and returns the first positional argument
+// and what follows it. valued lists the options that take a separate value.
+func subcommand(args []string, valued map[string]bool) (string, []string) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "-") {
+			return a, args[i+1:]
+		}
+		if valued[a] {
+			i++
+		}
+	}
+	return "", nil
+}
+
+// positional returns the arguments that are not options. Option values are
+// not recognized, so this is only used where it doesn't matter.
+func positional(args []string) []string {
+	var out []string
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// hasAny reports whether args contains any of flags.
+func hasAny(args []string, flags ...string) bool {
+	for _, a := range args {
+		for _, f := range flags {
+			if a == f || strings.HasPrefix(a, f+"=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var jjValuedOptions = map[string]bool{
+	"-R": true, "--repository": true, "--at-operation": true, "--at-op": true,
+	"--color": true, "--config": true, "--config-toml": true, "--config-file": true,
+}
+
+var jjReadCommands = map[string]bool{
+	"log": true, "show": true, "diff": true, "status": true, "st": true,
+	"evolog": true, "obslog": true, "interdiff": true, "root": true,
+	"version": true, "files": true, "cat": true, "help": true,
+}
+
+// jjReadSubcommands are command groups whose listed subcommands only read.
+var jjReadSubcommands = map[string][]string{
+	"file":      {"show", "list", "annotate"},
+	"config":    {"get", "list", "path"},
+	"op":        {"log", "show", "diff"},
+	"operation": {"log", "show", "diff"},
+	"workspace": {"list", "root"},
+	"bookmark":  {"list"},
+	"branch":    {"list"},
+	"tag":       {"list"},
+}
+
+func jjReadOnly(args []string) bool {
+	if hasAny(args, "--version", "-V") {
+		return true
+	}
+	cmd, rest := subcommand(args, jjValuedOptions)
+	if jjReadCommands[cmd] {
+		return true
+	}
+	if subs, ok := jjReadSubcommands[cmd]; ok {
+		sub, _ := subcommand(rest, nil)
+		for _, s := range subs {
+			if s == sub {
+				return true
+			}
+		}
+		return false
+	}
+	switch cmd {
+	case "resolve":
+		return hasAny(rest, "--list", "-l")
+	case "git":
+		sub, rest := subcommand(rest, nil)
+		if sub == "remote" {
+			s, _ := subcommand(rest, nil)
+			return s == "list"
+		}
+	}
+	return false
+}
+
+var gitValuedOptions = map[string]bool{
+	"-C": true, "-c": true, "--git-dir": true, "--work-tree": true, "--namespace": true,
+}
+
+var gitReadCommands = map[string]bool{
+	"rev-parse": true, "log": true, "show": true, "diff": true, "status": true,
+	"ls-files": true, "ls-tree": true, "ls-remote": true, "cat-file": true,
+	"merge-base": true, "rev-list": true, "for-each-ref": true, "show-ref": true,
+	"diff-tree": true, "diff-index": true, "diff-files": true, "blame": true,
+	"annotate": true, "grep": true, "describe": true, "name-rev": true,
+	"check-ignore": true, "check-attr": true, "check-ref-format": true,
+	"var": true, "version": true, "count-objects": true, "shortlog": true,
+	"cherry": true, "range-diff": true, "help": true,
+}
+
+func gitReadOnly(args []string) bool {
+	if hasAny(args, "--version") {
+		return true
+	}
+	cmd, rest := subcommand(args, gitValuedOptions)
+	if gitReadCommands[cmd] {
+		return true
+	}
+	pos := positional(rest)
+	first := ""
+	if len(pos) > 0 {
+		first = pos[0]
+	}
+	switch cmd {
+	case "config":
+		return hasAny(rest, "--get", "--get-all", "--get-regexp", "--list", "-l") ||
+			first == "get" || first == "list"
+	case "remote":
+		return first == "" || first == "get-url" || first == "show"
+	case "branch":
+		if hasAny(rest, "-d", "-D", "--delete", "-m", "-M", "--move", "-c", "-C", "--copy",
+			"-u", "--set-upstream-to", "--unset-upstream", "--edit-description", "-f", "--force") {
+			return false
+		}
+		return len(pos) == 0 || hasAny(rest, "--list", "-l")
+	case "tag":
+		if hasAny(rest, "-d", "--delete") {
+			return false
+		}
+		return len(pos) == 0 || hasAny(rest, "--list", "-l")
+	case "stash", "notes":
+		return first == "list" || first == "show"
+	case "reflog":
+		return first != "expire" && first != "delete"
+	case "worktree":
+		return first == "list"
+	case "clean":
+		return hasAny(rest, "-n", "--dry-run")
+	case "symbolic-ref":
+		return len(pos) <= 1 && !hasAny(rest, "-d", "--delete")
+	}
+	return false
+}
+
+var hgValuedOptions = map[string]bool{
+	"-R": true, "--repository": true, "--cwd": true, "--config": true, "--color": true,
+}
+
+var hgReadCommands = map[string]bool{
+	"log": true, "status": true, "st": true, "diff": true, "cat": true, "root": true,
+	"files": true, "manifest": true, "id": true, "identify": true, "summary": true,
+	"sum": true, "paths": true, "config": true, "showconfig": true, "annotate": true,
+	"blame": true, "version": true, "heads": true, "parents": true, "tip": true,
+	"incoming": true, "outgoing": true, "help": true, "branches": true, "tags": true,
+	"grep": true, "locate": true, "smartlog": true,
+}
+
+func hgReadOnly(args []string) bool {
+	if hasAny(args, "--version") {
+		return true
+	}
+	cmd, rest := subcommand(args, hgValuedOptions)
+	if hgReadCommands[cmd] {
+		return true
+	}
+	switch cmd {
+	case "bookmarks", "bookmark", "book", "branch":
+		return len(positional(rest)) == 0 && !hasAny(rest, "-d", "--delete", "-m", "--rename", "-f", "--force", "-C", "--clean")
+	case "phase":
+		return !hasAny(rest, "-p", "--public", "-d", "--draft", "-s", "--secret", "-f", "--force")
+	case "resolve":
+		return hasAny(rest, "-l", "--list")
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package vcs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsReadOnlyCommand(t *testing.T) {
+	tests := []struct {
+		bin  string
+		args string
+		want bool
+	}{
+		{"jj", "log -r @ --no-graph", true},
+		{"jj", "--color=never --at-operation abc --ignore-working-copy diff --summary", true},
+		{"jj", "-R /repo file show -r @ a.txt", true},
+		{"jj", "file untrack a.txt", false},
+		{"jj", "bookmark list", true},
+		{"jj", "bookmark set main -r @", false},
+		{"jj", "config get user.name", true},
+		{"jj", "config set --repo user.name x", false},
+		{"jj", "resolve --list", true},
+		{"jj", "resolve a.txt", false},
+		{"jj", "git remote list", true},
+		{"jj", "git push --remote origin", false},
+		{"jj", "--version", true},
+		{"jj", "new root()", false},
+		{"jj", "edit @-", false},
+		{"/usr/local/bin/jj", "op log", true},
+		{"git", "rev-parse HEAD", true},
+		{"git", "-C /repo -c core.quotepath=off status --porcelain", true},
+		{"git", "--git-dir=/repo/.git --work-tree=/repo ls-files -z --others", true},
+		{"git", "config --get core.hooksPath", true},
+		{"git", "config core.hooksPath hooks", false},
+		{"git", "branch", true},
+		{"git", "branch --list feat*", true},
+		{"git", "branch -D feat", false},
+		{"git", "branch feat", false},
+		{"git", "tag -l", true},
+		{"git", "tag v1", false},
+		{"git", "remote", true},
+		{"git", "remote get-url origin", true},
+		{"git", "remote add origin url", false},
+		{"git", "clean -n", true},
+		{"git", "clean -f", false},
+		{"git", "symbolic-ref --short HEAD", true},
+		{"git", "symbolic-ref HEAD refs/heads/x", false},
+		{"git", "reset --hard HEAD~1 --", false},
+		{"git", "push --force-with-lease origin main", false},
+		{"hg", "status --unknown --no-status", true},
+		{"hg", "--config extensions.purge= purge", false},
+		{"sl", "bookmarks", true},
+		{"sl", "bookmark feat", false},
+		{"hg", "update --clean -r .", false},
+		{"sh", "-c true", false},
+	}
+	for _, tt := range tests {
+		if got := IsReadOnlyCommand(tt.bin, strings.Fields(tt.args)); got != tt.want {
+			t.Errorf("IsReadOnlyCommand(%s %s) = %v, want %v", tt.bin, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRunner_PlanSkipsMutatingCommands(t *testing.T) {
+	var ran []string
+	r := &Runner{Sink: CommandSinkFunc(func(rec CommandRecord) { ran = append(ran, strings.Join(rec.Args, " ")) })}
+	dir := t.TempDir()
+	plan, err := DryRun(context.Background(), func(ctx context.Context) error {
+		if _, err := r.Run(ctx, Invocation{Bin: "git", Args: []string{"--version"}}); err != nil {
+			return err
+		}
+		res, err := r.Run(ctx, Invocation{Bin: "git", Args: []string{"init", "-q", "new repo"}, Dir: dir})
+		if err != nil || len(res.Stdout) != 0 {
+			t.Errorf("planned command = %+v, %v; want empty success", res, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 || ran[0] != "--version" {
+		t.Errorf("ran %q, want only the read-only command", ran)
+	}
+	if len(plan.Steps) != 1 || plan.Steps[0].Dir != dir || plan.String() != "git init -q \"new repo\"\n" {
+		t.Errorf("plan = %+v", plan.Steps)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); !os.IsNotExist(err) {
+		t.Errorf("planned git init ran: %v", err)
+	}
+}
+
+func TestRunner_PlanReadsIgnoreWorkingCopy(t *testing.T) {
+	transcript := &Transcript{Entries: []TranscriptEntry{
+		{Bin: "jj", Args: []string{"--ignore-working-copy", "log", "-r", "@"}, Stdout: "planned"},
+		{Bin: "jj", Args: []string{"--ignore-working-copy", "status"}, Stdout: "already set"},
+		{Bin: "jj", Args: []string{"log", "-r", "@"}, Stdout: "snapshot"},
+	}}
+	r := &Runner{Replay: transcript}
+	plan := &Plan{}
+	ctx := WithPlan(context.Background(), plan)
+
+	if res, err := r.Run(ctx, Invocation{Bin: "jj", Args: []string{"log", "-r", "@"}}); err != nil || string(res.Stdout) != "planned" {
+		t.Errorf("planned jj log = %q, %v; want it run with --ignore-working-copy", res.Stdout, err)
+	}
+	if res, err := r.Run(ctx, Invocation{Bin: "jj", Args: []string{"--ignore-working-copy", "status"}}); err != nil || string(res.Stdout) != "already set" {
+		t.Errorf("planned jj status = %q, %v; want the flag not repeated", res.Stdout, err)
+	}
+	// Outside plan mode reads snapshot as usual.
+	if res, err := r.Run(context.Background(), Invocation{Bin: "jj", Args: []string{"log", "-r", "@"}}); err != nil || string(res.Stdout) != "snapshot" {
+		t.Errorf("jj log = %q, %v", res.Stdout, err)
+	}
+	if len(plan.Steps) != 0 {
+		t.Errorf("reads were planned: %+v", plan.Steps)
+	}
+}
+
+func TestGitVCS_PlanResetHardAndClean(t *testing.T) {
+	g, h, repo := gitStackRepo(t)
+	ctx := context.Background()
+	h.WriteFile(repo, "a.txt", "dirty\n")
+	h.WriteFile(repo, "junk.txt", "junk\n")
+	head := gitOut(h, repo, "rev-parse", "HEAD")
+
+	plan, err := DryRun(ctx, func(ctx context.Context) error { return g.ResetHard(ctx, "HEAD~1") })
+	if err != nil {
+		t.Fatalf("ResetHard: %v", err)
+	}
+	if len(plan.Steps) != 1 || plan.Steps[0].String() != "git reset --hard HEAD~1 --" {
+		t.Errorf("steps = %q", plan.String())
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0] != head {
+		t.Errorf("changes = %v, want the dropped HEAD %s", plan.Changes, head)
+	}
+	if strings.Join(plan.Files, " ") != strings.Join(strings.Fields(gitOut(h, repo, "diff", "--name-only", "HEAD~1")), " ") {
+		t.Errorf("files = %v", plan.Files)
+	}
+	if gitOut(h, repo, "rev-parse", "HEAD") != head || gitOut(h, repo, "status", "--porcelain", "a.txt") == "" {
+		t.Error("planned ResetHard changed the repository")
+	}
+
+	plan, err = DryRun(ctx, func(ctx context.Context) error { return g.Clean(ctx) })
+	if err != nil {
+		t.Fatalf("Clean: %v", err)
+	}
+	if plan.String() != "git clean -f\n" || strings.Join(plan.Files, " ") != "junk.txt" {
+		t.Errorf("Clean plan = %q %v", plan.String(), plan.Files)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "junk.txt")); err != nil {
+		t.Errorf("planned Clean removed junk.txt: %v", err)
+	}
+}
+
+func TestGitVCS_PlanForcePush(t *testing.T) {
+	g, h, repo, upstream, _ := gitRemotesRepo(t)
+	ctx := context.Background()
+	if err := g.AddRemote(ctx, "upstream", upstream); err != nil {
+		t.Fatal(err)
+	}
+	h.runCmd(repo, "git", "push", "-q", "upstream", "main")
+	h.runCmd(repo, "git", "fetch", "-q", "upstream")
+	remoteHead := gitOut(h, repo, "rev-parse", "main")
+	h.WriteFile(repo, "code.txt", "rewritten\n")
+	h.runCmd(repo, "git", "commit", "-q", "--amend", "-am", "rewritten")
+
+	plan, err := DryRun(ctx, func(ctx context.Context) error { return g.ForcePush(ctx, "upstream", "main") })
+	if err != nil {
+		t.Fatalf("ForcePush: %v", err)
+	}
+	if plan.String() != "git push --force-with-lease --end-of-options upstream main\n" {
+		t.Errorf("steps = %q", plan.String())
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0] != remoteHead || strings.Join(plan.Files, " ") != "code.txt" {
+		t.Errorf("plan = %v %v; want %s overwritten", plan.Changes, plan.Files, remoteHead)
+	}
+	if got := gitOut(h, upstream, "rev-parse", "main"); got != remoteHead {
+		t.Errorf("planned ForcePush moved upstream main to %s", got)
+	}
+
+	// Nothing to overwrite on a branch the remote doesn't have.
+	plan, err = DryRun(ctx, func(ctx context.Context) error { return g.ForcePush(ctx, "upstream", "wong-db") })
+	if err != nil || len(plan.Steps) != 1 || len(plan.Changes) != 0 {
+		t.Errorf("new branch plan = %+v, %v", plan, err)
+	}
+}
+
+func TestJujutsuVCS_PlanResetHard(t *testing.T) {
+	dir := t.TempDir()
+	j := &JujutsuVCS{repoRoot: dir, caps: JJCapabilitiesFor(JJVersion{}), runner: &Runner{Replay: &Transcript{Entries: []TranscriptEntry{
+		{Bin: "jj", Args: []string{"--ignore-working-copy", "log", "--no-graph", "-r", "@-", "-T", `change_id ++ "\n"`}, Stdout: "qpvuntsmwlqtxyzwmnopqrstu\n"},
+		{Bin: "jj", Args: []string{"--ignore-working-copy", "diff", "--summary", "--from", "@", "--to", "@-"}, Stdout: "M a.txt\nR {b.txt => c.txt}\n"},
+	}}}}
+
+	plan, err := DryRun(context.Background(), func(ctx context.Context) error { return j.ResetHard(ctx, "@-") })
+	if err != nil {
+		t.Fatalf("ResetHard: %v", err)
+	}
+	if plan.String() != "jj edit @-\n" {
+		t.Errorf("steps = %q", plan.String())
+	}
+	if strings.Join(plan.Changes, " ") != "qpvuntsmwlqtxyzwmnopqrstu" || strings.Join(plan.Files, " ") != "a.txt b.txt c.txt" {
+		t.Errorf("plan = %v %v", plan.Changes, plan.Files)
+	}
+}
@@ -0,0 +1,353 @@
+package vcs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReadView is a read-only view of a repository pinned to one point in time.
+// Every read through the same view observes the same repository state, even
+// if other workspaces or processes commit in between.
+type ReadView interface {
+	// PinnedAt returns what the view is pinned to: a jj operation ID, or
+	// the commit HEAD resolved to for git.
+	PinnedAt() string
+
+	CurrentChange(ctx context.Context) (*ChangeInfo, error)
+	Status(ctx context.Context) ([]StatusEntry, error)
+	HasMergeConflicts(ctx context.Context) (bool, error)
+	GetConflicts(ctx context.Context) ([]MergeConflict, error)
+	Log(ctx context.Context, limit int) ([]ChangeInfo, error)
+	Show(ctx context.Context, id string) (*ChangeInfo, error)
+	Query(ctx context.Context, revset string) ([]ChangeInfo, error)
+	ListBranches(ctx context.Context) ([]BranchInfo, error)
+	BranchExists(ctx context.Context, name string) (bool, error)
+	ResolveRef(ctx context.Context, ref string) (string, error)
+	ShowFile(ctx context.Context, ref, path string) ([]byte, error)
+}
+
+// Pinner is implemented by backends that can create a ReadView.
+type Pinner interface {
+	Pin(ctx context.Context) (ReadView, error)
+}
+
+// --- jj ---
+
+// jjReadView runs every read at a recorded operation without snapshotting
+// the working copy.
+type jjReadView struct {
+	vcs *JujutsuVCS
+	op  string
+}
+
+// Pin snapshots the working copy once and returns a ReadView of the
+// resulting operation. Reads through the view pass --at-operation and
+// --ignore-working-copy, so they neither see later operations nor pay for
+// another snapshot.
+func (j *JujutsuVCS) Pin(ctx context.Context) (ReadView, error) {
+	op, err := j.runJJ(ctx, "op", "log", "--no-graph", "--limit", "1", "-T", "id")
+	if err != nil {
+		return nil, err
+	}
+	if op == "" {
+		return nil, &CommandError{VCS: VCSTypeJujutsu, Command: "op log", Err: ErrCommandFailed, Stderr: "no operation ID"}
+	}
+	pinned := *j
+	pinned.globalArgs = []string{"--at-operation", op, "--ignore-working-copy"}
+	return &jjReadView{vcs: &pinned, op: op}, nil
+}
+
+// PinnedAt returns the operation ID. The remaining jjReadView methods run
+// the JujutsuVCS method of the same name at that operation.
+func (v *jjReadView) PinnedAt() string { return v.op }
+
+func (v *jjReadView) CurrentChange(ctx context.Context) (*ChangeInfo, error) {
+	return v.vcs.CurrentChange(ctx)
+}
+
+func (v *jjReadView) Status(ctx context.Context) ([]StatusEntry, error) {
+	return v.vcs.Status(ctx)
+}
+
+func (v *jjReadView) HasMergeConflicts(ctx context.Context) (bool, error) {
+	return v.vcs.HasMergeConflicts(ctx)
+}
+
+func (v *jjReadView) GetConflicts(ctx context.Context) ([]MergeConflict, error) {
+	return v.vcs.GetConflicts(ctx)
+}
+
+func (v *jjReadView) Log(ctx context.Context, limit int) ([]ChangeInfo, error) {
+	return v.vcs.Log(ctx, limit)
+}
+
+func (v *jjReadView) Show(ctx context.Context, id string) (*ChangeInfo, error) {
+	return v.vcs.Show(ctx, id)
+}
+
+func (v *jjReadView) Query(ctx context.Context, revset string) ([]ChangeInfo, error) {
+	return v.vcs.Query(ctx, revset)
+}
+
+func (v *jjReadView) ListBranches(ctx context.Context) ([]BranchInfo, error) {
+	return v.vcs.ListBranches(ctx)
+}
+
+func (v *jjReadView) BranchExists(ctx context.Context, name string) (bool, error) {
+	return v.vcs.BranchExists(ctx, name)
+}
+
+func (v *jjReadView) ResolveRef(ctx context.Context, ref string) (string, error) {
+	return v.vcs.ResolveRef(ctx, ref)
+}
+
+func (v *jjReadView) ShowFile(ctx context.Context, ref, path string) ([]byte, error) {
+	return v.vcs.ShowFile(ctx, ref, path)
+}
+
+// --- git ---
+
+// gitRef is one ref recorded by GitVCS.Pin.
+type gitRef struct {
+	oid    string // what the ref points to
+	commit string // oid peeled to a commit (differs for annotated tags)
+}
+
+// gitReadView answers reads from the refs, status and conflicts recorded
+// when it was pinned. Commits are immutable, so history reads only need
+// revisions rewritten to the recorded object IDs.
+type gitReadView struct {
+	g         *GitVCS
+	head      string // "" on an unborn branch
+	refs      map[string]gitRef
+	branches  []BranchInfo
+	status    []StatusEntry
+	conflicts []MergeConflict
+}
+
+// gitObjectNameRe matches full or abbreviated object names.
+var gitObjectNameRe = regexp.MustCompile(`^[0-9a-f]{4,64}$`)
+
+// Pin records HEAD, every ref, the branch list and the working tree status,
+// and returns a ReadView that resolves all revisions against them.
+func (g *GitVCS) Pin(ctx context.Context) (ReadView, error) {
+	head, err := g.runGit(ctx, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		head = "" // unborn branch
+	}
+	out, err := g.runGit(ctx, "for-each-ref", "--format=%(objectname) %(*objectname) %(refname)")
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]gitRef)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		r := gitRef{oid: fields[0], commit: fields[1]}
+		if r.commit == "" {
+			r.commit = r.oid
+		}
+		refs[fields[2]] = r
+	}
+	v := &gitReadView{g: g, head: head, refs: refs}
+	if v.branches, err = g.ListBranches(ctx); err != nil {
+		return nil, err
+	}
+	if v.status, err = g.Status(ctx); err != nil {
+		return nil, err
+	}
+	if v.conflicts, err = g.GetConflicts(ctx); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// PinnedAt returns the commit HEAD resolved to. Undocumented gitReadView
+// methods behave like the GitVCS method of the same name at that point.
+func (v *gitReadView) PinnedAt() string { return v.head }
+
+// lookup resolves name the way git does for a bare ref name, against the
+// recorded refs.
+func (v *gitReadView) lookup(name string) (string, bool) {
+	if name == "HEAD" || name == "@" {
+		return v.head, v.head != ""
+	}
+	for _, full := range []string{
+		name,
+		"refs/" + name,
+		"refs/tags/" + name,
+		"refs/heads/" + name,
+		"refs/remotes/" + name,
+		"refs/remotes/" + name + "/HEAD",
+	} {
+		if r, ok := v.refs[full]; ok {
+			return r.oid, true
+		}
+	}
+	return "", false
+}
+
+// resolve rewrites ref to the object it named when the view was pinned.
+// Suffixes such as ~1 or ^2 are applied to the recorded object.
+func (v *gitReadView) resolve(ctx context.Context, ref string) (string, error) {
+	if err := validateGitRevision(ref); err != nil {
+		return "", err
+	}
+	base, suffix := ref, ""
+	if i := strings.IndexAny(ref, "~^"); i > 0 {
+		base, suffix = ref[:i], ref[i:]
+	}
+	oid, ok := v.lookup(base)
+	if ok && suffix == "" {
+		return oid, nil
+	}
+	if !ok {
+		if !gitObjectNameRe.MatchString(base) {
+			return "", fmt.Errorf("%w: %q did not exist when the view was pinned", ErrBranchNotFound, ref)
+		}
+		oid = base
+	}
+	return v.g.runGit(ctx, "rev-parse", "--verify", "--end-of-options", oid+suffix)
+}
+
+// decorate sets IsWorking, Bookmarks and Tags from the recorded refs, so
+// they don't reflect refs created or moved after the view was pinned.
+func (v *gitReadView) decorate(changes []ChangeInfo) {
+	bookmarks := make(map[string][]string)
+	tags := make(map[string][]string)
+	for name, r := range v.refs {
+		if b, ok := strings.CutPrefix(name, "refs/heads/"); ok {
+			bookmarks[r.commit] = append(bookmarks[r.commit], b)
+		} else if t, ok := strings.CutPrefix(name, "refs/tags/"); ok {
+			tags[r.commit] = append(tags[r.commit], t)
+		}
+	}
+	for i := range changes {
+		c := &changes[i]
+		c.IsWorking = c.ID == v.head
+		c.Bookmarks = bookmarks[c.ID]
+		c.Tags = tags[c.ID]
+		sort.Strings(c.Bookmarks)
+		sort.Strings(c.Tags)
+	}
+}
+
+// show returns the commit oid names, decorated.
+func (v *gitReadView) show(ctx context.Context, oid string) (*ChangeInfo, error) {
+	c, err := v.g.showChange(ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	changes := []ChangeInfo{*c}
+	v.decorate(changes)
+	return &changes[0], nil
+}
+
+func (v *gitReadView) CurrentChange(ctx context.Context) (*ChangeInfo, error) {
+	if v.head == "" {
+		return nil, &CommandError{VCS: VCSTypeGit, Command: "log", Args: []string{"HEAD"}, Err: ErrCommandFailed, Stderr: "no commits yet"}
+	}
+	return v.show(ctx, v.head)
+}
+
+// Status returns the working tree status recorded by Pin.
+func (v *gitReadView) Status(ctx context.Context) ([]StatusEntry, error) {
+	return append([]StatusEntry{}, v.status...), nil
+}
+
+// HasMergeConflicts reports whether Pin recorded any conflicts.
+func (v *gitReadView) HasMergeConflicts(ctx context.Context) (bool, error) {
+	return len(v.conflicts) > 0, nil
+}
+
+// GetConflicts returns the conflicts recorded by Pin.
+func (v *gitReadView) GetConflicts(ctx context.Context) ([]MergeConflict, error) {
+	return append([]MergeConflict(nil), v.conflicts...), nil
+}
+
+func (v *gitReadView) Log(ctx context.Context, limit int) ([]ChangeInfo, error) {
+	if v.head == "" {
+		return nil, nil
+	}
+	var args []string
+	if limit > 0 {
+		args = append(args, "-n", strconv.Itoa(limit))
+	}
+	changes, err := v.g.logChanges(ctx, append(args, "--end-of-options", v.head, "--")...)
+	if err != nil {
+		return nil, err
+	}
+	v.decorate(changes)
+	return changes, nil
+}
+
+func (v *gitReadView) Show(ctx context.Context, id string) (*ChangeInfo, error) {
+	oid, err := v.resolve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return v.show(ctx, oid)
+}
+
+// Query evaluates revset over the commits reachable from the recorded refs;
+// see GitVCS.Query.
+func (v *gitReadView) Query(ctx context.Context, revset string) ([]ChangeInfo, error) {
+	seen := make(map[string]bool)
+	var tips []string
+	for _, r := range v.refs {
+		if !seen[r.commit] {
+			seen[r.commit] = true
+			tips = append(tips, r.commit)
+		}
+	}
+	if v.head != "" && !seen[v.head] {
+		tips = append(tips, v.head)
+	}
+	var changes []ChangeInfo
+	if len(tips) > 0 {
+		sort.Strings(tips)
+		var err error
+		changes, err = v.g.logChanges(ctx, append(append([]string{"--end-of-options"}, tips...), "--")...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	v.decorate(changes)
+	return QueryChanges(revset, changes, v.head)
+}
+
+// ListBranches returns the branches recorded by Pin.
+func (v *gitReadView) ListBranches(ctx context.Context) ([]BranchInfo, error) {
+	return append([]BranchInfo(nil), v.branches...), nil
+}
+
+func (v *gitReadView) BranchExists(ctx context.Context, name string) (bool, error) {
+	if err := ValidateRefName(name); err != nil {
+		return false, err
+	}
+	_, ok := v.refs["refs/heads/"+name]
+	return ok, nil
+}
+
+func (v *gitReadView) ResolveRef(ctx context.Context, ref string) (string, error) {
+	return v.resolve(ctx, ref)
+}
+
+func (v *gitReadView) ShowFile(ctx context.Context, ref, path string) ([]byte, error) {
+	oid, err := v.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return v.g.ShowFile(ctx, oid, path)
+}
+
+var (
+	_ Pinner = (*JujutsuVCS)(nil)
+	_ Pinner = (*GitVCS)(nil)
+)
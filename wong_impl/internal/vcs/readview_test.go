@@ -0,0 +1,174 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestGitVCS_Pin(t *testing.T) {
+	h := NewTestHelper(t)
+	repoPath := h.CreateGitRepo("pin")
+	g, err := NewGitVCS(repoPath)
+	if err != nil {
+		t.Fatalf("NewGitVCS: %v", err)
+	}
+	ctx := context.Background()
+
+	h.WriteFile(repoPath, "a.txt", "one")
+	h.runCmd(repoPath, "git", "add", "a.txt")
+	h.runCmd(repoPath, "git", "commit", "-m", "first")
+	h.runCmd(repoPath, "git", "tag", "-a", "v1", "-m", "v1")
+	h.WriteFile(repoPath, "a.txt", "two")
+	h.runCmd(repoPath, "git", "commit", "-am", "second")
+	h.WriteFile(repoPath, "dirty.txt", "x")
+
+	view, err := g.Pin(ctx)
+	if err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+	head := view.PinnedAt()
+	branch, _ := g.CurrentBranch(ctx)
+
+	// Everything below happens after the pin and must not be visible.
+	h.runCmd(repoPath, "git", "add", "dirty.txt")
+	h.runCmd(repoPath, "git", "commit", "-m", "third")
+	h.runCmd(repoPath, "git", "branch", "later")
+	h.runCmd(repoPath, "git", "tag", "v2")
+
+	current, err := view.CurrentChange(ctx)
+	if err != nil || current.ID != head || current.Description != "second" || !current.IsWorking {
+		t.Errorf("CurrentChange = %+v, %v; want the pinned HEAD", current, err)
+	}
+	if len(current.Tags) != 0 || len(current.Bookmarks) != 1 || current.Bookmarks[0] != branch {
+		t.Errorf("decoration = %v %v; want only %s", current.Bookmarks, current.Tags, branch)
+	}
+	if got, _ := view.ResolveRef(ctx, branch); got != head {
+		t.Errorf("ResolveRef(%s) = %s, want %s", branch, got, head)
+	}
+	if got, _ := view.ResolveRef(ctx, "HEAD"); got != head {
+		t.Errorf("ResolveRef(HEAD) = %s, want %s", got, head)
+	}
+	first, err := view.ResolveRef(ctx, "HEAD~1")
+	if err != nil {
+		t.Fatalf("ResolveRef(HEAD~1): %v", err)
+	}
+	if c, err := view.Show(ctx, first); err != nil || c.Description != "first" || len(c.Tags) != 1 {
+		t.Errorf("Show(HEAD~1) = %+v, %v", c, err)
+	}
+	if _, err := view.ResolveRef(ctx, "later"); !errors.Is(err, ErrBranchNotFound) {
+		t.Errorf("ResolveRef(later) error = %v, want ErrBranchNotFound", err)
+	}
+	if ok, _ := view.BranchExists(ctx, "later"); ok {
+		t.Error("BranchExists(later) saw a branch created after the pin")
+	}
+	if branches, _ := view.ListBranches(ctx); len(branches) != 1 {
+		t.Errorf("ListBranches = %+v, want one branch", branches)
+	}
+	if log, _ := view.Log(ctx, 0); len(log) != 2 {
+		t.Errorf("Log = %d commits, want 2", len(log))
+	}
+	if changes, err := view.Query(ctx, "tags()"); err != nil || len(changes) != 1 || changes[0].ID != first {
+		t.Errorf("Query(tags()) = %+v, %v; want the first commit only", changes, err)
+	}
+	if data, err := view.ShowFile(ctx, "HEAD", "a.txt"); err != nil || string(data) != "two" {
+		t.Errorf("ShowFile = %q, %v", data, err)
+	}
+	status, _ := view.Status(ctx)
+	if len(status) != 1 || status[0].Path != "dirty.txt" {
+		t.Errorf("Status = %+v, want the untracked file recorded at the pin", status)
+	}
+	if _, err := view.ResolveRef(ctx, "--output=x"); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("ResolveRef(--output=x) error = %v, want ErrInvalidRef", err)
+	}
+}
+
+func TestJujutsuVCS_PinArgs(t *testing.T) {
+	repo, argsLog := stubJJ(t, "0.28.2")
+	if err := os.WriteFile(strings.TrimSuffix(argsLog, "args.log")+"stdout.op", []byte("0a1b2c3d\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	j, err := NewJujutsuVCS(repo)
+	if err != nil {
+		t.Fatalf("NewJujutsuVCS: %v", err)
+	}
+	ctx := context.Background()
+	view, err := j.Pin(ctx)
+	if err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+	if view.PinnedAt() != "0a1b2c3d" {
+		t.Errorf("PinnedAt = %q", view.PinnedAt())
+	}
+	view.Status(ctx)
+	view.ListBranches(ctx)
+	j.Status(ctx) // the original is not pinned
+
+	data, err := os.ReadFile(argsLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Everything up to the bookmark listing is the pinned view's; the rest
+	// is the original's Status.
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	last := -1
+	for i, l := range lines {
+		if strings.HasSuffix(l, "bookmark list --all") {
+			last = i
+		}
+	}
+	if last < 2 || last == len(lines)-1 {
+		t.Fatalf("invocations = %q", lines)
+	}
+	for _, l := range lines[1 : last+1] {
+		if !strings.HasPrefix(l, "--at-operation 0a1b2c3d --ignore-working-copy ") {
+			t.Errorf("pinned read ran %q", l)
+		}
+	}
+	for _, l := range lines[last+1:] {
+		if strings.Contains(l, "--at-operation") {
+			t.Errorf("unpinned read ran %q", l)
+		}
+	}
+}
+
+func TestJujutsuVCS_Pin(t *testing.T) {
+	if _, err := exec.LookPath("jj"); err != nil {
+		t.Skip("jj not installed, skipping")
+	}
+
+	h := NewTestHelper(t)
+	repoPath := h.CreateJJRepo("jj-pin")
+	j, err := NewJujutsuVCS(repoPath)
+	if err != nil {
+		t.Fatalf("NewJujutsuVCS: %v", err)
+	}
+	ctx := context.Background()
+
+	h.WriteFile(repoPath, "a.txt", "one")
+	view, err := j.Pin(ctx)
+	if err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+	before, err := view.CurrentChange(ctx)
+	if err != nil {
+		t.Fatalf("CurrentChange: %v", err)
+	}
+
+	h.runCmd(repoPath, "jj", "commit", "-m", "after pin")
+
+	after, err := view.CurrentChange(ctx)
+	if err != nil {
+		t.Fatalf("CurrentChange: %v", err)
+	}
+	if after.ID != before.ID || after.Description != "" {
+		t.Errorf("pinned CurrentChange moved: %+v -> %+v", before, after)
+	}
+	status, err := view.Status(ctx)
+	if err != nil || len(status) != 1 {
+		t.Errorf("pinned Status = %+v, %v; want a.txt", status, err)
+	}
+}
@@ -0,0 +1,131 @@
+package vcs
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Backend describes a VCS implementation that can be detected on disk and
+// constructed for a path. Backends are registered with RegisterBackend and
+// consulted by DetectVCS, FindRepoRoot and DefaultDetector.
+type Backend struct {
+	// Type identifies the backend. Registering a second backend with the same
+	// Type replaces the first.
+	Type VCSType
+
+	// Priority orders probes when several backends match the same directory.
+	// Higher priorities win, which is how jj is preferred over git in
+	// colocated repos.
+	Priority int
+
+	// Probe reports whether dir is the root of a repository of this type.
+	// It is called for each directory from the start path up to the
+	// filesystem root and must not spawn processes.
+	Probe func(dir string) bool
+
+	// New creates a VCS instance for a path inside a detected repository.
+	New func(path string) (VCS, error)
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[VCSType]Backend)
+)
+
+func init() {
+	RegisterBackend(Backend{
+		Type:     VCSTypeJujutsu,
+		Priority: 100,
+		Probe:    func(dir string) bool { return isDirectory(filepath.Join(dir, ".jj")) },
+		New:      func(path string) (VCS, error) { return NewJujutsuVCS(path) },
+	})
+	RegisterBackend(Backend{
+		Type:     VCSTypeSapling,
+		Priority: 75,
+		Probe:    func(dir string) bool { return isDirectory(filepath.Join(dir, ".sl")) },
+		New:      func(path string) (VCS, error) { return NewSaplingVCS(path) },
+	})
+	RegisterBackend(Backend{
+		Type:     VCSTypeGit,
+		Priority: 50,
+		// .git can be a file for worktrees
+		Probe: func(dir string) bool { return isDirectoryOrFile(filepath.Join(dir, ".git")) },
+		New:   func(path string) (VCS, error) { return NewGitVCS(path) },
+	})
+	RegisterBackend(Backend{
+		Type:     VCSTypeMercurial,
+		Priority: 40,
+		Probe:    func(dir string) bool { return isDirectory(filepath.Join(dir, ".hg")) },
+		New:      func(path string) (VCS, error) { return NewMercurialVCS(path) },
+	})
+}
+
+// RegisterBackend adds a backend to the registry, replacing any backend
+// already registered with the same Type.
+func RegisterBackend(b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[b.Type] = b
+}
+
+// UnregisterBackend removes the backend registered for t, if any.
+func UnregisterBackend(t VCSType) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	delete(backends, t)
+}
+
+// LookupBackend returns the backend registered for t.
+func LookupBackend(t VCSType) (Backend, bool) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	b, ok := backends[t]
+	return b, ok
+}
+
+// Backends returns the registered backends in probe order (highest priority
+// first, ties broken by type name).
+func Backends() []Backend {
+	backendsMu.RLock()
+	list := make([]Backend, 0, len(backends))
+	for _, b := range backends {
+		list = append(list, b)
+	}
+	backendsMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Priority != list[j].Priority {
+			return list[i].Priority > list[j].Priority
+		}
+		return list[i].Type < list[j].Type
+	})
+	return list
+}
+
+// detectBackend walks up from path and returns the first directory that a
+// registered backend recognizes, along with that backend.
+func detectBackend(path string) (string, Backend, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", Backend{}, err
+	}
+
+	probes := Backends()
+	current := absPath
+	for {
+		for _, b := range probes {
+			if b.Probe != nil && b.Probe(current) {
+				return current, b, nil
+			}
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			break
+		}
+		current = parent
+	}
+
+	return "", Backend{}, ErrNoVCSFound
+}
@@ -0,0 +1,130 @@
+package vcs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackends_ProbeOrder(t *testing.T) {
+	var order []VCSType
+	for _, b := range Backends() {
+		switch b.Type {
+		case VCSTypeJujutsu, VCSTypeSapling, VCSTypeGit, VCSTypeMercurial:
+			order = append(order, b.Type)
+		}
+	}
+	want := []VCSType{VCSTypeJujutsu, VCSTypeSapling, VCSTypeGit, VCSTypeMercurial}
+	if len(order) != len(want) {
+		t.Fatalf("built-in backends = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("probe order = %v, want %v", order, want)
+			break
+		}
+	}
+}
+
+func TestDetectVCSType_MarkerDirs(t *testing.T) {
+	tests := []struct {
+		name    string
+		markers []string
+		want    VCSType
+	}{
+		{"mercurial", []string{".hg"}, VCSTypeMercurial},
+		{"sapling", []string{".sl"}, VCSTypeSapling},
+		{"jj over git", []string{".jj", ".git"}, VCSTypeJujutsu},
+		{"sapling over git", []string{".sl", ".git"}, VCSTypeSapling},
+		{"git over mercurial", []string{".git", ".hg"}, VCSTypeGit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, m := range tt.markers {
+				if err := os.Mkdir(filepath.Join(root, m), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sub := filepath.Join(root, "a", "b")
+			if err := os.MkdirAll(sub, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := detectVCSType(sub)
+			if err != nil {
+				t.Fatalf("detectVCSType failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("detectVCSType = %v, want %v", got, tt.want)
+			}
+
+			gotRoot, gotType, err := FindRepoRoot(sub)
+			if err != nil {
+				t.Fatalf("FindRepoRoot failed: %v", err)
+			}
+			if gotRoot != root || gotType != tt.want {
+				t.Errorf("FindRepoRoot = (%s, %v), want (%s, %v)", gotRoot, gotType, root, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectVCS_Mercurial(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".hg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := DetectVCS(root)
+	if err != nil {
+		t.Fatalf("DetectVCS failed: %v", err)
+	}
+	hg, ok := v.(*MercurialVCS)
+	if !ok {
+		t.Fatalf("DetectVCS returned %T, want *MercurialVCS", v)
+	}
+	if hg.Type() != VCSTypeMercurial || hg.RepoRoot() != root {
+		t.Errorf("got type %v root %s", hg.Type(), hg.RepoRoot())
+	}
+}
+
+func TestRegisterBackend_Custom(t *testing.T) {
+	const customType VCSType = "custom"
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".custom"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fake := NewFakeVCS(root)
+
+	RegisterBackend(Backend{
+		Type:     customType,
+		Priority: 10,
+		Probe:    func(dir string) bool { return isDirectory(filepath.Join(dir, ".custom")) },
+		New:      func(path string) (VCS, error) { return fake, nil },
+	})
+	t.Cleanup(func() { UnregisterBackend(customType) })
+
+	if _, ok := LookupBackend(customType); !ok {
+		t.Fatal("LookupBackend did not find registered backend")
+	}
+	got, err := detectVCSType(root)
+	if err != nil {
+		t.Fatalf("detectVCSType failed: %v", err)
+	}
+	if got != customType {
+		t.Errorf("detectVCSType = %v, want %v", got, customType)
+	}
+	v, err := DetectVCS(root)
+	if err != nil {
+		t.Fatalf("DetectVCS failed: %v", err)
+	}
+	if v != VCS(fake) {
+		t.Errorf("DetectVCS returned %v, want the registered fake", v)
+	}
+
+	UnregisterBackend(customType)
+	if _, err := detectVCSType(root); err != ErrNoVCSFound {
+		t.Errorf("after unregister, err = %v, want ErrNoVCSFound", err)
+	}
+}
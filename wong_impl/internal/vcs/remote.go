@@ -0,0 +1,487 @@
+package vcs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RemoteInfo describes a configured remote and which bookmarks it is used
+// for.
+type RemoteInfo struct {
+	Name     string
+	FetchURL string
+	PushURL  string // Same as FetchURL unless a separate push URL is set
+
+	// FetchBookmarks are the bookmarks FetchRemote updates; empty means all.
+	FetchBookmarks []string
+
+	// PushBookmarks are the bookmarks PushRemote sends; empty means the
+	// backend's default, as with Push(ctx, name, "").
+	PushBookmarks []string
+}
+
+// RemoteManager is implemented by backends that can configure remotes.
+// It lets fork-based workflows send some bookmarks (e.g. wong-db) to one
+// remote and code to another.
+type RemoteManager interface {
+	// ListRemotes returns every remote, sorted by name.
+	ListRemotes(ctx context.Context) ([]RemoteInfo, error)
+
+	AddRemote(ctx context.Context, name, url string) error
+	RemoveRemote(ctx context.Context, name string) error
+	RenameRemote(ctx context.Context, oldName, newName string) error
+	SetRemoteURL(ctx context.Context, name, url string) error
+
+	// SetRemoteFetchBookmarks limits which bookmarks FetchRemote updates
+	// from name. No bookmarks restores fetching all of them.
+	SetRemoteFetchBookmarks(ctx context.Context, name string, bookmarks []string) error
+
+	// SetRemotePushBookmarks sets the bookmarks PushRemote sends to name.
+	SetRemotePushBookmarks(ctx context.Context, name string, bookmarks []string) error
+
+	// FetchRemote fetches name's configured bookmarks.
+	FetchRemote(ctx context.Context, name string) error
+
+	// PushRemote pushes name's configured bookmarks to it.
+	PushRemote(ctx context.Context, name string) error
+
+	// PushRemoteFor returns the remote whose push bookmarks include
+	// bookmark, or the default remote (see VCS.GetRemote) if none does.
+	PushRemoteFor(ctx context.Context, bookmark string) (string, error)
+}
+
+// validateRemote checks a remote name and each bookmark name.
+func validateRemote(name string, bookmarks ...string) error {
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	for _, b := range bookmarks {
+		if err := ValidateRefName(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findRemote returns the remote called name from remotes, or ErrNoRemote.
+func findRemote(remotes []RemoteInfo, name string) (*RemoteInfo, error) {
+	for i := range remotes {
+		if remotes[i].Name == name {
+			return &remotes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoRemote, name)
+}
+
+// pushRemoteFor picks the first remote that pushes bookmark, falling back
+// to def.
+func pushRemoteFor(remotes []RemoteInfo, bookmark string, def func() (string, error)) (string, error) {
+	for _, r := range remotes {
+		for _, b := range r.PushBookmarks {
+			if b == bookmark {
+				return r.Name, nil
+			}
+		}
+	}
+	return def()
+}
+
+// --- git ---
+
+// ListRemotes reads remote.<name>.* from git config. Fetch and push
+// bookmarks come from the remote's refspecs; a fetch refspec for every
+// branch means all bookmarks.
+func (g *GitVCS) ListRemotes(ctx context.Context) ([]RemoteInfo, error) {
+	out, err := g.runGit(ctx, "remote")
+	if err != nil {
+		return nil, err
+	}
+	names := strings.Fields(out)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+	remotes := make([]RemoteInfo, len(names))
+	byName := make(map[string]*RemoteInfo, len(names))
+	for i, n := range names {
+		remotes[i].Name = n
+		byName[n] = &remotes[i]
+	}
+	config, err := g.runGit(ctx, "config", "--get-regexp", `^remote\.`)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(config, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		// Remote names may contain dots; the variable never does.
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			continue
+		}
+		r := byName[strings.TrimPrefix(key[:i], "remote.")]
+		if r == nil {
+			continue
+		}
+		switch key[i+1:] {
+		case "url":
+			r.FetchURL = value
+		case "pushurl":
+			r.PushURL = value
+		case "fetch":
+			if b, ok := gitRefspecBranch(value); ok && b != "*" {
+				r.FetchBookmarks = append(r.FetchBookmarks, b)
+			}
+		case "push":
+			if b, ok := gitRefspecBranch(value); ok {
+				r.PushBookmarks = append(r.PushBookmarks, b)
+			}
+		}
+	}
+	for i := range remotes {
+		if remotes[i].PushURL == "" {
+			remotes[i].PushURL = remotes[i].FetchURL
+		}
+	}
+	return remotes, nil
+}
+
+// gitRefspecBranch returns the branch named by the source side of a
+// refspec such as "+refs/heads/main:refs/remotes/origin/main".
+func gitRefspecBranch(refspec string) (string, bool) {
+	src, _, _ := strings.Cut(strings.TrimPrefix(refspec, "+"), ":")
+	if b, ok := strings.CutPrefix(src, "refs/heads/"); ok {
+		return b, true
+	}
+	if src != "" && !strings.HasPrefix(src, "refs/") {
+		return src, true
+	}
+	return "", false
+}
+
+// AddRemote runs git remote add.
+func (g *GitVCS) AddRemote(ctx context.Context, name, url string) error {
+	if err := validateRemote(name); err != nil {
+		return err
+	}
+	if err := validateArg("url", url); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "remote", "add", "--", name, url)
+	return err
+}
+
+// RemoveRemote runs git remote remove, which also drops its
+// remote-tracking branches.
+func (g *GitVCS) RemoveRemote(ctx context.Context, name string) error {
+	if err := validateRemote(name); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "remote", "remove", "--", name)
+	return err
+}
+
+// RenameRemote runs git remote rename, which also rewrites the default
+// fetch refspec and remote-tracking branches.
+func (g *GitVCS) RenameRemote(ctx context.Context, oldName, newName string) error {
+	if err := validateRemote(oldName, newName); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "remote", "rename", "--", oldName, newName)
+	return err
+}
+
+// SetRemoteURL runs git remote set-url. A separate push URL is left alone.
+func (g *GitVCS) SetRemoteURL(ctx context.Context, name, url string) error {
+	if err := validateRemote(name); err != nil {
+		return err
+	}
+	if err := validateArg("url", url); err != nil {
+		return err
+	}
+	_, err := g.runGit(ctx, "remote", "set-url", "--", name, url)
+	return err
+}
+
+// SetRemoteFetchBookmarks rewrites the remote's fetch refspecs with git
+// remote set-branches.
+func (g *GitVCS) SetRemoteFetchBookmarks(ctx context.Context, name string, bookmarks []string) error {
+	if err := validateRemote(name, bookmarks...); err != nil {
+		return err
+	}
+	if len(bookmarks) == 0 {
+		bookmarks = []string{"*"}
+	}
+	_, err := g.runGit(ctx, append([]string{"remote", "set-branches", "--", name}, bookmarks...)...)
+	return err
+}
+
+// SetRemotePushBookmarks replaces remote.<name>.push with a refspec per
+// bookmark, so plain git push <name> sends the same branches.
+func (g *GitVCS) SetRemotePushBookmarks(ctx context.Context, name string, bookmarks []string) error {
+	if err := validateRemote(name, bookmarks...); err != nil {
+		return err
+	}
+	remotes, err := g.ListRemotes(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := findRemote(remotes, name)
+	if err != nil {
+		return err
+	}
+	key := "remote." + name + ".push"
+	if len(r.PushBookmarks) > 0 {
+		if _, err := g.runGit(ctx, "config", "--unset-all", key); err != nil {
+			return err
+		}
+	}
+	for _, b := range bookmarks {
+		spec := "refs/heads/" + b + ":refs/heads/" + b
+		if _, err := g.runGit(ctx, "config", "--add", key, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchRemote runs git fetch <name>, which follows its fetch refspecs.
+func (g *GitVCS) FetchRemote(ctx context.Context, name string) error {
+	if err := validateRemote(name); err != nil {
+		return err
+	}
+	return g.Fetch(ctx, name, "")
+}
+
+// PushRemote runs git push <name>, which follows its push refspecs.
+func (g *GitVCS) PushRemote(ctx context.Context, name string) error {
+	if err := validateRemote(name); err != nil {
+		return err
+	}
+	return g.Push(ctx, name, "")
+}
+
+// PushRemoteFor looks bookmark up in the remotes' push refspecs.
+func (g *GitVCS) PushRemoteFor(ctx context.Context, bookmark string) (string, error) {
+	remotes, err := g.ListRemotes(ctx)
+	if err != nil {
+		return "", err
+	}
+	return pushRemoteFor(remotes, bookmark, func() (string, error) { return g.GetRemote(ctx) })
+}
+
+// --- jj ---
+
+// jj has no per-remote bookmark settings, so they are kept in repo config
+// as space-separated lists under wong.remotes.<name>.
+
+const (
+	jjFetchBookmarksKey = "fetch-bookmarks"
+	jjPushBookmarksKey  = "push-bookmarks"
+)
+
+// jjPlainKeyRe matches TOML bare keys, which need no quoting.
+var jjPlainKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// jjRemoteKey returns the repo config key holding setting for remote name.
+func jjRemoteKey(name, setting string) string {
+	if !jjPlainKeyRe.MatchString(name) {
+		name = quoteRevsetString(name)
+	}
+	return "wong.remotes." + name + "." + setting
+}
+
+// remoteBookmarks reads one of the wong.remotes settings; unset is empty.
+func (j *JujutsuVCS) remoteBookmarks(ctx context.Context, name, setting string) []string {
+	out, err := j.runJJ(ctx, "config", "get", jjRemoteKey(name, setting))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(out)
+}
+
+// setRemoteBookmarks writes a wong.remotes setting, or removes it when
+// bookmarks is empty.
+func (j *JujutsuVCS) setRemoteBookmarks(ctx context.Context, name, setting string, bookmarks []string) error {
+	key := jjRemoteKey(name, setting)
+	if len(bookmarks) == 0 {
+		if len(j.remoteBookmarks(ctx, name, setting)) == 0 {
+			return nil
+		}
+		_, err := j.runJJ(ctx, "config", "unset", "--repo", "--", key)
+		return err
+	}
+	_, err := j.runJJ(ctx, "config", "set", "--repo", "--", key, strings.Join(bookmarks, " "))
+	return err
+}
+
+// ListRemotes combines jj git remote list with the wong.remotes settings.
+func (j *JujutsuVCS) ListRemotes(ctx context.Context) ([]RemoteInfo, error) {
+	urls, err := j.GetRemoteURLs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	remotes := make([]RemoteInfo, 0, len(urls))
+	for name, url := range urls {
+		remotes = append(remotes, RemoteInfo{
+			Name:           name,
+			FetchURL:       url,
+			PushURL:        url,
+			FetchBookmarks: j.remoteBookmarks(ctx, name, jjFetchBookmarksKey),
+			PushBookmarks:  j.remoteBookmarks(ctx, name, jjPushBookmarksKey),
+		})
+	}
+	sort.Slice(remotes, func(a, b int) bool { return remotes[a].Name < remotes[b].Name })
+	return remotes, nil
+}
+
+// AddRemote runs jj git remote add.
+func (j *JujutsuVCS) AddRemote(ctx context.Context, name, url string) error {
+	if err := validateRemote(name); err != nil {
+		return err
+	}
+	if err := validateArg("url", url); err != nil {
+		return err
+	}
+	_, err := j.runJJ(ctx, "git", "remote", "add", "--", name, url)
+	return err
+}
+
+// RemoveRemote runs jj git remote remove and drops the remote's
+// wong.remotes settings.
+func (j *JujutsuVCS) RemoveRemote(ctx context.Context, name string) error {
+	if err := validateRemote(name); err != nil {
+		return err
+	}
+	if _, err := j.runJJ(ctx, "git", "remote", "remove", "--", name); err != nil {
+		return err
+	}
+	for _, setting := range []string{jjFetchBookmarksKey, jjPushBookmarksKey} {
+		if err := j.setRemoteBookmarks(ctx, name, setting, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameRemote runs jj git remote rename and moves the wong.remotes
+// settings to the new name.
+func (j *JujutsuVCS) RenameRemote(ctx context.Context, oldName, newName string) error {
+	if err := validateRemote(oldName, newName); err != nil {
+		return err
+	}
+	if _, err := j.runJJ(ctx, "git", "remote", "rename", "--", oldName, newName); err != nil {
+		return err
+	}
+	for _, setting := range []string{jjFetchBookmarksKey, jjPushBookmarksKey} {
+		bookmarks := j.remoteBookmarks(ctx, oldName, setting)
+		if len(bookmarks) == 0 {
+			continue
+		}
+		if err := j.setRemoteBookmarks(ctx, newName, setting, bookmarks); err != nil {
+			return err
+		}
+		if err := j.setRemoteBookmarks(ctx, oldName, setting, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetRemoteURL runs jj git remote set-url.
+func (j *JujutsuVCS) SetRemoteURL(ctx context.Context, name, url string) error {
+	if err := validateRemote(name); err != nil {
+		return err
+	}
+	if err := validateArg("url", url); err != nil {
+		return err
+	}
+	_, err := j.runJJ(ctx, "git", "remote", "set-url", "--", name, url)
+	return err
+}
+
+// checkRemote returns ErrNoRemote unless name is configured.
+func (j *JujutsuVCS) checkRemote(ctx context.Context, name string) error {
+	urls, err := j.GetRemoteURLs(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := urls[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrNoRemote, name)
+	}
+	return nil
+}
+
+// SetRemoteFetchBookmarks stores the list in wong.remotes.<name>.
+func (j *JujutsuVCS) SetRemoteFetchBookmarks(ctx context.Context, name string, bookmarks []string) error {
+	if err := validateRemote(name, bookmarks...); err != nil {
+		return err
+	}
+	if err := j.checkRemote(ctx, name); err != nil {
+		return err
+	}
+	return j.setRemoteBookmarks(ctx, name, jjFetchBookmarksKey, bookmarks)
+}
+
+// SetRemotePushBookmarks stores the list in wong.remotes.<name>.
+func (j *JujutsuVCS) SetRemotePushBookmarks(ctx context.Context, name string, bookmarks []string) error {
+	if err := validateRemote(name, bookmarks...); err != nil {
+		return err
+	}
+	if err := j.checkRemote(ctx, name); err != nil {
+		return err
+	}
+	return j.setRemoteBookmarks(ctx, name, jjPushBookmarksKey, bookmarks)
+}
+
+// FetchRemote runs jj git fetch --remote name with a --branch pattern per
+// configured bookmark.
+func (j *JujutsuVCS) FetchRemote(ctx context.Context, name string) error {
+	if err := validateRemote(name); err != nil {
+		return err
+	}
+	args := []string{"git", "fetch", "--remote", name}
+	for _, b := range j.remoteBookmarks(ctx, name, jjFetchBookmarksKey) {
+		pattern, err := jjBookmarkPattern(b)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--branch", pattern)
+	}
+	_, err := j.runJJ(ctx, args...)
+	return err
+}
+
+// PushRemote runs jj git push --remote name with a bookmark flag per
+// configured bookmark.
+func (j *JujutsuVCS) PushRemote(ctx context.Context, name string) error {
+	if err := validateRemote(name); err != nil {
+		return err
+	}
+	args := []string{"git", "push", "--remote", name}
+	for _, b := range j.remoteBookmarks(ctx, name, jjPushBookmarksKey) {
+		pattern, err := jjBookmarkPattern(b)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--bookmark", pattern)
+	}
+	_, err := j.runJJ(ctx, args...)
+	return err
+}
+
+// PushRemoteFor looks bookmark up in the wong.remotes push settings.
+func (j *JujutsuVCS) PushRemoteFor(ctx context.Context, bookmark string) (string, error) {
+	remotes, err := j.ListRemotes(ctx)
+	if err != nil {
+		return "", err
+	}
+	return pushRemoteFor(remotes, bookmark, func() (string, error) { return j.GetRemote(ctx) })
+}
+
+var (
+	_ RemoteManager = (*GitVCS)(nil)
+	_ RemoteManager = (*JujutsuVCS)(nil)
+)
@@ -0,0 +1,180 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRemotesRepo returns a git repo with main and wong-db branches and two
+// empty bare repositories to use as remotes.
+func gitRemotesRepo(t *testing.T) (g *GitVCS, h *TestHelper, repo, upstream, fork string) {
+	t.Helper()
+	h = NewTestHelper(t)
+	upstream = h.CreateGitRepo("upstream.git")
+	h.runCmd(upstream, "git", "config", "core.bare", "true")
+	fork = h.CreateGitRepo("fork.git")
+	h.runCmd(fork, "git", "config", "core.bare", "true")
+	repo = h.CreateGitRepo("repo")
+	h.runCmd(repo, "git", "checkout", "-q", "-b", "main")
+	h.WriteFile(repo, "code.txt", "code\n")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-q", "-m", "code")
+	h.runCmd(repo, "git", "branch", "wong-db")
+	g, err := NewGitVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g, h, repo, upstream, fork
+}
+
+func TestGitVCS_RemoteManager(t *testing.T) {
+	g, h, repo, upstream, fork := gitRemotesRepo(t)
+	ctx := context.Background()
+	if err := g.AddRemote(ctx, "upstream", upstream); err != nil {
+		t.Fatalf("AddRemote: %v", err)
+	}
+	if err := g.AddRemote(ctx, "fork", fork); err != nil {
+		t.Fatalf("AddRemote: %v", err)
+	}
+	if err := g.SetRemotePushBookmarks(ctx, "upstream", []string{"main"}); err != nil {
+		t.Fatalf("SetRemotePushBookmarks: %v", err)
+	}
+	if err := g.SetRemotePushBookmarks(ctx, "fork", []string{"wong-db"}); err != nil {
+		t.Fatalf("SetRemotePushBookmarks: %v", err)
+	}
+
+	remotes, err := g.ListRemotes(ctx)
+	if err != nil {
+		t.Fatalf("ListRemotes: %v", err)
+	}
+	if len(remotes) != 2 || remotes[0].Name != "fork" || remotes[1].Name != "upstream" {
+		t.Fatalf("ListRemotes = %+v", remotes)
+	}
+	if r := remotes[0]; r.FetchURL != fork || r.PushURL != fork || len(r.FetchBookmarks) != 0 || strings.Join(r.PushBookmarks, " ") != "wong-db" {
+		t.Errorf("fork = %+v", r)
+	}
+
+	for _, name := range []string{"upstream", "fork"} {
+		if err := g.PushRemote(ctx, name); err != nil {
+			t.Fatalf("PushRemote(%s): %v", name, err)
+		}
+	}
+	if got := gitOut(h, upstream, "for-each-ref", "--format=%(refname)"); got != "refs/heads/main" {
+		t.Errorf("upstream refs = %q", got)
+	}
+	if got := gitOut(h, fork, "for-each-ref", "--format=%(refname)"); got != "refs/heads/wong-db" {
+		t.Errorf("fork refs = %q", got)
+	}
+	if got, err := g.PushRemoteFor(ctx, "wong-db"); err != nil || got != "fork" {
+		t.Errorf("PushRemoteFor(wong-db) = %q, %v", got, err)
+	}
+
+	// Limiting fetch to main leaves the other branch alone. Pushing by URL
+	// keeps git from creating the tracking ref itself.
+	h.runCmd(repo, "git", "push", "-q", upstream, "wong-db")
+	if err := g.SetRemoteFetchBookmarks(ctx, "upstream", []string{"main"}); err != nil {
+		t.Fatalf("SetRemoteFetchBookmarks: %v", err)
+	}
+	if err := g.FetchRemote(ctx, "upstream"); err != nil {
+		t.Fatalf("FetchRemote: %v", err)
+	}
+	if got := gitOut(h, repo, "for-each-ref", "--format=%(refname)", "refs/remotes/upstream/"); got != "refs/remotes/upstream/main" {
+		t.Errorf("fetched %q", got)
+	}
+	if err := g.SetRemoteFetchBookmarks(ctx, "upstream", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.FetchRemote(ctx, "upstream"); err != nil {
+		t.Fatal(err)
+	}
+	if got := gitOut(h, repo, "for-each-ref", "--format=%(refname)", "refs/remotes/upstream/"); got != "refs/remotes/upstream/main\nrefs/remotes/upstream/wong-db" {
+		t.Errorf("fetched after reset %q", got)
+	}
+
+	if err := g.RenameRemote(ctx, "fork", "mine"); err != nil {
+		t.Fatalf("RenameRemote: %v", err)
+	}
+	if got, err := g.PushRemoteFor(ctx, "wong-db"); err != nil || got != "mine" {
+		t.Errorf("PushRemoteFor after rename = %q, %v", got, err)
+	}
+	if err := g.SetRemoteURL(ctx, "mine", upstream); err != nil {
+		t.Fatalf("SetRemoteURL: %v", err)
+	}
+	if got, _ := g.GetRemoteURL(ctx, "mine"); got != upstream {
+		t.Errorf("url after SetRemoteURL = %q", got)
+	}
+	if err := g.RemoveRemote(ctx, "mine"); err != nil {
+		t.Fatalf("RemoveRemote: %v", err)
+	}
+	if got, err := g.PushRemoteFor(ctx, "wong-db"); err != nil || got != "upstream" {
+		t.Errorf("PushRemoteFor falls back to %q, %v; want upstream", got, err)
+	}
+
+	if err := g.SetRemotePushBookmarks(ctx, "missing", nil); !errors.Is(err, ErrNoRemote) {
+		t.Errorf("SetRemotePushBookmarks(missing) = %v; want ErrNoRemote", err)
+	}
+	if err := g.AddRemote(ctx, "-x", upstream); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("AddRemote(-x) = %v; want ErrInvalidRef", err)
+	}
+}
+
+func TestJujutsuVCS_RemoteManager(t *testing.T) {
+	repo, argsLog := stubJJ(t, "0.28.2")
+	dir := filepath.Dir(repo)
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("stdout.git", "fork /srv/fork.git\nupstream /srv/upstream.git\n")
+	j, err := NewJujutsuVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := j.AddRemote(ctx, "fork", "/srv/fork.git"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.SetRemotePushBookmarks(ctx, "fork", []string{"wong-db", "main"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.SetRemotePushBookmarks(ctx, "missing", []string{"main"}); !errors.Is(err, ErrNoRemote) {
+		t.Errorf("SetRemotePushBookmarks(missing) = %v; want ErrNoRemote", err)
+	}
+	write("stdout.config", "wong-db main\n")
+	if err := j.PushRemote(ctx, "fork"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.RenameRemote(ctx, "fork", "my.fork"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(argsLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"git remote add -- fork /srv/fork.git",
+		"git remote list",
+		"config set --repo -- wong.remotes.fork.push-bookmarks wong-db main",
+		"git remote list",
+		"config get wong.remotes.fork.push-bookmarks",
+		"git push --remote fork --bookmark exact:wong-db --bookmark exact:main",
+		"git remote rename -- fork my.fork",
+		"config get wong.remotes.fork.fetch-bookmarks",
+		`config set --repo -- wong.remotes."my.fork".fetch-bookmarks wong-db main`,
+		"config get wong.remotes.fork.fetch-bookmarks",
+		"config unset --repo -- wong.remotes.fork.fetch-bookmarks",
+		"config get wong.remotes.fork.push-bookmarks",
+		`config set --repo -- wong.remotes."my.fork".push-bookmarks wong-db main`,
+		"config get wong.remotes.fork.push-bookmarks",
+		"config unset --repo -- wong.remotes.fork.push-bookmarks",
+	}
+	if got := strings.Split(strings.TrimSpace(string(data)), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("invocations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
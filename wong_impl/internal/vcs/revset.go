@@ -0,0 +1,855 @@
+package vcs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// RevsetCommit is one node of the graph EvalRevset evaluates against.
+type RevsetCommit struct {
+	ID          string
+	Parents     []string
+	Bookmarks   []string
+	Tags        []string
+	Description string
+	Author      string
+	AuthorEmail string
+}
+
+// EvalRevset evaluates a jj-style revset over commits and returns the IDs of
+// the matching commits in the order they appear in commits. working is the
+// ID that "@" refers to.
+//
+// Backends without native revsets use it to implement Query. The supported
+// subset is:
+//
+//	@, bookmark or tag names, commit IDs (or unique prefixes of 4+ chars)
+//	x | y, x & y, x ~ y, ~x, (x)
+//	::x, x::, x::y, ..x, x.., x..y, x-, x+
+//	all(), none(), root(), heads(x), roots(x), parents(x), children(x),
+//	ancestors(x), descendants(x), bookmarks([pattern]), tags([pattern]),
+//	description(pattern), author(pattern)
+//
+// Patterns are quoted or bare strings, optionally prefixed with "exact:",
+// "glob:", "substring:" or "regex:". The default is substring, as in jj.
+func EvalRevset(expr string, commits []RevsetCommit, working string) ([]string, error) {
+	node, err := parseRevset(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	g := newRevsetGraph(commits, working)
+	set, err := g.eval(node)
+	if err != nil {
+		return nil, fmt.Errorf("revset %q: %w", expr, err)
+	}
+	var ids []string
+	for _, c := range commits {
+		if set[c.ID] {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids, nil
+}
+
+// parseRevset parses expr into its syntax tree.
+func parseRevset(expr string) (*revsetNode, error) {
+	p := &revsetParser{input: expr}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	node, err := p.parseUnion()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("revset %q: unexpected %q at offset %d", expr, tok.text, tok.pos)
+	}
+	return node, nil
+}
+
+// revsetScope reports whether expr gives the same result when evaluated over
+// just the ancestors of the symbols it names, and returns those symbols. That
+// holds when every commit expr can match is such an ancestor and every
+// operator that looks at ancestors (::x, x..y, parents(), heads() and the
+// like) is applied to a set that is too. Expressions that can reach further,
+// such as all(), x:: or description(), report false, as do ones that don't
+// parse.
+func revsetScope(expr string) (symbols []string, ok bool) {
+	node, err := parseRevset(expr)
+	if err != nil {
+		return nil, false
+	}
+	seen := map[string]bool{}
+	bounded, ok := revsetNodeScope(node, func(sym string) {
+		if !seen[sym] {
+			seen[sym] = true
+			symbols = append(symbols, sym)
+		}
+	})
+	if !bounded || !ok {
+		return nil, false
+	}
+	return symbols, true
+}
+
+// revsetNodeScope walks n for revsetScope, passing each symbol it evaluates
+// to addSymbol. bounded reports whether n's result lies within the ancestors
+// of those symbols; ok reports whether n evaluates the same over just them.
+func revsetNodeScope(n *revsetNode, addSymbol func(string)) (bounded, ok bool) {
+	sub := func(i int) (bool, bool) {
+		if i >= len(n.args) {
+			return false, true // evaluation reports the missing argument
+		}
+		return revsetNodeScope(n.args[i], addSymbol)
+	}
+	switch n.op {
+	case "symbol":
+		addSymbol(n.name)
+		return true, true
+	case "string":
+		return false, true
+	case "not":
+		_, ok := sub(0)
+		return false, ok
+	case "|", "&", "~", "::", "..":
+		xb, xok := sub(0)
+		yb, yok := sub(1)
+		switch n.op {
+		case "|":
+			return xb && yb, xok && yok
+		case "&":
+			return xb || yb, xok && yok
+		case "~":
+			return xb, xok && yok
+		case "::":
+			return yb, xok && yok && yb
+		default: // ..
+			return yb, xok && yok && xb && yb
+		}
+	case "prefix::", "prefix..":
+		b, ok := sub(0)
+		return b, ok && b
+	case "postfix::":
+		_, ok := sub(0)
+		return false, ok
+	case "postfix..":
+		b, ok := sub(0)
+		return false, ok && b
+	case "fn":
+		switch n.name {
+		case "none":
+			return true, true
+		case "parents", "ancestors", "heads":
+			b, ok := sub(0)
+			return b, ok && b
+		case "roots":
+			return sub(0)
+		case "children", "descendants":
+			_, ok := sub(0)
+			return false, ok
+		}
+		// all(), root() and the pattern functions look at every commit.
+		return false, true
+	}
+	return false, false
+}
+
+// --- Lexer ---
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokOp // | & ~ ( ) , :: .. - + :
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type revsetParser struct {
+	input  string
+	tokens []token
+	pos    int
+}
+
+// isIdentRune reports whether r can appear in a symbol.
+func isIdentRune(r byte) bool {
+	return r == '_' || r == '/' || r == '@' || r < 0x80 && (unicode.IsLetter(rune(r)) || unicode.IsDigit(rune(r)))
+}
+
+func (p *revsetParser) tokenize() error {
+	s := p.input
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case strings.HasPrefix(s[i:], "::") || strings.HasPrefix(s[i:], ".."):
+			p.tokens = append(p.tokens, token{tokOp, s[i : i+2], i})
+			i += 2
+		case strings.ContainsRune("|&~(),-+:", rune(c)):
+			p.tokens = append(p.tokens, token{tokOp, string(c), i})
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return fmt.Errorf("revset %q: unterminated string at offset %d", s, i)
+			}
+			p.tokens = append(p.tokens, token{tokString, b.String(), i})
+			i = j + 1
+		case isIdentRune(c):
+			// Symbols may contain '-', '.' and '+' between identifier
+			// characters ("wong-db", "v1.2"), but a trailing '-' or '+' is
+			// the parents/children operator and ".." is a range.
+			j := i + 1
+			for j < len(s) {
+				if isIdentRune(s[j]) {
+					j++
+					continue
+				}
+				if (s[j] == '-' || s[j] == '.' || s[j] == '+') && j+1 < len(s) && isIdentRune(s[j+1]) {
+					j += 2
+					continue
+				}
+				break
+			}
+			p.tokens = append(p.tokens, token{tokIdent, s[i:j], i})
+			i = j
+		default:
+			return fmt.Errorf("revset %q: unexpected character %q at offset %d", s, c, i)
+		}
+	}
+	p.tokens = append(p.tokens, token{tokEOF, "", len(s)})
+	return nil
+}
+
+func (p *revsetParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *revsetParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *revsetParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *revsetParser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	return fmt.Errorf("revset %q: %s at offset %d", p.input, fmt.Sprintf(format, args...), t.pos)
+}
+
+// --- Parser (precedence from loosest: |, & and infix ~, prefix ~, ranges, postfix -/+) ---
+
+// revsetNode is a parsed revset expression.
+type revsetNode struct {
+	op   string // "symbol", "string", "fn", or an operator
+	name string // symbol, string or function name
+	args []*revsetNode
+}
+
+func (p *revsetParser) parseUnion() (*revsetNode, error) {
+	left, err := p.parseIntersection()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("|") {
+		right, err := p.parseIntersection()
+		if err != nil {
+			return nil, err
+		}
+		left = &revsetNode{op: "|", args: []*revsetNode{left, right}}
+	}
+	return left, nil
+}
+
+func (p *revsetParser) parseIntersection() (*revsetNode, error) {
+	left, err := p.parseNegation()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.accept("&"):
+			op = "&"
+		case p.accept("~"):
+			op = "~"
+		default:
+			return left, nil
+		}
+		right, err := p.parseNegation()
+		if err != nil {
+			return nil, err
+		}
+		left = &revsetNode{op: op, args: []*revsetNode{left, right}}
+	}
+}
+
+func (p *revsetParser) parseNegation() (*revsetNode, error) {
+	if p.accept("~") {
+		operand, err := p.parseNegation()
+		if err != nil {
+			return nil, err
+		}
+		return &revsetNode{op: "not", args: []*revsetNode{operand}}, nil
+	}
+	return p.parseRange()
+}
+
+func (p *revsetParser) parseRange() (*revsetNode, error) {
+	for _, op := range []string{"::", ".."} {
+		if p.accept(op) {
+			if p.startsOperand() {
+				operand, err := p.parsePostfix()
+				if err != nil {
+					return nil, err
+				}
+				return &revsetNode{op: "prefix" + op, args: []*revsetNode{operand}}, nil
+			}
+			// Bare "::" or ".." means everything.
+			return &revsetNode{op: "fn", name: "all"}, nil
+		}
+	}
+
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"::", ".."} {
+		if p.accept(op) {
+			if !p.startsOperand() {
+				return &revsetNode{op: "postfix" + op, args: []*revsetNode{left}}, nil
+			}
+			right, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return &revsetNode{op: op, args: []*revsetNode{left, right}}, nil
+		}
+	}
+	return left, nil
+}
+
+// startsOperand reports whether the next token can begin a primary.
+func (p *revsetParser) startsOperand() bool {
+	t := p.peek()
+	return t.kind == tokIdent || t.kind == tokString || t.kind == tokOp && t.text == "("
+}
+
+func (p *revsetParser) parsePostfix() (*revsetNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("-"):
+			node = &revsetNode{op: "fn", name: "parents", args: []*revsetNode{node}}
+		case p.accept("+"):
+			node = &revsetNode{op: "fn", name: "children", args: []*revsetNode{node}}
+		default:
+			return node, nil
+		}
+	}
+}
+
+func (p *revsetParser) parsePrimary() (*revsetNode, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokOp && t.text == "(":
+		node, err := p.parseUnion()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf("expected )")
+		}
+		return node, nil
+	case t.kind == tokString:
+		return &revsetNode{op: "symbol", name: t.text}, nil
+	case t.kind == tokIdent:
+		if !p.accept("(") {
+			return &revsetNode{op: "symbol", name: t.text}, nil
+		}
+		fn := &revsetNode{op: "fn", name: t.text}
+		if p.accept(")") {
+			return fn, nil
+		}
+		for {
+			arg, err := p.parseArg()
+			if err != nil {
+				return nil, err
+			}
+			fn.args = append(fn.args, arg)
+			if p.accept(")") {
+				return fn, nil
+			}
+			if !p.accept(",") {
+				return nil, p.errorf("expected , or )")
+			}
+		}
+	default:
+		if t.kind == tokEOF {
+			return nil, p.errorf("unexpected end of revset")
+		}
+		p.pos--
+		return nil, p.errorf("unexpected %q", t.text)
+	}
+}
+
+// parseArg parses a function argument: a "kind:value" pattern or a revset.
+func (p *revsetParser) parseArg() (*revsetNode, error) {
+	if t := p.peek(); t.kind == tokIdent && p.tokens[p.pos+1].kind == tokOp && p.tokens[p.pos+1].text == ":" {
+		p.pos += 2
+		v := p.next()
+		if v.kind != tokString && v.kind != tokIdent {
+			if v.kind != tokEOF {
+				p.pos--
+			}
+			return nil, p.errorf("expected pattern after %s:", t.text)
+		}
+		return &revsetNode{op: "string", name: t.text + ":" + v.text}, nil
+	}
+	return p.parseUnion()
+}
+
+// --- Evaluation ---
+
+type revsetSet map[string]bool
+
+type revsetGraph struct {
+	commits  []RevsetCommit
+	byID     map[string]*RevsetCommit
+	children map[string][]string
+	working  string
+}
+
+func newRevsetGraph(commits []RevsetCommit, working string) *revsetGraph {
+	g := &revsetGraph{
+		commits:  commits,
+		byID:     make(map[string]*RevsetCommit, len(commits)),
+		children: make(map[string][]string),
+		working:  working,
+	}
+	for i := range commits {
+		c := &commits[i]
+		g.byID[c.ID] = c
+		for _, p := range c.Parents {
+			g.children[p] = append(g.children[p], c.ID)
+		}
+	}
+	return g
+}
+
+func (g *revsetGraph) all() revsetSet {
+	s := make(revsetSet, len(g.commits))
+	for _, c := range g.commits {
+		s[c.ID] = true
+	}
+	return s
+}
+
+// walk returns the closure of set over next (parents or children).
+func (g *revsetGraph) walk(set revsetSet, next func(string) []string) revsetSet {
+	out := make(revsetSet, len(set))
+	stack := make([]string, 0, len(set))
+	for id := range set {
+		stack = append(stack, id)
+	}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if out[id] {
+			continue
+		}
+		out[id] = true
+		stack = append(stack, next(id)...)
+	}
+	return out
+}
+
+func (g *revsetGraph) parentsOf(id string) []string {
+	if c, ok := g.byID[id]; ok {
+		return c.Parents
+	}
+	return nil
+}
+
+func (g *revsetGraph) childrenOf(id string) []string {
+	return g.children[id]
+}
+
+func (g *revsetGraph) ancestors(s revsetSet) revsetSet   { return g.walk(s, g.parentsOf) }
+func (g *revsetGraph) descendants(s revsetSet) revsetSet { return g.walk(s, g.childrenOf) }
+
+func intersect(a, b revsetSet) revsetSet {
+	out := make(revsetSet)
+	for id := range a {
+		if b[id] {
+			out[id] = true
+		}
+	}
+	return out
+}
+
+func union(a, b revsetSet) revsetSet {
+	out := make(revsetSet, len(a)+len(b))
+	for id := range a {
+		out[id] = true
+	}
+	for id := range b {
+		out[id] = true
+	}
+	return out
+}
+
+func difference(a, b revsetSet) revsetSet {
+	out := make(revsetSet)
+	for id := range a {
+		if !b[id] {
+			out[id] = true
+		}
+	}
+	return out
+}
+
+func (g *revsetGraph) eval(n *revsetNode) (revsetSet, error) {
+	switch n.op {
+	case "symbol":
+		id, err := g.resolve(n.name)
+		if err != nil {
+			return nil, err
+		}
+		return revsetSet{id: true}, nil
+	case "string":
+		return nil, fmt.Errorf("pattern %q is only valid as a function argument", n.name)
+	case "fn":
+		return g.evalFunc(n)
+	case "not":
+		s, err := g.eval(n.args[0])
+		if err != nil {
+			return nil, err
+		}
+		return difference(g.all(), s), nil
+	}
+
+	sets := make([]revsetSet, len(n.args))
+	for i, a := range n.args {
+		s, err := g.eval(a)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = s
+	}
+	switch n.op {
+	case "|":
+		return union(sets[0], sets[1]), nil
+	case "&":
+		return intersect(sets[0], sets[1]), nil
+	case "~":
+		return difference(sets[0], sets[1]), nil
+	case "prefix::", "prefix..":
+		// ..x also excludes the root in jj; there is no virtual root here.
+		return g.ancestors(sets[0]), nil
+	case "postfix::":
+		return g.descendants(sets[0]), nil
+	case "postfix..":
+		return difference(g.all(), g.ancestors(sets[0])), nil
+	case "::":
+		return intersect(g.descendants(sets[0]), g.ancestors(sets[1])), nil
+	case "..":
+		return difference(g.ancestors(sets[1]), g.ancestors(sets[0])), nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", n.op)
+}
+
+// resolve maps a symbol to a commit ID.
+func (g *revsetGraph) resolve(sym string) (string, error) {
+	if sym == "@" || sym == "HEAD" {
+		if g.working == "" {
+			return "", fmt.Errorf("no working copy commit")
+		}
+		return g.working, nil
+	}
+	for _, c := range g.commits {
+		for _, b := range c.Bookmarks {
+			if b == sym {
+				return c.ID, nil
+			}
+		}
+	}
+	for _, c := range g.commits {
+		for _, tag := range c.Tags {
+			if tag == sym {
+				return c.ID, nil
+			}
+		}
+	}
+	if _, ok := g.byID[sym]; ok {
+		return sym, nil
+	}
+	if len(sym) >= 4 {
+		var match string
+		for _, c := range g.commits {
+			if strings.HasPrefix(c.ID, sym) {
+				if match != "" {
+					return "", fmt.Errorf("commit ID prefix %q is ambiguous", sym)
+				}
+				match = c.ID
+			}
+		}
+		if match != "" {
+			return match, nil
+		}
+	}
+	return "", fmt.Errorf("revision %q doesn't exist: %w", sym, ErrBranchNotFound)
+}
+
+func (g *revsetGraph) evalFunc(n *revsetNode) (revsetSet, error) {
+	arity := func(min, max int) error {
+		if len(n.args) < min || len(n.args) > max {
+			return fmt.Errorf("%s() takes %d to %d arguments, got %d", n.name, min, max, len(n.args))
+		}
+		return nil
+	}
+	setArg := func() (revsetSet, error) {
+		if err := arity(1, 1); err != nil {
+			return nil, err
+		}
+		return g.eval(n.args[0])
+	}
+	patternArg := func(optional bool) (func(string) bool, error) {
+		min := 1
+		if optional {
+			min = 0
+		}
+		if err := arity(min, 1); err != nil {
+			return nil, err
+		}
+		if len(n.args) == 0 {
+			return func(string) bool { return true }, nil
+		}
+		a := n.args[0]
+		if a.op != "string" && a.op != "symbol" {
+			return nil, fmt.Errorf("%s() expects a string pattern", n.name)
+		}
+		return compilePattern(a.name)
+	}
+
+	switch n.name {
+	case "all":
+		return g.all(), arity(0, 0)
+	case "none":
+		return revsetSet{}, arity(0, 0)
+	case "root":
+		s := revsetSet{}
+		for _, c := range g.commits {
+			if len(c.Parents) == 0 {
+				s[c.ID] = true
+			}
+		}
+		return s, arity(0, 0)
+	case "parents", "children", "ancestors", "descendants", "heads", "roots":
+		s, err := setArg()
+		if err != nil {
+			return nil, err
+		}
+		switch n.name {
+		case "parents":
+			out := revsetSet{}
+			for id := range s {
+				for _, p := range g.parentsOf(id) {
+					out[p] = true
+				}
+			}
+			return out, nil
+		case "children":
+			out := revsetSet{}
+			for id := range s {
+				for _, c := range g.childrenOf(id) {
+					out[c] = true
+				}
+			}
+			return out, nil
+		case "ancestors":
+			return g.ancestors(s), nil
+		case "descendants":
+			return g.descendants(s), nil
+		case "heads":
+			// Members of s with no descendants in s.
+			out := revsetSet{}
+			for id := range s {
+				out[id] = true
+			}
+			for id := range s {
+				for p := range g.ancestors(revsetSet{id: true}) {
+					if p != id {
+						delete(out, p)
+					}
+				}
+			}
+			return out, nil
+		default: // roots
+			out := revsetSet{}
+			for id := range s {
+				out[id] = true
+			}
+			for id := range s {
+				for d := range g.descendants(revsetSet{id: true}) {
+					if d != id {
+						delete(out, d)
+					}
+				}
+			}
+			return out, nil
+		}
+	case "bookmarks", "branches", "tags", "description", "author":
+		match, err := patternArg(n.name != "description" && n.name != "author")
+		if err != nil {
+			return nil, err
+		}
+		out := revsetSet{}
+		for _, c := range g.commits {
+			var fields []string
+			switch n.name {
+			case "bookmarks", "branches":
+				fields = c.Bookmarks
+			case "tags":
+				fields = c.Tags
+			case "description":
+				fields = []string{c.Description}
+			case "author":
+				fields = []string{c.Author, c.AuthorEmail}
+			}
+			for _, f := range fields {
+				if match(f) {
+					out[c.ID] = true
+					break
+				}
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("function %s() is not supported: %w", n.name, ErrNotSupported)
+}
+
+// compilePattern turns a jj string pattern into a matcher.
+func compilePattern(pattern string) (func(string) bool, error) {
+	kind, value, ok := strings.Cut(pattern, ":")
+	if !ok {
+		kind, value = "substring", pattern
+	}
+	switch kind {
+	case "exact":
+		return func(s string) bool { return s == value }, nil
+	case "substring":
+		return func(s string) bool { return strings.Contains(s, value) }, nil
+	case "glob":
+		re, err := regexp.Compile(globToRegexp(value))
+		if err != nil {
+			return nil, fmt.Errorf("bad glob %q: %w", value, err)
+		}
+		return re.MatchString, nil
+	case "regex":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("bad regex %q: %w", value, err)
+		}
+		return re.MatchString, nil
+	}
+	// Not a known kind: the colon was part of a substring.
+	return func(s string) bool { return strings.Contains(s, pattern) }, nil
+}
+
+// globToRegexp translates a glob into an anchored regexp. As in jj, the
+// glob must match the whole string, '*' also matches '/' and newlines, and
+// [...] classes are passed through.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString(`$`)
+	return b.String()
+}
+
+// QueryChanges evaluates revset over changes with EvalRevset and returns the
+// matching changes in their original order. working is the ID "@" refers to.
+func QueryChanges(revset string, changes []ChangeInfo, working string) ([]ChangeInfo, error) {
+	commits := make([]RevsetCommit, len(changes))
+	for i, c := range changes {
+		desc := c.FullDescription
+		if desc == "" {
+			desc = c.Description
+		}
+		commits[i] = RevsetCommit{
+			ID:          c.ID,
+			Parents:     c.Parents,
+			Bookmarks:   c.Bookmarks,
+			Tags:        c.Tags,
+			Description: desc,
+			Author:      c.Author,
+			AuthorEmail: c.AuthorEmail,
+		}
+	}
+	ids, err := EvalRevset(revset, commits, working)
+	if err != nil {
+		return nil, err
+	}
+	matched := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		matched[id] = true
+	}
+	var result []ChangeInfo
+	for _, c := range changes {
+		if matched[c.ID] {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
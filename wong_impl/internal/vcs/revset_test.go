@@ -0,0 +1,303 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// revsetTestGraph is, newest first:
+//
+//	d999999  merge of c333333 and f666666 (@)
+//	f666666  feature
+//	e555555  wong-db
+//	c333333  main
+//	b222222  tag v1.0
+//	a111111  root
+var revsetTestGraph = []RevsetCommit{
+	{ID: "d999999", Parents: []string{"c333333", "f666666"}, Description: "Merge feature", Author: "Alice", AuthorEmail: "alice@example.com"},
+	{ID: "f666666", Parents: []string{"e555555"}, Bookmarks: []string{"feature"}, Description: "feat: two", Author: "Bob", AuthorEmail: "bob@example.com"},
+	{ID: "e555555", Parents: []string{"b222222"}, Bookmarks: []string{"wong-db"}, Description: "feat: one", Author: "Bob", AuthorEmail: "bob@example.com"},
+	{ID: "c333333", Parents: []string{"b222222"}, Bookmarks: []string{"main"}, Description: "fix: bug\n\nlong body", Author: "Alice", AuthorEmail: "alice@example.com"},
+	{ID: "b222222", Parents: []string{"a111111"}, Tags: []string{"v1.0"}, Description: "second", Author: "Alice", AuthorEmail: "alice@example.com"},
+	{ID: "a111111", Description: "initial", Author: "Alice", AuthorEmail: "alice@example.com"},
+}
+
+func TestEvalRevset(t *testing.T) {
+	tests := []struct {
+		revset string
+		want   string // space-separated ID prefixes, in graph order
+	}{
+		{"@", "d"},
+		{"@-", "f c"},
+		{"parents(@) & wong-db", ""},
+		{"wong-db-", "b"},
+		{"b222222+", "e c"},
+		{"::main", "c b a"},
+		{"..main", "c b a"},
+		{"main..", "d f e"},
+		{"main..feature", "f e"},
+		{"feature::", "d f"},
+		{"b222222::@", "d f e c b"},
+		{"::", "d f e c b a"},
+		{"heads(::@ ~ @)", "f c"},
+		{"roots(main..@)", "e"},
+		{"bookmarks()", "f e c"},
+		{"bookmarks(feat)", "f"},
+		{`bookmarks(exact:"main")`, "c"},
+		{`bookmarks(glob:"*-*")`, "e"},
+		{"tags()", "b"},
+		{"v1.0", "b"},
+		{`"feature"`, "f"},
+		{"c3333", "c"},
+		{`description(glob:"feat:*")`, "f e"},
+		{`description("long body")`, "c"},
+		{`description(regex:"^fix")`, "c"},
+		{`description(exact:"second")`, "b"},
+		{"author(bob@example.com)", "f e"},
+		{"author(Alice) & tags()", "b"},
+		{"description(feat) & ~feature", "d e"},
+		{"all() ~ ::main", "d f e"},
+		{"~::main", "d f e"},
+		{"::main | feature", "f c b a"},
+		{"(::main | feature) & ::@-", "f c b a"},
+		{"none()", ""},
+		{"root()", "a"},
+		{"ancestors(wong-db)", "e b a"},
+		{"descendants(wong-db)", "d f e"},
+	}
+	for _, tt := range tests {
+		ids, err := EvalRevset(tt.revset, revsetTestGraph, "d999999")
+		if err != nil {
+			t.Errorf("EvalRevset(%q): %v", tt.revset, err)
+			continue
+		}
+		var got []string
+		for _, id := range ids {
+			got = append(got, id[:1])
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("EvalRevset(%q) = %v, want %q", tt.revset, got, tt.want)
+		}
+	}
+}
+
+func TestEvalRevset_Errors(t *testing.T) {
+	tests := []struct {
+		revset string
+		is     error
+	}{
+		{"", nil},
+		{"(main", nil},
+		{"main &", nil},
+		{"main )", nil},
+		{`"unterminated`, nil},
+		{"main $ feature", nil},
+		{"description()", nil},
+		{"heads()", nil},
+		{"bookmarks(regex:\"(\")", nil},
+		{"nosuch", ErrBranchNotFound},
+		{"a11", ErrBranchNotFound}, // prefixes need four characters
+		{"mine()", ErrNotSupported},
+	}
+	for _, tt := range tests {
+		_, err := EvalRevset(tt.revset, revsetTestGraph, "d999999")
+		if err == nil {
+			t.Errorf("EvalRevset(%q) succeeded, want error", tt.revset)
+			continue
+		}
+		if tt.is != nil && !errors.Is(err, tt.is) {
+			t.Errorf("EvalRevset(%q) = %v, want %v", tt.revset, err, tt.is)
+		}
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob, s string
+		want    bool
+	}{
+		{"feat*", "feature", true},
+		{"feat*", "a feature", false},
+		{"*/*", "user/topic", true},
+		{"fix?", "fix1", true},
+		{"fix?", "fix12", false},
+		{"v[0-9].*", "v1.0", true},
+		{"v[!0-9]", "vx", true},
+		{"a.b", "axb", false},
+		{"*", "multi\nline", true},
+	}
+	for _, tt := range tests {
+		match, err := compilePattern("glob:" + tt.glob)
+		if err != nil {
+			t.Fatalf("compilePattern(glob:%s): %v", tt.glob, err)
+		}
+		if got := match(tt.s); got != tt.want {
+			t.Errorf("glob %q on %q = %v, want %v", tt.glob, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestGitVCS_Query(t *testing.T) {
+	h := NewTestHelper(t)
+	repoPath := h.CreateGitRepo("query")
+	g, err := NewGitVCS(repoPath)
+	if err != nil {
+		t.Fatalf("NewGitVCS: %v", err)
+	}
+	ctx := context.Background()
+
+	h.WriteFile(repoPath, "a.txt", "one")
+	h.runCmd(repoPath, "git", "add", "a.txt")
+	h.runCmd(repoPath, "git", "commit", "-m", "base")
+	h.runCmd(repoPath, "git", "tag", "v1")
+	h.runCmd(repoPath, "git", "checkout", "-q", "-b", "wong-db")
+	h.runCmd(repoPath, "git", "commit", "--allow-empty", "-m", "db: sync")
+	h.runCmd(repoPath, "git", "checkout", "-q", "-")
+	h.runCmd(repoPath, "git", "commit", "--allow-empty", "-m", "work")
+
+	descriptions := func(revset string) string {
+		t.Helper()
+		changes, err := g.Query(ctx, revset)
+		if err != nil {
+			t.Fatalf("Query(%q): %v", revset, err)
+		}
+		var d []string
+		for _, c := range changes {
+			d = append(d, c.Description)
+		}
+		return strings.Join(d, ",")
+	}
+
+	if got := descriptions("@"); got != "work" {
+		t.Errorf("Query(@) = %q", got)
+	}
+	if got := descriptions("heads(all())"); got != "work,db: sync" && got != "db: sync,work" {
+		t.Errorf("Query(heads(all())) = %q", got)
+	}
+	if got := descriptions("roots(all())"); got != "base" {
+		t.Errorf("Query(roots(all())) = %q", got)
+	}
+	if got := descriptions("v1..wong-db"); got != "db: sync" {
+		t.Errorf("Query(v1..wong-db) = %q", got)
+	}
+	if got := descriptions("parents(@) & wong-db"); got != "" {
+		t.Errorf("Query(parents(@) & wong-db) = %q", got)
+	}
+	if got := descriptions(`description(glob:"db:*")`); got != "db: sync" {
+		t.Errorf("Query(description(glob)) = %q", got)
+	}
+	if got := descriptions("author(test@example.com) ~ ::v1"); !strings.Contains(got, "work") || strings.Contains(got, "base") {
+		t.Errorf("Query(author() ~ ::v1) = %q", got)
+	}
+
+	changes, err := g.Query(ctx, "@")
+	if err != nil || len(changes) != 1 || !changes[0].IsWorking {
+		t.Errorf("Query(@) = %+v, %v; want the working commit", changes, err)
+	}
+	if _, err := g.Query(ctx, "nosuch"); !errors.Is(err, ErrBranchNotFound) {
+		t.Errorf("Query(nosuch) error = %v, want ErrBranchNotFound", err)
+	}
+}
+
+func TestRevsetScope(t *testing.T) {
+	tests := []struct {
+		expr    string
+		symbols string
+		ok      bool
+	}{
+		{"@", "@", true},
+		{"main..@", "main,@", true},
+		{"::main ~ ::v1", "main,v1", true},
+		{"parents(@) & wong-db", "@,wong-db", true},
+		{"heads(::main | ::feature)", "main,feature", true},
+		{"main:: & ::@", "main,@", true},
+		{"roots(main..@)", "main,@", true},
+		{"author(bob) & ::@", "@", true},
+		{"none()", "", true},
+		{"all()", "", false},
+		{"main::", "", false},
+		{"::main | all()", "", false},
+		{"~main", "", false},
+		{"heads(all())", "", false},
+		{"ancestors(main::) & @", "", false},
+		{"main..", "", false},
+		{"description(fix)", "", false},
+		{"main &", "", false},
+	}
+	for _, tt := range tests {
+		symbols, ok := revsetScope(tt.expr)
+		if got := strings.Join(symbols, ","); ok != tt.ok || got != tt.symbols {
+			t.Errorf("revsetScope(%q) = %q, %v; want %q, %v", tt.expr, got, ok, tt.symbols, tt.ok)
+		}
+	}
+}
+
+func TestGitVCS_QueryLimitsWalk(t *testing.T) {
+	h := NewTestHelper(t)
+	repoPath := h.CreateGitRepo("query-walk")
+	g, err := NewGitVCS(repoPath)
+	if err != nil {
+		t.Fatalf("NewGitVCS: %v", err)
+	}
+	ctx := context.Background()
+
+	h.runCmd(repoPath, "git", "commit", "--allow-empty", "-m", "base")
+	h.runCmd(repoPath, "git", "branch", "main")
+	h.runCmd(repoPath, "git", "checkout", "-q", "-b", "side")
+	h.runCmd(repoPath, "git", "commit", "--allow-empty", "-m", "side")
+	h.runCmd(repoPath, "git", "checkout", "-q", "main")
+	h.runCmd(repoPath, "git", "checkout", "-q", "-b", "work")
+	h.runCmd(repoPath, "git", "commit", "--allow-empty", "-m", "one")
+	h.runCmd(repoPath, "git", "commit", "--allow-empty", "-m", "two")
+
+	var logs [][]string
+	g.SetRunner(&Runner{Sink: CommandSinkFunc(func(rec CommandRecord) {
+		if len(rec.Args) > 0 && rec.Args[0] == "log" {
+			logs = append(logs, rec.Args)
+		}
+	})})
+	query := func(revset string) string {
+		t.Helper()
+		logs = nil
+		changes, err := g.Query(ctx, revset)
+		if err != nil {
+			t.Fatalf("Query(%q): %v", revset, err)
+		}
+		var d []string
+		for _, c := range changes {
+			d = append(d, c.Description)
+		}
+		return strings.Join(d, ",")
+	}
+	walksAll := func() bool {
+		for _, args := range logs {
+			for _, a := range args {
+				if a == "--all" {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if got := query("main..@"); got != "two,one" {
+		t.Errorf("Query(main..@) = %q, want two,one", got)
+	}
+	if len(logs) != 1 || walksAll() {
+		t.Errorf("Query(main..@) ran git log %q, want one walk from main and @", logs)
+	}
+	if got := query("none()"); got != "" || len(logs) != 0 {
+		t.Errorf("Query(none()) = %q after git log %q, want nothing run", got, logs)
+	}
+	if got := query("heads(all())"); got != "side,two" && got != "two,side" {
+		t.Errorf("Query(heads(all())) = %q", got)
+	}
+	if !walksAll() {
+		t.Errorf("Query(heads(all())) ran git log %q, want --all", logs)
+	}
+	if _, err := g.Query(ctx, "nosuch..@"); !errors.Is(err, ErrBranchNotFound) {
+		t.Errorf("Query(nosuch..@) error = %v, want ErrBranchNotFound", err)
+	}
+}
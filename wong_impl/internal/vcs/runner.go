@@ -0,0 +1,347 @@
+package vcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxStderr is how much stderr a CommandRecord keeps when
+// Runner.MaxStderr is zero.
+const DefaultMaxStderr = 4096
+
+// Invocation describes one external command.
+type Invocation struct {
+	// Bin is the program to run, e.g. "jj" or an absolute path to it.
+	Bin  string
+	Args []string
+	Dir  string
+
+	// Env is appended to the current process environment.
+	Env []string
+
+	Stdin string
+
+	// Interactive hands the command this process's stdin (unless Stdin is
+	// set), stdout and stderr, so it sees the terminal and can use color, a
+	// pager or an editor. Its output is not captured in the Result, except
+	// that a Runner with a Record or Sink also copies it there when stdout
+	// isn't a terminal. It is for commands run on the user's behalf, such as
+	// the jj decorator.
+	Interactive bool
+}
+
+// Command returns an exec.Cmd for inv that is not yet started.
+func (inv Invocation) Command(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, inv.Bin, inv.Args...)
+	cmd.Dir = inv.Dir
+	cmd.Env = append(os.Environ(), inv.Env...)
+	if inv.Stdin != "" {
+		cmd.Stdin = strings.NewReader(inv.Stdin)
+	} else if inv.Interactive {
+		cmd.Stdin = os.Stdin
+	}
+	return cmd
+}
+
+// Result is the output of a finished command. It is filled in even when Run
+// returns an error, so callers can report stderr.
+type Result struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// CommandRecord is what a Runner reports to its Sink after each command.
+type CommandRecord struct {
+	Bin      string        `json:"bin"`
+	Args     []string      `json:"args"`
+	Dir      string        `json:"dir"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+
+	// ExitCode is -1 when the command could not be started or was killed.
+	ExitCode int `json:"exit_code"`
+
+	// Stderr is truncated to Runner.MaxStderr bytes.
+	Stderr   string `json:"stderr,omitempty"`
+	Err      string `json:"error,omitempty"`
+	Replayed bool   `json:"replayed,omitempty"`
+}
+
+// CommandSink receives a CommandRecord for every command a Runner runs.
+// Implementations must be safe for concurrent use.
+type CommandSink interface {
+	RecordCommand(rec CommandRecord)
+}
+
+// CommandSinkFunc adapts a function to a CommandSink.
+type CommandSinkFunc func(rec CommandRecord)
+
+// RecordCommand calls f(rec).
+func (f CommandSinkFunc) RecordCommand(rec CommandRecord) {
+	f(rec)
+}
+
+// jsonSink writes one JSON object per line.
+type jsonSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONSink returns a CommandSink that writes each record to w as a line
+// of JSON.
+func NewJSONSink(w io.Writer) CommandSink {
+	return &jsonSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonSink) RecordCommand(rec CommandRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(rec)
+}
+
+// Runner executes the commands behind every backend. The zero value runs
+// commands directly with no timeout and no recording.
+type Runner struct {
+	// Timeout bounds each command; zero means no limit beyond the caller's
+	// context.
+	Timeout time.Duration
+
+	// Sink, if set, is told about every command after it finishes.
+	Sink CommandSink
+
+	// MaxStderr caps CommandRecord.Stderr; zero means DefaultMaxStderr.
+	MaxStderr int
+
+	// Record, if set, gets a full transcript entry for every command run.
+	Record *Transcript
+
+	// Replay, if set, answers commands from a transcript instead of running
+	// anything. Commands missing from it fail with ErrNotRecorded.
+	Replay *Transcript
+}
+
+// DefaultRunner is used by backends that have no Runner of their own. Tests
+// and tracing can replace it before creating backends.
+var DefaultRunner = &Runner{}
+
+// Run runs inv, or replays it, and reports it to the Sink. The error is the
+// process error (or ErrCommandTimeout / ErrNotRecorded); callers wrap it in a
+// CommandError. A nil Runner behaves like DefaultRunner.
+//
+// In plan mode (see WithPlan) commands that are not IsReadOnlyCommand are
+// added to the Plan and succeed with empty output without running or being
+// reported. jj reads run with --ignore-working-copy, so that a dry run does
+// not snapshot the working copy.
+func (r *Runner) Run(ctx context.Context, inv Invocation) (Result, error) {
+	if r == nil {
+		r = DefaultRunner
+	}
+	if plan := PlanFromContext(ctx); plan != nil {
+		if !IsReadOnlyCommand(inv.Bin, inv.Args) {
+			plan.addCommand(inv)
+			return Result{}, nil
+		}
+		inv = planRead(inv)
+	}
+	start := time.Now()
+	var res Result
+	var err error
+	if r.Replay != nil {
+		res, err = r.Replay.replay(inv)
+		if inv.Interactive {
+			os.Stdout.Write(res.Stdout)
+			os.Stderr.Write(res.Stderr)
+		}
+	} else {
+		res, err = r.exec(ctx, inv)
+		if r.Record != nil {
+			r.Record.add(inv, res)
+		}
+	}
+	if r.Sink != nil {
+		rec := CommandRecord{
+			Bin:      inv.Bin,
+			Args:     inv.Args,
+			Dir:      inv.Dir,
+			Start:    start,
+			Duration: time.Since(start),
+			ExitCode: res.ExitCode,
+			Stderr:   truncate(string(res.Stderr), r.maxStderr()),
+			Replayed: r.Replay != nil,
+		}
+		if err != nil {
+			rec.Err = err.Error()
+		}
+		r.Sink.RecordCommand(rec)
+	}
+	return res, err
+}
+
+// exec runs inv as a child process.
+func (r *Runner) exec(ctx context.Context, inv Invocation) (Result, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	cmd := inv.Command(ctx)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if inv.Interactive {
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if (r.Record != nil || r.Sink != nil) && !isTerminal(os.Stdout) {
+			cmd.Stdout = io.MultiWriter(&stdout, os.Stdout)
+			cmd.Stderr = io.MultiWriter(&stderr, os.Stderr)
+		}
+	}
+	err := cmd.Run()
+	res := Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	} else {
+		res.ExitCode = -1
+	}
+	if err != nil && r.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s: %v", ErrCommandTimeout, r.Timeout, err)
+	}
+	return res, err
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *Runner) maxStderr() int {
+	if r.MaxStderr > 0 {
+		return r.MaxStderr
+	}
+	return DefaultMaxStderr
+}
+
+// truncate cuts s to at most n bytes, marking the cut.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "...(truncated)"
+}
+
+// TranscriptEntry is one recorded command and its output.
+type TranscriptEntry struct {
+	// Bin is the base name of the program, so transcripts recorded with an
+	// absolute jj path replay against plain "jj".
+	Bin      string   `json:"bin"`
+	Args     []string `json:"args"`
+	Stdin    string   `json:"stdin,omitempty"`
+	Stdout   string   `json:"stdout"`
+	Stderr   string   `json:"stderr,omitempty"`
+	ExitCode int      `json:"exit_code"`
+}
+
+// Transcript is an ordered list of commands for record/replay. Replay matches
+// on program, arguments and stdin but not on directory, and hands out each
+// entry once in recorded order, so repeated commands can return different
+// output. Arguments that embed absolute paths only replay in the same place.
+type Transcript struct {
+	mu      sync.Mutex
+	Entries []TranscriptEntry
+	used    []bool
+}
+
+// LoadTranscript reads a transcript written by Save.
+func LoadTranscript(path string) (*Transcript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var t Transcript
+	if err := json.Unmarshal(data, &t.Entries); err != nil {
+		return nil, fmt.Errorf("parsing transcript %s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// Save writes the transcript to path as indented JSON.
+func (t *Transcript) Save(path string) error {
+	t.mu.Lock()
+	data, err := json.MarshalIndent(t.Entries, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Unused returns the entries replay has not handed out yet.
+func (t *Transcript) Unused() []TranscriptEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []TranscriptEntry
+	for i, e := range t.Entries {
+		if i >= len(t.used) || !t.used[i] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (t *Transcript) add(inv Invocation, res Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Entries = append(t.Entries, TranscriptEntry{
+		Bin:      filepath.Base(inv.Bin),
+		Args:     append([]string(nil), inv.Args...),
+		Stdin:    inv.Stdin,
+		Stdout:   string(res.Stdout),
+		Stderr:   string(res.Stderr),
+		ExitCode: res.ExitCode,
+	})
+}
+
+// replay returns the first unused entry matching inv.
+func (t *Transcript) replay(inv Invocation) (Result, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.used) < len(t.Entries) {
+		t.used = append(t.used, make([]bool, len(t.Entries)-len(t.used))...)
+	}
+	bin := filepath.Base(inv.Bin)
+	for i, e := range t.Entries {
+		if t.used[i] || e.Bin != bin || e.Stdin != inv.Stdin || !sameArgs(e.Args, inv.Args) {
+			continue
+		}
+		t.used[i] = true
+		res := Result{Stdout: []byte(e.Stdout), Stderr: []byte(e.Stderr), ExitCode: e.ExitCode}
+		if e.ExitCode != 0 {
+			return res, fmt.Errorf("exit status %d", e.ExitCode)
+		}
+		return res, nil
+	}
+	return Result{ExitCode: -1}, fmt.Errorf("%w: %s %s", ErrNotRecorded, bin, strings.Join(inv.Args, " "))
+}
+
+func sameArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
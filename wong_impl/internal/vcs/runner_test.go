@@ -0,0 +1,193 @@
+package vcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunner_SinkRecordsInvocation(t *testing.T) {
+	var mu sync.Mutex
+	var recs []CommandRecord
+	r := &Runner{MaxStderr: 8, Sink: CommandSinkFunc(func(rec CommandRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		recs = append(recs, rec)
+	})}
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	res, err := r.Run(ctx, Invocation{Bin: "sh", Args: []string{"-c", "echo out; echo 0123456789abcdef >&2; exit 3"}, Dir: dir})
+	if err == nil || res.ExitCode != 3 {
+		t.Fatalf("Run = %+v, %v; want exit 3", res, err)
+	}
+	if string(res.Stdout) != "out\n" || string(res.Stderr) != "0123456789abcdef\n" {
+		t.Errorf("Result = %q %q; want full output", res.Stdout, res.Stderr)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	rec := recs[0]
+	if rec.Bin != "sh" || rec.Dir != dir || rec.Args[0] != "-c" || rec.ExitCode != 3 || rec.Err == "" {
+		t.Errorf("record = %+v", rec)
+	}
+	if rec.Stderr != "01234567...(truncated)" {
+		t.Errorf("record stderr = %q, want truncated to 8 bytes", rec.Stderr)
+	}
+	if rec.Duration <= 0 || rec.Start.IsZero() {
+		t.Errorf("record timing = %v at %v", rec.Duration, rec.Start)
+	}
+}
+
+func TestRunner_Timeout(t *testing.T) {
+	r := &Runner{Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	res, err := r.Run(context.Background(), Invocation{Bin: "sleep", Args: []string{"5"}})
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Fatalf("Run error = %v, want ErrCommandTimeout", err)
+	}
+	if res.ExitCode != -1 {
+		t.Errorf("ExitCode = %d, want -1 for a killed command", res.ExitCode)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("timeout did not stop the command")
+	}
+}
+
+func TestRunner_Interactive(t *testing.T) {
+	ctx := context.Background()
+	inv := Invocation{Bin: "sh", Args: []string{"-c", "echo out; echo err >&2"}, Interactive: true}
+
+	// Without a record the output goes only to this process's stdout and
+	// stderr, which the command is handed directly.
+	res, err := (&Runner{}).Run(ctx, inv)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Stdout) != 0 || len(res.Stderr) != 0 {
+		t.Errorf("Result = %q %q; want nothing captured", res.Stdout, res.Stderr)
+	}
+
+	// A recording runner also captures it when stdout isn't a terminal, as
+	// under go test.
+	if isTerminal(os.Stdout) {
+		t.Skip("stdout is a terminal")
+	}
+	transcript := &Transcript{}
+	res, err = (&Runner{Record: transcript}).Run(ctx, inv)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if string(res.Stdout) != "out\n" || string(res.Stderr) != "err\n" {
+		t.Errorf("recorded Result = %q %q; want the output captured as well", res.Stdout, res.Stderr)
+	}
+	if len(transcript.Entries) != 1 || transcript.Entries[0].Stdout != "out\n" {
+		t.Errorf("transcript = %+v", transcript.Entries)
+	}
+}
+
+func TestNewJSONSink(t *testing.T) {
+	var buf bytes.Buffer
+	r := &Runner{Sink: NewJSONSink(&buf)}
+	r.Run(context.Background(), Invocation{Bin: "true"})
+	r.Run(context.Background(), Invocation{Bin: "false"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	var rec CommandRecord
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Bin != "false" || rec.ExitCode != 1 || rec.Err == "" {
+		t.Errorf("record = %+v", rec)
+	}
+}
+
+func TestRunner_RecordReplayGit(t *testing.T) {
+	h := NewTestHelper(t)
+	repoPath := h.CreateGitRepo("record")
+	h.WriteFile(repoPath, "a.txt", "one")
+	h.runCmd(repoPath, "git", "add", "a.txt")
+	h.runCmd(repoPath, "git", "commit", "-m", "first")
+	ctx := context.Background()
+
+	rec := &Transcript{}
+	g, err := NewGitVCS(repoPath)
+	if err != nil {
+		t.Fatalf("NewGitVCS: %v", err)
+	}
+	g.SetRunner(&Runner{Record: rec})
+	branch, err := g.CurrentBranch(ctx)
+	if err != nil {
+		t.Fatalf("CurrentBranch: %v", err)
+	}
+	if _, err := g.ResolveRef(ctx, "no-such-ref"); err == nil {
+		t.Fatal("ResolveRef(no-such-ref) succeeded")
+	}
+	path := filepath.Join(t.TempDir(), "git.json")
+	if err := rec.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// Replay must not touch the repository at all.
+	if err := os.RemoveAll(filepath.Join(repoPath, ".git")); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadTranscript(path)
+	if err != nil {
+		t.Fatalf("LoadTranscript: %v", err)
+	}
+	g.SetRunner(&Runner{Replay: loaded})
+	if got, err := g.CurrentBranch(ctx); err != nil || got != branch {
+		t.Errorf("replayed CurrentBranch = %q, %v; want %q", got, err, branch)
+	}
+	if _, err := g.ResolveRef(ctx, "no-such-ref"); err == nil {
+		t.Error("replayed ResolveRef(no-such-ref) succeeded")
+	}
+	if _, err := g.CurrentBranch(ctx); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("third CurrentBranch error = %v, want ErrNotRecorded", err)
+	}
+	if unused := loaded.Unused(); len(unused) != 0 {
+		t.Errorf("unused entries: %+v", unused)
+	}
+}
+
+func TestJujutsuVCS_Replay(t *testing.T) {
+	tr, err := LoadTranscript(filepath.Join("testdata", "transcripts", "jj_current_branch.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".jj"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var recs []CommandRecord
+	r := &Runner{Replay: tr, Sink: CommandSinkFunc(func(rec CommandRecord) { recs = append(recs, rec) })}
+
+	j, err := NewJujutsuVCSWithRunner(dir, r)
+	if err != nil {
+		t.Fatalf("NewJujutsuVCSWithRunner: %v", err)
+	}
+	if v := j.Capabilities().Version; v.Major != 0 || v.Minor != 23 {
+		t.Errorf("probed version = %v, want 0.23 from the transcript", v)
+	}
+	ctx := context.Background()
+	if got, err := j.CurrentBranch(ctx); err != nil || got != "qpvuntsmwlqt" {
+		t.Errorf("CurrentBranch = %q, %v", got, err)
+	}
+	if _, err := j.CurrentBranch(ctx); !errors.Is(err, ErrStaleWorkingCopy) {
+		t.Errorf("second CurrentBranch error = %v, want ErrStaleWorkingCopy", err)
+	}
+	if len(recs) != 3 || !recs[2].Replayed || recs[2].ExitCode != 1 || recs[2].Dir != j.RepoRoot() {
+		t.Errorf("records = %+v", recs)
+	}
+}
@@ -0,0 +1,285 @@
+package vcs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Caller-supplied names and revisions are checked here before they reach a
+// command line. Git revisions are validated and placed after
+// --end-of-options; jj revisions are quoted so they resolve as a single
+// symbol and can never be parsed as a revset expression.
+
+// ValidateRefName reports whether name is usable as a branch, bookmark or
+// remote name. It applies git check-ref-format rules, which also keep the
+// name from being read as an option, a revset or a string pattern.
+func ValidateRefName(name string) error {
+	reason := ""
+	switch {
+	case name == "":
+		reason = "empty"
+	case name == "@":
+		reason = `"@" is reserved`
+	case strings.HasPrefix(name, "-"):
+		reason = "starts with '-'"
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/"):
+		reason = "starts or ends with '/'"
+	case strings.HasSuffix(name, "."):
+		reason = "ends with '.'"
+	case strings.Contains(name, ".."):
+		reason = `contains ".."`
+	case strings.Contains(name, "@{"):
+		reason = `contains "@{"`
+	case strings.Contains(name, "//"):
+		reason = `contains "//"`
+	case strings.ContainsAny(name, " ~^:?*[\\"):
+		reason = "contains a forbidden character"
+	case hasControl(name):
+		reason = "contains a control character"
+	}
+	if reason == "" {
+		for _, part := range strings.Split(name, "/") {
+			if strings.HasPrefix(part, ".") || strings.HasSuffix(part, ".lock") {
+				reason = "has a component starting with '.' or ending with .lock"
+				break
+			}
+		}
+	}
+	if reason != "" {
+		return fmt.Errorf("%w: %q %s", ErrInvalidRef, name, reason)
+	}
+	return nil
+}
+
+// validateGitRevision checks a revision passed to git. Revision syntax such
+// as HEAD~1, main^2 or HEAD@{1} is allowed, but ranges and tree paths are
+// not: callers that need them build them from validated parts.
+func validateGitRevision(rev string) error {
+	reason := ""
+	switch {
+	case rev == "":
+		reason = "empty"
+	case strings.HasPrefix(rev, "-"):
+		reason = "starts with '-'"
+	case strings.Contains(rev, ".."):
+		reason = `contains ".."`
+	case strings.ContainsAny(rev, ": \\"):
+		reason = "contains a forbidden character"
+	case hasControl(rev):
+		reason = "contains a control character"
+	}
+	if reason != "" {
+		return fmt.Errorf("%w: %q %s", ErrInvalidRef, rev, reason)
+	}
+	return nil
+}
+
+// validateArg checks a non-revision argument such as a remote, workspace
+// name or config key: it must not look like an option or contain control
+// characters. kind names the argument in the error.
+func validateArg(kind, value string) error {
+	if strings.HasPrefix(value, "-") || hasControl(value) {
+		return fmt.Errorf("%w: %s %q", ErrInvalidArgument, kind, value)
+	}
+	return nil
+}
+
+// validatePath rejects paths containing NUL or newlines, which no VCS can
+// store. Leading '-' is fine as long as the caller passes paths after "--".
+func validatePath(path string) error {
+	if strings.ContainsAny(path, "\x00\n\r") {
+		return fmt.Errorf("%w: path %q", ErrInvalidArgument, path)
+	}
+	return nil
+}
+
+// hasControl reports whether s contains ASCII control characters.
+func hasControl(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// jjBuiltinRevisions are revset expressions callers may pass where a single
+// revision is expected. Anything else is quoted.
+var jjBuiltinRevisions = map[string]bool{
+	"trunk()": true,
+	"root()":  true,
+}
+
+var (
+	// jjWorkingCopyRe matches @ and its ancestors or descendants (@-, @--, @+).
+	jjWorkingCopyRe = regexp.MustCompile(`^@[-+]*$`)
+
+	// jjChangeIDRe matches full and templated short change IDs, which jj
+	// writes in the letters k-z.
+	jjChangeIDRe = regexp.MustCompile(`^[k-z]{12,32}$`)
+)
+
+// jjRevision turns a caller-supplied revision into a revset that denotes
+// exactly that revision: change IDs become change_id("..."), name@remote
+// becomes a quoted remote symbol, and anything else a quoted symbol that jj
+// resolves like a bare name (tag, bookmark, git ref or commit ID prefix).
+func jjRevision(rev string) (string, error) {
+	switch {
+	case rev == "":
+		return "", fmt.Errorf("%w: empty revision", ErrInvalidRef)
+	case hasControl(rev):
+		return "", fmt.Errorf("%w: %q contains a control character", ErrInvalidRef, rev)
+	case jjWorkingCopyRe.MatchString(rev) || jjBuiltinRevisions[rev]:
+		return rev, nil
+	case jjChangeIDRe.MatchString(rev):
+		return "change_id(" + quoteRevsetString(rev) + ")", nil
+	}
+	if name, remote, ok := strings.Cut(rev, "@"); ok && ValidateRefName(name) == nil && ValidateRefName(remote) == nil {
+		return quoteRevsetString(name) + "@" + quoteRevsetString(remote), nil
+	}
+	return quoteRevsetString(rev), nil
+}
+
+// jjBookmarkRevset returns a revset for the commit bookmark name points to.
+func jjBookmarkRevset(name string) (string, error) {
+	if err := ValidateRefName(name); err != nil {
+		return "", err
+	}
+	return "bookmarks(exact:" + quoteRevsetString(name) + ")", nil
+}
+
+// jjBookmarkPattern returns a command-line string pattern that matches only
+// the bookmark name, for commands such as jj git push --bookmark that
+// otherwise treat the argument as a glob.
+func jjBookmarkPattern(name string) (string, error) {
+	if err := ValidateRefName(name); err != nil {
+		return "", err
+	}
+	return "exact:" + name, nil
+}
+
+// jjFilesetMeta are characters with meaning in jj filesets.
+const jjFilesetMeta = "()~&|!*?[]{}:\"'\\ \t"
+
+// jjPath returns path as a fileset argument. Ordinary paths are passed
+// through; paths with fileset syntax or a leading '-' are quoted as
+// file:"...".
+func jjPath(path string) (string, error) {
+	if err := validatePath(path); err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(path, "-") || strings.ContainsAny(path, jjFilesetMeta) {
+		return "file:" + quoteRevsetString(path), nil
+	}
+	return path, nil
+}
+
+// quoteRevsetString renders s as a revset string literal. jj and hg both
+// accept these escapes, and both resolve a quoted string as a single symbol.
+func quoteRevsetString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// jjPaths applies jjPath to each of paths.
+func jjPaths(paths []string) ([]string, error) {
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		q, err := jjPath(p)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = q
+	}
+	return out, nil
+}
+
+// validateGitRevisions applies validateGitRevision to each of revs.
+func validateGitRevisions(revs ...string) error {
+	for _, r := range revs {
+		if err := validateGitRevision(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gitRemoteArgs appends the optional remote and branch of a fetch, pull or
+// push to args, after validating them and --end-of-options.
+func gitRemoteArgs(args []string, remote, branch string) ([]string, error) {
+	if remote == "" && branch == "" {
+		return args, nil
+	}
+	args = append(args, "--end-of-options")
+	if remote != "" {
+		if err := validateArg("remote", remote); err != nil {
+			return nil, err
+		}
+		args = append(args, remote)
+	}
+	if branch != "" {
+		if err := ValidateRefName(branch); err != nil {
+			return nil, err
+		}
+		args = append(args, branch)
+	}
+	return args, nil
+}
+
+// hgBuiltinRevisions are hg revisions passed through unquoted.
+var hgBuiltinRevisions = map[string]bool{
+	".":    true,
+	"tip":  true,
+	"null": true,
+	"p1()": true,
+	"p2()": true,
+}
+
+// hgRevision quotes a caller-supplied revision so hg looks it up as a single
+// symbol (bookmark, branch, tag, hash or revision number).
+func hgRevision(rev string) (string, error) {
+	switch {
+	case rev == "":
+		return "", fmt.Errorf("%w: empty revision", ErrInvalidRef)
+	case hasControl(rev):
+		return "", fmt.Errorf("%w: %q contains a control character", ErrInvalidRef, rev)
+	case hgBuiltinRevisions[rev]:
+		return rev, nil
+	}
+	return quoteRevsetString(rev), nil
+}
+
+// hgRevisions applies hgRevision to each of revs.
+func hgRevisions(revs ...string) ([]string, error) {
+	out := make([]string, len(revs))
+	for i, r := range revs {
+		q, err := hgRevision(r)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = q
+	}
+	return out, nil
+}
@@ -0,0 +1,364 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// hostileNames are names a caller might pass through from user input, each
+// trying to escape into an option, a revset expression or a string pattern.
+var hostileNames = []string{
+	"-b",
+	"--upload-pack=touch pwned",
+	"--output=pwned",
+	"all()",
+	`x")|all()|("`,
+	`x" | all() | "`,
+	"main | all()",
+	"glob:*",
+	"regex:.*",
+	"exact:main",
+	"main..feature",
+	"@{-1}",
+	"HEAD:secret.txt",
+	"main\nall()",
+	"main\x00",
+	"",
+}
+
+// unquoteRevsetString decodes a literal produced by quoteRevsetString and
+// reports whether s is exactly one well-formed literal.
+func unquoteRevsetString(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", false
+	}
+	var b strings.Builder
+	body := s[1 : len(s)-1]
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == '"' {
+			return "", false // an unescaped quote would end the literal early
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(body) {
+			return "", false
+		}
+		switch body[i] {
+		case '"', '\\':
+			b.WriteByte(body[i])
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'x':
+			if i+2 >= len(body) {
+				return "", false
+			}
+			var v byte
+			for _, h := range body[i+1 : i+3] {
+				v <<= 4
+				switch {
+				case h >= '0' && h <= '9':
+					v |= byte(h - '0')
+				case h >= 'a' && h <= 'f':
+					v |= byte(h-'a') + 10
+				default:
+					return "", false
+				}
+			}
+			b.WriteByte(v)
+			i += 2
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+func FuzzJJRevision(f *testing.F) {
+	for _, s := range hostileNames {
+		f.Add(s)
+	}
+	for _, s := range []string{"@", "@-", "trunk()", "qpvuntsmwlqt", "main", "main@origin", "3a2c8d1e", "a@b@c"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, rev string) {
+		got, err := jjRevision(rev)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidRef) {
+				t.Fatalf("jjRevision(%q) error %v is not ErrInvalidRef", rev, err)
+			}
+			return
+		}
+		if jjWorkingCopyRe.MatchString(rev) || jjBuiltinRevisions[rev] {
+			if got != rev {
+				t.Fatalf("jjRevision(%q) = %q, want it unchanged", rev, got)
+			}
+			return
+		}
+		if inner, ok := strings.CutPrefix(got, "change_id("); ok {
+			inner, ok = strings.CutSuffix(inner, ")")
+			if s, lit := unquoteRevsetString(inner); !ok || !lit || s != rev {
+				t.Fatalf("jjRevision(%q) = %q, not a change_id of the input", rev, got)
+			}
+			return
+		}
+		if s, ok := unquoteRevsetString(got); ok {
+			if s != rev {
+				t.Fatalf("jjRevision(%q) = %q, unquotes to %q", rev, got, s)
+			}
+			return
+		}
+		name, remote, ok := strings.Cut(got, `"@"`)
+		n, nok := unquoteRevsetString(name + `"`)
+		r, rok := unquoteRevsetString(`"` + remote)
+		if !ok || !nok || !rok || n+"@"+r != rev {
+			t.Fatalf("jjRevision(%q) = %q, not a single symbol", rev, got)
+		}
+	})
+}
+
+func FuzzHgRevision(f *testing.F) {
+	for _, s := range hostileNames {
+		f.Add(s)
+	}
+	f.Add(".")
+	f.Add("tip")
+	f.Fuzz(func(t *testing.T, rev string) {
+		got, err := hgRevision(rev)
+		if err != nil {
+			return
+		}
+		if hgBuiltinRevisions[rev] {
+			if got != rev {
+				t.Fatalf("hgRevision(%q) = %q, want it unchanged", rev, got)
+			}
+			return
+		}
+		if s, ok := unquoteRevsetString(got); !ok || s != rev {
+			t.Fatalf("hgRevision(%q) = %q, not a single symbol", rev, got)
+		}
+	})
+}
+
+func FuzzJJPath(f *testing.F) {
+	for _, s := range []string{"a.txt", "dir/b.go", "-rf", "all()", `x"y`, "a b", "~", "glob:*.go", "root:x"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, path string) {
+		got, err := jjPath(path)
+		if err != nil {
+			return
+		}
+		if got == path {
+			if strings.HasPrefix(path, "-") || strings.ContainsAny(path, jjFilesetMeta) {
+				t.Fatalf("jjPath(%q) passed fileset syntax through", path)
+			}
+			return
+		}
+		inner, ok := strings.CutPrefix(got, "file:")
+		if s, lit := unquoteRevsetString(inner); !ok || !lit || s != path {
+			t.Fatalf("jjPath(%q) = %q, not a quoted file pattern", path, got)
+		}
+	})
+}
+
+func FuzzValidateRefName(f *testing.F) {
+	for _, s := range hostileNames {
+		f.Add(s)
+	}
+	for _, s := range []string{"main", "feature/x-1", "wong-db", "v1.0", ".hidden", "a.lock", "a/", "a//b"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		if err := ValidateRefName(name); err != nil {
+			if !errors.Is(err, ErrInvalidRef) {
+				t.Fatalf("ValidateRefName(%q) error %v is not ErrInvalidRef", name, err)
+			}
+			return
+		}
+		if strings.HasPrefix(name, "-") || hasControl(name) ||
+			strings.ContainsAny(name, " ~^:?*[\\") || strings.Contains(name, "..") {
+			t.Fatalf("ValidateRefName accepted %q", name)
+		}
+		if p, _ := jjBookmarkPattern(name); p != "exact:"+name {
+			t.Fatalf("jjBookmarkPattern(%q) = %q", name, p)
+		}
+	})
+}
+
+func FuzzValidateGitRevision(f *testing.F) {
+	for _, s := range hostileNames {
+		f.Add(s)
+	}
+	for _, s := range []string{"HEAD", "HEAD~1", "main^2", "origin/main", "HEAD@{1}"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, rev string) {
+		if validateGitRevision(rev) != nil {
+			return
+		}
+		if strings.HasPrefix(rev, "-") || hasControl(rev) || strings.Contains(rev, "..") || strings.ContainsAny(rev, ": ") {
+			t.Fatalf("validateGitRevision accepted %q", rev)
+		}
+	})
+}
+
+func TestValidateRefName_MatchesGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed, skipping")
+	}
+	names := append([]string{
+		"main", "feature/x-1", "wong-db", "v1.0", "a@b", "@", ".hidden", "dir/.x",
+		"a.lock", "a.", "/a", "a/", "a//b", "a@{1}", "a b", "a~1", "a^", "a?", "a*", "a[",
+		`a\b`, "a\x7f",
+	}, hostileNames...)
+	for _, name := range names {
+		if strings.ContainsRune(name, 0) {
+			continue // can't be passed as an argument
+		}
+		gitOK := exec.Command("git", "check-ref-format", "--branch", name).Run() == nil
+		ourErr := ValidateRefName(name)
+		// git accepts a leading '-' and "@{-1}"-style shorthands here;
+		// ValidateRefName is stricter, never looser.
+		if ourErr == nil && !gitOK {
+			t.Errorf("ValidateRefName(%q) accepted a name git rejects", name)
+		}
+		if ourErr != nil && gitOK && !strings.HasPrefix(name, "-") && !strings.Contains(name, "@{") && name != "@" {
+			t.Errorf("ValidateRefName(%q) = %v, git accepts it", name, ourErr)
+		}
+	}
+}
+
+func TestJJRevision(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"@", "@"},
+		{"@--", "@--"},
+		{"trunk()", "trunk()"},
+		{"qpvuntsmwlqt", `change_id("qpvuntsmwlqt")`},
+		{"main", `"main"`},
+		{"main@origin", `"main"@"origin"`},
+		{"all()", `"all()"`},
+		{`x")|all()|("`, `"x\")|all()|(\""`},
+		{"a@b@c", `"a"@"b@c"`},
+	}
+	for _, tt := range tests {
+		got, err := jjRevision(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("jjRevision(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := jjRevision("a\nb"); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("jjRevision(newline) error = %v, want ErrInvalidRef", err)
+	}
+}
+
+func TestGitVCS_HostileNames(t *testing.T) {
+	h := NewTestHelper(t)
+	repoPath := h.CreateGitRepo("hostile")
+	g, err := NewGitVCS(repoPath)
+	if err != nil {
+		t.Fatalf("NewGitVCS: %v", err)
+	}
+	ctx := context.Background()
+	h.WriteFile(repoPath, "a.txt", "one")
+	h.runCmd(repoPath, "git", "add", "a.txt")
+	h.runCmd(repoPath, "git", "commit", "-m", "base")
+
+	hostile := []string{
+		"--upload-pack=touch pwned",
+		"--output=pwned",
+		"-b",
+		"main..HEAD",
+		"HEAD:a.txt",
+		"HEAD\nmain",
+	}
+	rejected := func(op, name string, err error) {
+		t.Helper()
+		if !errors.Is(err, ErrInvalidRef) && !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("%s(%q) error = %v, want ErrInvalidRef or ErrInvalidArgument", op, name, err)
+		}
+	}
+	for _, name := range hostile {
+		_, err := g.ResolveRef(ctx, name)
+		rejected("ResolveRef", name, err)
+		_, err = g.Show(ctx, name)
+		rejected("Show", name, err)
+		rejected("CreateBranch", name, g.CreateBranch(ctx, name))
+		rejected("Checkout", name, g.Checkout(ctx, name))
+		if strings.HasPrefix(name, "-") || strings.Contains(name, "\n") {
+			// Remotes may be URLs or paths, so only options and control
+			// characters are rejected.
+			rejected("Push", name, g.Push(ctx, name, ""))
+		}
+		rejected("Push", name, g.Push(ctx, "origin", name))
+		_, err = g.ShowFile(ctx, name, "a.txt")
+		rejected("ShowFile", name, err)
+		_, err = g.LogBetween(ctx, name, "HEAD")
+		rejected("LogBetween", name, err)
+		_, err = g.IsAncestor(ctx, "HEAD", name)
+		rejected("IsAncestor", name, err)
+		rejected("ResetHard", name, g.ResetHard(ctx, name))
+	}
+
+	if _, err := os.Stat(filepath.Join(repoPath, "pwned")); err == nil {
+		t.Fatal("a hostile name was run as an option")
+	}
+
+	// A path that looks like an option is still just a path.
+	h.WriteFile(repoPath, "-n", "x")
+	if err := g.Stage(ctx, "-n"); err != nil {
+		t.Fatalf("Stage(-n): %v", err)
+	}
+	if tracked, err := g.IsFileTracked(ctx, "-n"); err != nil || !tracked {
+		t.Errorf("IsFileTracked(-n) = %v, %v; want true", tracked, err)
+	}
+
+	// Ordinary revision syntax keeps working.
+	if err := g.CreateBranch(ctx, "feature/x-1"); err != nil {
+		t.Fatalf("CreateBranch: %v", err)
+	}
+	if _, err := g.ResolveRef(ctx, "HEAD~0"); err != nil {
+		t.Errorf("ResolveRef(HEAD~0): %v", err)
+	}
+}
+
+func TestJujutsuVCS_HostileNames(t *testing.T) {
+	if _, err := exec.LookPath("jj"); err != nil {
+		t.Skip("jj not installed, skipping")
+	}
+
+	h := NewTestHelper(t)
+	repoPath := h.CreateJJRepo("jj-hostile")
+	j, err := NewJujutsuVCS(repoPath)
+	if err != nil {
+		t.Fatalf("NewJujutsuVCS: %v", err)
+	}
+	ctx := context.Background()
+
+	// Quoted, this is a symbol that doesn't exist; unquoted it would match
+	// every commit.
+	if _, err := j.ResolveRef(ctx, `x")|all()|("`); err == nil {
+		t.Error("ResolveRef resolved a revset expression")
+	}
+	if ok, _ := j.BranchExists(ctx, "glob:*"); ok {
+		t.Error("BranchExists(glob:*) matched a pattern")
+	}
+	if err := j.CreateBranch(ctx, "--help"); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("CreateBranch(--help) error = %v, want ErrInvalidRef", err)
+	}
+	if err := j.Push(ctx, "--upload-pack=x", ""); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Push(--upload-pack) error = %v, want ErrInvalidArgument", err)
+	}
+}
@@ -0,0 +1,609 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// StackEditor is implemented by backends that can rewrite a stack of
+// changes without user interaction. IDs are jj change IDs, or commit hashes
+// for git.
+type StackEditor interface {
+	// SplitByPaths splits id in two: first holds its changes to paths and
+	// second, a child of first, the rest. Descendants of id move onto
+	// second.
+	SplitByPaths(ctx context.Context, id string, paths []string) (first, second string, err error)
+
+	// Absorb moves the changes in from (the working copy if empty) into the
+	// mutable ancestors that last touched the same lines, and returns the
+	// changes that received something.
+	Absorb(ctx context.Context, from string) ([]string, error)
+
+	// Duplicate copies id onto the same parents and returns the copy.
+	Duplicate(ctx context.Context, id string) (string, error)
+
+	// Parallelize turns a linear chain of changes into siblings sharing the
+	// parent of the chain's first change, and makes the children of its
+	// last change merges of all of them. It returns the changes, oldest
+	// first.
+	Parallelize(ctx context.Context, ids ...string) ([]string, error)
+}
+
+// --- jj ---
+
+// jjNoEditor makes commands that would open an editor keep the text they
+// would have shown, so they never wait for input.
+var jjNoEditor = []string{"JJ_EDITOR=true"}
+
+// changeIDs returns the full change IDs in revset, newest first.
+func (j *JujutsuVCS) changeIDs(ctx context.Context, revset string) ([]string, error) {
+	out, err := j.runJJ(ctx, "log", "--no-graph", "-r", revset, "-T", `change_id ++ "\n"`)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+// changeID resolves rev to a single full change ID.
+func (j *JujutsuVCS) changeID(ctx context.Context, rev string) (string, error) {
+	ids, err := j.changeIDs(ctx, rev)
+	if err != nil {
+		return "", err
+	}
+	if len(ids) != 1 {
+		return "", fmt.Errorf("%w: %s resolves to %d changes", ErrInvalidRef, rev, len(ids))
+	}
+	return ids[0], nil
+}
+
+// newChangeIn returns the change in revset that isn't in before.
+func (j *JujutsuVCS) newChangeIn(ctx context.Context, revset string, before []string) (string, error) {
+	after, err := j.changeIDs(ctx, revset)
+	if err != nil {
+		return "", err
+	}
+	known := make(map[string]bool, len(before))
+	for _, id := range before {
+		known[id] = true
+	}
+	for _, id := range after {
+		if !known[id] {
+			return id, nil
+		}
+	}
+	return "", &CommandError{VCS: VCSTypeJujutsu, Command: "log", Args: []string{"-r", revset}, Err: ErrCommandFailed, Stderr: "no new change found"}
+}
+
+// SplitByPaths runs jj split with paths, keeping the original description
+// on both halves. jj keeps the change ID of id on one of them; the other is
+// found among its new parents or children.
+func (j *JujutsuVCS) SplitByPaths(ctx context.Context, id string, paths []string) (string, string, error) {
+	if len(paths) == 0 {
+		return "", "", fmt.Errorf("%w: no paths to split off", ErrInvalidArgument)
+	}
+	rev, err := j.revision(id)
+	if err != nil {
+		return "", "", err
+	}
+	filesets, err := jjPaths(paths)
+	if err != nil {
+		return "", "", err
+	}
+	change, err := j.changeID(ctx, rev)
+	if err != nil {
+		return "", "", err
+	}
+	self, err := j.revision(change)
+	if err != nil {
+		return "", "", err
+	}
+	neighbours := fmt.Sprintf("parents(%s) | children(%s)", self, self)
+	before, err := j.changeIDs(ctx, neighbours)
+	if err != nil {
+		return "", "", err
+	}
+	if _, _, err := j.runJJEnv(ctx, jjNoEditor, append([]string{"split", "-r", self}, filesets...)...); err != nil {
+		return "", "", err
+	}
+	other, err := j.newChangeIn(ctx, neighbours, before)
+	if err != nil {
+		return "", "", err
+	}
+	children, err := j.changeIDs(ctx, "children("+self+")")
+	if err != nil {
+		return "", "", err
+	}
+	for _, c := range children {
+		if c == other {
+			return change, other, nil
+		}
+	}
+	return other, change, nil
+}
+
+// Absorb runs jj absorb and returns the changes it reports, newest first.
+func (j *JujutsuVCS) Absorb(ctx context.Context, from string) ([]string, error) {
+	if !j.caps.Absorb {
+		return nil, j.caps.unsupported("absorb")
+	}
+	args := []string{"--color=never", "absorb"}
+	if from != "" {
+		rev, err := j.revision(from)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--from", rev)
+	}
+	_, stderr, err := j.runJJEnv(ctx, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	short := parseAbsorbed(stderr)
+	if len(short) == 0 {
+		return nil, nil
+	}
+	revs, err := j.revisions(short...)
+	if err != nil {
+		return nil, err
+	}
+	return j.changeIDs(ctx, strings.Join(revs, " | "))
+}
+
+// parseAbsorbed returns the short change IDs jj absorb lists under
+// "Absorbed changes into ...:", one indented commit summary per line.
+func parseAbsorbed(stderr string) []string {
+	var ids []string
+	listing := false
+	for _, line := range strings.Split(stderr, "\n") {
+		switch {
+		case strings.HasPrefix(line, "Absorbed changes into"):
+			listing = true
+		case listing && strings.HasPrefix(line, "  "):
+			if fields := strings.Fields(line); len(fields) > 0 {
+				ids = append(ids, fields[0])
+			}
+		default:
+			listing = false
+		}
+	}
+	return ids
+}
+
+// Duplicate runs jj duplicate. The copy is the new child of id's parents.
+func (j *JujutsuVCS) Duplicate(ctx context.Context, id string) (string, error) {
+	rev, err := j.revision(id)
+	if err != nil {
+		return "", err
+	}
+	siblings := fmt.Sprintf("children(parents(%s))", rev)
+	before, err := j.changeIDs(ctx, siblings)
+	if err != nil {
+		return "", err
+	}
+	if _, err := j.runJJ(ctx, "duplicate", rev); err != nil {
+		return "", err
+	}
+	return j.newChangeIn(ctx, siblings, before)
+}
+
+// Parallelize runs jj parallelize. The changes keep their change IDs.
+func (j *JujutsuVCS) Parallelize(ctx context.Context, ids ...string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: no changes to parallelize", ErrInvalidArgument)
+	}
+	revs, err := j.revisions(ids...)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := j.changeIDs(ctx, strings.Join(revs, " | "))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := j.runJJ(ctx, append([]string{"parallelize"}, revs...)...); err != nil {
+		return nil, err
+	}
+	for i, k := 0, len(changes)-1; i < k; i, k = i+1, k-1 {
+		changes[i], changes[k] = changes[k], changes[i]
+	}
+	return changes, nil
+}
+
+// --- git ---
+
+// resolveCommit returns the full hash of the commit rev names.
+func (g *GitVCS) resolveCommit(ctx context.Context, rev string) (string, error) {
+	if err := validateGitRevision(rev); err != nil {
+		return "", err
+	}
+	return g.runGit(ctx, "rev-parse", "--verify", "--end-of-options", rev+"^{commit}")
+}
+
+// commitParents returns the parents of commit.
+func (g *GitVCS) commitParents(ctx context.Context, commit string) ([]string, error) {
+	out, err := g.runGit(ctx, "rev-list", "--parents", "-n", "1", commit)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields[1:], nil
+}
+
+// commitLike creates a commit of tree with the given parents, copying the
+// author and message of from. env is added to commit-tree's environment.
+func (g *GitVCS) commitLike(ctx context.Context, tree string, parents []string, from string, env ...string) (string, error) {
+	out, err := g.runGitRaw(ctx, "log", "-1", "--date=raw", "--format=%an%x00%ae%x00%ad%x00%B", from, "--")
+	if err != nil {
+		return "", err
+	}
+	fields := strings.SplitN(out, "\x00", 4)
+	if len(fields) != 4 {
+		return "", &CommandError{VCS: VCSTypeGit, Command: "log", Args: []string{from}, Err: ErrCommandFailed, Stderr: "unexpected log output"}
+	}
+	env = append(env,
+		"GIT_AUTHOR_NAME="+fields[0],
+		"GIT_AUTHOR_EMAIL="+fields[1],
+		"GIT_AUTHOR_DATE="+fields[2],
+	)
+	args := []string{"commit-tree", tree}
+	for _, p := range parents {
+		args = append(args, "-p", p)
+	}
+	return g.runGitInput(ctx, env, strings.TrimRight(fields[3], "\n")+"\n", args...)
+}
+
+// tempIndex returns the environment for running git against a fresh index
+// file, leaving the repository's index alone, and a function removing it.
+func tempIndex() ([]string, func(), error) {
+	dir, err := os.MkdirTemp("", "wong-index-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	return []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}, func() { os.RemoveAll(dir) }, nil
+}
+
+// replaceInHistory makes the current branch use replacement in place of
+// old, which must have the same tree: HEAD moves if it is old, and commits
+// between old and HEAD are rebased. Other branches are left alone.
+func (g *GitVCS) replaceInHistory(ctx context.Context, old, replacement string) error {
+	head, err := g.runGit(ctx, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		return nil // unborn branch
+	}
+	if head == old {
+		_, err := g.runGit(ctx, "update-ref", "-m", "wong: rewrite", "HEAD", replacement, old)
+		return err
+	}
+	if ok, err := g.IsAncestor(ctx, old, head); err != nil || !ok {
+		return err
+	}
+	_, err = g.runGit(ctx, "rebase", "--quiet", "--autostash", "--onto", replacement, old)
+	return err
+}
+
+// SplitByPaths emulates jj split with commit-tree: first is id's parent plus
+// id's version of paths, second has id's full tree. id must have exactly one
+// parent. Only the current branch is rewritten.
+func (g *GitVCS) SplitByPaths(ctx context.Context, id string, paths []string) (string, string, error) {
+	if len(paths) == 0 {
+		return "", "", fmt.Errorf("%w: no paths to split off", ErrInvalidArgument)
+	}
+	for _, p := range paths {
+		if err := validatePath(p); err != nil {
+			return "", "", err
+		}
+	}
+	commit, err := g.resolveCommit(ctx, id)
+	if err != nil {
+		return "", "", err
+	}
+	parents, err := g.commitParents(ctx, commit)
+	if err != nil {
+		return "", "", err
+	}
+	if len(parents) != 1 {
+		return "", "", fmt.Errorf("%w: git can only split a commit with one parent", ErrNotSupported)
+	}
+
+	env, cleanup, err := tempIndex()
+	if err != nil {
+		return "", "", err
+	}
+	defer cleanup()
+	if _, err := g.runGitInput(ctx, env, "", "read-tree", parents[0]); err != nil {
+		return "", "", err
+	}
+	if _, err := g.runGitInput(ctx, env, "", append([]string{"reset", "--quiet", commit, "--"}, paths...)...); err != nil {
+		return "", "", err
+	}
+	tree, err := g.runGitInput(ctx, env, "", "write-tree")
+	if err != nil {
+		return "", "", err
+	}
+
+	first, err := g.commitLike(ctx, tree, parents, commit)
+	if err != nil {
+		return "", "", err
+	}
+	second, err := g.commitLike(ctx, commit+"^{tree}", []string{first}, commit)
+	if err != nil {
+		return "", "", err
+	}
+	if err := g.replaceInHistory(ctx, commit, second); err != nil {
+		return "", "", err
+	}
+	return first, second, nil
+}
+
+// Absorb emulates jj absorb with fixup commits and an autosquash rebase.
+// Where jj assigns each hunk by blame, git assigns whole files: each changed
+// file goes to the newest commit in StackInfo that touched it, and files no
+// stack commit touched stay in the working tree. Only the working tree can
+// be absorbed from.
+func (g *GitVCS) Absorb(ctx context.Context, from string) ([]string, error) {
+	if from != "" && from != "@" {
+		return nil, fmt.Errorf("%w: git can only absorb working tree changes", ErrNotSupported)
+	}
+	stack, err := g.StackInfo(ctx)
+	if err != nil || len(stack) == 0 {
+		return nil, err
+	}
+	base, revRange := "", "HEAD"
+	if parents := stack[len(stack)-1].Parents; len(parents) > 0 {
+		base = parents[0]
+		revRange = base + "..HEAD"
+	}
+
+	out, err := g.runGitRaw(ctx, "diff", "--name-only", "-z", "HEAD", "--")
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string][]string)
+	for _, file := range strings.Split(out, "\x00") {
+		if file == "" {
+			continue
+		}
+		target, err := g.runGit(ctx, "log", "-1", "--format=%H", revRange, "--", file)
+		if err != nil {
+			return nil, err
+		}
+		if target != "" {
+			targets[target] = append(targets[target], file)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	before, err := g.runGit(ctx, "rev-list", "--reverse", revRange)
+	if err != nil {
+		return nil, err
+	}
+	head, err := g.runGit(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	commits := strings.Fields(before)
+	for _, c := range commits {
+		if files := targets[c]; files != nil {
+			args := append([]string{"commit", "--quiet", "--no-verify", "--fixup=" + c, "--"}, files...)
+			if _, err := g.runGit(ctx, args...); err != nil {
+				return nil, g.undoAbsorb(ctx, head, err)
+			}
+		}
+	}
+	args := []string{"rebase", "--quiet", "--interactive", "--autosquash", "--autostash"}
+	if base == "" {
+		args = append(args, "--root")
+	} else {
+		args = append(args, base)
+	}
+	if _, err := g.runGitInput(ctx, []string{"GIT_SEQUENCE_EDITOR=true", "GIT_EDITOR=true"}, "", args...); err != nil {
+		return nil, g.undoAbsorb(ctx, head, err)
+	}
+
+	after, err := g.runGit(ctx, "rev-list", "--reverse", revRange)
+	if err != nil {
+		return nil, g.undoAbsorb(ctx, head, err)
+	}
+	rewritten := strings.Fields(after)
+	if len(rewritten) != len(commits) {
+		err := &CommandError{VCS: VCSTypeGit, Command: "rebase", Args: args, Err: ErrCommandFailed, Stderr: "autosquash changed the number of commits"}
+		return nil, g.undoAbsorb(ctx, head, err)
+	}
+	var absorbed []string
+	for i := len(commits) - 1; i >= 0; i-- {
+		if targets[commits[i]] != nil {
+			absorbed = append(absorbed, rewritten[i])
+		}
+	}
+	return absorbed, nil
+}
+
+// undoAbsorb puts the repository back the way Absorb found it after err:
+// an unfinished rebase is aborted and HEAD is reset to head, which leaves
+// the changes from the fixup commits in the working tree again.
+func (g *GitVCS) undoAbsorb(ctx context.Context, head string, err error) error {
+	rebaseDir, pathErr := g.runGit(ctx, "rev-parse", "--path-format=absolute", "--git-path", "rebase-merge")
+	if pathErr != nil {
+		return errors.Join(err, pathErr)
+	}
+	if _, statErr := os.Stat(rebaseDir); statErr == nil {
+		if _, abortErr := g.runGit(ctx, "rebase", "--abort"); abortErr != nil {
+			return errors.Join(err, abortErr)
+		}
+	}
+	if _, resetErr := g.runGit(ctx, "reset", "--quiet", head); resetErr != nil {
+		return errors.Join(err, resetErr)
+	}
+	return err
+}
+
+// Duplicate creates a copy of id on the same parents with commit-tree. The
+// copy isn't on any branch.
+func (g *GitVCS) Duplicate(ctx context.Context, id string) (string, error) {
+	commit, err := g.resolveCommit(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	parents, err := g.commitParents(ctx, commit)
+	if err != nil {
+		return "", err
+	}
+	dup, err := g.commitLike(ctx, commit+"^{tree}", parents, commit)
+	if err != nil || dup != commit {
+		return dup, err
+	}
+	// Copied within the same second, the copy is byte for byte the
+	// original. Move its committer date on so it is a distinct commit.
+	date, err := g.runGit(ctx, "log", "-1", "--date=raw", "--format=%cd", commit, "--")
+	if err != nil {
+		return "", err
+	}
+	secs, zone, _ := strings.Cut(date, " ")
+	n, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("parsing committer date %q: %w", date, err)
+	}
+	return g.commitLike(ctx, commit+"^{tree}", parents, commit, fmt.Sprintf("GIT_COMMITTER_DATE=%d %s", n+1, zone))
+}
+
+// Parallelize emulates jj parallelize by applying each commit's own diff to
+// the chain's base. It fails with ErrMergeConflict if a commit depends on an
+// earlier one in the chain. If the chain is on the current branch, the
+// commit after it becomes a merge of the new siblings; if its last commit
+// is HEAD, a merge commit is added so the working tree stays the same.
+func (g *GitVCS) Parallelize(ctx context.Context, ids ...string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: no changes to parallelize", ErrInvalidArgument)
+	}
+	parentOf := make(map[string]string)
+	for _, id := range ids {
+		c, err := g.resolveCommit(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		parents, err := g.commitParents(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if len(parents) != 1 {
+			return nil, fmt.Errorf("%w: git can only parallelize commits with one parent", ErrNotSupported)
+		}
+		parentOf[c] = parents[0]
+	}
+	chain, err := linearChain(parentOf)
+	if err != nil {
+		return nil, err
+	}
+	base := parentOf[chain[0]]
+
+	env, cleanup, err := tempIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	siblings := make([]string, 0, len(chain))
+	for _, c := range chain {
+		if _, err := g.runGitInput(ctx, env, "", "read-tree", base); err != nil {
+			return nil, err
+		}
+		patch, err := g.runGitRaw(ctx, "diff-tree", "-p", "--binary", "--full-index", parentOf[c], c)
+		if err != nil {
+			return nil, err
+		}
+		if patch != "" {
+			if _, err := g.runGitInput(ctx, env, patch, "apply", "--cached"); err != nil {
+				return nil, fmt.Errorf("%w: %s depends on an earlier commit in the chain: %v", ErrMergeConflict, c, err)
+			}
+		}
+		tree, err := g.runGitInput(ctx, env, "", "write-tree")
+		if err != nil {
+			return nil, err
+		}
+		s, err := g.commitLike(ctx, tree, []string{base}, c)
+		if err != nil {
+			return nil, err
+		}
+		siblings = append(siblings, s)
+	}
+
+	tip := chain[len(chain)-1]
+	head, err := g.runGit(ctx, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		return siblings, nil
+	}
+	if head == tip {
+		args := []string{"commit-tree", tip + "^{tree}"}
+		for _, s := range siblings {
+			args = append(args, "-p", s)
+		}
+		merge, err := g.runGitInput(ctx, nil, "Merge parallelized commits\n", args...)
+		if err != nil {
+			return nil, err
+		}
+		return siblings, g.replaceInHistory(ctx, tip, merge)
+	}
+	if ok, err := g.IsAncestor(ctx, tip, head); err != nil || !ok {
+		return siblings, err
+	}
+	path, err := g.runGit(ctx, "rev-list", "--reverse", "--ancestry-path", tip+"..HEAD")
+	if err != nil {
+		return nil, err
+	}
+	child := strings.Fields(path)[0]
+	parents, err := g.commitParents(ctx, child)
+	if err != nil {
+		return nil, err
+	}
+	newParents := append([]string{}, siblings...)
+	for _, p := range parents {
+		if p != tip {
+			newParents = append(newParents, p)
+		}
+	}
+	merged, err := g.commitLike(ctx, child+"^{tree}", newParents, child)
+	if err != nil {
+		return nil, err
+	}
+	return siblings, g.replaceInHistory(ctx, child, merged)
+}
+
+// linearChain orders commits, given as a map to their parents, from the
+// oldest so each is the parent of the next.
+func linearChain(parentOf map[string]string) ([]string, error) {
+	childOf := make(map[string]string)
+	var root string
+	for c, p := range parentOf {
+		if _, dup := childOf[p]; dup {
+			return nil, fmt.Errorf("%w: commits to parallelize must form a linear chain", ErrInvalidArgument)
+		}
+		childOf[p] = c
+		if _, inChain := parentOf[p]; !inChain {
+			if root != "" {
+				return nil, fmt.Errorf("%w: commits to parallelize must form a linear chain", ErrInvalidArgument)
+			}
+			root = c
+		}
+	}
+	chain := []string{root}
+	for c, ok := childOf[root]; ok; c, ok = childOf[c] {
+		chain = append(chain, c)
+	}
+	if len(chain) != len(parentOf) {
+		return nil, fmt.Errorf("%w: commits to parallelize must form a linear chain", ErrInvalidArgument)
+	}
+	return chain, nil
+}
+
+var (
+	_ StackEditor = (*JujutsuVCS)(nil)
+	_ StackEditor = (*GitVCS)(nil)
+)
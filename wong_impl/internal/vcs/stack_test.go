@@ -0,0 +1,285 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitStackRepo returns a git repo whose origin has "init" (c.txt), with
+// "one" (a.txt) and "two" (b.txt) committed on top and not pushed.
+func gitStackRepo(t *testing.T) (*GitVCS, *TestHelper, string) {
+	t.Helper()
+	h := NewTestHelper(t)
+	remote := h.CreateGitRepo("remote.git")
+	h.runCmd(remote, "git", "config", "core.bare", "true")
+	repo := h.CreateGitRepo("repo")
+	h.runCmd(repo, "git", "checkout", "-q", "-b", "main")
+	h.WriteFile(repo, "c.txt", "c\n")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-q", "-m", "init")
+	h.runCmd(repo, "git", "remote", "add", "origin", remote)
+	h.runCmd(repo, "git", "push", "-q", "origin", "main")
+	h.WriteFile(repo, "a.txt", "a\n")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-q", "-m", "one")
+	h.WriteFile(repo, "b.txt", "b\n")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-q", "-m", "two")
+	g, err := NewGitVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g, h, repo
+}
+
+// gitOut runs git in repo and returns its trimmed output.
+func gitOut(h *TestHelper, repo string, args ...string) string {
+	return strings.TrimSpace(h.runCmd(repo, "git", args...))
+}
+
+func TestGitVCS_SplitByPaths(t *testing.T) {
+	g, h, repo := gitStackRepo(t)
+	ctx := context.Background()
+	h.WriteFile(repo, "a.txt", "a2\n")
+	h.WriteFile(repo, "d.txt", "d\n")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-q", "-m", "three")
+	three := gitOut(h, repo, "rev-parse", "HEAD")
+
+	first, second, err := g.SplitByPaths(ctx, "HEAD", []string{"d.txt"})
+	if err != nil {
+		t.Fatalf("SplitByPaths: %v", err)
+	}
+	if got := gitOut(h, repo, "diff-tree", "--no-commit-id", "--name-only", "-r", first); got != "d.txt" {
+		t.Errorf("first changes %q; want d.txt", got)
+	}
+	if got := gitOut(h, repo, "diff-tree", "--no-commit-id", "--name-only", "-r", second); got != "a.txt" {
+		t.Errorf("second changes %q; want a.txt", got)
+	}
+	if got := gitOut(h, repo, "rev-parse", "HEAD"); got != second {
+		t.Errorf("HEAD = %s; want second %s", got, second)
+	}
+	if got := gitOut(h, repo, "rev-parse", second+"^{tree}"); got != gitOut(h, repo, "rev-parse", three+"^{tree}") {
+		t.Error("second doesn't have the original tree")
+	}
+	if got := gitOut(h, repo, "log", "-1", "--format=%s", first); got != "three" {
+		t.Errorf("first message = %q", got)
+	}
+
+	// Splitting a commit below HEAD rebases the commits above it.
+	first, second, err = g.SplitByPaths(ctx, "HEAD~2", []string{"b.txt"})
+	if err != nil {
+		t.Fatalf("SplitByPaths(HEAD~2): %v", err)
+	}
+	if got := gitOut(h, repo, "rev-parse", "HEAD~2", "HEAD~3"); got != second+"\n"+first {
+		t.Errorf("HEAD~2, HEAD~3 = %q; want second, first", got)
+	}
+	if got := gitOut(h, repo, "log", "--format=%s"); got != "three\nthree\ntwo\ntwo\none\ninit" {
+		t.Errorf("log = %q", got)
+	}
+	if got := gitOut(h, repo, "status", "--porcelain"); got != "" {
+		t.Errorf("working tree changed: %q", got)
+	}
+	if _, _, err := g.SplitByPaths(ctx, "HEAD", nil); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("SplitByPaths without paths: %v", err)
+	}
+}
+
+func TestGitVCS_Absorb(t *testing.T) {
+	g, h, repo := gitStackRepo(t)
+	ctx := context.Background()
+	h.WriteFile(repo, "a.txt", "a fixed\n")
+	h.WriteFile(repo, "b.txt", "b fixed\n")
+	h.WriteFile(repo, "c.txt", "c changed\n") // last touched by the pushed commit
+
+	absorbed, err := g.Absorb(ctx, "")
+	if err != nil {
+		t.Fatalf("Absorb: %v", err)
+	}
+	head := gitOut(h, repo, "rev-parse", "HEAD")
+	one := gitOut(h, repo, "rev-parse", "HEAD~1")
+	if len(absorbed) != 2 || absorbed[0] != head || absorbed[1] != one {
+		t.Errorf("Absorb = %v; want [%s %s]", absorbed, head, one)
+	}
+	if got := gitOut(h, repo, "log", "--format=%s"); got != "two\none\ninit" {
+		t.Errorf("log = %q", got)
+	}
+	if got := gitOut(h, repo, "show", "HEAD~1:a.txt"); got != "a fixed" {
+		t.Errorf("one's a.txt = %q", got)
+	}
+	if got := gitOut(h, repo, "status", "--porcelain"); got != "M c.txt" {
+		t.Errorf("status = %q; want only c.txt left", got)
+	}
+
+	if _, err := g.Absorb(ctx, "HEAD"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Absorb(HEAD) = %v; want ErrNotSupported", err)
+	}
+}
+
+func TestGitVCS_AbsorbConflictRollsBack(t *testing.T) {
+	g, h, repo := gitStackRepo(t)
+	ctx := context.Background()
+	// A merge in the stack makes the autosquash rebase flatten it, and the
+	// two sides of the merge conflict on a.txt.
+	h.runCmd(repo, "git", "checkout", "-q", "-b", "side", "origin/main")
+	h.WriteFile(repo, "a.txt", "side\n")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-q", "-m", "side")
+	h.runCmd(repo, "git", "checkout", "-q", "main")
+	h.runCmdNoFail(repo, "git", "merge", "-q", "side")
+	h.WriteFile(repo, "a.txt", "merged\n")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-q", "--no-edit")
+	head := gitOut(h, repo, "rev-parse", "HEAD")
+	h.WriteFile(repo, "a.txt", "merged fixed\n")
+
+	if _, err := g.Absorb(ctx, ""); err == nil {
+		t.Fatal("Absorb succeeded across a conflicting merge")
+	}
+	if got := gitOut(h, repo, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD = %s; want %s", got, head)
+	}
+	if _, err := os.Stat(filepath.Join(repo, gitOut(h, repo, "rev-parse", "--git-path", "rebase-merge"))); err == nil {
+		t.Error("rebase still in progress")
+	}
+	if got := gitOut(h, repo, "status", "--porcelain"); got != "M a.txt" {
+		t.Errorf("status = %q; want a.txt modified", got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo, "a.txt")); string(data) != "merged fixed\n" {
+		t.Errorf("a.txt = %q", data)
+	}
+}
+
+func TestGitVCS_Duplicate(t *testing.T) {
+	g, h, repo := gitStackRepo(t)
+	dup, err := g.Duplicate(context.Background(), "HEAD")
+	if err != nil {
+		t.Fatalf("Duplicate: %v", err)
+	}
+	if dup == gitOut(h, repo, "rev-parse", "HEAD") {
+		t.Fatal("Duplicate returned HEAD")
+	}
+	for _, format := range []string{"%T", "%P", "%B", "%an <%ae> %ad"} {
+		if got, want := gitOut(h, repo, "log", "-1", "--format="+format, dup), gitOut(h, repo, "log", "-1", "--format="+format, "HEAD"); got != want {
+			t.Errorf("%s: %q; want %q", format, got, want)
+		}
+	}
+	if got := gitOut(h, repo, "branch", "--contains", dup); got != "" {
+		t.Errorf("duplicate is on branches %q", got)
+	}
+}
+
+func TestGitVCS_Parallelize(t *testing.T) {
+	g, h, repo := gitStackRepo(t)
+	ctx := context.Background()
+	init := gitOut(h, repo, "rev-parse", "HEAD~2")
+	tree := gitOut(h, repo, "rev-parse", "HEAD^{tree}")
+
+	siblings, err := g.Parallelize(ctx, "HEAD", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Parallelize: %v", err)
+	}
+	if len(siblings) != 2 {
+		t.Fatalf("Parallelize = %v", siblings)
+	}
+	for i, want := range []string{"one", "two"} {
+		if got := gitOut(h, repo, "log", "-1", "--format=%s %P", siblings[i]); got != want+" "+init {
+			t.Errorf("sibling %d = %q; want %q", i, got, want+" "+init)
+		}
+	}
+	if got := gitOut(h, repo, "log", "-1", "--format=%P %T", "HEAD"); got != siblings[0]+" "+siblings[1]+" "+tree {
+		t.Errorf("HEAD = %q; want a merge of the siblings with the old tree", got)
+	}
+
+	// A commit that needs its predecessor can't be moved beside it.
+	h.WriteFile(repo, "a.txt", "a2\n")
+	h.runCmd(repo, "git", "commit", "-q", "-am", "three")
+	if _, err := g.Parallelize(ctx, siblings[0], "HEAD"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Parallelize of a non-chain = %v; want ErrInvalidArgument", err)
+	}
+	h.runCmd(repo, "git", "reset", "-q", "--hard", siblings[0])
+	h.WriteFile(repo, "a.txt", "a2\n")
+	h.runCmd(repo, "git", "commit", "-q", "-am", "three")
+	if _, err := g.Parallelize(ctx, "HEAD~1", "HEAD"); !errors.Is(err, ErrMergeConflict) {
+		t.Errorf("Parallelize of dependent commits = %v; want ErrMergeConflict", err)
+	}
+}
+
+func TestParseAbsorbed(t *testing.T) {
+	stderr := "Absorbed changes into these revisions:\n" +
+		"  zsuskuln 3027ceb3 foo\n" +
+		"  kkmpptxz 7b3f1e22 bar | second line\n" +
+		"Rebased 1 descendant commits.\n" +
+		"Working copy now at: yqosqzyt 8c0e4a19 (empty) (no description set)\n" +
+		"Parent commit      : zsuskuln 3027ceb3 foo\n"
+	if got := strings.Join(parseAbsorbed(stderr), " "); got != "zsuskuln kkmpptxz" {
+		t.Errorf("parseAbsorbed = %q", got)
+	}
+	if got := parseAbsorbed("Nothing changed.\n"); got != nil {
+		t.Errorf("parseAbsorbed(nothing) = %v", got)
+	}
+}
+
+func TestJujutsuVCS_StackEditorUnsupported(t *testing.T) {
+	repo, _ := stubJJ(t, "0.22.0")
+	j, err := NewJujutsuVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.Absorb(context.Background(), ""); !errors.Is(err, ErrUnsupportedJJVersion) {
+		t.Errorf("Absorb on 0.22 = %v; want ErrUnsupportedJJVersion", err)
+	}
+}
+
+func TestJujutsuVCS_StackEditor(t *testing.T) {
+	if _, err := exec.LookPath("jj"); err != nil {
+		t.Skip("jj not installed")
+	}
+	h := NewTestHelper(t)
+	repo := h.CreateJJRepo("stack")
+	j, err := NewJujutsuVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	h.WriteFile(repo, "a.txt", "a\n")
+	h.WriteFile(repo, "b.txt", "b\n")
+	h.runCmd(repo, "jj", "describe", "-m", "both")
+
+	first, second, err := j.SplitByPaths(ctx, "@", []string{"a.txt"})
+	if err != nil {
+		t.Fatalf("SplitByPaths: %v", err)
+	}
+	firstDiff, err := j.DiffStructured(ctx, first+"-", first, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(firstDiff.Files) != 1 || firstDiff.Files[0].Path() != "a.txt" {
+		t.Errorf("first changes %+v; want a.txt", firstDiff.Files)
+	}
+	parent, err := j.changeIDs(ctx, "parents(change_id("+quoteRevsetString(second)+"))")
+	if err != nil || len(parent) != 1 || parent[0] != first {
+		t.Errorf("parent of second = %v, %v; want %s", parent, err, first)
+	}
+
+	dup, err := j.Duplicate(ctx, first)
+	if err != nil {
+		t.Fatalf("Duplicate: %v", err)
+	}
+	if dup == first || dup == second {
+		t.Errorf("Duplicate returned an existing change %s", dup)
+	}
+
+	changes, err := j.Parallelize(ctx, first, second)
+	if err != nil {
+		t.Fatalf("Parallelize: %v", err)
+	}
+	if len(changes) != 2 || changes[0] != first || changes[1] != second {
+		t.Errorf("Parallelize = %v; want [%s %s]", changes, first, second)
+	}
+}
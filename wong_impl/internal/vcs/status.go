@@ -0,0 +1,198 @@
+package vcs
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Status output from every backend is reduced to the same StatusEntry
+// semantics:
+//   - renames and copies report the new Path and the OldPath;
+//   - conflicted files have FileStatusConflicted, Conflicted set and Staged
+//     clear, whatever else changed about them;
+//   - untracked and ignored files are never Staged;
+//   - entries are sorted by Path.
+
+// finishStatus marks paths as conflicted, adding entries for any not yet
+// listed, and sorts the result.
+func finishStatus(entries []StatusEntry, conflicted []string) []StatusEntry {
+	for _, p := range conflicted {
+		found := false
+		for i := range entries {
+			if entries[i].Path == p {
+				entries[i] = StatusEntry{Path: p, Status: FileStatusConflicted, Conflicted: true}
+				found = true
+			}
+		}
+		if !found {
+			entries = append(entries, StatusEntry{Path: p, Status: FileStatusConflicted, Conflicted: true})
+		}
+	}
+	if entries == nil {
+		entries = []StatusEntry{}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// untrackedEntries returns an entry with status s for each path.
+func untrackedEntries(paths []string, s FileStatus) []StatusEntry {
+	entries := make([]StatusEntry, 0, len(paths))
+	for _, p := range paths {
+		entries = append(entries, StatusEntry{Path: p, Status: s})
+	}
+	return entries
+}
+
+// splitNul splits NUL-terminated output, as from git -z, into its fields.
+func splitNul(out string) []string {
+	fields := strings.Split(out, "\x00")
+	if n := len(fields); n > 0 && fields[n-1] == "" {
+		fields = fields[:n-1]
+	}
+	return fields
+}
+
+// --- git ---
+
+// gitStatusCode maps a porcelain v1 XY code to a status. staged reports
+// whether the change is in the index.
+func gitStatusCode(x, y byte) (status FileStatus, staged bool) {
+	switch {
+	case x == 'U' || y == 'U' || x == 'A' && y == 'A' || x == 'D' && y == 'D':
+		return FileStatusConflicted, false
+	case x == '?':
+		return FileStatusUntracked, false
+	case x == '!':
+		return FileStatusIgnored, false
+	case x == 'R' || y == 'R':
+		return FileStatusRenamed, x == 'R'
+	case x == 'C' || y == 'C':
+		return FileStatusCopied, x == 'C'
+	case x == 'A':
+		return FileStatusAdded, true
+	case x == 'D' || y == 'D':
+		return FileStatusDeleted, x == 'D'
+	case x == 'M' || y == 'M' || x == 'T' || y == 'T':
+		return FileStatusModified, x == 'M' || x == 'T'
+	}
+	return FileStatusModified, x != ' '
+}
+
+// parseGitStatus parses git status --porcelain -z. Renames and copies are
+// followed by a field holding the old path.
+func parseGitStatus(out string) []StatusEntry {
+	var entries []StatusEntry
+	fields := splitNul(out)
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if len(f) < 4 {
+			continue
+		}
+		x, y := f[0], f[1]
+		e := StatusEntry{Path: f[3:]}
+		e.Status, e.Staged = gitStatusCode(x, y)
+		e.Conflicted = e.Status == FileStatusConflicted
+		if x == 'R' || x == 'C' || y == 'R' || y == 'C' {
+			if i+1 < len(fields) {
+				i++
+				e.OldPath = fields[i]
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// --- jj ---
+
+// parseJJSummary parses jj diff --summary. Renames and copies are shown as
+// "R dir/{old => new}/file".
+func parseJJSummary(out string) []StatusEntry {
+	var entries []StatusEntry
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) < 3 || line[1] != ' ' {
+			continue
+		}
+		e := StatusEntry{Path: line[2:], Staged: true} // jj snapshots everything
+		switch line[0] {
+		case 'M':
+			e.Status = FileStatusModified
+		case 'A':
+			e.Status = FileStatusAdded
+		case 'D':
+			e.Status = FileStatusDeleted
+		case 'R':
+			e.Status = FileStatusRenamed
+			e.OldPath, e.Path = splitRenamePath(e.Path)
+		case 'C':
+			e.Status = FileStatusCopied
+			e.OldPath, e.Path = splitRenamePath(e.Path)
+		default:
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// splitRenamePath expands "prefix{old => new}suffix" into both paths. An
+// empty side leaves a doubled slash, which is collapsed.
+func splitRenamePath(s string) (oldPath, newPath string) {
+	open := strings.Index(s, "{")
+	arrow := strings.Index(s, " => ")
+	end := strings.LastIndex(s, "}")
+	if open < 0 || arrow < open || end < arrow {
+		if old, cur, ok := strings.Cut(s, " => "); ok {
+			return old, cur
+		}
+		return s, s
+	}
+	prefix, suffix := s[:open], s[end+1:]
+	clean := func(p string) string {
+		return strings.TrimPrefix(strings.ReplaceAll(p, "//", "/"), "/")
+	}
+	return clean(prefix + s[open+1:arrow] + suffix), clean(prefix + s[arrow+4:end] + suffix)
+}
+
+// jjConflictLineRe matches a jj resolve --list line: the path, padding and a
+// description such as "2-sided conflict including 1 deletion".
+var jjConflictLineRe = regexp.MustCompile(`^(.*?)\s+\d+-sided conflict`)
+
+// parseJJConflicts returns the paths listed by jj resolve --list.
+func parseJJConflicts(out string) []string {
+	var paths []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if m := jjConflictLineRe.FindStringSubmatch(line); m != nil {
+			paths = append(paths, m[1])
+		} else {
+			paths = append(paths, strings.TrimSpace(line))
+		}
+	}
+	return paths
+}
+
+// parseJJUntracked returns the "? path" lines of jj status's "Untracked
+// paths:" section, which releases with snapshot.auto-track print.
+func parseJJUntracked(out string) []string {
+	var paths []string
+	in := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case line == "Untracked paths:":
+			in = true
+		case in && strings.HasPrefix(line, "? "):
+			paths = append(paths, line[2:])
+		default:
+			in = false
+		}
+	}
+	return paths
+}
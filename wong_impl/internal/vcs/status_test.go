@@ -0,0 +1,209 @@
+package vcs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// statusCorpus describes working-copy states as each backend reports them.
+// Both parsers must reduce them to the same entries. git changes are staged
+// so that Staged agrees with jj, which snapshots everything.
+var statusCorpus = []struct {
+	name string
+
+	git string // git status --porcelain -z --untracked-files=all
+
+	jjSummary   string // jj diff --summary
+	jjConflicts string // jj resolve --list
+	jjStatus    string // jj status, for untracked paths
+
+	want []StatusEntry
+}{
+	{
+		name:      "modified",
+		git:       "M  a.txt\x00",
+		jjSummary: "M a.txt",
+		want:      []StatusEntry{{Path: "a.txt", Status: FileStatusModified, Staged: true}},
+	},
+	{
+		name:      "added and deleted",
+		git:       "D  old.txt\x00A  new.txt\x00",
+		jjSummary: "A new.txt\nD old.txt",
+		want: []StatusEntry{
+			{Path: "new.txt", Status: FileStatusAdded, Staged: true},
+			{Path: "old.txt", Status: FileStatusDeleted, Staged: true},
+		},
+	},
+	{
+		name:      "space in path",
+		git:       "M  my file.txt\x00",
+		jjSummary: "M my file.txt",
+		want:      []StatusEntry{{Path: "my file.txt", Status: FileStatusModified, Staged: true}},
+	},
+	{
+		name:      "rename in directory",
+		git:       "R  dir/new.txt\x00dir/old.txt\x00",
+		jjSummary: "R dir/{old.txt => new.txt}",
+		want:      []StatusEntry{{Path: "dir/new.txt", OldPath: "dir/old.txt", Status: FileStatusRenamed, Staged: true}},
+	},
+	{
+		name:      "rename across directories",
+		git:       "R  b/f.txt\x00a/f.txt\x00",
+		jjSummary: "R {a => b}/f.txt",
+		want:      []StatusEntry{{Path: "b/f.txt", OldPath: "a/f.txt", Status: FileStatusRenamed, Staged: true}},
+	},
+	{
+		name:      "rename into subdirectory",
+		git:       "R  sub/f.txt\x00f.txt\x00",
+		jjSummary: "R { => sub}/f.txt",
+		want:      []StatusEntry{{Path: "sub/f.txt", OldPath: "f.txt", Status: FileStatusRenamed, Staged: true}},
+	},
+	{
+		name:      "copy",
+		git:       "C  copy.txt\x00orig.txt\x00",
+		jjSummary: "C {orig.txt => copy.txt}",
+		want:      []StatusEntry{{Path: "copy.txt", OldPath: "orig.txt", Status: FileStatusCopied, Staged: true}},
+	},
+	{
+		name:        "conflict",
+		git:         "M  a.txt\x00UU both.txt\x00",
+		jjSummary:   "M a.txt\nM both.txt",
+		jjConflicts: "both.txt    2-sided conflict",
+		want: []StatusEntry{
+			{Path: "a.txt", Status: FileStatusModified, Staged: true},
+			{Path: "both.txt", Status: FileStatusConflicted, Conflicted: true},
+		},
+	},
+	{
+		name:        "conflict added on both sides",
+		git:         "AA new file.txt\x00",
+		jjSummary:   "A new file.txt",
+		jjConflicts: "new file.txt    2-sided conflict",
+		want:        []StatusEntry{{Path: "new file.txt", Status: FileStatusConflicted, Conflicted: true}},
+	},
+	{
+		name:        "conflict with deletion",
+		git:         "UD gone.txt\x00",
+		jjSummary:   "M gone.txt",
+		jjConflicts: "gone.txt    2-sided conflict including 1 deletion",
+		want:        []StatusEntry{{Path: "gone.txt", Status: FileStatusConflicted, Conflicted: true}},
+	},
+	{
+		name:      "untracked",
+		git:       "M  a.txt\x00?? notes/todo.txt\x00",
+		jjSummary: "M a.txt",
+		jjStatus: "Working copy changes:\nM a.txt\nUntracked paths:\n? notes/todo.txt\n" +
+			"Working copy  (@) : qpvuntsm 230dd059 (no description set)\n" +
+			"Parent commit (@-): zzzzzzzz 00000000 (empty) (no description set)",
+		want: []StatusEntry{
+			{Path: "a.txt", Status: FileStatusModified, Staged: true},
+			{Path: "notes/todo.txt", Status: FileStatusUntracked},
+		},
+	},
+	{
+		name: "clean",
+		want: []StatusEntry{},
+	},
+}
+
+func TestStatusCorpus(t *testing.T) {
+	for _, tc := range statusCorpus {
+		t.Run(tc.name, func(t *testing.T) {
+			want := fmt.Sprintf("%+v", tc.want)
+			if got := fmt.Sprintf("%+v", finishStatus(parseGitStatus(tc.git), nil)); got != want {
+				t.Errorf("git:\n got %s\nwant %s", got, want)
+			}
+			jj := parseJJSummary(tc.jjSummary)
+			jj = append(jj, untrackedEntries(parseJJUntracked(tc.jjStatus), FileStatusUntracked)...)
+			if got := fmt.Sprintf("%+v", finishStatus(jj, parseJJConflicts(tc.jjConflicts))); got != want {
+				t.Errorf("jj:\n got %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestGitStatusCode(t *testing.T) {
+	tests := []struct {
+		xy     string
+		status FileStatus
+		staged bool
+	}{
+		{" M", FileStatusModified, false},
+		{"MM", FileStatusModified, true},
+		{" T", FileStatusModified, false},
+		{" D", FileStatusDeleted, false},
+		{"AM", FileStatusAdded, true},
+		{"RM", FileStatusRenamed, true},
+		{"DD", FileStatusConflicted, false},
+		{"AU", FileStatusConflicted, false},
+		{"??", FileStatusUntracked, false},
+		{"!!", FileStatusIgnored, false},
+	}
+	for _, tt := range tests {
+		if status, staged := gitStatusCode(tt.xy[0], tt.xy[1]); status != tt.status || staged != tt.staged {
+			t.Errorf("%q = %s, %v; want %s, %v", tt.xy, status, staged, tt.status, tt.staged)
+		}
+	}
+}
+
+func TestGitVCS_StatusWithOptions(t *testing.T) {
+	h := NewTestHelper(t)
+	repo := h.CreateGitRepo("status")
+	h.WriteFile(repo, ".gitignore", "*.log\n")
+	h.WriteFile(repo, "old.txt", "rename me\nplease\n")
+	h.WriteFile(repo, "both.txt", "base\n")
+	h.runCmd(repo, "git", "add", ".")
+	h.runCmd(repo, "git", "commit", "-q", "-m", "base")
+	h.runCmd(repo, "git", "checkout", "-q", "-b", "other")
+	h.WriteFile(repo, "both.txt", "other\n")
+	h.runCmd(repo, "git", "commit", "-q", "-am", "other")
+	h.runCmd(repo, "git", "checkout", "-q", "-")
+	h.WriteFile(repo, "both.txt", "mine\n")
+	h.runCmd(repo, "git", "commit", "-q", "-am", "mine")
+	h.runCmdNoFail(repo, "git", "merge", "-q", "other") // conflicts in both.txt
+	h.runCmd(repo, "git", "mv", "old.txt", "new.txt")
+	h.WriteFile(repo, "new.txt", "rename me\nplease\nnow\n") // unstaged edit on top
+	h.WriteFile(repo, "debug.log", "x\n")
+	h.WriteFile(repo, "untracked.txt", "x\n")
+
+	g, err := NewGitVCS(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	summarize := func(entries []StatusEntry) string {
+		s := ""
+		for _, e := range entries {
+			s += fmt.Sprintf("%s:%s<%s staged=%v conflicted=%v\n", e.Status, e.Path, e.OldPath, e.Staged, e.Conflicted)
+		}
+		return s
+	}
+	tracked := "conflicted:both.txt< staged=false conflicted=true\n" +
+		"renamed:new.txt<old.txt staged=true conflicted=false\n"
+
+	entries, err := g.StatusWithOptions(ctx, nil)
+	if err != nil {
+		t.Fatalf("StatusWithOptions: %v", err)
+	}
+	if got := summarize(entries); got != tracked {
+		t.Errorf("tracked only:\n%s", got)
+	}
+	entries, err = g.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := summarize(entries), tracked+"untracked:untracked.txt< staged=false conflicted=false\n"; got != want {
+		t.Errorf("Status:\n%s\nwant:\n%s", got, want)
+	}
+	entries, err = g.StatusWithOptions(ctx, &StatusOptions{Ignored: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "conflicted:both.txt< staged=false conflicted=true\n" +
+		"ignored:debug.log< staged=false conflicted=false\n" +
+		"renamed:new.txt<old.txt staged=true conflicted=false\n"
+	if got := summarize(entries); got != want {
+		t.Errorf("ignored:\n%s\nwant:\n%s", got, want)
+	}
+}
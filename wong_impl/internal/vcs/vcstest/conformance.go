@@ -0,0 +1,546 @@
+// Package vcstest provides a conformance suite for vcs.VCS implementations.
+// Each backend's tests call Run with a factory for fresh repositories, so the
+// same behavioral expectations are checked against git, jj and FakeVCS and any
+// divergence between backends shows up as a failing subtest.
+//
+// The suite only asserts behavior that callers rely on regardless of backend.
+// Known, documented differences (jj has no staging area, jj IDs are change
+// IDs, jj Merge never fails on conflicts) are deliberately left out.
+package vcstest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+// Repo is a fresh repository handed to each conformance case.
+type Repo struct {
+	// VCS is the backend under test.
+	VCS vcs.VCS
+
+	// WriteFile creates or overwrites a file relative to the repo root.
+	WriteFile func(t *testing.T, path, content string)
+
+	// RemoveFile deletes a file relative to the repo root.
+	RemoveFile func(t *testing.T, path string)
+
+	// WorkspacePath returns a path where a new workspace called name can be
+	// created.
+	WorkspacePath func(t *testing.T, name string) string
+}
+
+// Run runs every conformance case as a subtest of t. newRepo must return an
+// empty repository with an identity configured for committing.
+func Run(t *testing.T, newRepo func(t *testing.T) *Repo) {
+	cases := []struct {
+		name string
+		fn   func(t *testing.T, r *Repo)
+	}{
+		{"CommitAndLog", testCommitAndLog},
+		{"ShowAndShowFile", testShowAndShowFile},
+		{"RichChangeInfo", testRichChangeInfo},
+		{"ResolveRef", testResolveRef},
+		{"IsAncestor", testIsAncestor},
+		{"LogBetween", testLogBetween},
+		{"Query", testQuery},
+		{"DiffStructured", testDiffStructured},
+		{"Evolog", testEvolog},
+		{"Annotate", testAnnotate},
+		{"IsFileTracked", testIsFileTracked},
+		{"StatusNewFile", testStatusNewFile},
+		{"StatusModifiedFile", testStatusModifiedFile},
+		{"StatusOptions", testStatusOptions},
+		{"Branches", testBranches},
+		{"Config", testConfig},
+		{"Workspaces", testWorkspaces},
+		{"NoConflicts", testNoConflicts},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newRepo(t))
+		})
+	}
+}
+
+// commitFile writes, stages and commits a single file, then returns the ID
+// of the new change as reported by Log.
+func commitFile(t *testing.T, r *Repo, path, content, message string) string {
+	t.Helper()
+	ctx := context.Background()
+	r.WriteFile(t, path, content)
+	if err := r.VCS.Stage(ctx, path); err != nil {
+		t.Fatalf("Stage(%s): %v", path, err)
+	}
+	if err := r.VCS.Commit(ctx, message, nil); err != nil {
+		t.Fatalf("Commit(%q): %v", message, err)
+	}
+	return findChange(t, r, message).ID
+}
+
+// findChange returns the logged change whose description is message.
+func findChange(t *testing.T, r *Repo, message string) vcs.ChangeInfo {
+	t.Helper()
+	changes, err := r.VCS.Log(context.Background(), 20)
+	if err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+	for _, c := range changes {
+		if strings.TrimSpace(c.Description) == message {
+			return c
+		}
+	}
+	t.Fatalf("no change with description %q in log %+v", message, changes)
+	return vcs.ChangeInfo{}
+}
+
+func testCommitAndLog(t *testing.T, r *Repo) {
+	commitFile(t, r, "a.txt", "one\n", "first")
+	commitFile(t, r, "b.txt", "two\n", "second")
+
+	changes, err := r.VCS.Log(context.Background(), 20)
+	if err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+	first, second := -1, -1
+	for i, c := range changes {
+		switch strings.TrimSpace(c.Description) {
+		case "first":
+			first = i
+		case "second":
+			second = i
+		}
+		if c.ID == "" || c.ShortID == "" {
+			t.Errorf("change %d has empty ID or ShortID: %+v", i, c)
+		}
+	}
+	if first < 0 || second < 0 {
+		t.Fatalf("log is missing commits: %+v", changes)
+	}
+	if second > first {
+		t.Errorf("log is not newest first: second at %d, first at %d", second, first)
+	}
+
+	limited, err := r.VCS.Log(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Log(1): %v", err)
+	}
+	if len(limited) != 1 {
+		t.Errorf("Log(1) returned %d changes", len(limited))
+	}
+}
+
+func testShowAndShowFile(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	id := commitFile(t, r, "dir/file.txt", "hello\nworld\n", "add file")
+
+	info, err := r.VCS.Show(ctx, id)
+	if err != nil {
+		t.Fatalf("Show: %v", err)
+	}
+	if info.ID != id || strings.TrimSpace(info.Description) != "add file" {
+		t.Errorf("Show(%s) = %+v", id, info)
+	}
+
+	data, err := r.VCS.ShowFile(ctx, id, "dir/file.txt")
+	if err != nil {
+		t.Fatalf("ShowFile: %v", err)
+	}
+	// git and jj trim command output, so compare without trailing newlines.
+	if got := strings.TrimSpace(string(data)); got != "hello\nworld" {
+		t.Errorf("ShowFile = %q", got)
+	}
+
+	if _, err := r.VCS.ShowFile(ctx, id, "missing.txt"); err == nil {
+		t.Error("ShowFile of a missing path should fail")
+	}
+}
+
+func testRichChangeInfo(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	first := commitFile(t, r, "a.txt", "one\n", "first")
+	firstInfo, err := r.VCS.Show(ctx, first)
+	if err != nil {
+		t.Fatalf("Show(first): %v", err)
+	}
+
+	r.WriteFile(t, "b.txt", "two\n")
+	if err := r.VCS.Stage(ctx, "b.txt"); err != nil {
+		t.Fatalf("Stage: %v", err)
+	}
+	message := "subject line\n\nBody with \"quotes\" and\ttabs.\nSecond body line."
+	if err := r.VCS.Commit(ctx, message, nil); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	info := findChange(t, r, "subject line")
+
+	if info.CommitID == "" {
+		t.Error("CommitID is empty")
+	}
+	if strings.TrimSpace(info.FullDescription) != message {
+		t.Errorf("FullDescription = %q, want %q", info.FullDescription, message)
+	}
+	if len(info.Parents) != 1 || info.Parents[0] != firstInfo.CommitID {
+		t.Errorf("Parents = %v, want [%s]", info.Parents, firstInfo.CommitID)
+	}
+	if info.Time.IsZero() {
+		t.Error("Time is zero")
+	}
+	if info.IsEmpty {
+		t.Error("a change that adds a file is reported empty")
+	}
+	if info.IsConflicted || info.IsDivergent {
+		t.Errorf("unexpected flags: %+v", info)
+	}
+}
+
+func testResolveRef(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	id := commitFile(t, r, "a.txt", "one\n", "resolve me")
+
+	resolved, err := r.VCS.ResolveRef(ctx, id)
+	if err != nil {
+		t.Fatalf("ResolveRef: %v", err)
+	}
+	info, err := r.VCS.Show(ctx, resolved)
+	if err != nil {
+		t.Fatalf("Show(resolved): %v", err)
+	}
+	if strings.TrimSpace(info.Description) != "resolve me" {
+		t.Errorf("ResolveRef(%s) = %s, which shows %+v", id, resolved, info)
+	}
+
+	if _, err := r.VCS.ResolveRef(ctx, "no-such-ref-anywhere"); err == nil {
+		t.Error("ResolveRef of an unknown ref should fail")
+	}
+}
+
+func testIsAncestor(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	first := commitFile(t, r, "a.txt", "one\n", "first")
+	second := commitFile(t, r, "b.txt", "two\n", "second")
+
+	if ok, err := r.VCS.IsAncestor(ctx, first, second); err != nil || !ok {
+		t.Errorf("IsAncestor(first, second) = %v, %v; want true", ok, err)
+	}
+	if ok, err := r.VCS.IsAncestor(ctx, second, first); err != nil || ok {
+		t.Errorf("IsAncestor(second, first) = %v, %v; want false", ok, err)
+	}
+}
+
+func testLogBetween(t *testing.T, r *Repo) {
+	first := commitFile(t, r, "a.txt", "one\n", "first")
+	second := commitFile(t, r, "b.txt", "two\n", "second")
+
+	changes, err := r.VCS.LogBetween(context.Background(), first, second)
+	if err != nil {
+		t.Fatalf("LogBetween: %v", err)
+	}
+	if len(changes) != 1 || strings.TrimSpace(changes[0].Description) != "second" {
+		t.Errorf("LogBetween(first, second) = %+v; want just second", changes)
+	}
+}
+
+func testQuery(t *testing.T, r *Repo) {
+	first := commitFile(t, r, "a.txt", "one\n", "first")
+	commitFile(t, r, "b.txt", "two\n", "second")
+	third := commitFile(t, r, "c.txt", "three\n", "third")
+
+	cases := []struct {
+		revset string
+		want   []string
+	}{
+		{`description(second)`, []string{"second"}},
+		{`description("first") | description("third")`, []string{"third", "first"}},
+		{first + ".." + third, []string{"third", "second"}},
+		{"(" + first + ".." + third + ") ~ description(third)", []string{"second"}},
+		{"::" + first + " & description(first)", []string{"first"}},
+	}
+	for _, tc := range cases {
+		changes, err := r.VCS.Query(context.Background(), tc.revset)
+		if err != nil {
+			t.Errorf("Query(%q): %v", tc.revset, err)
+			continue
+		}
+		var got []string
+		for _, c := range changes {
+			got = append(got, strings.TrimSpace(c.Description))
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("Query(%q) = %v; want %v", tc.revset, got, tc.want)
+		}
+	}
+}
+
+func testDiffStructured(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	first := commitFile(t, r, "a.txt", "one\ntwo\n", "first")
+	commitFile(t, r, "b.txt", "new\n", "second")
+	third := commitFile(t, r, "a.txt", "one\n2\n", "third")
+
+	d, err := r.VCS.DiffStructured(ctx, first, third, nil)
+	if err != nil {
+		t.Fatalf("DiffStructured: %v", err)
+	}
+	got := make(map[string]vcs.FileStatus)
+	for _, f := range d.Files {
+		got[f.Path()] = f.Status
+	}
+	if len(got) != 2 || got["a.txt"] != vcs.FileStatusModified || got["b.txt"] != vcs.FileStatusAdded {
+		t.Errorf("DiffStructured files = %v; want a.txt modified, b.txt added", got)
+	}
+	if d.Stats.FilesChanged != 2 || d.Stats.Additions < 2 || d.Stats.Deletions < 1 {
+		t.Errorf("DiffStructured stats = %+v", d.Stats)
+	}
+
+	d, err = r.VCS.DiffStructured(ctx, first, third, []string{"b.txt"})
+	if err != nil {
+		t.Fatalf("DiffStructured(b.txt): %v", err)
+	}
+	if len(d.Files) != 1 || d.Files[0].Path() != "b.txt" {
+		t.Fatalf("DiffStructured(b.txt) = %+v; want just b.txt", d.Files)
+	}
+	b := d.Files[0]
+	if len(b.Hunks) != 1 || len(b.Hunks[0].Lines) != 1 || b.Hunks[0].Lines[0] != (vcs.DiffLine{Op: vcs.DiffAdd, Text: "new", NewLine: 1}) {
+		t.Errorf("b.txt hunks = %+v", b.Hunks)
+	}
+}
+
+func testEvolog(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	id := commitFile(t, r, "a.txt", "one\n", "first")
+	before := findChange(t, r, "first").CommitID
+	r.WriteFile(t, "a.txt", "one amended\n")
+	if err := r.VCS.Stage(ctx, "a.txt"); err != nil {
+		t.Fatalf("Stage: %v", err)
+	}
+	if err := r.VCS.Commit(ctx, "first", &vcs.CommitOptions{Amend: true}); err != nil {
+		t.Fatalf("Commit(amend): %v", err)
+	}
+	after := findChange(t, r, "first")
+
+	versions, err := r.VCS.Evolog(ctx, after.ID)
+	if err != nil {
+		t.Fatalf("Evolog: %v", err)
+	}
+	if len(versions) < 2 || versions[0].CommitID != after.CommitID {
+		t.Fatalf("Evolog(%s) = %+v; want the amended commit first", id, versions)
+	}
+	found := false
+	for _, v := range versions[1:] {
+		found = found || v.CommitID == before
+	}
+	if !found {
+		t.Errorf("Evolog doesn't include the pre-amend commit %s: %+v", before, versions)
+	}
+}
+
+func testAnnotate(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	first := commitFile(t, r, "a.txt", "one\ntwo\n", "first")
+	second := commitFile(t, r, "a.txt", "one\nTWO\nthree\n", "second")
+
+	lines, err := r.VCS.Annotate(ctx, second, "a.txt")
+	if err != nil {
+		t.Fatalf("Annotate: %v", err)
+	}
+	want := []struct{ text, id string }{{"one", first}, {"TWO", second}, {"three", second}}
+	if len(lines) != len(want) {
+		t.Fatalf("Annotate = %+v; want %d lines", lines, len(want))
+	}
+	for i, w := range want {
+		if l := lines[i]; l.Line != i+1 || l.Text != w.text || l.ChangeID != w.id {
+			t.Errorf("line %d = %+v; want %q from %s", i+1, l, w.text, w.id)
+		}
+	}
+}
+
+func testIsFileTracked(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	commitFile(t, r, "tracked.txt", "x\n", "track")
+
+	if ok, err := r.VCS.IsFileTracked(ctx, "tracked.txt"); err != nil || !ok {
+		t.Errorf("IsFileTracked(tracked.txt) = %v, %v; want true", ok, err)
+	}
+	if ok, _ := r.VCS.IsFileTracked(ctx, "never-existed.txt"); ok {
+		t.Error("IsFileTracked(never-existed.txt) = true")
+	}
+}
+
+// statusOf returns the status entry for path, or nil.
+func statusOf(t *testing.T, r *Repo, path string) *vcs.StatusEntry {
+	t.Helper()
+	entries, err := r.VCS.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for i := range entries {
+		if entries[i].Path == path {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func testStatusNewFile(t *testing.T, r *Repo) {
+	commitFile(t, r, "base.txt", "base\n", "base")
+	r.WriteFile(t, "new.txt", "fresh\n")
+
+	// jj snapshots new files as added; git and FakeVCS report untracked.
+	e := statusOf(t, r, "new.txt")
+	if e == nil {
+		t.Fatal("new.txt missing from status")
+	}
+	if e.Status != vcs.FileStatusAdded && e.Status != vcs.FileStatusUntracked {
+		t.Errorf("new.txt status = %s; want added or untracked", e.Status)
+	}
+	if statusOf(t, r, "base.txt") != nil {
+		t.Error("unchanged base.txt should not appear in status")
+	}
+}
+
+func testStatusModifiedFile(t *testing.T, r *Repo) {
+	commitFile(t, r, "a.txt", "before\n", "base")
+	r.WriteFile(t, "a.txt", "after\n")
+
+	e := statusOf(t, r, "a.txt")
+	if e == nil {
+		t.Fatal("a.txt missing from status")
+	}
+	if e.Status != vcs.FileStatusModified {
+		t.Errorf("a.txt status = %s; want modified", e.Status)
+	}
+}
+
+func testStatusOptions(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	commitFile(t, r, ".gitignore", "*.log\n", "ignore logs")
+	commitFile(t, r, "a.txt", "before\n", "base")
+	r.WriteFile(t, "a.txt", "after\n")
+	r.WriteFile(t, "debug.log", "noise\n")
+
+	// Which files a backend leaves untracked differs (jj tracks new files),
+	// so only the ignored file and the modification are checked.
+	statuses := func(opts *vcs.StatusOptions) map[string]vcs.FileStatus {
+		t.Helper()
+		entries, err := r.VCS.StatusWithOptions(ctx, opts)
+		if err != nil {
+			t.Fatalf("StatusWithOptions(%+v): %v", opts, err)
+		}
+		got := make(map[string]vcs.FileStatus)
+		for _, e := range entries {
+			got[e.Path] = e.Status
+		}
+		return got
+	}
+	if got := statuses(nil); got["a.txt"] != vcs.FileStatusModified || got["debug.log"] != "" {
+		t.Errorf("StatusWithOptions(nil) = %v; want a.txt modified, no debug.log", got)
+	}
+	if got := statuses(&vcs.StatusOptions{Ignored: true}); got["a.txt"] != vcs.FileStatusModified || got["debug.log"] != vcs.FileStatusIgnored {
+		t.Errorf("StatusWithOptions(Ignored) = %v; want a.txt modified, debug.log ignored", got)
+	}
+	if statusOf(t, r, "debug.log") != nil {
+		t.Error("Status lists the ignored debug.log")
+	}
+}
+
+func testBranches(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	commitFile(t, r, "a.txt", "one\n", "base")
+
+	if ok, err := r.VCS.BranchExists(ctx, "conformance-feature"); err != nil || ok {
+		t.Fatalf("BranchExists before create = %v, %v", ok, err)
+	}
+	if err := r.VCS.CreateBranch(ctx, "conformance-feature"); err != nil {
+		t.Fatalf("CreateBranch: %v", err)
+	}
+	if ok, err := r.VCS.BranchExists(ctx, "conformance-feature"); err != nil || !ok {
+		t.Errorf("BranchExists after create = %v, %v", ok, err)
+	}
+
+	branches, err := r.VCS.ListBranches(ctx)
+	if err != nil {
+		t.Fatalf("ListBranches: %v", err)
+	}
+	found := false
+	for _, b := range branches {
+		if b.Name == "conformance-feature" && b.RemoteName == "" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("ListBranches missing conformance-feature: %+v", branches)
+	}
+
+	if err := r.VCS.DeleteBranch(ctx, "conformance-feature"); err != nil {
+		t.Fatalf("DeleteBranch: %v", err)
+	}
+	if ok, err := r.VCS.BranchExists(ctx, "conformance-feature"); err != nil || ok {
+		t.Errorf("BranchExists after delete = %v, %v", ok, err)
+	}
+}
+
+func testConfig(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	if err := r.VCS.SetConfig(ctx, "user.name", "Conformance Tester"); err != nil {
+		t.Fatalf("SetConfig: %v", err)
+	}
+	got, err := r.VCS.GetConfig(ctx, "user.name")
+	if err != nil {
+		t.Fatalf("GetConfig: %v", err)
+	}
+	if strings.TrimSpace(got) != "Conformance Tester" {
+		t.Errorf("GetConfig(user.name) = %q", got)
+	}
+}
+
+func testWorkspaces(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	commitFile(t, r, "a.txt", "one\n", "base")
+
+	path := r.WorkspacePath(t, "conf-ws")
+	if err := r.VCS.CreateWorkspace(ctx, "conf-ws", path); err != nil {
+		t.Fatalf("CreateWorkspace: %v", err)
+	}
+	if !hasWorkspace(t, r, "conf-ws") {
+		t.Fatal("ListWorkspaces missing conf-ws after create")
+	}
+	if err := r.VCS.RemoveWorkspace(ctx, "conf-ws"); err != nil {
+		t.Fatalf("RemoveWorkspace: %v", err)
+	}
+	if hasWorkspace(t, r, "conf-ws") {
+		t.Error("ListWorkspaces still has conf-ws after remove")
+	}
+}
+
+func hasWorkspace(t *testing.T, r *Repo, name string) bool {
+	t.Helper()
+	list, err := r.VCS.ListWorkspaces(context.Background())
+	if err != nil {
+		t.Fatalf("ListWorkspaces: %v", err)
+	}
+	for _, ws := range list {
+		if ws.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func testNoConflicts(t *testing.T, r *Repo) {
+	ctx := context.Background()
+	commitFile(t, r, "a.txt", "one\n", "base")
+
+	if ok, err := r.VCS.HasMergeConflicts(ctx); err != nil || ok {
+		t.Errorf("HasMergeConflicts = %v, %v; want false", ok, err)
+	}
+	conflicts, err := r.VCS.GetConflicts(ctx)
+	if err != nil {
+		t.Fatalf("GetConflicts: %v", err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("GetConflicts = %+v; want none", conflicts)
+	}
+}
@@ -320,11 +320,18 @@ func (wo *WorkspaceOrchestrator) GetSubtaskVCS(id string) (*JujutsuVCS, error) {
 //  1. Squash subtask changes into parent change
 //  2. If conflicts: mark as conflicted, create resolution bead
 //  3. If success: forget workspace, cleanup directory
+//
+// In plan mode (WithPlan) the subtask is left untouched and the plan lists
+// the squash and cleanup, the subtask and parent changes, and the files the
+// subtask changed.
 func (wo *WorkspaceOrchestrator) CompleteSubtask(ctx context.Context, id string) error {
 	subtask, ok := wo.subtasks[id]
 	if !ok {
 		return fmt.Errorf("subtask %s not found", id)
 	}
+	if plan := PlanFromContext(ctx); plan != nil {
+		return wo.planCompleteSubtask(ctx, plan, subtask)
+	}
 
 	// Try to squash the subtask's changes into main
 	// This is done from the main workspace, targeting the subtask's changes
@@ -356,6 +363,34 @@ func (wo *WorkspaceOrchestrator) CompleteSubtask(ctx context.Context, id string)
 	return wo.cleanupSubtask(ctx, subtask)
 }
 
+// planCompleteSubtask records what CompleteSubtask would do on success.
+func (wo *WorkspaceOrchestrator) planCompleteSubtask(ctx context.Context, plan *Plan, subtask *Subtask) error {
+	subtaskVCS, err := wo.GetSubtaskVCS(subtask.ID)
+	if err != nil {
+		return err
+	}
+	currentChange, err := subtaskVCS.CurrentChange(ctx)
+	if err != nil {
+		return err
+	}
+	plan.AddChanges(currentChange.ID, subtask.ParentChangeID)
+	out, err := subtaskVCS.runJJ(ctx, "diff", "--summary", "-r", "@")
+	if err != nil {
+		return err
+	}
+	plan.addStatusFiles(parseJJSummary(out))
+
+	// Both commands are recorded rather than run.
+	if _, err := wo.vcs.runJJ(ctx, wo.vcs.squashArgs(currentChange.ID, subtask.ParentChangeID)...); err != nil {
+		return err
+	}
+	if err := wo.vcs.RemoveWorkspace(ctx, subtask.WorkspaceName); err != nil {
+		return err
+	}
+	plan.AddNote("remove directory " + subtask.WorkspacePath)
+	return nil
+}
+
 // FailSubtask handles subtask failure.
 func (wo *WorkspaceOrchestrator) FailSubtask(ctx context.Context, id string, reason string) error {
 	subtask, ok := wo.subtasks[id]
@@ -395,7 +430,7 @@ func (wo *WorkspaceOrchestrator) squashSubtaskToMain(ctx context.Context, subtas
 
 	// From main workspace, squash the subtask's changes
 	// jj squash --from <subtask-change> --into <main-change>
-	_, err = wo.vcs.runJJ(ctx, "squash", "--from", currentChange.ID, "--into", subtask.ParentChangeID)
+	_, err = wo.vcs.runJJ(ctx, wo.vcs.squashArgs(currentChange.ID, subtask.ParentChangeID)...)
 	return err
 }
 
@@ -0,0 +1,319 @@
+package wongdb
+
+// Batch applies a set of issue writes and deletes all at once. Changes are
+// staged in a Tx, validated as a whole, and then committed in one step, so
+// a failure part-way never leaves some of them behind for the next Sync.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/steveyegge/beads/internal/types"
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+var (
+	// ErrInvalidIssue is returned by Batch when a staged issue is malformed.
+	ErrInvalidIssue = errors.New("invalid issue")
+
+	// ErrMissingDependency is returned by Batch when an issue would depend
+	// on an issue that does not exist after the batch.
+	ErrMissingDependency = errors.New("dependency on missing issue")
+
+	// ErrDependencyCycle is returned by Batch when blocking dependencies
+	// would form a cycle, leaving every issue in it blocked forever.
+	ErrDependencyCycle = errors.New("dependency cycle")
+)
+
+// Tx stages the changes of one Batch. Its reads see the staged changes on
+// top of the store's synced issues. A Tx must not be used after its Batch
+// function returns.
+type Tx struct {
+	ctx   context.Context
+	store IssueStore
+
+	// staged maps issue IDs to their new content; nil is a delete.
+	staged map[string]*types.Issue
+
+	// beforeCommit, if set, runs once the staged changes have been
+	// validated, just before they are committed; an error aborts the
+	// commit. It is not run in plan mode.
+	beforeCommit func() error
+}
+
+// Load returns an issue as the batch would leave it.
+func (tx *Tx) Load(id string) (*types.Issue, error) {
+	if issue, ok := tx.staged[id]; ok {
+		if issue == nil {
+			return nil, fmt.Errorf("wongdb: load issue %s: deleted in batch: %w", id, os.ErrNotExist)
+		}
+		return cloneIssue(issue), nil
+	}
+	return LoadIssue(tx.ctx, tx.store, id)
+}
+
+// Save stages a copy of issue.
+func (tx *Tx) Save(issue *types.Issue) error {
+	if err := validateIssueID(issue.ID); err != nil {
+		return err
+	}
+	tx.staged[issue.ID] = cloneIssue(issue)
+	return nil
+}
+
+// Delete stages the removal of an issue, which must exist.
+func (tx *Tx) Delete(id string) error {
+	if err := validateIssueID(id); err != nil {
+		return err
+	}
+	if !tx.exists(id) {
+		return fmt.Errorf("wongdb: issue %s not found: %w", id, os.ErrNotExist)
+	}
+	tx.staged[id] = nil
+	return nil
+}
+
+func (tx *Tx) exists(id string) bool {
+	if issue, ok := tx.staged[id]; ok {
+		return issue != nil
+	}
+	_, err := tx.store.ReadIssue(tx.ctx, id)
+	return err == nil
+}
+
+// batchCommitter is implemented by stores that can apply a batch on its own,
+// atomically, leaving other pending writes alone. changes maps issue IDs to
+// their JSON; nil is a delete.
+type batchCommitter interface {
+	commitBatch(ctx context.Context, changes map[string][]byte) error
+}
+
+// Batch calls fn with a Tx and, if fn succeeds, validates and commits the
+// staged changes together. Nothing is written if fn fails or validation
+// finds a malformed issue or one the store's schema rejects
+// (ErrInvalidIssue), a dependency on an issue that would not exist
+// (ErrMissingDependency) or a blocking cycle (ErrDependencyCycle).
+//
+// In plan mode (vcs.WithPlan) the batch is validated and its files recorded
+// in the plan, but not committed.
+func Batch(ctx context.Context, s IssueStore, fn func(tx *Tx) error) error {
+	tx := &Tx{ctx: ctx, store: s, staged: make(map[string]*types.Issue)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.staged) == 0 {
+		return nil
+	}
+	if err := tx.validate(); err != nil {
+		return fmt.Errorf("wongdb: batch: %w", err)
+	}
+
+	changes := make(map[string][]byte, len(tx.staged))
+	for id, issue := range tx.staged {
+		if issue == nil {
+			changes[id] = nil
+			continue
+		}
+		data, err := json.MarshalIndent(issue, "", "  ")
+		if err != nil {
+			return fmt.Errorf("wongdb: batch: marshal issue %s: %w", id, err)
+		}
+		prev, _ := s.ReadIssue(ctx, id)
+		changes[id] = withCustomFields(data, prev)
+	}
+	if err := validatePending(ctx, s, changes); err != nil {
+		return fmt.Errorf("wongdb: batch: %w", err)
+	}
+
+	if plan := vcs.PlanFromContext(ctx); plan != nil {
+		for _, id := range sortedKeys(changes) {
+			if changes[id] == nil {
+				plan.AddNote("delete " + issuePath(id))
+			} else {
+				plan.AddNote("write " + issuePath(id))
+			}
+			plan.AddFiles(issuePath(id))
+		}
+		return nil
+	}
+
+	if tx.beforeCommit != nil {
+		if err := tx.beforeCommit(); err != nil {
+			return fmt.Errorf("wongdb: batch: %w", err)
+		}
+	}
+	if bc, ok := s.(batchCommitter); ok {
+		if err := bc.commitBatch(ctx, changes); err != nil {
+			return fmt.Errorf("wongdb: batch: %w", err)
+		}
+		return nil
+	}
+	// Stores from outside the package get the changes staged and synced
+	// with whatever else they have pending.
+	for _, id := range sortedKeys(changes) {
+		var err error
+		if changes[id] == nil {
+			err = s.DeleteIssue(ctx, id)
+		} else {
+			err = s.WriteIssue(ctx, id, changes[id])
+		}
+		if err != nil {
+			return fmt.Errorf("wongdb: batch: %w", err)
+		}
+	}
+	if err := s.Sync(ctx); err != nil {
+		return fmt.Errorf("wongdb: batch: %w", err)
+	}
+	return nil
+}
+
+// Batch runs fn as a batch against db; see the package-level Batch.
+func (db *WongDB) Batch(ctx context.Context, fn func(tx *Tx) error) error {
+	return Batch(ctx, db, fn)
+}
+
+// validate checks the staged issues and the dependency graph the batch
+// would leave behind.
+func (tx *Tx) validate() error {
+	all, err := LoadAllIssues(tx.ctx, tx.store)
+	if err != nil {
+		return err
+	}
+	after := make(map[string]*types.Issue, len(all)+len(tx.staged))
+	for _, issue := range all {
+		after[issue.ID] = issue
+	}
+	for id, issue := range tx.staged {
+		if issue == nil {
+			delete(after, id)
+		} else {
+			after[id] = issue
+		}
+	}
+
+	ids := make([]string, 0, len(tx.staged))
+	for id := range tx.staged {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		issue := tx.staged[id]
+		if issue == nil {
+			continue
+		}
+		if err := validateIssue(issue); err != nil {
+			return err
+		}
+		for _, dep := range issue.Dependencies {
+			if dep.DependsOnID == issue.ID {
+				return fmt.Errorf("issue %s depends on itself: %w", id, ErrDependencyCycle)
+			}
+			if after[dep.DependsOnID] == nil {
+				return fmt.Errorf("issue %s depends on %s: %w", id, dep.DependsOnID, ErrMissingDependency)
+			}
+		}
+	}
+
+	// Issues left untouched must not lose a dependency to a delete.
+	for _, issue := range after {
+		if _, ok := tx.staged[issue.ID]; ok {
+			continue
+		}
+		for _, dep := range issue.Dependencies {
+			if deleted, ok := tx.staged[dep.DependsOnID]; ok && deleted == nil {
+				return fmt.Errorf("issue %s depends on deleted issue %s: %w", issue.ID, dep.DependsOnID, ErrMissingDependency)
+			}
+		}
+	}
+
+	if cycle := findBlockingCycle(after, ids); cycle != nil {
+		return fmt.Errorf("%s: %w", strings.Join(cycle, " -> "), ErrDependencyCycle)
+	}
+	return nil
+}
+
+// validateIssue checks the fields every stored issue needs.
+func validateIssue(issue *types.Issue) error {
+	if issue.Title == "" {
+		return fmt.Errorf("issue %s: title is required: %w", issue.ID, ErrInvalidIssue)
+	}
+	if issue.Priority < 0 || issue.Priority > 4 {
+		return fmt.Errorf("issue %s: priority %d is outside 0-4: %w", issue.ID, issue.Priority, ErrInvalidIssue)
+	}
+	for _, dep := range issue.Dependencies {
+		if dep == nil || dep.DependsOnID == "" {
+			return fmt.Errorf("issue %s: dependency without a target: %w", issue.ID, ErrInvalidIssue)
+		}
+	}
+	return nil
+}
+
+// isBlocking reports whether a dependency keeps its issue from being ready.
+func isBlocking(dep *types.Dependency) bool {
+	return dep.Type == types.DepBlocks || dep.Type == types.DepWaitsFor || dep.Type == types.DepConditionalBlocks
+}
+
+// findBlockingCycle returns the IDs along a cycle of blocking dependencies
+// that passes through one of start, first ID repeated at the end, or nil.
+// Cycles among other issues only are not reported: they were already in the
+// store before the batch.
+func findBlockingCycle(issues map[string]*types.Issue, start []string) []string {
+	touched := make(map[string]bool, len(start))
+	for _, id := range start {
+		touched[id] = true
+	}
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		switch state[id] {
+		case onPath:
+			for i, p := range path {
+				if p != id {
+					continue
+				}
+				for _, c := range path[i:] {
+					if touched[c] {
+						return append(append([]string{}, path[i:]...), id)
+					}
+				}
+			}
+			return nil
+		case done:
+			return nil
+		}
+		issue := issues[id]
+		if issue == nil {
+			return nil
+		}
+		state[id] = onPath
+		path = append(path, id)
+		for _, dep := range issue.Dependencies {
+			if !isBlocking(dep) {
+				continue
+			}
+			if cycle := visit(dep.DependsOnID); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = done
+		return nil
+	}
+	for _, id := range start {
+		if cycle := visit(id); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
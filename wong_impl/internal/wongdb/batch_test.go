@@ -0,0 +1,226 @@
+package wongdb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/types"
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+func TestBatch_CommitsTogether(t *testing.T) {
+	for name, s := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := s.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := Batch(ctx, s, func(tx *Tx) error {
+				return tx.Save(makeTestIssue("old", "Old"))
+			}); err != nil {
+				t.Fatalf("first Batch: %v", err)
+			}
+
+			// An unrelated pending write must not ride along with the batch.
+			s.WriteIssue(ctx, "pending", []byte(`{"id":"pending"}`))
+			err := Batch(ctx, s, func(tx *Tx) error {
+				for _, id := range []string{"bt-1", "bt-2", "bt-3"} {
+					if err := tx.Save(makeTestIssue(id, "Issue "+id)); err != nil {
+						return err
+					}
+				}
+				if _, err := tx.Load("bt-2"); err != nil {
+					t.Errorf("Load of staged issue: %v", err)
+				}
+				return tx.Delete("old")
+			})
+			if err != nil {
+				t.Fatalf("Batch: %v", err)
+			}
+			ids, _ := s.ListIssueIDs(ctx)
+			if got := strings.Join(ids, " "); got != "bt-1 bt-2 bt-3" {
+				t.Errorf("ListIssueIDs = %q", got)
+			}
+		})
+	}
+}
+
+func TestBatch_NothingWrittenOnError(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStoreWith(t, makeTestIssue("base", "Base"))
+
+	cycleA := blockedBy(makeTestIssue("a", "A"), types.DepBlocks, "b")
+	cycleB := blockedBy(makeTestIssue("b", "B"), types.DepBlocks, "a")
+	untitled := makeTestIssue("x", "")
+	tests := []struct {
+		name string
+		fn   func(tx *Tx) error
+		want error
+	}{
+		{"fn error", func(tx *Tx) error {
+			tx.Save(makeTestIssue("x", "X"))
+			return os.ErrClosed
+		}, os.ErrClosed},
+		{"invalid issue", func(tx *Tx) error {
+			return tx.Save(untitled)
+		}, ErrInvalidIssue},
+		{"missing dependency", func(tx *Tx) error {
+			return tx.Save(blockedBy(makeTestIssue("x", "X"), types.DepBlocks, "nope"))
+		}, ErrMissingDependency},
+		{"delete a blocker", func(tx *Tx) error {
+			tx.Save(blockedBy(makeTestIssue("x", "X"), types.DepBlocks, "base"))
+			return tx.Delete("base")
+		}, ErrMissingDependency},
+		{"self dependency", func(tx *Tx) error {
+			return tx.Save(blockedBy(makeTestIssue("x", "X"), types.DepBlocks, "x"))
+		}, ErrDependencyCycle},
+		{"cycle", func(tx *Tx) error {
+			tx.Save(cycleA)
+			return tx.Save(cycleB)
+		}, ErrDependencyCycle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Batch(ctx, s, tt.fn)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Batch = %v, want %v", err, tt.want)
+			}
+			ids, _ := s.ListIssueIDs(ctx)
+			if got := strings.Join(ids, " "); got != "base" {
+				t.Errorf("ListIssueIDs after failed batch = %q", got)
+			}
+		})
+	}
+
+	// A parent-child link is not blocking, so a loop through one is fine.
+	err := Batch(ctx, s, func(tx *Tx) error {
+		tx.Save(blockedBy(makeTestIssue("p", "Parent"), types.DepBlocks, "base"))
+		return tx.Save(blockedBy(makeTestIssue("base", "Base"), types.DepParentChild, "p"))
+	})
+	if err != nil {
+		t.Errorf("Batch with a non-blocking loop: %v", err)
+	}
+}
+
+func TestBatch_PlanMode(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStoreWith(t)
+	plan, err := vcs.DryRun(ctx, func(ctx context.Context) error {
+		return Batch(ctx, s, func(tx *Tx) error {
+			return tx.Save(makeTestIssue("bt-1", "One"))
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 1 || plan.Files[0] != ".wong/issues/bt-1.json" {
+		t.Errorf("plan files = %v", plan.Files)
+	}
+	if ids, _ := s.ListIssueIDs(ctx); len(ids) != 0 {
+		t.Errorf("dry-run batch wrote %v", ids)
+	}
+}
+
+func TestFSStore_BatchRollback(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := NewFSStore(dir)
+	if err := s.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	before := makeTestIssue("bt-1", "Before")
+	if err := Batch(ctx, s, func(tx *Tx) error { return tx.Save(before) }); err != nil {
+		t.Fatal(err)
+	}
+	orig, _ := s.ReadIssue(ctx, "bt-1")
+
+	// A directory where bt-2's file should go makes the second write fail
+	// after bt-1 has already been rewritten.
+	if err := os.Mkdir(filepath.Join(dir, ".wong", "issues", "bt-2.json"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := Batch(ctx, s, func(tx *Tx) error {
+		tx.Save(makeTestIssue("bt-1", "After"))
+		return tx.Save(makeTestIssue("bt-2", "New"))
+	})
+	if err == nil {
+		t.Fatal("Batch succeeded")
+	}
+	if got, _ := s.ReadIssue(ctx, "bt-1"); string(got) != string(orig) {
+		t.Errorf("bt-1 after rollback = %s, want %s", got, orig)
+	}
+}
+
+func TestWongDB_BatchRollback(t *testing.T) {
+	// An empty replay transcript makes every jj command fail, so the squash
+	// fails after the batch's files are written.
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".jj", "repo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	issues := filepath.Join(dir, ".wong", "issues")
+	if err := os.MkdirAll(issues, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(issues, "bt-1.json"), []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db := New(dir)
+	db.SetRunner(&vcs.Runner{Replay: &vcs.Transcript{}})
+
+	err := db.Batch(context.Background(), func(tx *Tx) error {
+		tx.Save(makeTestIssue("bt-1", "Changed"))
+		return tx.Save(makeTestIssue("bt-2", "New"))
+	})
+	if !errors.Is(err, vcs.ErrNotRecorded) {
+		t.Fatalf("Batch = %v, want the squash failure", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(issues, "bt-1.json")); string(data) != "v1" {
+		t.Errorf("bt-1.json = %q, want it restored", data)
+	}
+	if _, err := os.Stat(filepath.Join(issues, "bt-2.json")); !os.IsNotExist(err) {
+		t.Errorf("bt-2.json left behind: %v", err)
+	}
+	if snap := db.snapshotDirtyFiles(); len(snap) != 0 {
+		t.Errorf("dirty files after rollback = %v", snap)
+	}
+}
+
+func TestWongDB_BatchSquashesOnlyItsFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".jj", "repo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	override := []string{"--config", `revset-aliases."immutable_heads()"="none()"`}
+	transcript := &vcs.Transcript{Entries: []vcs.TranscriptEntry{
+		{Bin: "jj", Args: []string{"--version"}, Stdout: "jj 0.23.0\n"},
+		{Bin: "jj", Args: []string{"file", "show", "-r", "wong-db", ".wong/config.json"}, Stdout: `{"prefix":"","history_mode":"squash"}`},
+		{Bin: "jj", Args: append([]string{"squash", "--into", "wong-db", ".wong/issues/bt-1.json", "-u"}, override...)},
+	}}
+	db := New(dir)
+	db.SetRunner(&vcs.Runner{Replay: transcript})
+	ctx := context.Background()
+
+	// A file written outside the batch and not yet synced must stay pending.
+	if err := db.WriteIssue(ctx, "pending", []byte(`{"id":"pending"}`)); err != nil {
+		t.Fatal(err)
+	}
+	// The transcript only has a squash of bt-1.json, so squashing all of
+	// .wong/ fails the batch.
+	if err := db.Batch(ctx, func(tx *Tx) error {
+		return tx.Save(makeTestIssue("bt-1", "New"))
+	}); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, ".wong", "issues", "pending.json")); err != nil || string(data) != `{"id":"pending"}` {
+		t.Errorf("pending.json = %q, %v; want it left in the working copy", data, err)
+	}
+	snap := db.snapshotDirtyFiles()
+	if _, ok := snap[filepath.Join(".wong", "issues", "pending.json")]; !ok || len(snap) != 1 {
+		t.Errorf("dirty files after batch = %v, want only pending.json", snap)
+	}
+}
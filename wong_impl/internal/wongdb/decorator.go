@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"strings"
+
+	"github.com/steveyegge/beads/internal/vcs"
 )
 
 // Decorator wraps jj commands with optional pre/post wong-db sync.
@@ -20,6 +22,10 @@ var jjWriteCommands = []string{
 	"resolve", "backout", "bookmark", "branch", "git",
 }
 
+// jjTrunkCommands are jj subcommands that can move trunk(), after which
+// changes linked to issues may have landed.
+var jjTrunkCommands = []string{"git", "bookmark", "branch"}
+
 // jjReadCommands are jj subcommands that do not modify the repository.
 var jjReadCommands = []string{
 	"log", "show", "diff", "status", "file",
@@ -39,17 +45,17 @@ func NewDecorator(db *WongDB) *Decorator {
 }
 
 // Run is the main entry point for the decorator. It executes the jj command
-// with the given args, passing through stdin/stdout/stderr. If the subcommand
-// is a write command and jj exits successfully, it syncs .wong/ to wong-db.
+// with the given args through the WongDB's runner, handing it the terminal's
+// stdin/stdout/stderr. If the subcommand is a write command and jj exits
+// successfully, it syncs .wong/ to wong-db.
 func (d *Decorator) Run(ctx context.Context, args []string) error {
 	subcmd := d.extractSubcommand(args)
 
-	cmd := exec.CommandContext(ctx, d.jjBin, args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Run()
+	var runner *vcs.Runner
+	if d.db != nil {
+		runner = d.db.runner
+	}
+	_, err := runner.Run(ctx, vcs.Invocation{Bin: d.jjBin, Args: args, Interactive: true})
 
 	// If jj succeeded and this was a write command, sync wong-db.
 	if err == nil && d.isWriteCommand(subcmd) {
@@ -58,6 +64,17 @@ func (d *Decorator) Run(ctx context.Context, args []string) error {
 		}
 	}
 
+	// If trunk() may have moved, close the issues whose changes landed.
+	if err == nil && d.movesTrunk(subcmd) {
+		closed, closeErr := d.db.CloseLandedIssues(ctx, "")
+		if closeErr != nil {
+			fmt.Fprintf(os.Stderr, "wong: close landed issues warning: %v\n", closeErr)
+		}
+		if len(closed) > 0 {
+			fmt.Fprintf(os.Stderr, "wong: closed landed issues: %s\n", strings.Join(closed, ", "))
+		}
+	}
+
 	// Preserve jj's exit code: if jj failed, return the exec error
 	// (which includes the exit code). Sync errors do not change the exit code.
 	return err
@@ -73,6 +90,16 @@ func (d *Decorator) isWriteCommand(subcmd string) bool {
 	return false
 }
 
+// movesTrunk reports whether subcmd is a jj command that can move trunk().
+func (d *Decorator) movesTrunk(subcmd string) bool {
+	for _, c := range jjTrunkCommands {
+		if c == subcmd {
+			return true
+		}
+	}
+	return false
+}
+
 // extractSubcommand returns the first non-flag argument from args,
 // which is the jj subcommand (e.g. "log", "new", "commit").
 func (d *Decorator) extractSubcommand(args []string) string {
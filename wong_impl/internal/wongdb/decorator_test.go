@@ -0,0 +1,91 @@
+package wongdb
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/types"
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+// TestDecorator_RunsThroughRunner verifies that the wrapped jj command goes
+// through the WongDB's runner and that jj's failure is returned without a
+// post-sync.
+func TestDecorator_RunsThroughRunner(t *testing.T) {
+	transcript := &vcs.Transcript{Entries: []vcs.TranscriptEntry{
+		{Bin: "jj", Args: []string{"log", "-r", "@"}, Stdout: "@  abc\n"},
+		{Bin: "jj", Args: []string{"new", "nosuch"}, Stderr: "Error: Revision `nosuch` doesn't exist\n", ExitCode: 1},
+	}}
+	db := New(t.TempDir())
+	db.SetRunner(&vcs.Runner{Replay: transcript})
+	d := NewDecorator(db)
+	ctx := context.Background()
+
+	if err := d.Run(ctx, []string{"log", "-r", "@"}); err != nil {
+		t.Errorf("Run(log) = %v", err)
+	}
+	if err := d.Run(ctx, []string{"new", "nosuch"}); err == nil {
+		t.Error("Run(new nosuch) succeeded, want jj's failure")
+	}
+	// A sync after the failed write would have asked the replay for more.
+	if unused := transcript.Unused(); len(unused) != 0 {
+		t.Errorf("decorator did not use the runner: %+v unused", unused)
+	}
+}
+
+// TestDecorator_BookmarkClosesLandedIssues verifies that moving trunk()
+// through the decorator closes the issues whose linked changes landed.
+func TestDecorator_BookmarkClosesLandedIssues(t *testing.T) {
+	dir := setupJJRepo(t)
+	db := newTestDB(t, dir)
+	ctx := context.Background()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := db.SaveIssue(ctx, makeTestIssue("land-1", "Issue land-1")); err != nil {
+		t.Fatalf("SaveIssue failed: %v", err)
+	}
+	if err := db.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	runJJ(t, dir, "config", "set", "--repo", `revset-aliases."trunk()"`, "main")
+	runJJ(t, dir, "describe", "-m", "Land it\n\n"+FormatIssueTrailer("land-1"))
+	runJJ(t, dir, "bookmark", "create", "main", "-r", "@")
+	runJJ(t, dir, "new")
+
+	issue, err := db.LoadIssue(ctx, "land-1")
+	if err != nil || issue.Status != types.StatusOpen {
+		t.Fatalf("before the decorator: %+v, %v; want land-1 open", issue, err)
+	}
+
+	// The decorator runs jj where the user is, like jj itself.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	// Moving main to the same change is enough to trigger the check.
+	if err := NewDecorator(db).Run(ctx, []string{"bookmark", "set", "main", "-r", "@-"}); err != nil {
+		t.Fatalf("Run(bookmark set) failed: %v", err)
+	}
+	issue, err = db.LoadIssue(ctx, "land-1")
+	if err != nil {
+		t.Fatalf("LoadIssue failed: %v", err)
+	}
+	if issue.Status != types.StatusClosed {
+		t.Errorf("land-1 status = %s, want closed", issue.Status)
+	}
+
+	// Nothing is left to close.
+	closed, err := db.CloseLandedIssues(ctx, "")
+	if err != nil || !reflect.DeepEqual(closed, []string(nil)) {
+		t.Errorf("CloseLandedIssues after the decorator = %v, %v; want nothing left", closed, err)
+	}
+}
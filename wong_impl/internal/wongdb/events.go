@@ -0,0 +1,100 @@
+package wongdb
+
+// Events describes issue changes for subscribers such as the HTTP API.
+
+import (
+	"sync"
+	"time"
+
+	"github.com/steveyegge/beads/internal/types"
+)
+
+// EventType identifies the kind of issue change.
+type EventType string
+
+const (
+	EventIssueCreated EventType = "issue.created"
+	EventIssueUpdated EventType = "issue.updated"
+	EventIssueClosed  EventType = "issue.closed"
+	EventIssueDeleted EventType = "issue.deleted"
+)
+
+// Event describes a single issue change. Before is nil for created issues and
+// After is nil for deleted issues.
+type Event struct {
+	Type    EventType    `json:"type"`
+	IssueID string       `json:"issue_id"`
+	Before  *types.Issue `json:"before,omitempty"`
+	After   *types.Issue `json:"after,omitempty"`
+	Time    time.Time    `json:"time"`
+}
+
+// NewEvent builds an Event from the before and after states of an issue,
+// classifying the change under wf: moving into one of its done states is a
+// close. A nil wf is the built-in workflow. It returns nil if both states
+// are nil.
+func NewEvent(wf *Workflow, before, after *types.Issue) *Event {
+	ev := &Event{Before: before, After: after, Time: time.Now()}
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		ev.Type = EventIssueCreated
+		ev.IssueID = after.ID
+	case after == nil:
+		ev.Type = EventIssueDeleted
+		ev.IssueID = before.ID
+	case wf.IsDone(after.Status) && !wf.IsDone(before.Status):
+		ev.Type = EventIssueClosed
+		ev.IssueID = after.ID
+	default:
+		ev.Type = EventIssueUpdated
+		ev.IssueID = after.ID
+	}
+	return ev
+}
+
+// eventBufferSize is the per-subscriber channel buffer. Slow subscribers drop
+// events rather than blocking publishers.
+const eventBufferSize = 64
+
+// eventHub fans events out to subscribers.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan *Event]struct{}
+}
+
+// subscribe registers a new subscriber channel.
+func (h *eventHub) subscribe() chan *Event {
+	ch := make(chan *Event, eventBufferSize)
+	h.mu.Lock()
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan *Event]struct{})
+	}
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+// unsubscribe removes a subscriber channel.
+func (h *eventHub) unsubscribe(ch chan *Event) {
+	h.mu.Lock()
+	delete(h.subscribers, ch)
+	h.mu.Unlock()
+}
+
+// publish sends an event to every subscriber without blocking.
+func (h *eventHub) publish(ev *Event) {
+	if ev == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Subscriber is not keeping up; drop rather than block.
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package wongdb
+
+import (
+	"testing"
+
+	"github.com/steveyegge/beads/internal/types"
+)
+
+func TestNewEvent_Classification(t *testing.T) {
+	open := makeTestIssue("ev-1", "Event issue")
+	edited := makeTestIssue("ev-1", "Event issue (edited)")
+	closed := makeTestIssue("ev-1", "Event issue")
+	closed.Status = types.StatusClosed
+	shipped := makeTestIssue("ev-1", "Event issue")
+	shipped.Status = "shipped"
+	wf := &Workflow{States: []WorkflowState{{Name: "open"}, {Name: "shipped", Done: true}}}
+
+	tests := []struct {
+		name   string
+		wf     *Workflow
+		before *types.Issue
+		after  *types.Issue
+		want   EventType
+	}{
+		{"created", nil, nil, open, EventIssueCreated},
+		{"updated", nil, open, edited, EventIssueUpdated},
+		{"closed", nil, open, closed, EventIssueClosed},
+		{"still closed", nil, closed, closed, EventIssueUpdated},
+		{"deleted", nil, open, nil, EventIssueDeleted},
+		{"workflow done state", wf, open, shipped, EventIssueClosed},
+		{"not done without workflow", nil, open, shipped, EventIssueUpdated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := NewEvent(tt.wf, tt.before, tt.after)
+			if ev == nil {
+				t.Fatal("NewEvent returned nil")
+			}
+			if ev.Type != tt.want {
+				t.Errorf("Type = %s, want %s", ev.Type, tt.want)
+			}
+			if ev.IssueID != "ev-1" {
+				t.Errorf("IssueID = %q, want ev-1", ev.IssueID)
+			}
+		})
+	}
+
+	if NewEvent(nil, nil, nil) != nil {
+		t.Error("expected nil event when both states are nil")
+	}
+}
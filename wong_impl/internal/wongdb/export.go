@@ -0,0 +1,621 @@
+package wongdb
+
+// Export renders wong-db as a static site or a Markdown summary, so the
+// tracker can be published to people without jj. A Snapshot captures the
+// issue set at one revision; WriteSite and WriteMarkdown render it.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/steveyegge/beads/internal/types"
+)
+
+// ErrNoHistory is returned when a revision is requested from a store that
+// only has its current state, such as an FSStore or a MemStore.
+var ErrNoHistory = errors.New("store has no revision history")
+
+// HistoryEntry is one change or commit that touched an issue's file.
+type HistoryEntry struct {
+	Revision string
+	Author   string
+	Time     time.Time
+	Summary  string
+}
+
+// historyStore is implemented by stores that keep wong-db history and can
+// read issues as of an earlier revision.
+type historyStore interface {
+	readIssueAt(ctx context.Context, rev, id string) ([]byte, error)
+	listIssueIDsAt(ctx context.Context, rev string) ([]string, error)
+	issueHistory(ctx context.Context, rev, id string) ([]HistoryEntry, error)
+}
+
+// Snapshot is the issue set at one revision, with what the report needs to
+// show about each issue.
+type Snapshot struct {
+	// Title heads every page; it defaults to "Issues".
+	Title string
+	// Revision is the revision the snapshot was taken at; empty means the
+	// store's current state.
+	Revision string
+	// Issues are sorted by ID.
+	Issues []*types.Issue
+	// History holds each issue's changes, newest first, for stores that
+	// keep history.
+	History map[string][]HistoryEntry
+	// Links holds the jj changes that reference each issue.
+	Links map[string][]ChangeLink
+
+	workflow *Workflow
+	byID     map[string]*types.Issue
+}
+
+// changeLinkLister is implemented by stores that can scan changes for
+// "Wong:" trailers.
+type changeLinkLister interface {
+	allChangeLinks(ctx context.Context) ([]ChangeLink, error)
+}
+
+// LoadSnapshot reads every issue in s as of rev, with its history and
+// linked changes where s has them. An empty rev reads the current state.
+// Readiness and done states follow the store's current workflow.
+func LoadSnapshot(ctx context.Context, s IssueStore, rev string) (*Snapshot, error) {
+	hs, hasHistory := s.(historyStore)
+	if rev != "" && !hasHistory {
+		return nil, fmt.Errorf("wongdb: snapshot at %s: %w", rev, ErrNoHistory)
+	}
+
+	snap := &Snapshot{
+		Title:    "Issues",
+		Revision: rev,
+		History:  make(map[string][]HistoryEntry),
+		Links:    make(map[string][]ChangeLink),
+		workflow: configuredWorkflow(ctx, s),
+	}
+	if rev == "" {
+		issues, err := LoadAllIssues(ctx, s)
+		if err != nil {
+			return nil, fmt.Errorf("wongdb: snapshot: %w", err)
+		}
+		snap.Issues = issues
+	} else {
+		ids, err := hs.listIssueIDsAt(ctx, rev)
+		if err != nil {
+			return nil, fmt.Errorf("wongdb: snapshot at %s: %w", rev, err)
+		}
+		for _, id := range ids {
+			data, err := hs.readIssueAt(ctx, rev, id)
+			if err != nil {
+				return nil, fmt.Errorf("wongdb: snapshot at %s: %w", rev, err)
+			}
+			issue, err := unmarshalIssue(id, data)
+			if err != nil {
+				return nil, fmt.Errorf("wongdb: snapshot at %s: %w", rev, err)
+			}
+			snap.Issues = append(snap.Issues, issue)
+		}
+	}
+	sort.Slice(snap.Issues, func(i, j int) bool { return snap.Issues[i].ID < snap.Issues[j].ID })
+	snap.byID = make(map[string]*types.Issue, len(snap.Issues))
+	for _, issue := range snap.Issues {
+		snap.byID[issue.ID] = issue
+	}
+
+	if hasHistory {
+		historyRev := rev
+		if historyRev == "" {
+			historyRev = currentRevision(s)
+		}
+		for _, issue := range snap.Issues {
+			entries, err := hs.issueHistory(ctx, historyRev, issue.ID)
+			if err != nil {
+				return nil, fmt.Errorf("wongdb: snapshot: %w", err)
+			}
+			snap.History[issue.ID] = entries
+		}
+	}
+	if lister, ok := s.(changeLinkLister); ok {
+		links, err := lister.allChangeLinks(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("wongdb: snapshot links: %w", err)
+		}
+		for _, link := range links {
+			if snap.byID[link.IssueID] != nil {
+				snap.Links[link.IssueID] = append(snap.Links[link.IssueID], link)
+			}
+		}
+	}
+	return snap, nil
+}
+
+// currentRevision returns the revision holding a history store's current
+// state.
+func currentRevision(s IssueStore) string {
+	if _, ok := s.(*GitStore); ok {
+		return gitDBRef
+	}
+	return wongDBBookmark
+}
+
+// parseHistory parses records of four NUL-separated fields (revision,
+// author, RFC 3339 time, summary) terminated by linkRecordSep.
+func parseHistory(output string) []HistoryEntry {
+	var entries []HistoryEntry
+	for _, record := range strings.Split(output, linkRecordSep) {
+		record = strings.TrimLeft(record, "\n")
+		parts := strings.SplitN(record, "\x00", 4)
+		if len(parts) < 4 {
+			continue
+		}
+		when, _ := time.Parse(time.RFC3339, parts[2])
+		entries = append(entries, HistoryEntry{
+			Revision: parts[0],
+			Author:   parts[1],
+			Time:     when,
+			Summary:  parts[3],
+		})
+	}
+	return entries
+}
+
+// Issue returns the issue with the given ID, or nil.
+func (snap *Snapshot) Issue(id string) *types.Issue {
+	return snap.byID[id]
+}
+
+// IsDone reports whether an issue is in a done state of the workflow.
+func (snap *Snapshot) IsDone(issue *types.Issue) bool {
+	return snap.workflow.IsDone(issue.Status)
+}
+
+// Ready returns the snapshot's ready issues, by priority and then ID.
+func (snap *Snapshot) Ready() []*types.Issue {
+	ready := snap.workflow.FilterReady(snap.Issues)
+	sortByPriority(ready)
+	return ready
+}
+
+// IsReadyIssue reports whether an issue is ready in the snapshot.
+func (snap *Snapshot) IsReadyIssue(issue *types.Issue) bool {
+	return snap.workflow.isReady(issue, snap.Issue)
+}
+
+// Open returns the issues that are not done, by priority and then ID.
+func (snap *Snapshot) Open() []*types.Issue {
+	var open []*types.Issue
+	for _, issue := range snap.Issues {
+		if !snap.IsDone(issue) && issue.Status != types.StatusTombstone {
+			open = append(open, issue)
+		}
+	}
+	sortByPriority(open)
+	return open
+}
+
+// StatusCounts returns how many issues are in each status, in the order
+// the statuses first appear among the issues sorted by ID.
+func (snap *Snapshot) StatusCounts() []StatusCount {
+	var counts []StatusCount
+	index := make(map[types.Status]int)
+	for _, issue := range snap.Issues {
+		i, ok := index[issue.Status]
+		if !ok {
+			i = len(counts)
+			index[issue.Status] = i
+			counts = append(counts, StatusCount{Status: issue.Status})
+		}
+		counts[i].Count++
+	}
+	return counts
+}
+
+// StatusCount is the number of issues in one status.
+type StatusCount struct {
+	Status types.Status
+	Count  int
+}
+
+// Children returns the issues with a parent-child dependency on id.
+func (snap *Snapshot) Children(id string) []*types.Issue {
+	var children []*types.Issue
+	for _, issue := range snap.Issues {
+		for _, dep := range issue.Dependencies {
+			if dep.Type == types.DepParentChild && dep.DependsOnID == id {
+				children = append(children, issue)
+				break
+			}
+		}
+	}
+	return children
+}
+
+// Dependents returns the dependencies other issues have on id.
+func (snap *Snapshot) Dependents(id string) []*types.Dependency {
+	var deps []*types.Dependency
+	for _, issue := range snap.Issues {
+		for _, dep := range issue.Dependencies {
+			if dep.DependsOnID == id && dep.Type != types.DepParentChild {
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return deps
+}
+
+// Epics returns the epics, by priority and then ID.
+func (snap *Snapshot) Epics() []*types.Issue {
+	var epics []*types.Issue
+	for _, issue := range snap.Issues {
+		if issue.IssueType == types.TypeEpic {
+			epics = append(epics, issue)
+		}
+	}
+	sortByPriority(epics)
+	return epics
+}
+
+// EpicProgress returns how many of an epic's children are done, and how
+// many children it has.
+func (snap *Snapshot) EpicProgress(id string) (done, total int) {
+	for _, child := range snap.Children(id) {
+		total++
+		if snap.IsDone(child) {
+			done++
+		}
+	}
+	return done, total
+}
+
+// EpicGraph returns a Mermaid flowchart of the epics, their descendants and
+// the blocking dependencies between them, or "" if there are no epics.
+// Parent-child edges are dotted; blocking edges point from the blocker to
+// the blocked issue. Done issues are styled with the "done" class.
+func (snap *Snapshot) EpicGraph() string {
+	var nodes []*types.Issue
+	included := make(map[string]string)
+	var include func(issue *types.Issue)
+	include = func(issue *types.Issue) {
+		if _, ok := included[issue.ID]; ok {
+			return
+		}
+		included[issue.ID] = fmt.Sprintf("n%d", len(nodes))
+		nodes = append(nodes, issue)
+		for _, child := range snap.Children(issue.ID) {
+			include(child)
+		}
+	}
+	for _, epic := range snap.Epics() {
+		include(epic)
+	}
+	if len(nodes) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	b.WriteString("  classDef done fill:#e6f4ea,stroke:#34a853,color:#555\n")
+	b.WriteString("  classDef epic stroke-width:3px\n")
+	for _, issue := range nodes {
+		fmt.Fprintf(&b, "  %s[\"%s\"]", included[issue.ID], mermaidLabel(issue.ID+": "+issue.Title))
+		switch {
+		case snap.IsDone(issue):
+			b.WriteString(":::done")
+		case issue.IssueType == types.TypeEpic:
+			b.WriteString(":::epic")
+		}
+		b.WriteByte('\n')
+	}
+	for _, issue := range nodes {
+		for _, dep := range issue.Dependencies {
+			from, ok := included[dep.DependsOnID]
+			if !ok {
+				continue
+			}
+			switch {
+			case dep.Type == types.DepParentChild:
+				fmt.Fprintf(&b, "  %s -.-> %s\n", from, included[issue.ID])
+			case isBlocking(dep):
+				fmt.Fprintf(&b, "  %s --> %s\n", from, included[issue.ID])
+			}
+		}
+	}
+	return b.String()
+}
+
+// mermaidLabel escapes text for a quoted Mermaid node label.
+func mermaidLabel(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "\n", " ", "<", "#lt;", ">", "#gt;").Replace(s)
+}
+
+// sortByPriority sorts issues by priority and then ID.
+func sortByPriority(issues []*types.Issue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Priority != issues[j].Priority {
+			return issues[i].Priority < issues[j].Priority
+		}
+		return issues[i].ID < issues[j].ID
+	})
+}
+
+// issuePageName returns the file name of an issue's page in the site.
+func issuePageName(id string) string {
+	return url.PathEscape(id) + ".html"
+}
+
+// WriteSite renders the snapshot as a static site in dir, creating it if
+// needed: index.html lists and filters every issue, issues/<id>.html has
+// each issue's details, dependencies and history, and graph.html (with the
+// Mermaid source in epics.mmd) shows the epic dependency graph.
+func (snap *Snapshot) WriteSite(dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "issues"), 0o755); err != nil {
+		return fmt.Errorf("wongdb: export site: %w", err)
+	}
+	if err := renderPage(filepath.Join(dir, "index.html"), "index", snap); err != nil {
+		return err
+	}
+	for _, issue := range snap.Issues {
+		page := filepath.Join(dir, "issues", issuePageName(issue.ID))
+		if err := renderPage(page, "issue", issuePage{Snapshot: snap, Issue: issue}); err != nil {
+			return err
+		}
+	}
+	graph := snap.EpicGraph()
+	if err := os.WriteFile(filepath.Join(dir, "epics.mmd"), []byte(graph), 0o644); err != nil {
+		return fmt.Errorf("wongdb: export site: %w", err)
+	}
+	return renderPage(filepath.Join(dir, "graph.html"), "graph", graphPage{Snapshot: snap, Graph: graph})
+}
+
+// issuePage is the data for an issue's page.
+type issuePage struct {
+	*Snapshot
+	Issue *types.Issue
+}
+
+// graphPage is the data for the epic graph page.
+type graphPage struct {
+	*Snapshot
+	Graph string
+}
+
+// renderPage executes the named site template into path.
+func renderPage(path, name string, data interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("wongdb: export site: %w", err)
+	}
+	err = siteTemplates.ExecuteTemplate(f, name, data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("wongdb: export site %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+var siteFuncs = template.FuncMap{
+	"page": issuePageName,
+	"date": formatDate,
+	"join": strings.Join,
+}
+
+// formatDate formats a time.Time or non-nil *time.Time for a page.
+func formatDate(v interface{}) string {
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v != nil {
+			t = *v
+		}
+	}
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02 15:04")
+}
+
+var siteTemplates = template.Must(template.New("site").Funcs(siteFuncs).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.}}</title>
+<style>
+body { font: 15px/1.5 system-ui, sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+a { color: #1a5fb4; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .3rem .6rem; border-bottom: 1px solid #ddd; vertical-align: top; }
+.status { font-size: .85em; padding: 0 .4em; border-radius: .3em; background: #eee; }
+.done { color: #777; }
+.text { white-space: pre-wrap; }
+form label { margin-right: 1rem; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{define "nav"}}<p><a href="{{.}}index.html">All issues</a> · <a href="{{.}}graph.html">Epic graph</a></p>{{end}}
+
+{{define "rev"}}{{if .Revision}}<p>Snapshot at revision <code>{{.Revision}}</code>.</p>{{end}}{{end}}
+
+{{define "index"}}{{template "head" .Title}}
+<h1>{{.Title}}</h1>
+{{template "nav" ""}}
+{{template "rev" .}}
+<p>{{len .Issues}} issues{{range .StatusCounts}} · {{.Count}} {{.Status}}{{end}} · {{len .Ready}} ready</p>
+<form id="filters">
+<label>Status <select name="status"><option value="">any</option>{{range .StatusCounts}}<option>{{.Status}}</option>{{end}}</select></label>
+<label>Priority <select name="priority"><option value="">any</option><option>0</option><option>1</option><option>2</option><option>3</option><option>4</option></select></label>
+<label>Type <input name="type" size="8"></label>
+<label>Assignee <input name="assignee" size="10"></label>
+<label>Label <input name="label" size="10"></label>
+<label><input type="checkbox" name="ready"> Ready only</label>
+<label>Search <input name="q" size="14"></label>
+</form>
+<table id="issues">
+<thead><tr><th>ID</th><th>Title</th><th>Status</th><th>P</th><th>Type</th><th>Assignee</th><th>Labels</th></tr></thead>
+<tbody>
+{{- $snap := .}}{{range .Issues}}
+<tr data-status="{{.Status}}" data-priority="{{.Priority}}" data-type="{{.IssueType}}" data-assignee="{{.Assignee}}" data-labels="{{join .Labels " "}}" data-ready="{{$snap.IsReadyIssue .}}"{{if $snap.IsDone .}} class="done"{{end}}>
+<td><a href="issues/{{page .ID}}">{{.ID}}</a></td><td>{{.Title}}</td><td><span class="status">{{.Status}}</span></td><td>{{.Priority}}</td><td>{{.IssueType}}</td><td>{{.Assignee}}</td><td>{{join .Labels ", "}}</td>
+</tr>{{end}}
+</tbody>
+</table>
+<script>
+(function () {
+  var form = document.getElementById("filters");
+  function apply() {
+    var f = form.elements;
+    var rows = document.querySelectorAll("#issues tbody tr");
+    for (var i = 0; i < rows.length; i++) {
+      var d = rows[i].dataset;
+      var show = (!f.status.value || d.status === f.status.value) &&
+        (!f.priority.value || d.priority === f.priority.value) &&
+        (!f.type.value || d.type === f.type.value) &&
+        (!f.assignee.value || d.assignee === f.assignee.value) &&
+        (!f.label.value || (" " + d.labels + " ").indexOf(" " + f.label.value + " ") >= 0) &&
+        (!f.ready.checked || d.ready === "true") &&
+        (!f.q.value || rows[i].textContent.toLowerCase().indexOf(f.q.value.toLowerCase()) >= 0);
+      rows[i].hidden = !show;
+    }
+  }
+  form.addEventListener("input", apply);
+  form.addEventListener("change", apply);
+})();
+</script>
+</body>
+</html>
+{{end}}
+
+{{define "issue"}}{{template "head" (printf "%s: %s" .Issue.ID .Issue.Title)}}
+{{$snap := .Snapshot}}{{with .Issue}}
+<h1>{{.ID}}: {{.Title}}</h1>
+{{template "nav" "../"}}
+{{template "rev" $snap}}
+<table>
+<tr><th>Status</th><td><span class="status">{{.Status}}</span>{{if $snap.IsReadyIssue .}} (ready){{end}}</td></tr>
+<tr><th>Priority</th><td>P{{.Priority}}</td></tr>
+{{if .IssueType}}<tr><th>Type</th><td>{{.IssueType}}</td></tr>{{end}}
+{{if .Assignee}}<tr><th>Assignee</th><td>{{.Assignee}}</td></tr>{{end}}
+{{if .Owner}}<tr><th>Owner</th><td>{{.Owner}}</td></tr>{{end}}
+{{if .Labels}}<tr><th>Labels</th><td>{{join .Labels ", "}}</td></tr>{{end}}
+<tr><th>Created</th><td>{{date .CreatedAt}}</td></tr>
+<tr><th>Updated</th><td>{{date .UpdatedAt}}</td></tr>
+{{if .ClosedAt}}<tr><th>Closed</th><td>{{date .ClosedAt}}{{if .CloseReason}}: {{.CloseReason}}{{end}}</td></tr>{{end}}
+</table>
+{{if .Description}}<h2>Description</h2>
+<div class="text">{{.Description}}</div>{{end}}
+{{if .Notes}}<h2>Notes</h2>
+<div class="text">{{.Notes}}</div>{{end}}
+{{if .Dependencies}}<h2>Depends on</h2>
+<ul>{{range .Dependencies}}<li>{{.Type}} <a href="{{page .DependsOnID}}">{{.DependsOnID}}</a>{{with $snap.Issue .DependsOnID}} {{.Title}} <span class="status">{{.Status}}</span>{{else}} (missing){{end}}</li>{{end}}</ul>{{end}}
+{{with $snap.Dependents .ID}}<h2>Needed by</h2>
+<ul>{{range .}}<li>{{.Type}} <a href="{{page .IssueID}}">{{.IssueID}}</a>{{with $snap.Issue .IssueID}} {{.Title}} <span class="status">{{.Status}}</span>{{end}}</li>{{end}}</ul>{{end}}
+{{with $snap.Children .ID}}<h2>Children</h2>
+<ul>{{range .}}<li><a href="{{page .ID}}">{{.ID}}</a> {{.Title}} <span class="status">{{.Status}}</span></li>{{end}}</ul>{{end}}
+{{if .Comments}}<h2>Comments</h2>
+{{range .Comments}}<p><strong>{{.Author}}</strong> {{date .CreatedAt}}</p>
+<div class="text">{{.Text}}</div>{{end}}{{end}}
+{{with index $snap.Links .ID}}<h2>Linked changes</h2>
+<ul>{{range .}}<li><code>{{.ShortID}}</code> {{.Description}}</li>{{end}}</ul>{{end}}
+{{with index $snap.History .ID}}<h2>History</h2>
+<ul>{{range .}}<li><code>{{.Revision}}</code> {{date .Time}} {{.Author}}: {{.Summary}}</li>{{end}}</ul>{{end}}
+{{end}}
+</body>
+</html>
+{{end}}
+
+{{define "graph"}}{{template "head" (printf "%s: epics" .Title)}}
+<h1>{{.Title}}: epics</h1>
+{{template "nav" ""}}
+{{template "rev" .Snapshot}}
+{{if .Graph}}<pre class="mermaid">
+{{.Graph}}</pre>
+<p>Dotted edges link epics to their children; solid edges point from a blocker to the issue it blocks. The Mermaid source is in <a href="epics.mmd">epics.mmd</a>.</p>
+<script type="module">
+import mermaid from "https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.esm.min.mjs";
+mermaid.initialize({ startOnLoad: true });
+</script>
+{{else}}<p>There are no epics.</p>{{end}}
+</body>
+</html>
+{{end}}
+`))
+
+// WriteMarkdown writes a single-file Markdown summary of the snapshot,
+// suitable for pasting into a pull request: status counts, the ready and
+// open issues, epic progress and the epic graph as a Mermaid block.
+func (snap *Snapshot) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", snap.Title)
+	if snap.Revision != "" {
+		fmt.Fprintf(&b, "Snapshot at revision `%s`.\n\n", snap.Revision)
+	}
+	fmt.Fprintf(&b, "%d issues", len(snap.Issues))
+	for _, c := range snap.StatusCounts() {
+		fmt.Fprintf(&b, ", %d %s", c.Count, c.Status)
+	}
+	b.WriteString(".\n")
+
+	if ready := snap.Ready(); len(ready) > 0 {
+		fmt.Fprintf(&b, "\n## Ready (%d)\n\n", len(ready))
+		for _, issue := range ready {
+			fmt.Fprintf(&b, "- **%s** %s (P%d", issue.ID, markdownText(issue.Title), issue.Priority)
+			if issue.IssueType != "" {
+				fmt.Fprintf(&b, ", %s", issue.IssueType)
+			}
+			if issue.Assignee != "" {
+				fmt.Fprintf(&b, ", @%s", issue.Assignee)
+			}
+			b.WriteString(")\n")
+		}
+	}
+
+	if open := snap.Open(); len(open) > 0 {
+		fmt.Fprintf(&b, "\n## Open (%d)\n\n", len(open))
+		b.WriteString("| ID | Title | Status | P | Type | Assignee |\n")
+		b.WriteString("|----|-------|--------|---|------|----------|\n")
+		for _, issue := range open {
+			fmt.Fprintf(&b, "| %s | %s | %s | %d | %s | %s |\n", issue.ID, markdownCell(issue.Title),
+				issue.Status, issue.Priority, issue.IssueType, markdownCell(issue.Assignee))
+		}
+	}
+
+	if epics := snap.Epics(); len(epics) > 0 {
+		b.WriteString("\n## Epics\n\n")
+		for _, epic := range epics {
+			done, total := snap.EpicProgress(epic.ID)
+			fmt.Fprintf(&b, "- **%s** %s: %d/%d done\n", epic.ID, markdownText(epic.Title), done, total)
+		}
+		fmt.Fprintf(&b, "\n```mermaid\n%s```\n", snap.EpicGraph())
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("wongdb: export markdown: %w", err)
+	}
+	return nil
+}
+
+// markdownText flattens text onto one line for a Markdown list item.
+func markdownText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// markdownCell escapes text for a Markdown table cell.
+func markdownCell(s string) string {
+	return strings.ReplaceAll(markdownText(s), "|", `\|`)
+}
@@ -0,0 +1,195 @@
+package wongdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/types"
+)
+
+func newExportStore(t *testing.T) *MemStore {
+	t.Helper()
+	epic := makeTestIssue("ex-1", "Launch")
+	epic.IssueType = types.TypeEpic
+	shipped := blockedBy(makeTestIssue("ex-2", `Ship "v1"`), types.DepParentChild, "ex-1")
+	shipped.Status = types.StatusClosed
+	docs := blockedBy(makeTestIssue("ex-3", "Write <docs> | guide"), types.DepParentChild, "ex-1")
+	docs.Assignee = "alice"
+	docs.Priority = 1
+	blockedBy(docs, types.DepBlocks, "ex-2")
+	announce := blockedBy(makeTestIssue("ex-4", "Announce"), types.DepParentChild, "ex-1")
+	blockedBy(announce, types.DepBlocks, "ex-3")
+	return newMemStoreWith(t, epic, shipped, docs, announce, makeTestIssue("ex-5", "Unrelated"))
+}
+
+func TestSnapshot_EpicGraph(t *testing.T) {
+	snap, err := LoadSnapshot(context.Background(), newExportStore(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := snap.EpicGraph()
+	for _, want := range []string{
+		"flowchart LR\n",
+		`n0["ex-1: Launch"]:::epic`,
+		`n1["ex-2: Ship #quot;v1#quot;"]:::done`,
+		`n2["ex-3: Write #lt;docs#gt; | guide"]`,
+		"n0 -.-> n1\n",
+		"n1 --> n2\n",
+		"n2 --> n3\n",
+	} {
+		if !strings.Contains(graph, want) {
+			t.Errorf("graph missing %q:\n%s", want, graph)
+		}
+	}
+	if strings.Contains(graph, "ex-5") {
+		t.Errorf("graph includes issue outside any epic:\n%s", graph)
+	}
+
+	if done, total := snap.EpicProgress("ex-1"); done != 1 || total != 3 {
+		t.Errorf("EpicProgress = %d/%d, want 1/3", done, total)
+	}
+	empty, _ := LoadSnapshot(context.Background(), newMemStoreWith(t, makeTestIssue("x", "X")), "")
+	if graph := empty.EpicGraph(); graph != "" {
+		t.Errorf("graph without epics = %q", graph)
+	}
+}
+
+func TestSnapshot_WriteMarkdown(t *testing.T) {
+	snap, err := LoadSnapshot(context.Background(), newExportStore(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap.Title = "Launch tracker"
+	var buf bytes.Buffer
+	if err := snap.WriteMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	md := buf.String()
+	for _, want := range []string{
+		"# Launch tracker\n",
+		"5 issues, 4 open, 1 closed.\n",
+		"## Ready (3)\n\n- **ex-3** Write <docs> | guide (P1, task, @alice)\n",
+		"## Open (4)\n",
+		"| ex-3 | Write <docs> \\| guide | open | 1 | task | alice |\n",
+		"- **ex-1** Launch: 1/3 done\n",
+		"```mermaid\nflowchart LR\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "| ex-2 |") {
+		t.Errorf("closed issue listed as open:\n%s", md)
+	}
+}
+
+func TestSnapshot_WriteSite(t *testing.T) {
+	snap, err := LoadSnapshot(context.Background(), newExportStore(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "site")
+	if err := snap.WriteSite(dir); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	index := read("index.html")
+	for _, want := range []string{
+		`<a href="issues/ex-3.html">ex-3</a>`,
+		`data-status="open" data-priority="1" data-type="task" data-assignee="alice" data-labels="" data-ready="true"`,
+		`data-ready="false"`,
+		"Write &lt;docs&gt; | guide",
+		`<select name="status">`,
+	} {
+		if !strings.Contains(index, want) {
+			t.Errorf("index.html missing %q", want)
+		}
+	}
+	if strings.Contains(index, "<docs>") {
+		t.Error("index.html does not escape titles")
+	}
+
+	page := read(filepath.Join("issues", "ex-3.html"))
+	for _, want := range []string{
+		`blocks <a href="ex-2.html">ex-2</a> Ship &#34;v1&#34; <span class="status">closed</span>`,
+		`<h2>Needed by</h2>`,
+		`<a href="ex-4.html">ex-4</a> Announce`,
+		`<a href="../index.html">All issues</a>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("ex-3.html missing %q:\n%s", want, page)
+		}
+	}
+	if epic := read(filepath.Join("issues", "ex-1.html")); !strings.Contains(epic, "<h2>Children</h2>") {
+		t.Error("epic page lists no children")
+	}
+	if graph := read("graph.html"); !strings.Contains(graph, `<pre class="mermaid">`) {
+		t.Error("graph.html has no Mermaid block")
+	}
+	if mmd := read("epics.mmd"); mmd != snap.EpicGraph() {
+		t.Errorf("epics.mmd = %q", mmd)
+	}
+}
+
+func TestLoadSnapshot_Revision(t *testing.T) {
+	ctx := context.Background()
+	if _, err := LoadSnapshot(ctx, newExportStore(t), "main"); !errors.Is(err, ErrNoHistory) {
+		t.Fatalf("MemStore snapshot at revision = %v, want ErrNoHistory", err)
+	}
+
+	repo := setupGitRepo(t, t.TempDir())
+	s := NewGitStore(repo)
+	if err := s.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	save := func(issue *types.Issue) {
+		t.Helper()
+		if err := SaveIssue(ctx, s, issue); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save(makeTestIssue("gx-1", "First title"))
+	rev := runGit(t, repo, "rev-parse", gitDBRef)
+	save(makeTestIssue("gx-1", "Second title"))
+	save(makeTestIssue("gx-2", "Added later"))
+
+	old, err := LoadSnapshot(ctx, s, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(old.Issues) != 1 || old.Issues[0].Title != "First title" {
+		t.Errorf("snapshot at %s = %+v", rev, old.Issues)
+	}
+	if got := len(old.History["gx-1"]); got != 1 {
+		t.Errorf("history at %s has %d entries, want 1", rev, got)
+	}
+
+	cur, err := LoadSnapshot(ctx, s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := issueIDs(cur.Issues); got != "gx-1 gx-2" {
+		t.Errorf("current snapshot = %q", got)
+	}
+	history := cur.History["gx-1"]
+	if len(history) != 2 || history[0].Author != "Test User" || history[0].Time.IsZero() ||
+		history[0].Summary != "wong-db: update issues" {
+		t.Errorf("history = %+v", history)
+	}
+}
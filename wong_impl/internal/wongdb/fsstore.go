@@ -0,0 +1,281 @@
+package wongdb
+
+// FSStore keeps wong-db as plain files in a .wong/ directory with the same
+// layout as the jj wong-db change, for directories with no version control
+// or for tools that manage history themselves.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+// FSStore is an IssueStore on the filesystem under root/.wong.
+type FSStore struct {
+	root   string
+	staged stagedIssues
+
+	// batchMu keeps batches in this process from interleaving.
+	batchMu sync.Mutex
+}
+
+// NewFSStore creates an FSStore for the .wong directory under root.
+func NewFSStore(root string) *FSStore {
+	return &FSStore{root: root}
+}
+
+// path returns the absolute path of rel, a slash-separated path such as
+// ".wong/config.json".
+func (s *FSStore) path(rel string) string {
+	return filepath.Join(s.root, filepath.FromSlash(rel))
+}
+
+// Init creates .wong/ with the initial config and metadata. It does nothing
+// if .wong/metadata.json already exists. In plan mode the directories and
+// files are recorded in the plan instead.
+func (s *FSStore) Init(ctx context.Context) error {
+	if _, err := os.Stat(s.root); err != nil {
+		return fmt.Errorf("wongdb: %w", err)
+	}
+	if s.IsInitialized(ctx) {
+		return nil
+	}
+
+	cfgData, err := json.MarshalIndent(Config{Prefix: "", HistoryMode: "squash"}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("wongdb: failed to marshal config: %w", err)
+	}
+	metaData, err := json.MarshalIndent(Metadata{Version: 1, Backend: "filesystem", CreatedAt: time.Now()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("wongdb: failed to marshal metadata: %w", err)
+	}
+	if plan := vcs.PlanFromContext(ctx); plan != nil {
+		plan.AddNote("create directory " + wongIssuesDir)
+		for _, rel := range []string{wongDir + "/config.json", wongDir + "/metadata.json"} {
+			plan.AddNote("write " + rel)
+			plan.AddFiles(rel)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(s.path(wongIssuesDir), 0o755); err != nil {
+		return fmt.Errorf("wongdb: failed to create issues directory: %w", err)
+	}
+	if err := s.writeFile(wongDir+"/config.json", cfgData); err != nil {
+		return fmt.Errorf("wongdb: failed to write config: %w", err)
+	}
+	// metadata.json goes last: it is what IsInitialized looks for.
+	if err := s.writeFile(wongDir+"/metadata.json", metaData); err != nil {
+		return fmt.Errorf("wongdb: failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// IsInitialized reports whether .wong/metadata.json exists.
+func (s *FSStore) IsInitialized(ctx context.Context) bool {
+	_, err := os.Stat(s.path(wongDir + "/metadata.json"))
+	return err == nil
+}
+
+// ReadIssue reads a single synced issue's raw JSON bytes.
+func (s *FSStore) ReadIssue(ctx context.Context, id string) ([]byte, error) {
+	if err := validateIssueID(id); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.path(issuePath(id)))
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: failed to read issue %s: %w", id, err)
+	}
+	return data, nil
+}
+
+// ListIssueIDs returns the IDs of all synced issues in sorted order.
+func (s *FSStore) ListIssueIDs(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.path(wongIssuesDir))
+	if err != nil {
+		// No issues directory - return empty list
+		return nil, nil
+	}
+	var ids []string
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasSuffix(name, ".json") {
+			ids = append(ids, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// WriteIssue stages an issue's raw JSON data. Nothing is written to disk
+// until Sync.
+func (s *FSStore) WriteIssue(ctx context.Context, id string, data []byte) error {
+	if err := validateIssueID(id); err != nil {
+		return err
+	}
+	s.staged.write(id, data)
+	return nil
+}
+
+// DeleteIssue stages the removal of an issue until Sync.
+func (s *FSStore) DeleteIssue(ctx context.Context, id string) error {
+	if err := validateIssueID(id); err != nil {
+		return err
+	}
+	return s.staged.remove(id, func() bool {
+		_, err := os.Stat(s.path(issuePath(id)))
+		return err == nil
+	})
+}
+
+// stagedIssue returns the data staged for id by WriteIssue or DeleteIssue.
+func (s *FSStore) stagedIssue(id string) ([]byte, bool) {
+	return s.staged.get(id)
+}
+
+// ReadConfig reads .wong/config.json.
+func (s *FSStore) ReadConfig(ctx context.Context) (*Config, error) {
+	data, err := os.ReadFile(s.path(wongDir + "/config.json"))
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: failed to read config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("wongdb: failed to parse config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Sync writes the staged issues and removes the staged deletes, or none of
+// them if one breaks the schema. Each file is replaced atomically, so
+// readers never see a partial issue; changes that fail stay staged for the
+// next Sync. In plan mode the changes are
+// recorded in the plan and stay staged.
+func (s *FSStore) Sync(ctx context.Context) error {
+	if !s.IsInitialized(ctx) {
+		return fmt.Errorf("wongdb: sync failed: %s does not exist; run Init first", wongDir)
+	}
+	pending := s.staged.take(ctx)
+	if err := validatePending(ctx, s, pending); err != nil {
+		s.staged.restore(pending)
+		return fmt.Errorf("wongdb: sync failed: %w", err)
+	}
+	var errs []error
+	for id, data := range pending {
+		var err error
+		if data == nil {
+			if err = os.Remove(s.path(issuePath(id))); os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = s.writeFile(issuePath(id), data)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("issue %s: %w", id, err))
+			continue
+		}
+		delete(pending, id)
+	}
+	if len(errs) > 0 {
+		s.staged.restore(pending)
+		return fmt.Errorf("wongdb: sync failed: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// commitBatch writes a batch's files, leaving staged writes pending. If a
+// file cannot be written, the ones already changed are put back.
+func (s *FSStore) commitBatch(ctx context.Context, changes map[string][]byte) error {
+	if !s.IsInitialized(ctx) {
+		return fmt.Errorf("wongdb: %s does not exist; run Init first", wongDir)
+	}
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+
+	// prior holds each changed file's earlier content; nil means absent.
+	prior := make(map[string][]byte)
+	for _, id := range sortedKeys(changes) {
+		rel := issuePath(id)
+		old, err := s.replaceFile(rel, changes[id])
+		if err != nil {
+			if rerr := s.restoreFiles(prior); rerr != nil {
+				return fmt.Errorf("wongdb: issue %s: %w (rollback failed: %v)", id, err, rerr)
+			}
+			return fmt.Errorf("wongdb: issue %s: %w", id, err)
+		}
+		prior[rel] = old
+	}
+	return nil
+}
+
+// replaceFile writes data to rel, or removes rel if data is nil, and
+// returns what was there before (nil if nothing).
+func (s *FSStore) replaceFile(rel string, data []byte) ([]byte, error) {
+	old, err := os.ReadFile(s.path(rel))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if data != nil {
+		return old, s.writeFile(rel, data)
+	}
+	if err := os.Remove(s.path(rel)); err != nil && !os.IsNotExist(err) {
+		return old, err
+	}
+	return old, nil
+}
+
+// restoreFiles puts back file contents saved by commitBatch.
+func (s *FSStore) restoreFiles(prior map[string][]byte) error {
+	var errs []error
+	for rel, data := range prior {
+		if data == nil {
+			if err := os.Remove(s.path(rel)); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		} else if err := s.writeFile(rel, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Push syncs; an FSStore has no remote.
+func (s *FSStore) Push(ctx context.Context) error {
+	return s.Sync(ctx)
+}
+
+// Pull does nothing; an FSStore has no remote.
+func (s *FSStore) Pull(ctx context.Context) error {
+	return nil
+}
+
+// writeFile replaces rel with data via a temporary file and a rename.
+func (s *FSStore) writeFile(rel string, data []byte) error {
+	dst := s.path(rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,515 @@
+package wongdb
+
+// GitStore keeps wong-db on an orphan git ref for repositories without jj.
+// The ref's tree has the same .wong/ layout as the jj wong-db change, but it
+// is only ever written with plumbing (hash-object, mktree, commit-tree,
+// update-ref), so the user's index, HEAD and working tree are never touched.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+const (
+	// gitDBRef is the ref holding the wong-db history.
+	gitDBRef = "refs/wong/db"
+
+	// gitDBRemoteRefPrefix is where Pull fetches other clones' wong-db refs,
+	// e.g. refs/wong/remotes/origin/db.
+	gitDBRemoteRefPrefix = "refs/wong/remotes/"
+
+	// gitSyncAttempts bounds Sync's retries when another writer moves the
+	// ref between reading it and updating it.
+	gitSyncAttempts = 5
+)
+
+// GitStore stores issues on refs/wong/db in a plain git repository.
+type GitStore struct {
+	repoRoot string
+	remote   string
+
+	// runner runs every git command; nil means vcs.DefaultRunner.
+	runner *vcs.Runner
+
+	staged stagedIssues
+
+	// refMu keeps this process's Syncs, batches and Pulls from racing each
+	// other to move refs/wong/db.
+	refMu sync.Mutex
+}
+
+// NewGitStore creates a GitStore for the git repository at repoRoot that
+// pushes to and pulls from origin.
+func NewGitStore(repoRoot string) *GitStore {
+	return &GitStore{repoRoot: repoRoot, remote: "origin"}
+}
+
+// SetRunner makes s run its git commands through r.
+func (s *GitStore) SetRunner(r *vcs.Runner) {
+	s.runner = r
+}
+
+// git runs a git command in the repository and returns its untrimmed stdout.
+func (s *GitStore) git(ctx context.Context, stdin string, args ...string) (string, error) {
+	res, err := s.runner.Run(ctx, vcs.Invocation{Bin: "git", Args: args, Dir: s.repoRoot, Stdin: stdin})
+	if err != nil {
+		command := "git"
+		if len(args) > 0 {
+			command = args[0]
+		}
+		return "", fmt.Errorf("wongdb: git %s: %w", strings.Join(args, " "), &vcs.CommandError{
+			VCS:     vcs.VCSTypeGit,
+			Command: command,
+			Args:    args,
+			Stderr:  string(res.Stderr),
+			Stdout:  string(res.Stdout),
+			Err:     err,
+		})
+	}
+	return string(res.Stdout), nil
+}
+
+// Init creates refs/wong/db with the initial config and metadata. It does
+// nothing if the ref already exists.
+func (s *GitStore) Init(ctx context.Context) error {
+	if _, err := os.Stat(s.repoRoot); err != nil {
+		return fmt.Errorf("wongdb: %w", err)
+	}
+	if _, err := s.git(ctx, "", "rev-parse", "--git-dir"); err != nil {
+		return fmt.Errorf("wongdb: not a git repository (%s): %w", s.repoRoot, err)
+	}
+	if s.IsInitialized(ctx) {
+		return nil
+	}
+
+	cfgData, err := json.MarshalIndent(Config{Prefix: "", HistoryMode: "squash"}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("wongdb: failed to marshal config: %w", err)
+	}
+	metaData, err := json.MarshalIndent(Metadata{Version: 1, Backend: "git-ref", CreatedAt: time.Now()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("wongdb: failed to marshal metadata: %w", err)
+	}
+	files := make(map[string]string)
+	for name, data := range map[string][]byte{"config.json": cfgData, "metadata.json": metaData} {
+		blob, err := s.hashObject(ctx, data)
+		if err != nil {
+			return err
+		}
+		files[wongDir+"/"+name] = blob
+	}
+	tree, err := s.writeTree(ctx, files)
+	if err != nil {
+		return err
+	}
+	commit, err := s.commitTree(ctx, tree, "wong-db: issue tracker storage")
+	if err != nil {
+		return err
+	}
+	// create fails if another process initialized the ref in the meantime,
+	// in which case their wong-db stands.
+	if _, err := s.git(ctx, "create "+gitDBRef+" "+commit+"\n", "update-ref", "--stdin"); err != nil {
+		if s.IsInitialized(ctx) {
+			return nil
+		}
+		return fmt.Errorf("wongdb: failed to create %s: %w", gitDBRef, err)
+	}
+	return nil
+}
+
+// IsInitialized reports whether refs/wong/db exists.
+func (s *GitStore) IsInitialized(ctx context.Context) bool {
+	_, err := s.git(ctx, "", "rev-parse", "--verify", "--quiet", gitDBRef+"^{commit}")
+	return err == nil
+}
+
+// ReadIssue reads a single issue's raw JSON bytes from refs/wong/db.
+func (s *GitStore) ReadIssue(ctx context.Context, id string) ([]byte, error) {
+	return s.readIssueAt(ctx, gitDBRef, id)
+}
+
+// readIssueAt reads an issue's raw JSON bytes as of commit rev.
+func (s *GitStore) readIssueAt(ctx context.Context, rev, id string) ([]byte, error) {
+	if err := validateIssueID(id); err != nil {
+		return nil, err
+	}
+	out, err := s.git(ctx, "", "cat-file", "blob", rev+":"+issuePath(id))
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: failed to read issue %s: %w", id, err)
+	}
+	return []byte(out), nil
+}
+
+// ListIssueIDs returns the IDs of all issues stored on refs/wong/db.
+func (s *GitStore) ListIssueIDs(ctx context.Context) ([]string, error) {
+	return s.listIssueIDsAt(ctx, gitDBRef)
+}
+
+// listIssueIDsAt returns the IDs of the issues that existed at commit rev.
+func (s *GitStore) listIssueIDsAt(ctx context.Context, rev string) ([]string, error) {
+	out, err := s.git(ctx, "", "ls-tree", "-z", "--name-only", rev+":"+wongIssuesDir)
+	if err != nil {
+		// No issues directory or no ref - return empty list
+		return nil, nil
+	}
+	var ids []string
+	for _, name := range strings.Split(out, "\x00") {
+		if strings.HasSuffix(name, ".json") {
+			ids = append(ids, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	return ids, nil
+}
+
+// issueHistory returns the commits in rev's history that touched an issue's
+// file, newest first.
+func (s *GitStore) issueHistory(ctx context.Context, rev, id string) ([]HistoryEntry, error) {
+	if err := validateIssueID(id); err != nil {
+		return nil, err
+	}
+	out, err := s.git(ctx, "", "log", "--format=%h%x00%an%x00%aI%x00%s"+linkRecordSep, rev, "--", issuePath(id))
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: history of issue %s: %w", id, err)
+	}
+	return parseHistory(out), nil
+}
+
+// WriteIssue stages an issue's raw JSON data. Nothing is written to the
+// repository until Sync.
+func (s *GitStore) WriteIssue(ctx context.Context, id string, data []byte) error {
+	if err := validateIssueID(id); err != nil {
+		return err
+	}
+	s.staged.write(id, data)
+	return nil
+}
+
+// DeleteIssue stages the removal of an issue until Sync.
+func (s *GitStore) DeleteIssue(ctx context.Context, id string) error {
+	if err := validateIssueID(id); err != nil {
+		return err
+	}
+	return s.staged.remove(id, func() bool {
+		return s.exists(ctx, id)
+	})
+}
+
+// stagedIssue returns the data staged for id by WriteIssue or DeleteIssue.
+func (s *GitStore) stagedIssue(id string) ([]byte, bool) {
+	return s.staged.get(id)
+}
+
+// exists reports whether refs/wong/db has the issue.
+func (s *GitStore) exists(ctx context.Context, id string) bool {
+	_, err := s.git(ctx, "", "cat-file", "-e", gitDBRef+":"+issuePath(id))
+	return err == nil
+}
+
+// ReadConfig reads .wong/config.json from refs/wong/db.
+func (s *GitStore) ReadConfig(ctx context.Context) (*Config, error) {
+	out, err := s.git(ctx, "", "cat-file", "blob", gitDBRef+":"+wongDir+"/config.json")
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: failed to read config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal([]byte(out), &cfg); err != nil {
+		return nil, fmt.Errorf("wongdb: failed to parse config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Sync commits the staged writes and deletes onto refs/wong/db as one
+// commit. The ref is moved with update-ref against the commit the new one
+// was built on, so concurrent writers never lose each other's commits: if
+// the ref moved, the staged changes are reapplied on top and Sync retries.
+// It is a no-op when nothing is staged or nothing would change. If a staged
+// issue breaks the schema or the commit fails, nothing is committed and the
+// changes stay staged for the next Sync. In plan mode they are recorded in
+// the plan and stay staged.
+func (s *GitStore) Sync(ctx context.Context) error {
+	if !s.IsInitialized(ctx) {
+		return fmt.Errorf("wongdb: sync failed: %s does not exist; run Init first", gitDBRef)
+	}
+	pending := s.staged.take(ctx)
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := validatePending(ctx, s, pending); err != nil {
+		s.staged.restore(pending)
+		return fmt.Errorf("wongdb: sync failed: %w", err)
+	}
+
+	s.refMu.Lock()
+	defer s.refMu.Unlock()
+	var err error
+	for attempt := 0; attempt < gitSyncAttempts; attempt++ {
+		var done bool
+		if done, err = s.commitChanges(ctx, pending, "wong-db: update issues"); done {
+			return nil
+		}
+	}
+	s.staged.restore(pending)
+	return fmt.Errorf("wongdb: sync failed: %w", err)
+}
+
+// commitChanges builds one commit on the current refs/wong/db with changes
+// (nil values are deletes) and moves the ref to it. It reports whether the
+// ref now holds the changes; false with an error means the attempt should
+// be retried.
+func (s *GitStore) commitChanges(ctx context.Context, changes map[string][]byte, message string) (bool, error) {
+	old, err := s.git(ctx, "", "rev-parse", "--verify", gitDBRef+"^{commit}")
+	if err != nil {
+		return false, err
+	}
+	old = strings.TrimSpace(old)
+	files, err := s.readTree(ctx, old)
+	if err != nil {
+		return false, err
+	}
+	for id, data := range changes {
+		if data == nil {
+			delete(files, issuePath(id))
+			continue
+		}
+		blob, err := s.hashObject(ctx, data)
+		if err != nil {
+			return false, err
+		}
+		files[issuePath(id)] = blob
+	}
+	tree, err := s.writeTree(ctx, files)
+	if err != nil {
+		return false, err
+	}
+	oldTree, err := s.git(ctx, "", "rev-parse", old+"^{tree}")
+	if err != nil {
+		return false, err
+	}
+	if tree == strings.TrimSpace(oldTree) {
+		return true, nil
+	}
+	commit, err := s.commitTree(ctx, tree, message, old)
+	if err != nil {
+		return false, err
+	}
+	if _, err := s.git(ctx, "", "update-ref", "-m", "wong-db: sync", gitDBRef, commit, old); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// commitBatch commits a batch as its own commit on refs/wong/db, leaving
+// writes staged outside the batch pending.
+func (s *GitStore) commitBatch(ctx context.Context, changes map[string][]byte) error {
+	s.refMu.Lock()
+	defer s.refMu.Unlock()
+	if !s.IsInitialized(ctx) {
+		return fmt.Errorf("wongdb: %s does not exist; run Init first", gitDBRef)
+	}
+	var err error
+	for attempt := 0; attempt < gitSyncAttempts; attempt++ {
+		var done bool
+		if done, err = s.commitChanges(ctx, changes, "wong-db: batch update"); done {
+			return nil
+		}
+	}
+	return err
+}
+
+// Push syncs and pushes refs/wong/db to the remote. If the remote has
+// commits this clone lacks, they are pulled and merged first.
+func (s *GitStore) Push(ctx context.Context) error {
+	if err := s.Sync(ctx); err != nil {
+		return fmt.Errorf("wongdb: push: sync failed: %w", err)
+	}
+	refspec := gitDBRef + ":" + gitDBRef
+	if _, err := s.git(ctx, "", "push", "--", s.remote, refspec); err != nil {
+		if !errors.Is(err, vcs.ErrNonFastForward) {
+			return fmt.Errorf("wongdb: push failed: %w", err)
+		}
+		if err := s.Pull(ctx); err != nil {
+			return fmt.Errorf("wongdb: push: %w", err)
+		}
+		if _, err := s.git(ctx, "", "push", "--", s.remote, refspec); err != nil {
+			return fmt.Errorf("wongdb: push failed after pull: %w", err)
+		}
+	}
+	return nil
+}
+
+// Pull fetches the remote's refs/wong/db and merges it into the local ref.
+// Issues changed on only one side take that side's version; issues changed
+// on both keep the local version.
+func (s *GitStore) Pull(ctx context.Context) error {
+	remoteRef := gitDBRemoteRefPrefix + s.remote + "/db"
+	if _, err := s.git(ctx, "", "fetch", "--", s.remote, "+"+gitDBRef+":"+remoteRef); err != nil {
+		if strings.Contains(err.Error(), "couldn't find remote ref") {
+			return nil // nothing pushed yet
+		}
+		return fmt.Errorf("wongdb: pull: fetch failed: %w", err)
+	}
+	theirs, err := s.git(ctx, "", "rev-parse", "--verify", remoteRef+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("wongdb: pull: %w", err)
+	}
+	theirs = strings.TrimSpace(theirs)
+
+	s.refMu.Lock()
+	defer s.refMu.Unlock()
+	for attempt := 0; attempt < gitSyncAttempts; attempt++ {
+		if err = s.merge(ctx, theirs); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("wongdb: pull: %w", err)
+}
+
+// merge moves refs/wong/db to include theirs.
+func (s *GitStore) merge(ctx context.Context, theirs string) error {
+	ours, err := s.git(ctx, "", "rev-parse", "--verify", "--quiet", gitDBRef+"^{commit}")
+	if err != nil {
+		// No local wong-db yet: adopt the remote's.
+		_, err := s.git(ctx, "create "+gitDBRef+" "+theirs+"\n", "update-ref", "--stdin")
+		return err
+	}
+	ours = strings.TrimSpace(ours)
+	if ours == theirs {
+		return nil
+	}
+	if _, err := s.git(ctx, "", "merge-base", "--is-ancestor", theirs, ours); err == nil {
+		return nil // already included
+	}
+	next := theirs
+	if _, err := s.git(ctx, "", "merge-base", "--is-ancestor", ours, theirs); err != nil {
+		if next, err = s.mergeCommit(ctx, ours, theirs); err != nil {
+			return err
+		}
+	}
+	_, err = s.git(ctx, "", "update-ref", "-m", "wong-db: pull", gitDBRef, next, ours)
+	return err
+}
+
+// mergeCommit creates a merge of two diverged wong-db commits, resolving
+// each file in favour of whichever side changed it since the merge base and
+// of ours when both did.
+func (s *GitStore) mergeCommit(ctx context.Context, ours, theirs string) (string, error) {
+	baseFiles := map[string]string{}
+	if base, err := s.git(ctx, "", "merge-base", ours, theirs); err == nil {
+		if baseFiles, err = s.readTree(ctx, strings.TrimSpace(base)); err != nil {
+			return "", err
+		}
+	}
+	ourFiles, err := s.readTree(ctx, ours)
+	if err != nil {
+		return "", err
+	}
+	theirFiles, err := s.readTree(ctx, theirs)
+	if err != nil {
+		return "", err
+	}
+	merged := make(map[string]string)
+	for p, blob := range ourFiles {
+		merged[p] = blob
+	}
+	for p, blob := range theirFiles {
+		if ourFiles[p] == baseFiles[p] {
+			merged[p] = blob
+		}
+	}
+	for p := range baseFiles {
+		if _, kept := theirFiles[p]; !kept && ourFiles[p] == baseFiles[p] {
+			delete(merged, p) // deleted on their side only
+		}
+	}
+	tree, err := s.writeTree(ctx, merged)
+	if err != nil {
+		return "", err
+	}
+	return s.commitTree(ctx, tree, "wong-db: merge "+s.remote, ours, theirs)
+}
+
+// hashObject writes data as a blob and returns its ID.
+func (s *GitStore) hashObject(ctx context.Context, data []byte) (string, error) {
+	out, err := s.git(ctx, string(data), "hash-object", "-w", "--stdin")
+	return strings.TrimSpace(out), err
+}
+
+// commitTree creates a commit of tree with the given parents.
+func (s *GitStore) commitTree(ctx context.Context, tree, message string, parents ...string) (string, error) {
+	args := []string{"commit-tree", tree, "-m", message}
+	for _, p := range parents {
+		args = append(args, "-p", p)
+	}
+	out, err := s.git(ctx, "", args...)
+	return strings.TrimSpace(out), err
+}
+
+// readTree returns the blob ID of every file in commit, by path.
+func (s *GitStore) readTree(ctx context.Context, commit string) (map[string]string, error) {
+	out, err := s.git(ctx, "", "ls-tree", "-r", "-z", commit)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, entry := range strings.Split(out, "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		meta, p, ok := strings.Cut(entry, "\t")
+		if fields := strings.Fields(meta); ok && len(fields) == 3 && fields[1] == "blob" {
+			files[p] = fields[2]
+		}
+	}
+	return files, nil
+}
+
+// writeTree builds the nested trees for files (path to blob ID) with mktree
+// and returns the root tree's ID.
+func (s *GitStore) writeTree(ctx context.Context, files map[string]string) (string, error) {
+	blobs := make(map[string]string)
+	dirs := make(map[string]map[string]string)
+	for p, blob := range files {
+		dir, rest, nested := strings.Cut(p, "/")
+		if !nested {
+			blobs[p] = blob
+			continue
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]string)
+		}
+		dirs[dir][rest] = blob
+	}
+
+	var entries []string
+	for name, blob := range blobs {
+		entries = append(entries, "100644 blob "+blob+"\t"+name)
+	}
+	for name, sub := range dirs {
+		tree, err := s.writeTree(ctx, sub)
+		if err != nil {
+			return "", err
+		}
+		entries = append(entries, "040000 tree "+tree+"\t"+name)
+	}
+	sort.Strings(entries)
+	var input strings.Builder
+	for _, e := range entries {
+		input.WriteString(e)
+		input.WriteByte(0)
+	}
+	out, err := s.git(ctx, input.String(), "mktree", "-z")
+	return strings.TrimSpace(out), err
+}
+
+// issuePath returns the path of an issue's file in the wong-db tree.
+func issuePath(id string) string {
+	return path.Join(wongIssuesDir, id+".json")
+}
@@ -0,0 +1,247 @@
+package wongdb
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// runGit runs git in dir and returns trimmed stdout, failing the test on error.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// setupGitRepo creates a plain git repository with one commit and a dirty
+// working tree, so tests can check GitStore leaves both alone.
+func setupGitRepo(t *testing.T, dir string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "init", "-q", "-b", "main")
+	runGit(t, dir, "config", "user.email", "test@example.com")
+	runGit(t, dir, "config", "user.name", "Test User")
+	runGit(t, dir, "config", "commit.gpgsign", "false")
+	if err := os.WriteFile(filepath.Join(dir, "code.txt"), []byte("code\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", "code.txt")
+	runGit(t, dir, "commit", "-q", "-m", "code")
+	if err := os.WriteFile(filepath.Join(dir, "code.txt"), []byte("edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGitStore_RoundTrip(t *testing.T) {
+	repo := setupGitRepo(t, t.TempDir())
+	ctx := context.Background()
+	head := runGit(t, repo, "rev-parse", "HEAD")
+	status := runGit(t, repo, "status", "--porcelain")
+
+	store, err := OpenStore(repo)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	s, ok := store.(*GitStore)
+	if !ok {
+		t.Fatalf("OpenStore = %T, want *GitStore", store)
+	}
+	if s.IsInitialized(ctx) {
+		t.Fatal("IsInitialized before Init")
+	}
+	if err := s.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if err := s.Init(ctx); err != nil {
+		t.Fatalf("second Init: %v", err)
+	}
+	if cfg, err := s.ReadConfig(ctx); err != nil || cfg.HistoryMode != "squash" {
+		t.Errorf("ReadConfig = %+v, %v", cfg, err)
+	}
+
+	if err := s.WriteIssue(ctx, "bt-1", []byte(`{"id":"bt-1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteIssue(ctx, "bt-2", []byte(`{"id":"bt-2"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := s.ListIssueIDs(ctx); len(ids) != 0 {
+		t.Errorf("ListIssueIDs before Sync = %v, want none", ids)
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if ids, _ := s.ListIssueIDs(ctx); strings.Join(ids, " ") != "bt-1 bt-2" {
+		t.Errorf("ListIssueIDs = %v", ids)
+	}
+	if data, err := s.ReadIssue(ctx, "bt-2"); err != nil || string(data) != `{"id":"bt-2"}` {
+		t.Errorf("ReadIssue = %q, %v", data, err)
+	}
+
+	synced := runGit(t, repo, "rev-parse", gitDBRef)
+	if err := s.Sync(ctx); err != nil || runGit(t, repo, "rev-parse", gitDBRef) != synced {
+		t.Errorf("empty Sync moved the ref: %v", err)
+	}
+	if err := s.DeleteIssue(ctx, "bt-1"); err != nil {
+		t.Fatalf("DeleteIssue: %v", err)
+	}
+	if err := s.DeleteIssue(ctx, "bt-1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("second DeleteIssue = %v, want not found", err)
+	}
+	if err := s.DeleteIssue(ctx, "bt-9"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("DeleteIssue(missing) = %v, want not found", err)
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if ids, _ := s.ListIssueIDs(ctx); strings.Join(ids, " ") != "bt-2" {
+		t.Errorf("ListIssueIDs after delete = %v", ids)
+	}
+	if parent := runGit(t, repo, "rev-parse", gitDBRef+"^"); parent != synced {
+		t.Errorf("delete commit parent = %s, want %s", parent, synced)
+	}
+
+	// The user's branch, index and working tree are untouched.
+	if got := runGit(t, repo, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD moved to %s", got)
+	}
+	if got := runGit(t, repo, "status", "--porcelain"); got != status {
+		t.Errorf("status = %q, want %q", got, status)
+	}
+	if _, err := os.Stat(filepath.Join(repo, wongDir)); !os.IsNotExist(err) {
+		t.Errorf(".wong/ exists in the working tree: %v", err)
+	}
+}
+
+func TestGitStore_ConcurrentSync(t *testing.T) {
+	repo := setupGitRepo(t, t.TempDir())
+	ctx := context.Background()
+	if err := NewGitStore(repo).Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Separate stores stand in for separate processes racing on the ref.
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := NewGitStore(repo)
+			id := "bt-" + string(rune('a'+i))
+			s.WriteIssue(ctx, id, []byte(id))
+			errs <- s.Sync(ctx)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Sync: %v", err)
+		}
+	}
+	ids, _ := NewGitStore(repo).ListIssueIDs(ctx)
+	if strings.Join(ids, " ") != "bt-a bt-b bt-c bt-d" {
+		t.Errorf("ListIssueIDs = %v, want all four writers", ids)
+	}
+}
+
+func TestGitStore_FailedSyncKeepsChanges(t *testing.T) {
+	repo := setupGitRepo(t, t.TempDir())
+	ctx := context.Background()
+	s := NewGitStore(repo)
+	if err := s.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"id":"bt-1"}`)
+	s.WriteIssue(ctx, "bt-1", data)
+
+	// A file where the blob's object directory belongs makes hash-object
+	// fail, so the commit cannot be built.
+	sum := sha1.Sum([]byte(fmt.Sprintf("blob %d\x00%s", len(data), data)))
+	objDir := filepath.Join(repo, ".git", "objects", hex.EncodeToString(sum[:])[:2])
+	if _, err := os.Stat(objDir); err == nil {
+		t.Skip("object directory already exists")
+	}
+	if err := os.WriteFile(objDir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sync(ctx); err == nil {
+		t.Fatal("Sync succeeded although the blob could not be written")
+	}
+	if ids, _ := s.ListIssueIDs(ctx); len(ids) != 0 {
+		t.Errorf("ListIssueIDs after failed Sync = %v", ids)
+	}
+
+	if err := os.Remove(objDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatalf("Sync after the failure cleared: %v", err)
+	}
+	if got, err := s.ReadIssue(ctx, "bt-1"); err != nil || string(got) != string(data) {
+		t.Errorf("ReadIssue = %q, %v; want the write kept staged across the failure", got, err)
+	}
+}
+
+func TestGitStore_PushPull(t *testing.T) {
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.git")
+	runGit(t, dir, "init", "-q", "--bare", remote)
+	a := setupGitRepo(t, filepath.Join(dir, "a"))
+	b := setupGitRepo(t, filepath.Join(dir, "b"))
+	runGit(t, a, "remote", "add", "origin", remote)
+	runGit(t, b, "remote", "add", "origin", remote)
+	ctx := context.Background()
+
+	sa, sb := NewGitStore(a), NewGitStore(b)
+	if err := sa.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sa.WriteIssue(ctx, "bt-1", []byte("v1"))
+	if err := sa.Push(ctx); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if err := sb.Pull(ctx); err != nil {
+		t.Fatalf("Pull into empty clone: %v", err)
+	}
+	if data, err := sb.ReadIssue(ctx, "bt-1"); err != nil || string(data) != "v1" {
+		t.Fatalf("ReadIssue after Pull = %q, %v", data, err)
+	}
+
+	// Diverge: a edits bt-1, b adds bt-2. b's push must merge, not clobber.
+	sa.WriteIssue(ctx, "bt-1", []byte("v2"))
+	if err := sa.Push(ctx); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	sb.WriteIssue(ctx, "bt-2", []byte("new"))
+	if err := sb.Push(ctx); err != nil {
+		t.Fatalf("diverged Push: %v", err)
+	}
+	if err := sa.Pull(ctx); err != nil {
+		t.Fatalf("Pull: %v", err)
+	}
+	for _, s := range []*GitStore{sa, sb} {
+		one, _ := s.ReadIssue(ctx, "bt-1")
+		two, _ := s.ReadIssue(ctx, "bt-2")
+		if string(one) != "v2" || string(two) != "new" {
+			t.Errorf("%s: bt-1 = %q, bt-2 = %q; want both sides' edits", s.repoRoot, one, two)
+		}
+	}
+}
@@ -0,0 +1,709 @@
+package wongdb
+
+// Import migrates issues from GitHub and GitLab JSON exports into wong-db.
+// Each source issue is keyed by its repository and number, e.g.
+// "github:acme/widgets#12"; an ID mapping file records which wong-db issue
+// each key became, so importing a newer export updates those issues instead
+// of creating duplicates.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/steveyegge/beads/internal/types"
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+// ImportOptions configures an import.
+type ImportOptions struct {
+	// MapFile is the ID mapping file: a JSON object from source keys to
+	// wong-db issue IDs. It is read before the import and rewritten just
+	// before the import commits. If empty, no mapping is kept and every
+	// import creates new issues.
+	MapFile string
+
+	// Prefix is used for new issue IDs; empty means the store's configured
+	// prefix.
+	Prefix string
+}
+
+// ImportResult reports what an import did.
+type ImportResult struct {
+	// Created and Updated are the wong-db IDs written, sorted.
+	Created []string
+	Updated []string
+
+	// Skipped counts export entries that are not issues, such as GitHub
+	// pull requests.
+	Skipped int
+
+	// Downgraded lists blocking links that would have closed a cycle, such
+	// as two issues each marked blocked by the other. They were imported
+	// as related dependencies instead.
+	Downgraded []*types.Dependency
+}
+
+// externalIssue is a GitHub or GitLab issue in a source-neutral form.
+type externalIssue struct {
+	Key       string
+	Repo      string
+	Title     string
+	Body      string
+	Closed    bool
+	Reason    string
+	Labels    []string
+	Assignees []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ClosedAt  *time.Time
+	Comments  []*types.Comment
+
+	// BlockedBy and Blocks hold source keys from the tracker's own issue
+	// links; blocking references in the text are added on top.
+	BlockedBy []string
+	Blocks    []string
+	Related   []string
+}
+
+// ImportGitHub imports a GitHub issue export: a JSON array of issues as
+// returned by the REST API (/repos/{owner}/{repo}/issues) or by
+// "gh issue list --json". Pull requests are skipped. See importIssues for
+// how fields are mapped.
+func ImportGitHub(ctx context.Context, s IssueStore, path string, opts ImportOptions) (*ImportResult, error) {
+	var raw []githubIssue
+	if err := readExport(path, &raw); err != nil {
+		return nil, err
+	}
+	var issues []*externalIssue
+	skipped := 0
+	for _, gh := range raw {
+		if len(gh.PullRequest) > 0 {
+			skipped++
+			continue
+		}
+		issues = append(issues, gh.external())
+	}
+	res, err := importIssues(ctx, s, issues, opts)
+	if err != nil {
+		return nil, err
+	}
+	res.Skipped = skipped
+	return res, nil
+}
+
+// ImportGitLab imports a GitLab issue export: a JSON array of issues as
+// returned by the REST API (/projects/{id}/issues). An issue's "notes" and
+// "links" arrays, if present, are read as its comments and its linked
+// issues (/projects/{id}/issues/{iid}/notes and .../links); system notes
+// are skipped. See importIssues for how fields are mapped.
+func ImportGitLab(ctx context.Context, s IssueStore, path string, opts ImportOptions) (*ImportResult, error) {
+	var raw []gitlabIssue
+	if err := readExport(path, &raw); err != nil {
+		return nil, err
+	}
+	issues := make([]*externalIssue, 0, len(raw))
+	for _, gl := range raw {
+		issues = append(issues, gl.external())
+	}
+	return importIssues(ctx, s, issues, opts)
+}
+
+// readExport decodes an export file into v.
+func readExport(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("wongdb: import: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("wongdb: import %s: expected a JSON array of issues: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// importIssues writes issues to s in one Batch and updates the mapping
+// file. Issues already in the mapping are updated in place: their title,
+// description, labels, assignee, comments and timestamps are replaced,
+// while priority, notes and dependencies added in wong-db are kept. Closed
+// issues move to the workflow's close state and reopened ones to open; an
+// issue that stays open or closed keeps its wong-db status. The first
+// assignee becomes the assignee, and a "bug", "enhancement", "feature" or
+// "epic" label sets the issue type. "Blocked by #N" and "depends on #N" in
+// a description or comment, and the tracker's blocking links, become
+// blocking dependencies; other "#N" references become related ones. A
+// blocking link that would close a cycle becomes a related one and is
+// reported in ImportResult.Downgraded. References to issues that are
+// neither in the export nor in the mapping are dropped.
+func importIssues(ctx context.Context, s IssueStore, issues []*externalIssue, opts ImportOptions) (*ImportResult, error) {
+	ids, err := readIDMap(opts.MapFile)
+	if err != nil {
+		return nil, err
+	}
+	prefix := opts.Prefix
+	if prefix == "" {
+		if cfg, err := s.ReadConfig(ctx); err == nil {
+			prefix = cfg.Prefix
+		}
+	}
+	wf := configuredWorkflow(ctx, s)
+
+	byKey := make(map[string]*externalIssue, len(issues))
+	for _, ext := range issues {
+		byKey[ext.Key] = ext
+		ext.addTextRefs()
+	}
+	// Links recorded on the blocking side point the other way.
+	for _, ext := range issues {
+		for _, key := range ext.Blocks {
+			if blocked := byKey[key]; blocked != nil {
+				blocked.BlockedBy = append(blocked.BlockedBy, ext.Key)
+			}
+		}
+	}
+
+	// Mapped issues that are not in the store (deleted, or never committed
+	// by an import that failed after writing the map) are created again
+	// under their mapped IDs; any other failure to load one is an error.
+	stored, err := s.ListIssueIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: import: %w", err)
+	}
+	inStore := make(map[string]bool, len(stored))
+	for _, id := range stored {
+		inStore[id] = true
+	}
+
+	res := &ImportResult{}
+	err = Batch(ctx, s, func(tx *Tx) error {
+		existing := make(map[string]*types.Issue)
+		for _, ext := range issues {
+			if id, ok := ids[ext.Key]; ok {
+				if inStore[id] {
+					issue, err := tx.Load(id)
+					if err != nil {
+						return err
+					}
+					existing[ext.Key] = issue
+				}
+				continue
+			}
+			id := vcs.GenerateTaskID(prefix)
+			for tx.exists(id) || containsValue(ids, id) {
+				id = vcs.GenerateTaskID(prefix)
+			}
+			ids[ext.Key] = id
+		}
+
+		resolve := func(key string) (string, bool) {
+			id, ok := ids[key]
+			if !ok {
+				return "", false
+			}
+			return id, byKey[key] != nil || tx.exists(id)
+		}
+		imported := make([]*types.Issue, 0, len(issues))
+		for _, ext := range issues {
+			issue := existing[ext.Key]
+			if issue == nil {
+				issue = &types.Issue{ID: ids[ext.Key], Priority: 2}
+				res.Created = append(res.Created, issue.ID)
+			} else {
+				res.Updated = append(res.Updated, issue.ID)
+			}
+			ext.apply(issue, wf, resolve)
+			imported = append(imported, issue)
+		}
+		all, err := LoadAllIssues(ctx, s)
+		if err != nil {
+			return err
+		}
+		res.Downgraded = breakBlockingCycles(all, imported)
+		for _, issue := range imported {
+			if err := tx.Save(issue); err != nil {
+				return err
+			}
+		}
+		// Write the map before the issues, so that a commit that fails
+		// part-way can't leave issues the map doesn't know about, which a
+		// later import would duplicate.
+		tx.beforeCommit = func() error { return writeIDMap(opts.MapFile, ids) }
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: import: %w", err)
+	}
+	sort.Strings(res.Created)
+	sort.Strings(res.Updated)
+
+	if plan := vcs.PlanFromContext(ctx); plan != nil && opts.MapFile != "" {
+		plan.AddNote("write " + opts.MapFile)
+	}
+	return res, nil
+}
+
+// breakBlockingCycles turns blocking dependencies of imported issues into
+// related ones until no blocking cycle passes through an imported issue, and
+// returns the dependencies it changed. stored holds the store's issues; the
+// imported ones replace their stored versions.
+func breakBlockingCycles(stored []*types.Issue, imported []*types.Issue) []*types.Dependency {
+	all := make(map[string]*types.Issue, len(stored)+len(imported))
+	for _, issue := range stored {
+		all[issue.ID] = issue
+	}
+	start := make([]string, 0, len(imported))
+	for _, issue := range imported {
+		all[issue.ID] = issue
+		start = append(start, issue.ID)
+	}
+	isImported := make(map[string]bool, len(start))
+	for _, id := range start {
+		isImported[id] = true
+	}
+
+	var downgraded []*types.Dependency
+	for {
+		cycle := findBlockingCycle(all, start)
+		if cycle == nil {
+			return downgraded
+		}
+		// Every cycle found passes through an imported issue; drop the last
+		// link in it that the import owns, the one that closed the cycle.
+		for i := len(cycle) - 2; i >= 0; i-- {
+			if issue := all[cycle[i]]; isImported[issue.ID] {
+				downgraded = append(downgraded, downgradeBlocking(issue, cycle[i+1]))
+				break
+			}
+		}
+	}
+}
+
+// downgradeBlocking turns issue's blocking dependency on target into a
+// related one, or removes it if issue is already related to target, and
+// returns the dependency as it now reads.
+func downgradeBlocking(issue *types.Issue, target string) *types.Dependency {
+	blocking, related := -1, false
+	for i, dep := range issue.Dependencies {
+		if dep.DependsOnID != target {
+			continue
+		}
+		if isBlocking(dep) && blocking < 0 {
+			blocking = i
+		} else if dep.Type == types.DepRelated {
+			related = true
+		}
+	}
+	dep := issue.Dependencies[blocking]
+	if related {
+		issue.Dependencies = append(issue.Dependencies[:blocking], issue.Dependencies[blocking+1:]...)
+		dep = &types.Dependency{IssueID: dep.IssueID, DependsOnID: target, Type: types.DepRelated, CreatedAt: dep.CreatedAt}
+	} else {
+		dep.Type = types.DepRelated
+	}
+	return dep
+}
+
+// apply copies ext's fields onto issue. resolve maps a source key to the
+// wong-db ID of an issue that will exist after the import.
+func (ext *externalIssue) apply(issue *types.Issue, wf *Workflow, resolve func(key string) (string, bool)) {
+	issue.Title = ext.Title
+	issue.Description = ext.Body
+	issue.Labels = ext.Labels
+	issue.Assignee = ""
+	if len(ext.Assignees) > 0 {
+		issue.Assignee = ext.Assignees[0]
+	}
+	if issue.IssueType == "" {
+		issue.IssueType = types.TypeTask
+	}
+	for _, label := range ext.Labels {
+		if t, ok := labelTypes[strings.ToLower(label)]; ok {
+			issue.IssueType = t
+			break
+		}
+	}
+
+	issue.CreatedAt = ext.CreatedAt
+	issue.UpdatedAt = ext.UpdatedAt
+	if issue.UpdatedAt.IsZero() {
+		issue.UpdatedAt = time.Now()
+	}
+	switch {
+	case ext.Closed && (issue.Status == "" || !wf.IsDone(issue.Status)):
+		issue.Status = wf.CloseState()
+		issue.ClosedAt = ext.ClosedAt
+		issue.CloseReason = ext.Reason
+	case !ext.Closed && (issue.Status == "" || wf.IsDone(issue.Status)):
+		issue.Status = types.StatusOpen
+		issue.ClosedAt = nil
+		issue.CloseReason = ""
+	}
+
+	issue.Comments = nil
+	for i, c := range ext.Comments {
+		comment := *c
+		comment.ID = int64(i + 1)
+		comment.IssueID = issue.ID
+		issue.Comments = append(issue.Comments, &comment)
+	}
+
+	addDep := func(key string, depType types.DependencyType) {
+		target, ok := resolve(key)
+		if !ok || target == issue.ID {
+			return
+		}
+		for _, dep := range issue.Dependencies {
+			if dep.DependsOnID == target && (dep.Type == depType || isBlocking(dep)) {
+				return
+			}
+		}
+		issue.Dependencies = append(issue.Dependencies, &types.Dependency{
+			IssueID:     issue.ID,
+			DependsOnID: target,
+			Type:        depType,
+			CreatedAt:   ext.CreatedAt,
+		})
+	}
+	for _, key := range ext.BlockedBy {
+		addDep(key, types.DepBlocks)
+	}
+	for _, key := range ext.Related {
+		addDep(key, types.DepRelated)
+	}
+}
+
+// labelTypes maps lowercase labels to the issue types they imply.
+var labelTypes = map[string]types.IssueType{
+	"bug":         types.TypeBug,
+	"enhancement": types.TypeFeature,
+	"feature":     types.TypeFeature,
+	"epic":        types.TypeEpic,
+}
+
+var (
+	// issueRefPattern matches "#12", "acme/widgets#12" and, for GitLab
+	// subgroups, "group/sub/project#12".
+	issueRefPattern = regexp.MustCompile(`(?:^|[^\w/&.-])((?:[\w.-]+(?:/[\w.-]+)+)?)#(\d+)\b`)
+
+	// blockingRefPattern matches a blocking phrase and the references that
+	// follow it, e.g. "blocked by #3 and #4".
+	blockingRefPattern = regexp.MustCompile(`(?i)\b(?:blocked by|depends on):?((?:\s*(?:,|and)?\s*(?:[\w.-]+(?:/[\w.-]+)+)?#\d+\b)+)`)
+)
+
+// addTextRefs adds the issue references in ext's description and comments
+// to BlockedBy or Related.
+func (ext *externalIssue) addTextRefs() {
+	texts := []string{ext.Body}
+	for _, c := range ext.Comments {
+		texts = append(texts, c.Text)
+	}
+	source, _, _ := strings.Cut(ext.Key, ":")
+	blocking := make(map[string]bool)
+	for _, text := range texts {
+		for _, m := range blockingRefPattern.FindAllStringSubmatch(text, -1) {
+			for _, key := range ext.refKeys(source, " "+m[1]) {
+				blocking[key] = true
+				ext.BlockedBy = append(ext.BlockedBy, key)
+			}
+		}
+	}
+	for _, text := range texts {
+		for _, key := range ext.refKeys(source, text) {
+			if !blocking[key] && key != ext.Key {
+				ext.Related = append(ext.Related, key)
+			}
+		}
+	}
+}
+
+// refKeys returns the source keys of the issue references in text.
+// References without a repository are to ext's repository.
+func (ext *externalIssue) refKeys(source, text string) []string {
+	var keys []string
+	for _, m := range issueRefPattern.FindAllStringSubmatch(text, -1) {
+		repo := m[1]
+		if repo == "" {
+			repo = ext.Repo
+		}
+		keys = append(keys, sourceKey(source, repo, m[2]))
+	}
+	return keys
+}
+
+// sourceKey returns the mapping key of issue number in repo.
+func sourceKey(source, repo, number string) string {
+	return source + ":" + repo + "#" + number
+}
+
+// repoFromURL returns the repository path of an issue's web URL, e.g.
+// "acme/widgets" for https://github.com/acme/widgets/issues/12 and
+// "group/project" for https://gitlab.com/group/project/-/issues/12.
+func repoFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	p := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(p, "/issues/")
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimSuffix(p[:i], "/-")
+}
+
+// readIDMap reads the ID mapping file. A missing file is an empty mapping.
+func readIDMap(path string) (map[string]string, error) {
+	ids := make(map[string]string)
+	if path == "" {
+		return ids, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: import: read ID map: %w", err)
+	}
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, fmt.Errorf("wongdb: import: parse ID map %s: %w", path, err)
+	}
+	return ids, nil
+}
+
+// writeIDMap atomically replaces the ID mapping file.
+func writeIDMap(path string, ids map[string]string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(ids, "", "  ")
+	if err != nil {
+		return fmt.Errorf("wongdb: import: marshal ID map: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("wongdb: import: write ID map: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("wongdb: import: write ID map: %w", err)
+	}
+	return nil
+}
+
+func containsValue(m map[string]string, v string) bool {
+	for _, x := range m {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// exportUser is a user as GitHub ({"login": ...}) or GitLab
+// ({"username": ...}) exports it.
+type exportUser struct {
+	Login    string `json:"login"`
+	Username string `json:"username"`
+}
+
+func (u *exportUser) name() string {
+	if u == nil {
+		return ""
+	}
+	if u.Login != "" {
+		return u.Login
+	}
+	return u.Username
+}
+
+// exportLabels accepts labels as plain strings or as objects with a name.
+type exportLabels []string
+
+func (l *exportLabels) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for _, r := range raw {
+		var name string
+		if err := json.Unmarshal(r, &name); err != nil {
+			var obj struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(r, &obj); err != nil {
+				return err
+			}
+			name = obj.Name
+		}
+		if name != "" {
+			*l = append(*l, name)
+		}
+	}
+	return nil
+}
+
+// exportTime accepts either of two spellings of a timestamp field.
+func exportTime(a, b *time.Time) time.Time {
+	if a != nil && !a.IsZero() {
+		return *a
+	}
+	if b != nil {
+		return *b
+	}
+	return time.Time{}
+}
+
+// githubIssue is an issue in REST API (snake_case) or gh CLI (camelCase)
+// form.
+type githubIssue struct {
+	Number      int             `json:"number"`
+	Title       string          `json:"title"`
+	Body        string          `json:"body"`
+	State       string          `json:"state"`
+	StateReason string          `json:"state_reason"`
+	ReasonCamel string          `json:"stateReason"`
+	HTMLURL     string          `json:"html_url"`
+	URL         string          `json:"url"`
+	Labels      exportLabels    `json:"labels"`
+	Assignees   []exportUser    `json:"assignees"`
+	PullRequest json.RawMessage `json:"pull_request"`
+
+	CreatedAt      *time.Time `json:"created_at"`
+	CreatedAtCamel *time.Time `json:"createdAt"`
+	UpdatedAt      *time.Time `json:"updated_at"`
+	UpdatedAtCamel *time.Time `json:"updatedAt"`
+	ClosedAt       *time.Time `json:"closed_at"`
+	ClosedAtCamel  *time.Time `json:"closedAt"`
+
+	// Comments is a count in REST API exports and an array with gh.
+	Comments json.RawMessage `json:"comments"`
+}
+
+type githubComment struct {
+	User           *exportUser `json:"user"`
+	Author         *exportUser `json:"author"`
+	Body           string      `json:"body"`
+	CreatedAt      *time.Time  `json:"created_at"`
+	CreatedAtCamel *time.Time  `json:"createdAt"`
+}
+
+func (gh *githubIssue) external() *externalIssue {
+	webURL := gh.HTMLURL
+	if webURL == "" {
+		webURL = gh.URL
+	}
+	repo := repoFromURL(webURL)
+	ext := &externalIssue{
+		Key:       sourceKey("github", repo, strconv.Itoa(gh.Number)),
+		Repo:      repo,
+		Title:     gh.Title,
+		Body:      gh.Body,
+		Closed:    strings.EqualFold(gh.State, "closed"),
+		Reason:    strings.ToLower(gh.StateReason + gh.ReasonCamel),
+		Labels:    gh.Labels,
+		CreatedAt: exportTime(gh.CreatedAt, gh.CreatedAtCamel),
+		UpdatedAt: exportTime(gh.UpdatedAt, gh.UpdatedAtCamel),
+	}
+	if closed := exportTime(gh.ClosedAt, gh.ClosedAtCamel); ext.Closed && !closed.IsZero() {
+		ext.ClosedAt = &closed
+	}
+	for _, u := range gh.Assignees {
+		ext.Assignees = append(ext.Assignees, u.name())
+	}
+	var comments []githubComment
+	if json.Unmarshal(gh.Comments, &comments) == nil {
+		for _, c := range comments {
+			author := c.User
+			if author == nil {
+				author = c.Author
+			}
+			ext.Comments = append(ext.Comments, &types.Comment{
+				Author:    author.name(),
+				Text:      c.Body,
+				CreatedAt: exportTime(c.CreatedAt, c.CreatedAtCamel),
+			})
+		}
+	}
+	return ext
+}
+
+// gitlabIssue is an issue from the GitLab REST API, optionally with its
+// notes and links.
+type gitlabIssue struct {
+	IID         int          `json:"iid"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	State       string       `json:"state"`
+	WebURL      string       `json:"web_url"`
+	Labels      exportLabels `json:"labels"`
+	Assignees   []exportUser `json:"assignees"`
+	CreatedAt   *time.Time   `json:"created_at"`
+	UpdatedAt   *time.Time   `json:"updated_at"`
+	ClosedAt    *time.Time   `json:"closed_at"`
+
+	Notes []struct {
+		Author    *exportUser `json:"author"`
+		Body      string      `json:"body"`
+		System    bool        `json:"system"`
+		CreatedAt *time.Time  `json:"created_at"`
+	} `json:"notes"`
+
+	Links []struct {
+		IID      int    `json:"iid"`
+		WebURL   string `json:"web_url"`
+		LinkType string `json:"link_type"`
+	} `json:"links"`
+}
+
+func (gl *gitlabIssue) external() *externalIssue {
+	repo := repoFromURL(gl.WebURL)
+	ext := &externalIssue{
+		Key:       sourceKey("gitlab", repo, strconv.Itoa(gl.IID)),
+		Repo:      repo,
+		Title:     gl.Title,
+		Body:      gl.Description,
+		Closed:    gl.State == "closed",
+		Labels:    gl.Labels,
+		CreatedAt: exportTime(gl.CreatedAt, nil),
+		UpdatedAt: exportTime(gl.UpdatedAt, nil),
+	}
+	if gl.ClosedAt != nil && ext.Closed {
+		ext.ClosedAt = gl.ClosedAt
+	}
+	for _, u := range gl.Assignees {
+		ext.Assignees = append(ext.Assignees, u.name())
+	}
+	for _, n := range gl.Notes {
+		if n.System {
+			continue
+		}
+		ext.Comments = append(ext.Comments, &types.Comment{
+			Author:    n.Author.name(),
+			Text:      n.Body,
+			CreatedAt: exportTime(n.CreatedAt, nil),
+		})
+	}
+	for _, l := range gl.Links {
+		linkRepo := repoFromURL(l.WebURL)
+		if linkRepo == "" {
+			linkRepo = repo
+		}
+		key := sourceKey("gitlab", linkRepo, strconv.Itoa(l.IID))
+		switch l.LinkType {
+		case "is_blocked_by":
+			ext.BlockedBy = append(ext.BlockedBy, key)
+		case "blocks":
+			ext.Blocks = append(ext.Blocks, key)
+		default:
+			ext.Related = append(ext.Related, key)
+		}
+	}
+	return ext
+}
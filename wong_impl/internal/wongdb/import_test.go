@@ -0,0 +1,368 @@
+package wongdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/types"
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+// importedIssue loads the issue a source key was imported as.
+func importedIssue(t *testing.T, s IssueStore, mapFile, key string) *types.Issue {
+	t.Helper()
+	ids, err := readIDMap(mapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, ok := ids[key]
+	if !ok {
+		t.Fatalf("%s not in ID map %v", key, ids)
+	}
+	issue, err := LoadIssue(context.Background(), s, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issue
+}
+
+// depsOf renders an issue's dependencies as "type:id" pairs.
+func depsOf(issue *types.Issue) string {
+	var deps []string
+	for _, dep := range issue.Dependencies {
+		deps = append(deps, string(dep.Type)+":"+dep.DependsOnID)
+	}
+	return strings.Join(deps, " ")
+}
+
+func TestImportGitHub(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStoreWith(t)
+	s.SetConfig(Config{Prefix: "gh", HistoryMode: "squash"})
+	mapFile := filepath.Join(t.TempDir(), "import-map.json")
+	opts := ImportOptions{MapFile: mapFile}
+
+	res, err := ImportGitHub(ctx, s, filepath.Join("testdata", "import", "github.json"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Created) != 3 || len(res.Updated) != 0 || res.Skipped != 1 {
+		t.Fatalf("result = %+v", res)
+	}
+	for _, id := range res.Created {
+		if !strings.HasPrefix(id, "gh-") {
+			t.Errorf("new ID %s lacks the store prefix", id)
+		}
+	}
+
+	ci := importedIssue(t, s, mapFile, "github:acme/widgets#1")
+	if ci.Status != types.StatusClosed || ci.CloseReason != "completed" || ci.ClosedAt == nil ||
+		ci.Assignee != "alice" || ci.IssueType != types.TypeTask || ci.Title != "Set up CI" {
+		t.Errorf("issue #1 = %+v", ci)
+	}
+	docs := importedIssue(t, s, mapFile, "github:acme/widgets#3")
+	if docs.IssueType != types.TypeFeature || strings.Join(docs.Labels, ",") != "enhancement,docs" {
+		t.Errorf("issue #3 = %+v", docs)
+	}
+	crash := importedIssue(t, s, mapFile, "github:acme/widgets#2")
+	if crash.IssueType != types.TypeBug || crash.Status != types.StatusOpen || crash.Priority != 2 {
+		t.Errorf("issue #2 = %+v", crash)
+	}
+	// #4 is a pull request and other/repo#9 was not imported.
+	if got, want := depsOf(crash), "blocks:"+ci.ID+" blocks:"+docs.ID; got != want {
+		t.Errorf("issue #2 deps = %q, want %q", got, want)
+	}
+
+	// A second export resolves references through the mapping file.
+	if _, err := ImportGitHub(ctx, s, filepath.Join("testdata", "import", "gh.json"), opts); err != nil {
+		t.Fatal(err)
+	}
+	release := importedIssue(t, s, mapFile, "github:acme/widgets#5")
+	if release.IssueType != types.TypeEpic || release.Assignee != "dave" || release.CreatedAt.IsZero() {
+		t.Errorf("issue #5 = %+v", release)
+	}
+	if got := depsOf(release); got != "blocks:"+crash.ID {
+		t.Errorf("issue #5 deps = %q", got)
+	}
+	if len(release.Comments) != 2 || release.Comments[0].Author != "erin" || release.Comments[1].ID != 2 ||
+		release.Comments[1].IssueID != release.ID {
+		t.Errorf("issue #5 comments = %+v", release.Comments)
+	}
+}
+
+func TestImportGitHub_Reimport(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStoreWith(t)
+	mapFile := filepath.Join(t.TempDir(), "import-map.json")
+	opts := ImportOptions{MapFile: mapFile}
+	export := filepath.Join("testdata", "import", "github.json")
+
+	first, err := ImportGitHub(ctx, s, export, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Local edits that the tracker does not know about.
+	docs := importedIssue(t, s, mapFile, "github:acme/widgets#3")
+	docs.Priority = 0
+	docs.Notes = "triaged"
+	docs.Status = types.StatusInProgress
+	if err := SaveIssue(ctx, s, docs); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(data), `"title": "Write docs"`, `"title": "Write the docs"`, 1)
+	edited = strings.Replace(edited, `"state": "closed"`, `"state": "open"`, 1)
+	updatedExport := filepath.Join(t.TempDir(), "github.json")
+	if err := os.WriteFile(updatedExport, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := ImportGitHub(ctx, s, updatedExport, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Created) != 0 || strings.Join(second.Updated, " ") != strings.Join(first.Created, " ") {
+		t.Errorf("re-import = %+v, first import = %+v", second, first)
+	}
+	if ids, _ := s.ListIssueIDs(ctx); len(ids) != 3 {
+		t.Errorf("store has %d issues after re-import, want 3", len(ids))
+	}
+
+	docs = importedIssue(t, s, mapFile, "github:acme/widgets#3")
+	if docs.Title != "Write the docs" || docs.Priority != 0 || docs.Notes != "triaged" ||
+		docs.Status != types.StatusInProgress {
+		t.Errorf("re-imported issue #3 = %+v", docs)
+	}
+	crash := importedIssue(t, s, mapFile, "github:acme/widgets#2")
+	if len(crash.Dependencies) != 2 {
+		t.Errorf("re-import duplicated dependencies: %q", depsOf(crash))
+	}
+	ci := importedIssue(t, s, mapFile, "github:acme/widgets#1")
+	if ci.Status != types.StatusOpen || ci.ClosedAt != nil || ci.CloseReason != "" {
+		t.Errorf("reopened issue #1 = %+v", ci)
+	}
+}
+
+func TestImportGitLab(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStoreWith(t)
+	mapFile := filepath.Join(t.TempDir(), "import-map.json")
+
+	res, err := ImportGitLab(ctx, s, filepath.Join("testdata", "import", "gitlab.json"), ImportOptions{MapFile: mapFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Created) != 4 {
+		t.Fatalf("result = %+v", res)
+	}
+
+	key := func(iid string) string { return sourceKey("gitlab", "group/sub/proj", iid) }
+	migrate := importedIssue(t, s, mapFile, key("1"))
+	plan := importedIssue(t, s, mapFile, key("2"))
+	backup := importedIssue(t, s, mapFile, key("3"))
+	traffic := importedIssue(t, s, mapFile, key("4"))
+
+	if migrate.IssueType != types.TypeEpic || migrate.Assignee != "frank" {
+		t.Errorf("issue 1 = %+v", migrate)
+	}
+	if len(migrate.Comments) != 1 || migrate.Comments[0].Author != "grace" {
+		t.Errorf("issue 1 comments = %+v", migrate.Comments)
+	}
+	if got, want := depsOf(migrate), "blocks:"+backup.ID+" related:"+plan.ID; got != want {
+		t.Errorf("issue 1 deps = %q, want %q", got, want)
+	}
+	if plan.Status != types.StatusClosed || plan.ClosedAt == nil {
+		t.Errorf("issue 2 = %+v", plan)
+	}
+	// "blocks" links are recorded on the blocked issue.
+	if got := depsOf(traffic); got != "blocks:"+backup.ID {
+		t.Errorf("issue 4 deps = %q", got)
+	}
+
+	ready, err := ReadyIssues(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := issueIDs(ready), issueIDs([]*types.Issue{backup}); got != want {
+		t.Errorf("ready after import = %q, want %q", got, want)
+	}
+}
+
+func TestImport_AllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	export := filepath.Join(dir, "untitled.json")
+	// An issue without a title is invalid, so neither issue is imported.
+	err := os.WriteFile(export, []byte(`[
+		{"number": 1, "title": "A", "body": "blocked by #2", "state": "open", "html_url": "https://github.com/acme/widgets/issues/1"},
+		{"number": 2, "title": "", "body": "", "state": "open", "html_url": "https://github.com/acme/widgets/issues/2"}
+	]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newMemStoreWith(t)
+	mapFile := filepath.Join(dir, "import-map.json")
+	if _, err := ImportGitHub(ctx, s, export, ImportOptions{MapFile: mapFile}); !errors.Is(err, ErrInvalidIssue) {
+		t.Fatalf("import of an untitled issue = %v, want ErrInvalidIssue", err)
+	}
+	if ids, _ := s.ListIssueIDs(ctx); len(ids) != 0 {
+		t.Errorf("failed import wrote %v", ids)
+	}
+	if _, err := os.Stat(mapFile); !os.IsNotExist(err) {
+		t.Errorf("failed import wrote the ID map: %v", err)
+	}
+
+	// In plan mode nothing is written either, but the map file is noted.
+	plan := &vcs.Plan{}
+	res, err := ImportGitHub(vcs.WithPlan(ctx, plan), s, filepath.Join("testdata", "import", "github.json"), ImportOptions{MapFile: mapFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Created) != 3 {
+		t.Errorf("planned result = %+v", res)
+	}
+	if ids, _ := s.ListIssueIDs(ctx); len(ids) != 0 {
+		t.Errorf("planned import wrote %v", ids)
+	}
+	if _, err := os.Stat(mapFile); !os.IsNotExist(err) {
+		t.Errorf("planned import wrote the ID map: %v", err)
+	}
+	if !strings.Contains(plan.String(), "write "+mapFile) {
+		t.Errorf("plan = %s", plan)
+	}
+}
+
+func TestImport_BreaksBlockingCycles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	export := filepath.Join(dir, "cycle.json")
+	// Two issues blocked by each other could never become ready.
+	err := os.WriteFile(export, []byte(`[
+		{"number": 1, "title": "A", "body": "blocked by #2", "state": "open", "html_url": "https://github.com/acme/widgets/issues/1"},
+		{"number": 2, "title": "B", "body": "blocked by #1", "state": "open", "html_url": "https://github.com/acme/widgets/issues/2"}
+	]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newMemStoreWith(t)
+	mapFile := filepath.Join(dir, "import-map.json")
+	opts := ImportOptions{MapFile: mapFile}
+
+	// Importing twice must not pile up links.
+	for run := 1; run <= 2; run++ {
+		res, err := ImportGitHub(ctx, s, export, opts)
+		if err != nil {
+			t.Fatalf("import %d: %v", run, err)
+		}
+		a := importedIssue(t, s, mapFile, "github:acme/widgets#1")
+		b := importedIssue(t, s, mapFile, "github:acme/widgets#2")
+		if len(res.Downgraded) != 1 || res.Downgraded[0].IssueID != b.ID || res.Downgraded[0].DependsOnID != a.ID {
+			t.Fatalf("import %d: Downgraded = %+v, want B's link to A", run, res.Downgraded)
+		}
+		if got, want := depsOf(a), "blocks:"+b.ID; got != want {
+			t.Errorf("import %d: A deps = %q, want %q", run, got, want)
+		}
+		if got, want := depsOf(b), "related:"+a.ID; got != want {
+			t.Errorf("import %d: B deps = %q, want %q", run, got, want)
+		}
+	}
+}
+
+func TestImport_MapWrittenBeforeCommit(t *testing.T) {
+	ctx := context.Background()
+	mapFile := filepath.Join(t.TempDir(), "import-map.json")
+	opts := ImportOptions{MapFile: mapFile}
+	export := filepath.Join("testdata", "import", "github.json")
+
+	// The commit fails on a store that was never initialized, after the
+	// map has been written.
+	s := NewMemStore()
+	if _, err := ImportGitHub(ctx, s, export, opts); err == nil {
+		t.Fatal("import into an uninitialized store succeeded")
+	}
+	mapped, err := readIDMap(mapFile)
+	if err != nil || len(mapped) != 3 {
+		t.Fatalf("ID map after the failed commit = %v, %v; want 3 entries", mapped, err)
+	}
+
+	// Importing again creates the issues under the IDs the map recorded.
+	if err := s.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ImportGitHub(ctx, s, export, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Created) != 3 || len(res.Updated) != 0 {
+		t.Errorf("retried import = %+v", res)
+	}
+	for key, id := range mapped {
+		if issue := importedIssue(t, s, mapFile, key); issue.ID != id {
+			t.Errorf("%s imported as %s, want the mapped %s", key, issue.ID, id)
+		}
+	}
+}
+
+// unreadableStore is an IssueStore whose issues are listed but can't be
+// read, like a repository whose VCS commands are failing.
+type unreadableStore struct {
+	IssueStore
+}
+
+func (s unreadableStore) ReadIssue(ctx context.Context, id string) ([]byte, error) {
+	return nil, fmt.Errorf("read %s: %w", id, vcs.ErrCommandTimeout)
+}
+
+func TestImport_LoadErrorIsReturned(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStoreWith(t)
+	mapFile := filepath.Join(t.TempDir(), "import-map.json")
+	opts := ImportOptions{MapFile: mapFile}
+	export := filepath.Join("testdata", "import", "github.json")
+	if _, err := ImportGitHub(ctx, s, export, opts); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(mapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ImportGitHub(ctx, unreadableStore{s}, export, opts)
+	if !errors.Is(err, vcs.ErrCommandTimeout) {
+		t.Fatalf("re-import with unreadable issues error = %v, want the read error", err)
+	}
+	if ids, _ := s.ListIssueIDs(ctx); len(ids) != 3 {
+		t.Errorf("store has %d issues after the failed re-import, want 3", len(ids))
+	}
+	if after, _ := os.ReadFile(mapFile); string(after) != string(before) {
+		t.Errorf("failed re-import rewrote the ID map:\n%s", after)
+	}
+}
+
+func TestParseIssueTextRefs(t *testing.T) {
+	ext := &externalIssue{
+		Key:  "github:acme/widgets#1",
+		Repo: "acme/widgets",
+		Body: "Depends on #2, #3 and acme/other#4. Mentioned in #5, not in https://example.com/page#6 or &#39;, see #1.",
+	}
+	ext.addTextRefs()
+	data, _ := json.Marshal([][]string{ext.BlockedBy, ext.Related})
+	want := `[["github:acme/widgets#2","github:acme/widgets#3","github:acme/other#4"],["github:acme/widgets#5"]]`
+	if string(data) != want {
+		t.Errorf("refs = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,208 @@
+package wongdb
+
+// Links associates jj changes with wong-db issues via description trailers
+// such as "Wong: bt-3".
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+const (
+	// wongTrailerKey is the description trailer key that links a change to issues.
+	// Example description line: "Wong: bt-3, bt-4"
+	wongTrailerKey = "Wong"
+
+	// linkedChangesRevset selects every visible change that mentions the trailer key.
+	// Descriptions are re-parsed afterwards, so this only needs to be a superset.
+	linkedChangesRevset = `description(substring:"` + wongTrailerKey + `:")`
+
+	// linkRecordSep separates records in linked-change log output. Descriptions
+	// can span multiple lines, so a newline can't be used as the separator.
+	linkRecordSep = "\x1e"
+)
+
+// ChangeLink describes a jj change that references an issue.
+type ChangeLink struct {
+	IssueID  string
+	ChangeID string
+	ShortID  string
+	// Description is the first line of the change description.
+	Description string
+}
+
+// FormatIssueTrailer returns a description trailer linking a change to the given issues.
+// The result can be appended to a change description, e.g. "Wong: bt-3, bt-4".
+func FormatIssueTrailer(ids ...string) string {
+	return wongTrailerKey + ": " + strings.Join(ids, ", ")
+}
+
+// ParseIssueRefs extracts issue IDs from "Wong:" trailer lines in a change description.
+// A line may list several IDs separated by commas or whitespace. IDs are returned
+// in order of first appearance without duplicates.
+func ParseIssueRefs(description string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(description, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || strings.TrimSpace(key) != wongTrailerKey {
+			continue
+		}
+		fields := strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		for _, id := range fields {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// LinkedChanges returns the jj changes whose descriptions reference the given issue.
+func (db *WongDB) LinkedChanges(ctx context.Context, id string) ([]ChangeLink, error) {
+	all, err := db.allChangeLinks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: linked changes for %s: %w", id, err)
+	}
+
+	var links []ChangeLink
+	for _, link := range all {
+		if link.IssueID == id {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+// IssuesForChange returns the issue IDs referenced by a change's description.
+func (db *WongDB) IssuesForChange(ctx context.Context, changeID string) ([]string, error) {
+	caps, err := db.dialect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: issues for change %s: %w", changeID, err)
+	}
+	rev, err := caps.Revision(changeID)
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: issues for change %s: %w", changeID, err)
+	}
+	output, err := db.runJJ(ctx, "log", "-r", rev, "--no-graph", "-T", "description")
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: issues for change %s: %w", changeID, err)
+	}
+	return ParseIssueRefs(output), nil
+}
+
+// CloseLandedIssues closes every open issue whose linked change is an ancestor of
+// trunk. If trunk is empty, jj's trunk() revset is used. Issues are moved to the
+// workflow's close state through its transition rules and hooks; those the
+// workflow won't close are skipped. All closures are written and synced
+// together; the IDs of the closed issues are returned.
+func (db *WongDB) CloseLandedIssues(ctx context.Context, trunk string) ([]string, error) {
+	if trunk == "" {
+		trunk = "trunk()"
+	}
+
+	links, err := db.allChangeLinks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: close landed issues: %w", err)
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	jj, err := vcs.NewJujutsuVCSWithRunner(db.repoRoot, db.runner)
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: close landed issues: %w", err)
+	}
+
+	wf := configuredWorkflow(ctx, db)
+	var closed []string
+	done := make(map[string]bool)
+	for _, link := range links {
+		if done[link.IssueID] {
+			continue
+		}
+		landed, err := jj.IsAncestor(ctx, link.ChangeID, trunk)
+		if err != nil {
+			return closed, fmt.Errorf("wongdb: close landed issues: %w", err)
+		}
+		if !landed {
+			continue
+		}
+		done[link.IssueID] = true
+
+		issue, err := db.LoadIssue(ctx, link.IssueID)
+		if err != nil {
+			// The trailer may reference an issue that doesn't exist (typo,
+			// deleted issue); that shouldn't block closing the others.
+			continue
+		}
+		if wf.IsDone(issue.Status) || wf.IsHeld(issue.Status) {
+			continue
+		}
+
+		reason := fmt.Sprintf("landed in %s via change %s", trunk, link.ShortID)
+		if err := wf.Apply(ctx, db, issue, wf.CloseState(), reason); err != nil {
+			// The workflow doesn't allow closing from this state (e.g. an
+			// unreviewed issue); leave it for a person to move along.
+			if errors.Is(err, ErrTransitionNotAllowed) || errors.Is(err, ErrTransitionRejected) {
+				continue
+			}
+			return closed, fmt.Errorf("wongdb: close landed issues: %w", err)
+		}
+		if err := db.SaveIssue(ctx, issue); err != nil {
+			return closed, fmt.Errorf("wongdb: close landed issues: %w", err)
+		}
+		closed = append(closed, issue.ID)
+	}
+
+	if len(closed) == 0 {
+		return nil, nil
+	}
+	if err := db.Sync(ctx); err != nil {
+		return closed, fmt.Errorf("wongdb: close landed issues sync: %w", err)
+	}
+	return closed, nil
+}
+
+// allChangeLinks scans visible changes for "Wong:" trailers and returns one
+// ChangeLink per (change, issue) pair.
+func (db *WongDB) allChangeLinks(ctx context.Context) ([]ChangeLink, error) {
+	template := `change_id ++ "\x00" ++ change_id.short() ++ "\x00" ++ description ++ "` + linkRecordSep + `"`
+	output, err := db.runJJ(ctx, "log", "-r", linkedChangesRevset, "--no-graph", "-T", template)
+	if err != nil {
+		return nil, err
+	}
+	return parseChangeLinks(output), nil
+}
+
+// parseChangeLinks parses records produced by the allChangeLinks template.
+func parseChangeLinks(output string) []ChangeLink {
+	var links []ChangeLink
+	for _, record := range strings.Split(output, linkRecordSep) {
+		record = strings.TrimLeft(record, "\n")
+		if record == "" {
+			continue
+		}
+		parts := strings.SplitN(record, "\x00", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		firstLine, _, _ := strings.Cut(parts[2], "\n")
+		for _, id := range ParseIssueRefs(parts[2]) {
+			links = append(links, ChangeLink{
+				IssueID:     id,
+				ChangeID:    parts[0],
+				ShortID:     parts[1],
+				Description: firstLine,
+			})
+		}
+	}
+	return links
+}
@@ -0,0 +1,184 @@
+package wongdb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/types"
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+func TestParseIssueRefs(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		want        []string
+	}{
+		{"no trailer", "Fix the parser\n\nSome details.", nil},
+		{"single trailer", "Fix the parser\n\nWong: bt-3", []string{"bt-3"}},
+		{"comma list", "Fix\n\nWong: bt-3, bt-4", []string{"bt-3", "bt-4"}},
+		{"multiple lines", "Fix\n\nWong: bt-3\nWong: bt-5", []string{"bt-3", "bt-5"}},
+		{"duplicates", "Wong: bt-3\nWong: bt-3 bt-4", []string{"bt-3", "bt-4"}},
+		{"first line tag", "Wong: bt-7", []string{"bt-7"}},
+		{"indented", "Fix\n   Wong:   bt-8  ", []string{"bt-8"}},
+		{"other key", "Fix\n\nWong-DB: bt-9\nwong: bt-10", nil},
+		{"wong-db description", "wong-db: issue tracker storage", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseIssueRefs(tt.description)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseIssueRefs(%q) = %v, want %v", tt.description, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatIssueTrailer_RoundTrip(t *testing.T) {
+	trailer := FormatIssueTrailer("bt-1", "bt-2")
+	if trailer != "Wong: bt-1, bt-2" {
+		t.Errorf("FormatIssueTrailer = %q", trailer)
+	}
+	got := ParseIssueRefs("Some change\n\n" + trailer)
+	if !reflect.DeepEqual(got, []string{"bt-1", "bt-2"}) {
+		t.Errorf("round trip = %v", got)
+	}
+}
+
+func TestParseChangeLinks(t *testing.T) {
+	output := "aaaa\x00aa\x00Add tracker\n\nWong: bt-1, bt-2\n" + linkRecordSep +
+		"bbbb\x00bb\x00Fix tracker\n\nWong: bt-2\n" + linkRecordSep
+
+	links := parseChangeLinks(output)
+	want := []ChangeLink{
+		{IssueID: "bt-1", ChangeID: "aaaa", ShortID: "aa", Description: "Add tracker"},
+		{IssueID: "bt-2", ChangeID: "aaaa", ShortID: "aa", Description: "Add tracker"},
+		{IssueID: "bt-2", ChangeID: "bbbb", ShortID: "bb", Description: "Fix tracker"},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("parseChangeLinks = %+v, want %+v", links, want)
+	}
+}
+
+func TestWongDB_LinkedChanges(t *testing.T) {
+	dir := setupJJRepo(t)
+	db := newTestDB(t, dir)
+	ctx := context.Background()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := db.SaveIssue(ctx, makeTestIssue("link-1", "Linked issue")); err != nil {
+		t.Fatalf("SaveIssue failed: %v", err)
+	}
+	if err := db.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	runJJ(t, dir, "describe", "-m", "Implement link-1\n\n"+FormatIssueTrailer("link-1"))
+	changeID := runJJ(t, dir, "log", "-r", "@", "--no-graph", "-T", "change_id")
+
+	links, err := db.LinkedChanges(ctx, "link-1")
+	if err != nil {
+		t.Fatalf("LinkedChanges failed: %v", err)
+	}
+	if len(links) != 1 || links[0].ChangeID != changeID {
+		t.Fatalf("expected one link to %s, got %+v", changeID, links)
+	}
+	if links[0].Description != "Implement link-1" {
+		t.Errorf("expected first-line description, got %q", links[0].Description)
+	}
+
+	ids, err := db.IssuesForChange(ctx, changeID)
+	if err != nil {
+		t.Fatalf("IssuesForChange failed: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"link-1"}) {
+		t.Errorf("IssuesForChange = %v, want [link-1]", ids)
+	}
+}
+
+// TestWongDB_IssuesForChangeQuotesRevision verifies that the change ID is
+// passed to jj as a single revision rather than as revset syntax.
+func TestWongDB_IssuesForChangeQuotesRevision(t *testing.T) {
+	transcript := &vcs.Transcript{Entries: []vcs.TranscriptEntry{
+		{Bin: "jj", Args: []string{"--version"}, Stdout: "jj 0.28.0\n"},
+		{Bin: "jj", Args: []string{"log", "-r", `change_id("kxyzkxyzkxyz")`, "--no-graph", "-T", "description"}, Stdout: "Fix\n\nWong: bt-1\n"},
+		{Bin: "jj", Args: []string{"log", "-r", `"main|all()"`, "--no-graph", "-T", "description"}, Stdout: "Other\n"},
+	}}
+	db := New(t.TempDir())
+	db.SetRunner(&vcs.Runner{Replay: transcript})
+	ctx := context.Background()
+
+	ids, err := db.IssuesForChange(ctx, "kxyzkxyzkxyz")
+	if err != nil || !reflect.DeepEqual(ids, []string{"bt-1"}) {
+		t.Errorf("IssuesForChange(change ID) = %v, %v; want [bt-1]", ids, err)
+	}
+	if ids, err := db.IssuesForChange(ctx, "main|all()"); err != nil || len(ids) != 0 {
+		t.Errorf("IssuesForChange(main|all()) = %v, %v; want none", ids, err)
+	}
+	if _, err := db.IssuesForChange(ctx, ""); err == nil {
+		t.Error("IssuesForChange(\"\") succeeded, want an invalid revision error")
+	}
+	if unused := transcript.Unused(); len(unused) != 0 {
+		t.Errorf("unused transcript entries: %+v", unused)
+	}
+}
+
+func TestWongDB_CloseLandedIssues(t *testing.T) {
+	dir := setupJJRepo(t)
+	db := newTestDB(t, dir)
+	ctx := context.Background()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	for _, id := range []string{"land-1", "land-2"} {
+		if err := db.SaveIssue(ctx, makeTestIssue(id, "Issue "+id)); err != nil {
+			t.Fatalf("SaveIssue(%s) failed: %v", id, err)
+		}
+	}
+	if err := db.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	// land-1's change gets the trunk bookmark; land-2's change sits above it.
+	runJJ(t, dir, "describe", "-m", "Land it\n\n"+FormatIssueTrailer("land-1"))
+	runJJ(t, dir, "bookmark", "create", "main", "-r", "@")
+	runJJ(t, dir, "new", "-m", "Not yet\n\n"+FormatIssueTrailer("land-2"))
+
+	closed, err := db.CloseLandedIssues(ctx, "main")
+	if err != nil {
+		t.Fatalf("CloseLandedIssues failed: %v", err)
+	}
+	if !reflect.DeepEqual(closed, []string{"land-1"}) {
+		t.Fatalf("closed = %v, want [land-1]", closed)
+	}
+
+	landed, err := db.LoadIssue(ctx, "land-1")
+	if err != nil {
+		t.Fatalf("LoadIssue(land-1) failed: %v", err)
+	}
+	if landed.Status != types.StatusClosed || landed.ClosedAt == nil {
+		t.Errorf("expected land-1 closed with ClosedAt, got status=%s closedAt=%v", landed.Status, landed.ClosedAt)
+	}
+
+	pending, err := db.LoadIssue(ctx, "land-2")
+	if err != nil {
+		t.Fatalf("LoadIssue(land-2) failed: %v", err)
+	}
+	if pending.Status != types.StatusOpen {
+		t.Errorf("expected land-2 still open, got %s", pending.Status)
+	}
+
+	// Running again is a no-op.
+	closed, err = db.CloseLandedIssues(ctx, "main")
+	if err != nil {
+		t.Fatalf("second CloseLandedIssues failed: %v", err)
+	}
+	if len(closed) != 0 {
+		t.Errorf("expected no further closures, got %v", closed)
+	}
+}
@@ -0,0 +1,169 @@
+package wongdb
+
+// MemStore keeps wong-db in memory. It has no repository and no remote, so
+// issue operations, readiness and queries can be tested without jj or git.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// MemStore is an IssueStore backed by maps. It is safe for concurrent use.
+type MemStore struct {
+	staged stagedIssues
+
+	// mu protects the committed state below.
+	mu          sync.Mutex
+	initialized bool
+	config      Config
+	issues      map[string][]byte
+}
+
+// NewMemStore creates an empty, uninitialized MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{issues: make(map[string][]byte)}
+}
+
+// Init initializes the store with the default config. It does nothing if
+// the store is already initialized.
+func (s *MemStore) Init(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.initialized {
+		s.initialized = true
+		s.config = Config{Prefix: "", HistoryMode: "squash"}
+	}
+	return nil
+}
+
+// SetConfig replaces the config, initializing the store if needed.
+func (s *MemStore) SetConfig(cfg Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initialized = true
+	s.config = cfg
+}
+
+// IsInitialized reports whether Init has been called.
+func (s *MemStore) IsInitialized(ctx context.Context) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.initialized
+}
+
+// ReadIssue returns a copy of a synced issue's raw JSON bytes.
+func (s *MemStore) ReadIssue(ctx context.Context, id string) ([]byte, error) {
+	if err := validateIssueID(id); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.issues[id]
+	if !ok {
+		return nil, fmt.Errorf("wongdb: failed to read issue %s: %w", id, os.ErrNotExist)
+	}
+	return append([]byte{}, data...), nil
+}
+
+// ListIssueIDs returns the IDs of all synced issues in sorted order.
+func (s *MemStore) ListIssueIDs(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.issues))
+	for id := range s.issues {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// WriteIssue stages an issue's raw JSON data until Sync.
+func (s *MemStore) WriteIssue(ctx context.Context, id string, data []byte) error {
+	if err := validateIssueID(id); err != nil {
+		return err
+	}
+	s.staged.write(id, data)
+	return nil
+}
+
+// DeleteIssue stages the removal of an issue until Sync.
+func (s *MemStore) DeleteIssue(ctx context.Context, id string) error {
+	if err := validateIssueID(id); err != nil {
+		return err
+	}
+	return s.staged.remove(id, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_, ok := s.issues[id]
+		return ok
+	})
+}
+
+// stagedIssue returns the data staged for id by WriteIssue or DeleteIssue.
+func (s *MemStore) stagedIssue(id string) ([]byte, bool) {
+	return s.staged.get(id)
+}
+
+// ReadConfig returns a copy of the config set by Init.
+func (s *MemStore) ReadConfig(ctx context.Context) (*Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.initialized {
+		return nil, fmt.Errorf("wongdb: failed to read config: store not initialized")
+	}
+	cfg := s.config
+	return &cfg, nil
+}
+
+// Sync applies the staged writes and deletes, or none of them if one breaks
+// the schema. In plan mode they are recorded in the plan and stay staged.
+func (s *MemStore) Sync(ctx context.Context) error {
+	if !s.IsInitialized(ctx) {
+		return fmt.Errorf("wongdb: sync failed: store not initialized; run Init first")
+	}
+	pending := s.staged.take(ctx)
+	if err := validatePending(ctx, s, pending); err != nil {
+		s.staged.restore(pending)
+		return fmt.Errorf("wongdb: sync failed: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, data := range pending {
+		if data == nil {
+			delete(s.issues, id)
+		} else {
+			s.issues[id] = data
+		}
+	}
+	return nil
+}
+
+// commitBatch applies a batch directly, leaving staged writes pending.
+func (s *MemStore) commitBatch(ctx context.Context, changes map[string][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.initialized {
+		return fmt.Errorf("wongdb: store not initialized; run Init first")
+	}
+	for id, data := range changes {
+		if data == nil {
+			delete(s.issues, id)
+		} else {
+			s.issues[id] = data
+		}
+	}
+	return nil
+}
+
+// Push syncs; a MemStore has no remote.
+func (s *MemStore) Push(ctx context.Context) error {
+	return s.Sync(ctx)
+}
+
+// Pull does nothing; a MemStore has no remote.
+func (s *MemStore) Pull(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,424 @@
+package wongdb
+
+// Schema validation for issue JSON. A schema lives in .wong/config.json
+// under "schema"; without one, issues are stored as before with no checks
+// beyond those Batch always makes.
+//
+// Custom fields are kept in each issue's JSON under "custom", next to the
+// types.Issue fields:
+//
+//	{"id": "bt-1", "title": "...", "custom": {"estimate": 3, "team": "infra"}}
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/steveyegge/beads/internal/types"
+)
+
+// customKey is the issue JSON key that holds custom fields.
+const customKey = "custom"
+
+// FieldType is the type of a custom field.
+type FieldType string
+
+const (
+	FieldString     FieldType = "string"
+	FieldNumber     FieldType = "number"
+	FieldInteger    FieldType = "integer"
+	FieldBoolean    FieldType = "boolean"
+	FieldDate       FieldType = "date" // YYYY-MM-DD or RFC 3339
+	FieldEnum       FieldType = "enum" // one of CustomField.Values
+	FieldStringList FieldType = "string_list"
+)
+
+// CustomField describes one custom field.
+type CustomField struct {
+	Type     FieldType `json:"type"`
+	Required bool      `json:"required,omitempty"`
+
+	// Values lists the allowed values of an enum field.
+	Values []string `json:"values,omitempty"`
+}
+
+// Schema constrains the issues in a store. Empty lists allow anything.
+type Schema struct {
+	// Required lists issue JSON keys, such as "title" or "issue_type", that
+	// must be present and non-empty.
+	Required []string `json:"required,omitempty"`
+
+	Statuses []string `json:"statuses,omitempty"`
+	Types    []string `json:"types,omitempty"`
+	Labels   []string `json:"labels,omitempty"`
+
+	// CustomFields lists the fields allowed under "custom". If it is empty
+	// any custom fields are allowed.
+	CustomFields map[string]CustomField `json:"custom_fields,omitempty"`
+}
+
+// IssueProblems lists what is wrong with one issue.
+type IssueProblems struct {
+	ID       string   `json:"id"`
+	Problems []string `json:"problems"`
+}
+
+// ValidationReport is the result of checking a set of issues.
+type ValidationReport struct {
+	Checked int             `json:"checked"`
+	Invalid []IssueProblems `json:"invalid,omitempty"`
+}
+
+// OK reports whether every checked issue was valid.
+func (r *ValidationReport) OK() bool {
+	return len(r.Invalid) == 0
+}
+
+// Err returns nil if the report is OK, otherwise an error wrapping
+// ErrInvalidIssue that names every invalid issue.
+func (r *ValidationReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidIssue, r)
+}
+
+// String renders one line per invalid issue.
+func (r *ValidationReport) String() string {
+	lines := make([]string, len(r.Invalid))
+	for i, inv := range r.Invalid {
+		lines[i] = inv.ID + ": " + strings.Join(inv.Problems, "; ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// add validates one issue's JSON and records its problems.
+func (r *ValidationReport) add(sch *Schema, id string, data []byte) {
+	r.Checked++
+	if problems := sch.ValidateJSON(id, data); len(problems) > 0 {
+		r.Invalid = append(r.Invalid, IssueProblems{ID: id, Problems: problems})
+	}
+}
+
+// ValidateJSON returns every problem with an issue file's content, or nil.
+// It always checks that the content is an issue object whose "id" is id;
+// a nil Schema checks nothing else.
+func (sch *Schema) ValidateJSON(id string, data []byte) []string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return []string{"not a JSON object: " + err.Error()}
+	}
+	var issue types.Issue
+	if err := json.Unmarshal(data, &issue); err != nil {
+		return []string{"not a valid issue: " + err.Error()}
+	}
+	var problems []string
+	if issue.ID != id {
+		problems = append(problems, fmt.Sprintf("id %q does not match file name %q", issue.ID, id))
+	}
+	if sch == nil {
+		return problems
+	}
+
+	for _, key := range sch.Required {
+		if isEmptyJSON(fields[key]) {
+			problems = append(problems, fmt.Sprintf("%s is required", key))
+		}
+	}
+	if issue.Status != "" && !allowed(sch.Statuses, string(issue.Status)) {
+		problems = append(problems, fmt.Sprintf("status %q is not one of %s", issue.Status, strings.Join(sch.Statuses, ", ")))
+	}
+	if issue.IssueType != "" && !allowed(sch.Types, string(issue.IssueType)) {
+		problems = append(problems, fmt.Sprintf("type %q is not one of %s", issue.IssueType, strings.Join(sch.Types, ", ")))
+	}
+	for _, l := range issue.Labels {
+		if !allowed(sch.Labels, l) {
+			problems = append(problems, fmt.Sprintf("label %q is not allowed", l))
+		}
+	}
+	return append(problems, sch.validateCustom(fields[customKey])...)
+}
+
+// ValidateIssue validates issue as it would be stored.
+func (sch *Schema) ValidateIssue(issue *types.Issue) []string {
+	data, err := json.Marshal(issue)
+	if err != nil {
+		return []string{"cannot marshal: " + err.Error()}
+	}
+	return sch.ValidateJSON(issue.ID, data)
+}
+
+// validateCustom checks the "custom" object against CustomFields.
+func (sch *Schema) validateCustom(raw json.RawMessage) []string {
+	var custom map[string]json.RawMessage
+	if !isEmptyJSON(raw) {
+		if err := json.Unmarshal(raw, &custom); err != nil {
+			return []string{customKey + " is not a JSON object"}
+		}
+	}
+	if len(sch.CustomFields) == 0 {
+		return nil
+	}
+
+	var problems []string
+	for _, name := range sortedFieldNames(sch.CustomFields) {
+		field := sch.CustomFields[name]
+		value, ok := custom[name]
+		if !ok || string(value) == "null" {
+			if field.Required {
+				problems = append(problems, fmt.Sprintf("custom field %s is required", name))
+			}
+			continue
+		}
+		if problem := field.check(value); problem != "" {
+			problems = append(problems, fmt.Sprintf("custom field %s: %s", name, problem))
+		}
+	}
+	var unknown []string
+	for name := range custom {
+		if _, ok := sch.CustomFields[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("custom field %s is not in the schema", name))
+	}
+	return problems
+}
+
+// check returns what is wrong with value for f, or "".
+func (f CustomField) check(value json.RawMessage) string {
+	switch f.Type {
+	case FieldString:
+		var s string
+		if json.Unmarshal(value, &s) != nil {
+			return "want a string"
+		}
+	case FieldNumber:
+		var n float64
+		if json.Unmarshal(value, &n) != nil {
+			return "want a number"
+		}
+	case FieldInteger:
+		var n int64
+		if json.Unmarshal(value, &n) != nil {
+			return "want an integer"
+		}
+	case FieldBoolean:
+		var b bool
+		if json.Unmarshal(value, &b) != nil {
+			return "want true or false"
+		}
+	case FieldDate:
+		var s string
+		if json.Unmarshal(value, &s) != nil {
+			return "want a date string"
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Sprintf("%q is not YYYY-MM-DD or RFC 3339", s)
+			}
+		}
+	case FieldEnum:
+		var s string
+		if json.Unmarshal(value, &s) != nil {
+			return "want a string"
+		}
+		if !allowed(f.Values, s) {
+			return fmt.Sprintf("%q is not one of %s", s, strings.Join(f.Values, ", "))
+		}
+	case FieldStringList:
+		var l []string
+		if json.Unmarshal(value, &l) != nil {
+			return "want a list of strings"
+		}
+	default:
+		return fmt.Sprintf("schema has unknown field type %q", f.Type)
+	}
+	return ""
+}
+
+// allowed reports whether v is in list, or list is empty.
+func allowed(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, a := range list {
+		if a == v {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyJSON reports whether raw is absent, null, "", [] or {}.
+func isEmptyJSON(raw json.RawMessage) bool {
+	switch string(bytes.TrimSpace(raw)) {
+	case "", "null", `""`, "[]", "{}":
+		return true
+	}
+	return false
+}
+
+func sortedFieldNames(m map[string]CustomField) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadSchema returns the schema in s's config, or nil if it has none.
+func LoadSchema(ctx context.Context, s IssueStore) (*Schema, error) {
+	cfg, err := s.ReadConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Schema, nil
+}
+
+// configuredSchema is LoadSchema for write paths: a store with no config
+// yet, because it is not initialized, has no schema. Any other failure to
+// read the config is returned, so writes are never let through unchecked.
+func configuredSchema(ctx context.Context, s IssueStore) (*Schema, error) {
+	sch, err := LoadSchema(ctx, s)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || !s.IsInitialized(ctx) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return sch, nil
+}
+
+// ValidateStore checks every synced issue in s against its schema and
+// reports all invalid issues rather than stopping at the first. Issues
+// that cannot be read are reported as invalid too.
+func ValidateStore(ctx context.Context, s IssueStore) (*ValidationReport, error) {
+	sch, err := LoadSchema(ctx, s)
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: validate: %w", err)
+	}
+	ids, err := s.ListIssueIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: validate: %w", err)
+	}
+	report := &ValidationReport{}
+	for _, id := range ids {
+		data, err := s.ReadIssue(ctx, id)
+		if err != nil {
+			report.Checked++
+			report.Invalid = append(report.Invalid, IssueProblems{ID: id, Problems: []string{err.Error()}})
+			continue
+		}
+		report.add(sch, id, data)
+	}
+	return report, nil
+}
+
+// validatePending checks changes about to be synced (nil values are
+// deletes) against s's schema. It does nothing if there is no schema.
+func validatePending(ctx context.Context, s IssueStore, changes map[string][]byte) error {
+	sch, err := configuredSchema(ctx, s)
+	if err != nil || sch == nil {
+		return err
+	}
+	report := &ValidationReport{}
+	for _, id := range sortedKeys(changes) {
+		if changes[id] != nil {
+			report.add(sch, id, changes[id])
+		}
+	}
+	return report.Err()
+}
+
+// ReadCustomFields returns the custom fields of a synced issue.
+func ReadCustomFields(ctx context.Context, s IssueStore, id string) (map[string]interface{}, error) {
+	data, err := s.ReadIssue(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: read custom fields of %s: %w", id, err)
+	}
+	var doc struct {
+		Custom map[string]interface{} `json:"custom"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("wongdb: read custom fields of %s: %w", id, err)
+	}
+	return doc.Custom, nil
+}
+
+// SetCustomFields merges fields into an issue's custom fields, a nil value
+// removing the field, and writes the issue after validating it. It starts
+// from the issue's staged copy if it has one, so earlier unsynced writes are
+// kept. The caller should call Sync() afterward.
+func SetCustomFields(ctx context.Context, s IssueStore, id string, fields map[string]interface{}) error {
+	data, err := readStaged(ctx, s, id)
+	if err != nil {
+		return fmt.Errorf("wongdb: set custom fields of %s: %w", id, err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("wongdb: set custom fields of %s: %w", id, err)
+	}
+	custom, _ := doc[customKey].(map[string]interface{})
+	if custom == nil {
+		custom = make(map[string]interface{})
+	}
+	for name, value := range fields {
+		if value == nil {
+			delete(custom, name)
+		} else {
+			custom[name] = value
+		}
+	}
+	if len(custom) == 0 {
+		delete(doc, customKey)
+	} else {
+		doc[customKey] = custom
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("wongdb: set custom fields of %s: %w", id, err)
+	}
+	sch, err := configuredSchema(ctx, s)
+	if err != nil {
+		return fmt.Errorf("wongdb: set custom fields of %s: %w", id, err)
+	}
+	if sch != nil {
+		if problems := sch.ValidateJSON(id, out); len(problems) > 0 {
+			report := &ValidationReport{Checked: 1, Invalid: []IssueProblems{{ID: id, Problems: problems}}}
+			return fmt.Errorf("wongdb: set custom fields of %s: %w", id, report.Err())
+		}
+	}
+	return s.WriteIssue(ctx, id, out)
+}
+
+// withCustomFields returns data, the JSON of a typed issue, with the custom
+// fields of prev, the issue's earlier JSON, carried over, since types.Issue
+// has no field for them and saving it would otherwise drop them. A nil prev
+// has none.
+func withCustomFields(data, prev []byte) []byte {
+	if prev == nil {
+		return data
+	}
+	var doc map[string]json.RawMessage
+	if json.Unmarshal(prev, &doc) != nil || isEmptyJSON(doc[customKey]) {
+		return data
+	}
+	var buf bytes.Buffer
+	buf.Write(bytes.TrimSpace(bytes.TrimSuffix(bytes.TrimSpace(data), []byte("}"))))
+	buf.WriteString(",\n  \"" + customKey + "\": ")
+	if err := json.Indent(&buf, doc[customKey], "  ", "  "); err != nil {
+		return data
+	}
+	buf.WriteString("\n}")
+	return buf.Bytes()
+}
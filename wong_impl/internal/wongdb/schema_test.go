@@ -0,0 +1,306 @@
+package wongdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/types"
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+func testSchema() *Schema {
+	return &Schema{
+		Required: []string{"title", "issue_type"},
+		Statuses: []string{"open", "in_progress", "closed"},
+		Labels:   []string{"ui", "backend"},
+		CustomFields: map[string]CustomField{
+			"estimate": {Type: FieldNumber},
+			"team":     {Type: FieldEnum, Values: []string{"infra", "web"}, Required: true},
+			"due":      {Type: FieldDate},
+		},
+	}
+}
+
+func TestSchema_ValidateJSON(t *testing.T) {
+	sch := testSchema()
+	tests := []struct {
+		name string
+		data string
+		want []string // substrings, one per expected problem
+	}{
+		{"valid", `{"id":"a","title":"T","issue_type":"task","custom":{"team":"web","estimate":2.5,"due":"2026-01-31"}}`, nil},
+		{"not json", `{"id":`, []string{"not a JSON object"}},
+		{"wrong id", `{"id":"b","title":"T","issue_type":"task","custom":{"team":"web"}}`, []string{"does not match"}},
+		{"missing fields", `{"id":"a","title":"","custom":{"team":"web"}}`, []string{"title is required", "issue_type is required"}},
+		{"bad status and label", `{"id":"a","title":"T","issue_type":"task","status":"wontfix","labels":["ui","misc"],"custom":{"team":"web"}}`,
+			[]string{`status "wontfix"`, `label "misc"`}},
+		{"custom fields", `{"id":"a","title":"T","issue_type":"task","custom":{"estimate":"lots","due":"soon","color":"red"}}`,
+			[]string{"due:", "estimate: want a number", "team is required", "color is not in the schema"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sch.ValidateJSON("a", []byte(tt.data))
+			if len(got) != len(tt.want) {
+				t.Fatalf("problems = %q, want %d", got, len(tt.want))
+			}
+			for i, w := range tt.want {
+				if !strings.Contains(got[i], w) {
+					t.Errorf("problem %d = %q, want it to mention %q", i, got[i], w)
+				}
+			}
+		})
+	}
+
+	// Without a schema only the shape of the file is checked.
+	var none *Schema
+	if got := none.ValidateJSON("a", []byte(`{"id":"a"}`)); len(got) != 0 {
+		t.Errorf("nil schema problems = %q", got)
+	}
+}
+
+func newSchemaStore(t *testing.T) *MemStore {
+	t.Helper()
+	s := NewMemStore()
+	s.SetConfig(Config{HistoryMode: "squash", Schema: testSchema()})
+	return s
+}
+
+func TestSaveIssue_EnforcesSchema(t *testing.T) {
+	ctx := context.Background()
+	s := newSchemaStore(t)
+
+	issue := makeTestIssue("bt-1", "One")
+	issue.Labels = []string{"misc"}
+	err := SaveIssue(ctx, s, issue)
+	if !errors.Is(err, ErrInvalidIssue) {
+		t.Fatalf("SaveIssue = %v, want ErrInvalidIssue", err)
+	}
+	for _, want := range []string{`label "misc"`, "team is required"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	// Custom fields set on the stored issue survive a typed save.
+	s.WriteIssue(ctx, "bt-1", []byte(`{"id":"bt-1","title":"One","issue_type":"task","custom":{"team":"infra"}}`))
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCustomFields(ctx, s, "bt-1", map[string]interface{}{"estimate": 3}); err != nil {
+		t.Fatalf("SetCustomFields: %v", err)
+	}
+	if err := SetCustomFields(ctx, s, "bt-1", map[string]interface{}{"team": "sales"}); !errors.Is(err, ErrInvalidIssue) {
+		t.Errorf("SetCustomFields(bad enum) = %v, want ErrInvalidIssue", err)
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIssue(ctx, s, "bt-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Title = "Renamed"
+	if err := SaveIssue(ctx, s, loaded); err != nil {
+		t.Fatalf("SaveIssue: %v", err)
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := ReadCustomFields(ctx, s, "bt-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom["team"] != "infra" || custom["estimate"] != float64(3) {
+		t.Errorf("custom fields after save = %v", custom)
+	}
+	if got, _ := LoadIssue(ctx, s, "bt-1"); got.Title != "Renamed" {
+		t.Errorf("title = %q", got.Title)
+	}
+}
+
+// unreadableConfigStore is an initialized IssueStore whose config can't be
+// read, like a repository whose VCS commands are failing.
+type unreadableConfigStore struct {
+	IssueStore
+}
+
+func (s unreadableConfigStore) ReadConfig(ctx context.Context) (*Config, error) {
+	return nil, fmt.Errorf("read config: %w", vcs.ErrCommandTimeout)
+}
+
+func TestSchema_UnreadableConfigBlocksWrites(t *testing.T) {
+	ctx := context.Background()
+	s := unreadableConfigStore{newSchemaStore(t)}
+	if err := SaveIssue(ctx, s, makeTestIssue("bt-1", "One")); !errors.Is(err, vcs.ErrCommandTimeout) {
+		t.Errorf("SaveIssue = %v, want the config read error", err)
+	}
+	err := Batch(ctx, s, func(tx *Tx) error {
+		return tx.Save(makeTestIssue("bt-1", "One"))
+	})
+	if !errors.Is(err, vcs.ErrCommandTimeout) {
+		t.Errorf("Batch = %v, want the config read error", err)
+	}
+
+	// A store that was never initialized has no config and so no schema.
+	if err := SaveIssue(ctx, NewMemStore(), makeTestIssue("bt-1", "One")); err != nil {
+		t.Errorf("SaveIssue on an uninitialized store = %v", err)
+	}
+}
+
+func TestSaveIssue_KeepsStagedCustomFields(t *testing.T) {
+	for name, s := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := s.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			issue := makeTestIssue("bt-1", "One")
+			if err := SaveIssue(ctx, s, issue); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Sync(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			// Neither write is synced before the other is made.
+			if err := SetCustomFields(ctx, s, "bt-1", map[string]interface{}{"estimate": 3}); err != nil {
+				t.Fatalf("SetCustomFields: %v", err)
+			}
+			issue.Title = "Renamed"
+			if err := SaveIssue(ctx, s, issue); err != nil {
+				t.Fatalf("SaveIssue: %v", err)
+			}
+			if err := SetCustomFields(ctx, s, "bt-1", map[string]interface{}{"team": "infra"}); err != nil {
+				t.Fatalf("SetCustomFields: %v", err)
+			}
+			if err := s.Sync(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			custom, err := ReadCustomFields(ctx, s, "bt-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if custom["estimate"] != float64(3) || custom["team"] != "infra" {
+				t.Errorf("custom fields = %v, want both staged fields", custom)
+			}
+			if got, _ := LoadIssue(ctx, s, "bt-1"); got == nil || got.Title != "Renamed" {
+				t.Errorf("issue after sync = %+v, want the staged rename", got)
+			}
+		})
+	}
+}
+
+func TestSync_EnforcesSchema(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range map[string]IssueStore{"mem": newSchemaStore(t), "git": NewGitStore(setupGitRepo(t, t.TempDir()))} {
+		t.Run(name, func(t *testing.T) {
+			if g, ok := s.(*GitStore); ok {
+				initGitStoreWithSchema(t, g)
+			}
+			s.WriteIssue(ctx, "good", []byte(`{"id":"good","title":"G","issue_type":"task","custom":{"team":"web"}}`))
+			s.WriteIssue(ctx, "bad", []byte(`{"id":"bad"`))
+			err := s.Sync(ctx)
+			if !errors.Is(err, ErrInvalidIssue) || !strings.Contains(err.Error(), "bad:") {
+				t.Fatalf("Sync = %v, want the bad issue reported", err)
+			}
+			if ids, _ := s.ListIssueIDs(ctx); len(ids) != 0 {
+				t.Errorf("Sync committed %v despite an invalid issue", ids)
+			}
+			s.WriteIssue(ctx, "bad", []byte(`{"id":"bad","title":"B","issue_type":"bug","custom":{"team":"web"}}`))
+			if err := s.Sync(ctx); err != nil {
+				t.Fatalf("Sync after fix: %v", err)
+			}
+			if ids, _ := s.ListIssueIDs(ctx); strings.Join(ids, " ") != "bad good" {
+				t.Errorf("ListIssueIDs = %v", ids)
+			}
+		})
+	}
+}
+
+// initGitStoreWithSchema initializes s and commits a config with testSchema.
+func initGitStoreWithSchema(t *testing.T, s *GitStore) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := json.Marshal(Config{HistoryMode: "squash", Schema: testSchema()})
+	blob, err := s.hashObject(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := s.readTree(ctx, gitDBRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files[wongDir+"/config.json"] = blob
+	tree, err := s.writeTree(ctx, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := s.commitTree(ctx, tree, "schema", gitDBRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, s.repoRoot, "update-ref", gitDBRef, commit)
+}
+
+func TestValidateStore_ReportsEveryIssue(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := NewFSStore(dir)
+	if err := s.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := json.Marshal(Config{HistoryMode: "squash", Schema: testSchema()})
+	if err := os.WriteFile(filepath.Join(dir, ".wong", "config.json"), cfg, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Files written behind the store's back, as wong-write would.
+	for id, data := range map[string]string{
+		"ok":      `{"id":"ok","title":"Fine","issue_type":"task","custom":{"team":"web"}}`,
+		"garbage": `not json`,
+		"labels":  `{"id":"labels","title":"L","issue_type":"task","labels":["nope"],"custom":{"team":"web"}}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, ".wong", "issues", id+".json"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := ValidateStore(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 3 || len(report.Invalid) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Invalid[0].ID != "garbage" || report.Invalid[1].ID != "labels" {
+		t.Errorf("invalid = %+v", report.Invalid)
+	}
+	if err := report.Err(); !errors.Is(err, ErrInvalidIssue) || !strings.Contains(err.Error(), "labels: ") {
+		t.Errorf("report.Err() = %v", err)
+	}
+}
+
+func TestServer_RejectsSchemaViolation(t *testing.T) {
+	ts := httptest.NewServer(NewServer(newSchemaStore(t)))
+	t.Cleanup(ts.Close)
+	issue := makeTestIssue("api-1", "No team")
+	if status := doJSON(t, http.MethodPost, ts.URL+"/issues", issue, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("POST status = %d, want 422", status)
+	}
+	var listed []*types.Issue
+	doJSON(t, http.MethodGet, ts.URL+"/issues", nil, &listed)
+	if len(listed) != 0 {
+		t.Errorf("invalid issue was stored: %v", issueIDs(listed))
+	}
+}
@@ -0,0 +1,594 @@
+package wongdb
+
+// Server exposes an IssueStore over a local HTTP/JSON API ("wong serve").
+//
+// Routes:
+//
+//	GET    /issues             list issues (filters: status, assignee, label, type, priority)
+//	POST   /issues             create an issue
+//	GET    /issues/{id}        show an issue
+//	PUT    /issues/{id}        replace an issue
+//	PATCH  /issues/{id}        merge fields into an issue
+//	DELETE /issues/{id}        delete an issue
+//	POST   /issues/{id}/claim  claim an issue for an assignee
+//	POST   /issues/{id}/transition  change an issue's status through the workflow
+//	GET    /ready              list ready issues
+//	GET    /events             server-sent events stream of issue changes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/steveyegge/beads/internal/types"
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+// Server serves the wong-db HTTP API. All handlers share a single store so
+// the in-process dirty-file tracking and sync lock are used by every request.
+type Server struct {
+	db  IssueStore
+	mux *http.ServeMux
+
+	// writeMu serializes write+sync sequences so concurrent requests can't
+	// interleave a SaveIssue from one request with the Sync of another.
+	writeMu sync.Mutex
+
+	events eventHub
+
+	// followsWatcher is set once UseWatcher is called. Events then come from
+	// the watcher, which sees every workspace's writes, so the server stops
+	// publishing its own writes to avoid duplicates.
+	followsWatcher atomic.Bool
+}
+
+// NewServer creates an HTTP API server for the given store, usually a
+// WongDB.
+func NewServer(db IssueStore) *Server {
+	s := &Server{
+		db:  db,
+		mux: http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /issues", s.handleList)
+	s.mux.HandleFunc("POST /issues", s.handleCreate)
+	s.mux.HandleFunc("GET /issues/{id}", s.handleShow)
+	s.mux.HandleFunc("PUT /issues/{id}", s.handleReplace)
+	s.mux.HandleFunc("PATCH /issues/{id}", s.handlePatch)
+	s.mux.HandleFunc("DELETE /issues/{id}", s.handleDelete)
+	s.mux.HandleFunc("POST /issues/{id}/claim", s.handleClaim)
+	s.mux.HandleFunc("POST /issues/{id}/transition", s.handleTransition)
+	s.mux.HandleFunc("GET /ready", s.handleReady)
+	s.mux.HandleFunc("GET /events", s.handleEvents)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the API on addr until ctx is cancelled. An addr of the
+// form "unix:/path/to/sock" listens on a unix socket; anything else is a TCP
+// address such as "127.0.0.1:7433".
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network = "unix"
+		addr = path
+		// Remove a stale socket left behind by a previous run.
+		os.Remove(addr)
+	}
+
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return fmt.Errorf("wongdb: listen on %s: %w", addr, err)
+	}
+
+	srv := &http.Server{Handler: s}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("wongdb: serve: %w", err)
+	}
+	return nil
+}
+
+// Serve opens the store for the repository at repoRoot and serves the API on
+// addr until ctx is cancelled; it is what "wong serve" runs. For a jj
+// repository a Watcher feeds /events, so writes from other workspaces are
+// streamed too. If the watcher fails, the server is shut down and its error
+// returned.
+func Serve(ctx context.Context, repoRoot, addr string) error {
+	store, err := OpenStore(repoRoot)
+	if err != nil {
+		return err
+	}
+	s := NewServer(store)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchErr := make(chan error, 1)
+	if db, ok := store.(*WongDB); ok {
+		w := NewWatcher(db)
+		s.UseWatcher(ctx, w)
+		go func() {
+			if err := w.Run(ctx); err != nil && ctx.Err() == nil {
+				watchErr <- err
+				cancel()
+			}
+		}()
+	}
+
+	if err := s.ListenAndServe(ctx, addr); err != nil {
+		return err
+	}
+	select {
+	case err := <-watchErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// Publish sends an event to every subscriber of the events stream.
+func (s *Server) Publish(ev *Event) {
+	s.events.publish(ev)
+}
+
+// UseWatcher streams events from w to subscribers of /events until ctx is
+// cancelled. The watcher sees writes from every workspace and agent, not just
+// this server, so the server no longer publishes its own writes directly.
+func (s *Server) UseWatcher(ctx context.Context, w *Watcher) {
+	s.followsWatcher.Store(true)
+	ch, cancel := w.Subscribe()
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-ch:
+				if !ok {
+					return
+				}
+				s.Publish(ev)
+			}
+		}
+	}()
+}
+
+// publishWrite publishes an event for a write made through this server,
+// unless events are sourced from a watcher.
+func (s *Server) publishWrite(ctx context.Context, before, after *types.Issue) {
+	if s.followsWatcher.Load() {
+		return
+	}
+	s.Publish(NewEvent(configuredWorkflow(ctx, s.db), before, after))
+}
+
+// --- Handlers ---
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filtered, err := QueryIssues(r.Context(), s.db, Query{
+		Status:   q.Get("status"),
+		Assignee: q.Get("assignee"),
+		Label:    q.Get("label"),
+		Type:     q.Get("type"),
+		Priority: q.Get("priority"),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, filtered)
+}
+
+func (s *Server) handleShow(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	issue, status, err := s.loadExisting(r.Context(), id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, issue)
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var issue types.Issue
+	if err := json.NewDecoder(r.Body).Decode(&issue); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid issue JSON: %w", err))
+		return
+	}
+
+	ctx := r.Context()
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if issue.ID == "" {
+		prefix := ""
+		if cfg, err := s.db.ReadConfig(ctx); err == nil {
+			prefix = cfg.Prefix
+		}
+		issue.ID = vcs.GenerateTaskID(prefix)
+	} else if err := validateIssueID(issue.ID); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	} else if exists, err := s.exists(ctx, issue.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	} else if exists {
+		writeError(w, http.StatusConflict, fmt.Errorf("issue %s already exists", issue.ID))
+		return
+	}
+
+	now := time.Now()
+	if issue.Status == "" {
+		issue.Status = types.StatusOpen
+	}
+	if issue.CreatedAt.IsZero() {
+		issue.CreatedAt = now
+	}
+	issue.UpdatedAt = now
+
+	if err := s.save(ctx, nil, &issue); err != nil {
+		writeError(w, saveStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, &issue)
+}
+
+func (s *Server) handleReplace(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var issue types.Issue
+	if err := json.NewDecoder(r.Body).Decode(&issue); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid issue JSON: %w", err))
+		return
+	}
+	if issue.ID != "" && issue.ID != id {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("issue ID %q does not match path %q", issue.ID, id))
+		return
+	}
+	issue.ID = id
+
+	ctx := r.Context()
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	before, status, err := s.loadExisting(ctx, id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	issue.UpdatedAt = time.Now()
+	if err := s.changeStatus(ctx, before, &issue, ""); err != nil {
+		writeError(w, saveStatus(err), err)
+		return
+	}
+	if err := s.save(ctx, before, &issue); err != nil {
+		writeError(w, saveStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &issue)
+}
+
+func (s *Server) handlePatch(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	before, status, err := s.loadExisting(ctx, id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	// Decode the patch on top of a copy of the current issue so that only
+	// fields present in the body change.
+	after := cloneIssue(before)
+	if err := json.NewDecoder(r.Body).Decode(after); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid patch JSON: %w", err))
+		return
+	}
+	after.ID = id
+	after.UpdatedAt = time.Now()
+	if err := s.changeStatus(ctx, before, after, ""); err != nil {
+		writeError(w, saveStatus(err), err)
+		return
+	}
+
+	if err := s.save(ctx, before, after); err != nil {
+		writeError(w, saveStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, after)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	before, status, err := s.loadExisting(ctx, id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	if err := RemoveIssue(ctx, s.db, id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.publishWrite(ctx, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// claimRequest is the body of POST /issues/{id}/claim.
+type claimRequest struct {
+	Assignee string `json:"assignee"`
+}
+
+func (s *Server) handleClaim(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req claimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Assignee == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("claim requires a JSON body with an assignee"))
+		return
+	}
+
+	ctx := r.Context()
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	before, status, err := s.loadExisting(ctx, id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	wf, err := LoadWorkflow(ctx, s.db)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if wf.IsDone(before.Status) || wf.IsHeld(before.Status) {
+		writeError(w, http.StatusConflict, fmt.Errorf("issue %s is %s", id, before.Status))
+		return
+	}
+	if before.Assignee != "" && before.Assignee != req.Assignee {
+		writeError(w, http.StatusConflict, fmt.Errorf("issue %s is already claimed by %s", id, before.Assignee))
+		return
+	}
+
+	after := cloneIssue(before)
+	after.Assignee = req.Assignee
+	after.UpdatedAt = time.Now()
+	if err := wf.Apply(ctx, s.db, after, types.StatusInProgress, ""); err != nil {
+		writeError(w, saveStatus(err), err)
+		return
+	}
+	if err := s.save(ctx, before, after); err != nil {
+		writeError(w, saveStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, after)
+}
+
+// transitionRequest is the body of POST /issues/{id}/transition.
+type transitionRequest struct {
+	Status types.Status `json:"status"`
+	Reason string       `json:"reason,omitempty"`
+}
+
+func (s *Server) handleTransition(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req transitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Status == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("transition requires a JSON body with a status"))
+		return
+	}
+
+	ctx := r.Context()
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	before, status, err := s.loadExisting(ctx, id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	after := cloneIssue(before)
+	after.Status = req.Status
+	if err := s.changeStatus(ctx, before, after, req.Reason); err != nil {
+		writeError(w, saveStatus(err), err)
+		return
+	}
+	if err := s.save(ctx, before, after); err != nil {
+		writeError(w, saveStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, after)
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ready, err := ReadyIssues(r.Context(), s.db)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if ready == nil {
+		ready = []*types.Issue{}
+	}
+	writeJSON(w, http.StatusOK, ready)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-ch:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// --- Helpers ---
+
+// save writes an issue, syncs it to wong-db and publishes the change.
+// The caller must hold writeMu.
+func (s *Server) save(ctx context.Context, before, after *types.Issue) error {
+	if err := SaveIssue(ctx, s.db, after); err != nil {
+		return err
+	}
+	if err := s.db.Sync(ctx); err != nil {
+		return err
+	}
+	s.publishWrite(ctx, before, after)
+	return nil
+}
+
+// changeStatus runs a status change made by a write through the workflow:
+// after.Status is the requested status, and before's status is where the
+// transition starts from.
+func (s *Server) changeStatus(ctx context.Context, before, after *types.Issue, reason string) error {
+	if after.Status == before.Status {
+		return nil
+	}
+	wf, err := LoadWorkflow(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	to := after.Status
+	after.Status = before.Status
+	return wf.Apply(ctx, s.db, after, to, reason)
+}
+
+// saveStatus returns the HTTP status for an error from a write: 409 when
+// the workflow does not allow the status change, 422 when a transition
+// hook or the store's schema rejects the issue.
+func saveStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTransitionNotAllowed):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidIssueID):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrInvalidIssue), errors.Is(err, ErrTransitionRejected):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// exists reports whether an issue with the given ID is stored in wong-db.
+func (s *Server) exists(ctx context.Context, id string) (bool, error) {
+	ids, err := s.db.ListIssueIDs(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, existing := range ids {
+		if existing == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// loadExisting loads an issue, returning the HTTP status to use on failure.
+func (s *Server) loadExisting(ctx context.Context, id string) (*types.Issue, int, error) {
+	issue, err := LoadIssue(ctx, s.db, id)
+	if err == nil {
+		return issue, http.StatusOK, nil
+	}
+	if exists, existsErr := s.exists(ctx, id); existsErr == nil && !exists {
+		return nil, http.StatusNotFound, fmt.Errorf("issue %s not found", id)
+	}
+	return nil, http.StatusInternalServerError, err
+}
+
+// pathID returns the request's {id}, which the mux has already unescaped.
+// If it isn't a valid issue ID, it writes a 400 response and returns false.
+func pathID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if err := validateIssueID(id); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return "", false
+	}
+	return id, true
+}
+
+// cloneIssue returns a deep copy of an issue via a JSON round trip.
+func cloneIssue(issue *types.Issue) *types.Issue {
+	data, err := json.Marshal(issue)
+	if err != nil {
+		copied := *issue
+		return &copied
+	}
+	var copied types.Issue
+	if err := json.Unmarshal(data, &copied); err != nil {
+		shallow := *issue
+		return &shallow
+	}
+	return &copied
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,340 @@
+package wongdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steveyegge/beads/internal/types"
+)
+
+// newTestServer initializes wong-db in a fresh jj repo and serves it via httptest.
+func newTestServer(t *testing.T) (*httptest.Server, *WongDB) {
+	t.Helper()
+	dir := setupJJRepo(t)
+	db := newTestDB(t, dir)
+	if err := db.Init(context.Background()); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	ts := httptest.NewServer(NewServer(db))
+	t.Cleanup(ts.Close)
+	return ts, db
+}
+
+// doJSON sends a request with an optional JSON body and decodes the JSON response into out.
+func doJSON(t *testing.T, method, url string, body, out interface{}) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s %s response: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestQueryMatches(t *testing.T) {
+	issue := makeTestIssue("q-1", "Query me")
+	issue.Assignee = "alice"
+	issue.Labels = []string{"backend"}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  bool
+	}{
+		{"no filters", Query{}, true},
+		{"status match", Query{Status: "open"}, true},
+		{"status mismatch", Query{Status: "closed"}, false},
+		{"assignee match", Query{Assignee: "alice"}, true},
+		{"assignee mismatch", Query{Assignee: "bob"}, false},
+		{"label match", Query{Label: "backend"}, true},
+		{"label mismatch", Query{Label: "frontend"}, false},
+		{"type match", Query{Type: "task"}, true},
+		{"priority match", Query{Priority: "2"}, true},
+		{"priority mismatch", Query{Priority: "1"}, false},
+		{"priority invalid", Query{Priority: "high"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.Matches(issue); got != tt.want {
+				t.Errorf("%+v.Matches = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_EventsStream(t *testing.T) {
+	srv := NewServer(nil)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// The subscriber is registered before headers are flushed, so publishing
+	// now is guaranteed to reach it.
+	srv.Publish(NewEvent(nil, nil, makeTestIssue("sse-1", "Streamed")))
+
+	reader := bufio.NewReader(resp.Body)
+	var eventLine, dataLine string
+	for eventLine == "" || dataLine == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			eventLine = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			dataLine = strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+		}
+	}
+
+	if eventLine != string(EventIssueCreated) {
+		t.Errorf("event = %q, want %q", eventLine, EventIssueCreated)
+	}
+	var ev Event
+	if err := json.Unmarshal([]byte(dataLine), &ev); err != nil {
+		t.Fatalf("unmarshal event data: %v", err)
+	}
+	if ev.IssueID != "sse-1" || ev.After == nil || ev.After.Title != "Streamed" {
+		t.Errorf("unexpected event payload: %+v", ev)
+	}
+}
+
+func TestServer_IssueLifecycle(t *testing.T) {
+	ts, _ := newTestServer(t)
+	checkIssueLifecycle(t, ts)
+}
+
+// TestServer_IssueLifecycleMemStore runs the same API checks against an
+// in-memory store, with no jj involved.
+func TestServer_IssueLifecycleMemStore(t *testing.T) {
+	store := NewMemStore()
+	if err := store.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewServer(store))
+	t.Cleanup(ts.Close)
+	checkIssueLifecycle(t, ts)
+}
+
+func TestServer_CreateRejectsPathIDs(t *testing.T) {
+	store := NewMemStore()
+	if err := store.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewServer(store))
+	t.Cleanup(ts.Close)
+
+	for _, id := range []string{"../escape", "a/b", `a\b`, "x..y"} {
+		if status := doJSON(t, http.MethodPost, ts.URL+"/issues", makeTestIssue(id, "Bad ID"), nil); status != http.StatusBadRequest {
+			t.Errorf("create %q status = %d, want 400", id, status)
+		}
+	}
+	var issues []*types.Issue
+	if status := doJSON(t, http.MethodGet, ts.URL+"/issues", nil, &issues); status != http.StatusOK || len(issues) != 0 {
+		t.Errorf("list after rejected creates = %d, %d issues; want 200 and none", status, len(issues))
+	}
+}
+
+// TestServer_PathIDTraversal verifies that an {id} that unescapes to a path
+// outside .wong/issues is rejected by every issue route before it reaches
+// the store.
+func TestServer_PathIDTraversal(t *testing.T) {
+	root := t.TempDir()
+	store := NewFSStore(root)
+	if err := store.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	victim := filepath.Join(root, "victim.json")
+	if err := os.WriteFile(victim, []byte(`{"id":"victim"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewServer(store))
+	t.Cleanup(ts.Close)
+
+	body := makeTestIssue("victim", "Overwritten")
+	for _, id := range []string{"..%2F..%2Fvictim", "..%2Fconfig", "a%5Cb", "x..y"} {
+		for _, route := range []struct{ method, suffix string }{
+			{http.MethodGet, ""},
+			{http.MethodPut, ""},
+			{http.MethodPatch, ""},
+			{http.MethodDelete, ""},
+			{http.MethodPost, "/claim"},
+			{http.MethodPost, "/transition"},
+		} {
+			url := ts.URL + "/issues/" + id + route.suffix
+			if status := doJSON(t, route.method, url, body, nil); status != http.StatusBadRequest {
+				t.Errorf("%s %s status = %d, want 400", route.method, url, status)
+			}
+		}
+	}
+	if data, err := os.ReadFile(victim); err != nil || string(data) != `{"id":"victim"}` {
+		t.Errorf("victim.json after traversal attempts = %q, %v", data, err)
+	}
+	if cfg, err := store.ReadConfig(context.Background()); err != nil || cfg.Prefix == "" && cfg.HistoryMode == "" {
+		t.Errorf("config after traversal attempts = %+v, %v", cfg, err)
+	}
+}
+
+func TestServe_UnixSocket(t *testing.T) {
+	repo := setupGitRepo(t, t.TempDir())
+	store, err := OpenStore(repo)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	if err := store.Init(context.Background()); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	sock := filepath.Join(t.TempDir(), "wong.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, repo, "unix:"+sock) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	var resp *http.Response
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if resp, err = client.Get("http://wong/issues"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		cancel()
+		t.Fatalf("GET /issues over %s: %v", sock, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /issues status = %d, want 200", resp.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Serve did not return after cancel")
+	}
+}
+
+// checkIssueLifecycle creates, reads, patches, claims, lists and deletes an
+// issue through the API served by ts, which must start empty.
+func checkIssueLifecycle(t *testing.T, ts *httptest.Server) {
+	t.Helper()
+
+	// Create
+	var created types.Issue
+	status := doJSON(t, http.MethodPost, ts.URL+"/issues", makeTestIssue("api-1", "API issue"), &created)
+	if status != http.StatusCreated {
+		t.Fatalf("POST /issues status = %d, want 201", status)
+	}
+	if created.ID != "api-1" {
+		t.Errorf("created ID = %q, want api-1", created.ID)
+	}
+
+	// Duplicate create conflicts
+	if status := doJSON(t, http.MethodPost, ts.URL+"/issues", makeTestIssue("api-1", "Dup"), nil); status != http.StatusConflict {
+		t.Errorf("duplicate POST status = %d, want 409", status)
+	}
+
+	// Show
+	var shown types.Issue
+	if status := doJSON(t, http.MethodGet, ts.URL+"/issues/api-1", nil, &shown); status != http.StatusOK {
+		t.Fatalf("GET /issues/api-1 status = %d", status)
+	}
+	if shown.Title != "API issue" {
+		t.Errorf("shown title = %q", shown.Title)
+	}
+
+	// Missing issue
+	if status := doJSON(t, http.MethodGet, ts.URL+"/issues/nope", nil, nil); status != http.StatusNotFound {
+		t.Errorf("GET missing status = %d, want 404", status)
+	}
+
+	// Patch only the title
+	var patched types.Issue
+	if status := doJSON(t, http.MethodPatch, ts.URL+"/issues/api-1", map[string]string{"title": "Renamed"}, &patched); status != http.StatusOK {
+		t.Fatalf("PATCH status = %d", status)
+	}
+	if patched.Title != "Renamed" || patched.Priority != 2 {
+		t.Errorf("patch result = %+v", patched)
+	}
+
+	// Ready includes the open issue
+	var ready []*types.Issue
+	if status := doJSON(t, http.MethodGet, ts.URL+"/ready", nil, &ready); status != http.StatusOK {
+		t.Fatalf("GET /ready status = %d", status)
+	}
+	if len(ready) != 1 || ready[0].ID != "api-1" {
+		t.Errorf("ready = %+v", ready)
+	}
+
+	// Claim
+	var claimed types.Issue
+	if status := doJSON(t, http.MethodPost, ts.URL+"/issues/api-1/claim", claimRequest{Assignee: "alice"}, &claimed); status != http.StatusOK {
+		t.Fatalf("claim status = %d", status)
+	}
+	if claimed.Assignee != "alice" || claimed.Status != types.StatusInProgress {
+		t.Errorf("claimed = %+v", claimed)
+	}
+	if status := doJSON(t, http.MethodPost, ts.URL+"/issues/api-1/claim", claimRequest{Assignee: "bob"}, nil); status != http.StatusConflict {
+		t.Errorf("second claim status = %d, want 409", status)
+	}
+
+	// List with filter
+	var listed []*types.Issue
+	if status := doJSON(t, http.MethodGet, ts.URL+"/issues?assignee=alice", nil, &listed); status != http.StatusOK {
+		t.Fatalf("GET /issues status = %d", status)
+	}
+	if len(listed) != 1 {
+		t.Errorf("expected 1 issue for alice, got %d", len(listed))
+	}
+
+	// Delete
+	if status := doJSON(t, http.MethodDelete, ts.URL+"/issues/api-1", nil, nil); status != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want 204", status)
+	}
+	if status := doJSON(t, http.MethodGet, ts.URL+"/issues/api-1", nil, nil); status != http.StatusNotFound {
+		t.Errorf("GET after delete status = %d, want 404", status)
+	}
+}
@@ -1,22 +1,30 @@
 package wongdb
 
-// Storage provides typed issue read/write on top of WongDB.
+// Storage provides typed issue read/write, readiness and queries on top of
+// any IssueStore. The WongDB methods are kept for existing callers and
+// delegate to the package-level functions.
 
 import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/steveyegge/beads/internal/types"
 )
 
-// LoadIssue reads an issue from wong-db by ID and deserializes it.
-func (db *WongDB) LoadIssue(ctx context.Context, id string) (*types.Issue, error) {
-	data, err := db.ReadIssue(ctx, id)
+// LoadIssue reads an issue from s by ID and deserializes it.
+func LoadIssue(ctx context.Context, s IssueStore, id string) (*types.Issue, error) {
+	data, err := s.ReadIssue(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("wongdb: load issue %s: %w", id, err)
 	}
 
+	return unmarshalIssue(id, data)
+}
+
+// unmarshalIssue deserializes an issue's raw JSON bytes.
+func unmarshalIssue(id string, data []byte) (*types.Issue, error) {
 	var issue types.Issue
 	if err := json.Unmarshal(data, &issue); err != nil {
 		return nil, fmt.Errorf("wongdb: unmarshal issue %s: %w", id, err)
@@ -24,34 +32,40 @@ func (db *WongDB) LoadIssue(ctx context.Context, id string) (*types.Issue, error
 	return &issue, nil
 }
 
-// SaveIssue serializes an issue to JSON and writes it to the working copy.
-// The caller should call Sync() afterward to persist the change to wong-db.
-func (db *WongDB) SaveIssue(ctx context.Context, issue *types.Issue) error {
-	if issue.ID == "" {
-		return fmt.Errorf("wongdb: cannot save issue with empty ID")
+// SaveIssue serializes an issue to JSON and writes it to s, keeping any
+// custom fields the issue's staged copy, or else its synced one, has. If s has a schema the issue must
+// satisfy it. The caller should call Sync() afterward to persist the change.
+func SaveIssue(ctx context.Context, s IssueStore, issue *types.Issue) error {
+	if err := validateIssueID(issue.ID); err != nil {
+		return err
 	}
 
 	data, err := json.MarshalIndent(issue, "", "  ")
 	if err != nil {
 		return fmt.Errorf("wongdb: marshal issue %s: %w", issue.ID, err)
 	}
+	prev, _ := readStaged(ctx, s, issue.ID)
+	data = withCustomFields(data, prev)
+	if err := validatePending(ctx, s, map[string][]byte{issue.ID: data}); err != nil {
+		return fmt.Errorf("wongdb: save issue %s: %w", issue.ID, err)
+	}
 
-	if err := db.WriteIssue(ctx, issue.ID, data); err != nil {
+	if err := s.WriteIssue(ctx, issue.ID, data); err != nil {
 		return fmt.Errorf("wongdb: save issue %s: %w", issue.ID, err)
 	}
 	return nil
 }
 
-// LoadAllIssues reads all issues from wong-db.
-func (db *WongDB) LoadAllIssues(ctx context.Context) ([]*types.Issue, error) {
-	ids, err := db.ListIssueIDs(ctx)
+// LoadAllIssues reads all issues from s.
+func LoadAllIssues(ctx context.Context, s IssueStore) ([]*types.Issue, error) {
+	ids, err := s.ListIssueIDs(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("wongdb: list issues: %w", err)
 	}
 
 	var issues []*types.Issue
 	for _, id := range ids {
-		issue, err := db.LoadIssue(ctx, id)
+		issue, err := LoadIssue(ctx, s, id)
 		if err != nil {
 			return nil, fmt.Errorf("wongdb: load all issues: %w", err)
 		}
@@ -60,88 +74,193 @@ func (db *WongDB) LoadAllIssues(ctx context.Context) ([]*types.Issue, error) {
 	return issues, nil
 }
 
-// IsReady checks if an issue's blocking dependencies are all closed.
+// RemoveIssue deletes an issue from s and syncs the deletion.
+func RemoveIssue(ctx context.Context, s IssueStore, id string) error {
+	if err := s.DeleteIssue(ctx, id); err != nil {
+		return fmt.Errorf("wongdb: remove issue %s: %w", id, err)
+	}
+	if err := s.Sync(ctx); err != nil {
+		return fmt.Errorf("wongdb: remove issue %s sync: %w", id, err)
+	}
+	return nil
+}
+
+// IsReady checks if an issue's blocking dependencies are all done.
 // An issue is "ready" if it has no unresolved blocking dependencies.
-// Issues that are already closed are not considered ready.
-func (db *WongDB) IsReady(ctx context.Context, id string) (bool, error) {
-	issue, err := db.LoadIssue(ctx, id)
+// Issues in a done or hold state of s's workflow are not considered ready.
+func IsReady(ctx context.Context, s IssueStore, id string) (bool, error) {
+	issue, err := LoadIssue(ctx, s, id)
 	if err != nil {
 		return false, err
 	}
+	return configuredWorkflow(ctx, s).isReady(issue, func(id string) *types.Issue {
+		// If we can't load the blocker, treat it as still blocking
+		blocker, _ := LoadIssue(ctx, s, id)
+		return blocker
+	}), nil
+}
 
-	// Closed/tombstone issues are not ready (already done)
-	if issue.Status == types.StatusClosed || issue.Status == types.StatusTombstone {
-		return false, nil
+// ReadyIssues returns all issues in s that are ready to be worked on.
+// An issue is ready if it is not done or held and all its blocking
+// dependencies are done, by s's workflow.
+func ReadyIssues(ctx context.Context, s IssueStore) ([]*types.Issue, error) {
+	allIssues, err := LoadAllIssues(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	return configuredWorkflow(ctx, s).FilterReady(allIssues), nil
+}
+
+// FilterReady returns the issues that are ready under the built-in
+// workflow; see Workflow.FilterReady.
+func FilterReady(issues []*types.Issue) []*types.Issue {
+	return (*Workflow)(nil).FilterReady(issues)
+}
+
+// FilterReady returns the issues that are ready, resolving blockers within
+// issues. A blocker missing from issues counts as not done.
+func (wf *Workflow) FilterReady(issues []*types.Issue) []*types.Issue {
+	// Build a map for quick lookups
+	issueMap := make(map[string]*types.Issue, len(issues))
+	for _, issue := range issues {
+		issueMap[issue.ID] = issue
+	}
+	lookup := func(id string) *types.Issue { return issueMap[id] }
+
+	var ready []*types.Issue
+	for _, issue := range issues {
+		if wf.isReady(issue, lookup) {
+			ready = append(ready, issue)
+		}
+	}
+	return ready
+}
+
+// isReady reports whether issue is neither done nor held and every
+// blocking dependency, found with lookup, is done. lookup returns nil for
+// unknown issues.
+func (wf *Workflow) isReady(issue *types.Issue, lookup func(id string) *types.Issue) bool {
+	// Done issues are finished; held ones are parked
+	if wf.IsDone(issue.Status) || wf.IsHeld(issue.Status) {
+		return false
 	}
 
-	// Check blocking dependencies
 	for _, dep := range issue.Dependencies {
-		if dep.Type != types.DepBlocks && dep.Type != types.DepWaitsFor && dep.Type != types.DepConditionalBlocks {
+		if !isBlocking(dep) {
 			continue // non-blocking dependency type
 		}
 		// dep.DependsOnID is what this issue depends on
-		blocker, err := db.LoadIssue(ctx, dep.DependsOnID)
-		if err != nil {
-			// If we can't load the blocker, treat as still blocking
-			return false, nil
-		}
-		if blocker.Status != types.StatusClosed {
-			return false, nil
+		blocker := lookup(dep.DependsOnID)
+		if blocker == nil || !wf.IsDone(blocker.Status) {
+			return false
 		}
 	}
+	return true
+}
+
+// Query selects issues by field. Fields are compared as their string form,
+// as they arrive from the CLI or a URL; empty fields match everything.
+type Query struct {
+	Status   string
+	Assignee string
+	Label    string
+	Type     string
 
-	return true, nil
+	// Priority must parse as an integer; anything else matches nothing.
+	Priority string
+
+	// Ready limits the result to ready issues (see Workflow.FilterReady).
+	Ready bool
 }
 
-// ReadyIssues returns all issues that are ready to be worked on.
-// An issue is ready if it is not closed and all its blocking dependencies are closed.
-func (db *WongDB) ReadyIssues(ctx context.Context) ([]*types.Issue, error) {
-	allIssues, err := db.LoadAllIssues(ctx)
-	if err != nil {
-		return nil, err
+// Matches reports whether issue matches q's field filters. Ready is not
+// checked, since it depends on other issues.
+func (q Query) Matches(issue *types.Issue) bool {
+	if q.Status != "" && string(issue.Status) != q.Status {
+		return false
 	}
-
-	// Build a map for quick lookups
-	issueMap := make(map[string]*types.Issue)
-	for _, issue := range allIssues {
-		issueMap[issue.ID] = issue
+	if q.Assignee != "" && issue.Assignee != q.Assignee {
+		return false
 	}
-
-	var ready []*types.Issue
-	for _, issue := range allIssues {
-		// Skip already closed
-		if issue.Status == types.StatusClosed || issue.Status == types.StatusTombstone {
-			continue
+	if q.Type != "" && string(issue.IssueType) != q.Type {
+		return false
+	}
+	if q.Priority != "" {
+		p, err := strconv.Atoi(q.Priority)
+		if err != nil || issue.Priority != p {
+			return false
 		}
-
-		// Check blocking dependencies
-		blocked := false
-		for _, dep := range issue.Dependencies {
-			if dep.Type != types.DepBlocks && dep.Type != types.DepWaitsFor && dep.Type != types.DepConditionalBlocks {
-				continue
-			}
-			blocker, ok := issueMap[dep.DependsOnID]
-			if !ok || blocker.Status != types.StatusClosed {
-				blocked = true
+	}
+	if q.Label != "" {
+		found := false
+		for _, l := range issue.Labels {
+			if l == q.Label {
+				found = true
 				break
 			}
 		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
 
-		if !blocked {
-			ready = append(ready, issue)
+// Filter returns the issues that match q, in their original order, using
+// the built-in workflow for Ready.
+func (q Query) Filter(issues []*types.Issue) []*types.Issue {
+	return q.filter(nil, issues)
+}
+
+func (q Query) filter(wf *Workflow, issues []*types.Issue) []*types.Issue {
+	if q.Ready {
+		issues = wf.FilterReady(issues)
+	}
+	matched := make([]*types.Issue, 0, len(issues))
+	for _, issue := range issues {
+		if q.Matches(issue) {
+			matched = append(matched, issue)
 		}
 	}
+	return matched
+}
+
+// QueryIssues loads every issue in s and returns those matching q.
+func QueryIssues(ctx context.Context, s IssueStore, q Query) ([]*types.Issue, error) {
+	issues, err := LoadAllIssues(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	return q.filter(configuredWorkflow(ctx, s), issues), nil
+}
+
+// LoadIssue reads an issue from wong-db by ID and deserializes it.
+func (db *WongDB) LoadIssue(ctx context.Context, id string) (*types.Issue, error) {
+	return LoadIssue(ctx, db, id)
+}
+
+// SaveIssue serializes an issue to JSON and writes it to the working copy.
+// The caller should call Sync() afterward to persist the change to wong-db.
+func (db *WongDB) SaveIssue(ctx context.Context, issue *types.Issue) error {
+	return SaveIssue(ctx, db, issue)
+}
 
-	return ready, nil
+// LoadAllIssues reads all issues from wong-db.
+func (db *WongDB) LoadAllIssues(ctx context.Context) ([]*types.Issue, error) {
+	return LoadAllIssues(ctx, db)
+}
+
+// IsReady checks if an issue's blocking dependencies are all closed.
+func (db *WongDB) IsReady(ctx context.Context, id string) (bool, error) {
+	return IsReady(ctx, db, id)
+}
+
+// ReadyIssues returns all issues that are ready to be worked on.
+func (db *WongDB) ReadyIssues(ctx context.Context) ([]*types.Issue, error) {
+	return ReadyIssues(ctx, db)
 }
 
 // RemoveIssue deletes an issue from the working copy and syncs the deletion to wong-db.
 func (db *WongDB) RemoveIssue(ctx context.Context, id string) error {
-	if err := db.DeleteIssue(ctx, id); err != nil {
-		return fmt.Errorf("wongdb: remove issue %s: %w", id, err)
-	}
-	if err := db.Sync(ctx); err != nil {
-		return fmt.Errorf("wongdb: remove issue %s sync: %w", id, err)
-	}
-	return nil
+	return RemoveIssue(ctx, db, id)
 }
@@ -0,0 +1,133 @@
+package wongdb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/types"
+)
+
+// newMemStoreWith returns an initialized MemStore holding issues.
+func newMemStoreWith(t *testing.T, issues ...*types.Issue) *MemStore {
+	t.Helper()
+	ctx := context.Background()
+	s := NewMemStore()
+	if err := s.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range issues {
+		if err := SaveIssue(ctx, s, issue); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func issueIDs(issues []*types.Issue) string {
+	ids := make([]string, len(issues))
+	for i, issue := range issues {
+		ids[i] = issue.ID
+	}
+	return strings.Join(ids, " ")
+}
+
+func blockedBy(issue *types.Issue, depType types.DependencyType, blockers ...string) *types.Issue {
+	for _, b := range blockers {
+		issue.Dependencies = append(issue.Dependencies, &types.Dependency{
+			IssueID:     issue.ID,
+			DependsOnID: b,
+			Type:        depType,
+		})
+	}
+	return issue
+}
+
+func TestReadyIssues_MemStore(t *testing.T) {
+	closed := makeTestIssue("done", "Done")
+	closed.Status = types.StatusClosed
+	s := newMemStoreWith(t,
+		closed,
+		makeTestIssue("open", "Open"),
+		blockedBy(makeTestIssue("after-done", "Unblocked"), types.DepBlocks, "done"),
+		blockedBy(makeTestIssue("after-open", "Blocked"), types.DepBlocks, "open"),
+		blockedBy(makeTestIssue("waits", "Waits"), types.DepWaitsFor, "open"),
+		blockedBy(makeTestIssue("missing", "Missing blocker"), types.DepBlocks, "gone"),
+		blockedBy(makeTestIssue("child", "Child"), types.DepParentChild, "open"),
+	)
+	ctx := context.Background()
+
+	ready, err := ReadyIssues(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := issueIDs(ready); got != "after-done child open" {
+		t.Errorf("ReadyIssues = %q", got)
+	}
+
+	for id, want := range map[string]bool{"done": false, "open": true, "after-done": true, "after-open": false, "missing": false} {
+		if got, err := IsReady(ctx, s, id); err != nil || got != want {
+			t.Errorf("IsReady(%s) = %v, %v; want %v", id, got, err, want)
+		}
+	}
+	if _, err := IsReady(ctx, s, "nope"); err == nil {
+		t.Error("IsReady on a missing issue succeeded")
+	}
+}
+
+func TestQueryIssues_MemStore(t *testing.T) {
+	bug := makeTestIssue("bug", "Bug")
+	bug.IssueType = types.TypeBug
+	bug.Assignee = "alice"
+	bug.Labels = []string{"ui"}
+	bug.Priority = 1
+	s := newMemStoreWith(t,
+		bug,
+		makeTestIssue("task", "Task"),
+		blockedBy(makeTestIssue("blocked", "Blocked"), types.DepBlocks, "task"),
+	)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{"all", Query{}, "blocked bug task"},
+		{"assignee", Query{Assignee: "alice"}, "bug"},
+		{"type", Query{Type: "task"}, "blocked task"},
+		{"label", Query{Label: "ui"}, "bug"},
+		{"priority", Query{Priority: "2"}, "blocked task"},
+		{"priority invalid", Query{Priority: "high"}, ""},
+		{"ready", Query{Ready: true}, "bug task"},
+		{"ready and type", Query{Ready: true, Type: "task"}, "task"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := QueryIssues(ctx, s, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := issueIDs(got); ids != tt.want {
+				t.Errorf("QueryIssues = %q, want %q", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveIssue_MemStore(t *testing.T) {
+	s := newMemStoreWith(t, makeTestIssue("bt-1", "One"))
+	ctx := context.Background()
+	if err := RemoveIssue(ctx, s, "bt-1"); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := LoadAllIssues(ctx, s); len(all) != 0 {
+		t.Errorf("LoadAllIssues after remove = %v", issueIDs(all))
+	}
+	if err := RemoveIssue(ctx, s, "bt-1"); err == nil {
+		t.Error("second RemoveIssue succeeded")
+	}
+}
@@ -0,0 +1,182 @@
+package wongdb
+
+// IssueStore abstracts where wong-db keeps issue files, so the same issue
+// operations (see storage.go) work on a jj change (WongDB), a git ref
+// (GitStore), a plain directory (FSStore) or memory (MemStore).
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+// IssueStore reads and writes raw issue JSON. Writes and deletes are pending
+// until Sync commits them; reads see only committed issues.
+type IssueStore interface {
+	// Init creates the storage if needed; it is a no-op when initialized.
+	Init(ctx context.Context) error
+	IsInitialized(ctx context.Context) bool
+
+	ReadIssue(ctx context.Context, id string) ([]byte, error)
+	ListIssueIDs(ctx context.Context) ([]string, error)
+	WriteIssue(ctx context.Context, id string, data []byte) error
+	DeleteIssue(ctx context.Context, id string) error
+	ReadConfig(ctx context.Context) (*Config, error)
+
+	Sync(ctx context.Context) error
+	Push(ctx context.Context) error
+	Pull(ctx context.Context) error
+}
+
+// ErrInvalidIssueID is returned for issue IDs that can't name a file in
+// .wong/issues.
+var ErrInvalidIssueID = errors.New("invalid issue ID")
+
+// validateIssueID rejects IDs that are empty or could name a file outside
+// .wong/issues: ones containing a path separator or "..". Every store
+// checks the IDs it reads, writes and deletes.
+func validateIssueID(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return fmt.Errorf("wongdb: %w %q: must be non-empty without /, \\ or ..", ErrInvalidIssueID, id)
+	}
+	return nil
+}
+
+var (
+	_ IssueStore = (*WongDB)(nil)
+	_ IssueStore = (*GitStore)(nil)
+	_ IssueStore = (*FSStore)(nil)
+	_ IssueStore = (*MemStore)(nil)
+)
+
+// OpenStore returns the IssueStore for the repository at repoRoot: the
+// jj-native WongDB when there is a .jj directory, otherwise a GitStore when
+// there is a .git directory or file, otherwise an FSStore when there is
+// already a .wong directory.
+func OpenStore(repoRoot string) (IssueStore, error) {
+	if info, err := os.Stat(filepath.Join(repoRoot, ".jj")); err == nil && info.IsDir() {
+		return New(repoRoot), nil
+	}
+	if _, err := os.Stat(filepath.Join(repoRoot, ".git")); err == nil {
+		return NewGitStore(repoRoot), nil
+	}
+	if info, err := os.Stat(filepath.Join(repoRoot, wongDir)); err == nil && info.IsDir() {
+		return NewFSStore(repoRoot), nil
+	}
+	return nil, fmt.Errorf("wongdb: no jj or git repository or %s directory in %s", wongDir, repoRoot)
+}
+
+// stagedReader is implemented by stores that can return an issue's staged,
+// not yet synced, data.
+type stagedReader interface {
+	stagedIssue(id string) ([]byte, bool)
+}
+
+// readStaged returns an issue's staged data if it has any and its synced
+// data otherwise. A staged delete reads as not found.
+func readStaged(ctx context.Context, s IssueStore, id string) ([]byte, error) {
+	if sr, ok := s.(stagedReader); ok {
+		if data, staged := sr.stagedIssue(id); staged {
+			if data == nil {
+				return nil, fmt.Errorf("wongdb: issue %s not found: %w", id, os.ErrNotExist)
+			}
+			return data, nil
+		}
+	}
+	return s.ReadIssue(ctx, id)
+}
+
+// stagedIssues holds the writes and deletes a store has not synced yet,
+// keyed by issue ID. A nil value is a pending delete.
+type stagedIssues struct {
+	mu      sync.Mutex
+	pending map[string][]byte
+}
+
+// write stages a copy of data for id.
+func (st *stagedIssues) write(id string, data []byte) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.pending == nil {
+		st.pending = make(map[string][]byte)
+	}
+	st.pending[id] = append([]byte{}, data...) // copy; never nil
+}
+
+// remove stages the deletion of id. committed reports whether the store
+// already has the issue; it is only called when id has nothing staged.
+func (st *stagedIssues) remove(id string, committed func() bool) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	data, staged := st.pending[id]
+	if staged && data == nil || !staged && !committed() {
+		return fmt.Errorf("wongdb: issue %s not found: %w", id, os.ErrNotExist)
+	}
+	if st.pending == nil {
+		st.pending = make(map[string][]byte)
+	}
+	st.pending[id] = nil
+	return nil
+}
+
+// get returns the data staged for id; ok is false if nothing is staged, and
+// data is nil for a staged delete.
+func (st *stagedIssues) get(id string) (data []byte, ok bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	data, ok = st.pending[id]
+	return data, ok
+}
+
+// take returns the staged changes and clears them. In plan mode it records
+// them in the plan instead and returns nothing, leaving them staged.
+func (st *stagedIssues) take(ctx context.Context) map[string][]byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if plan := vcs.PlanFromContext(ctx); plan != nil {
+		for _, id := range sortedKeys(st.pending) {
+			if st.pending[id] == nil {
+				plan.AddNote("delete " + issuePath(id))
+			} else {
+				plan.AddNote("write " + issuePath(id))
+			}
+			plan.AddFiles(issuePath(id))
+		}
+		return nil
+	}
+	pending := st.pending
+	st.pending = nil
+	return pending
+}
+
+// restore puts back changes from a failed sync, unless id was staged again
+// in the meantime.
+func (st *stagedIssues) restore(pending map[string][]byte) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for id, data := range pending {
+		if _, again := st.pending[id]; again {
+			continue
+		}
+		if st.pending == nil {
+			st.pending = make(map[string][]byte)
+		}
+		st.pending[id] = data
+	}
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
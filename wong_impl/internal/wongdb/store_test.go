@@ -0,0 +1,169 @@
+package wongdb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+// storeBackends returns a fresh, uninitialized store of each kind that runs
+// without jj.
+func storeBackends(t *testing.T) map[string]IssueStore {
+	t.Helper()
+	return map[string]IssueStore{
+		"mem": NewMemStore(),
+		"fs":  NewFSStore(t.TempDir()),
+		"git": NewGitStore(setupGitRepo(t, t.TempDir())),
+	}
+}
+
+func TestIssueStore_Contract(t *testing.T) {
+	for name, s := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if s.IsInitialized(ctx) {
+				t.Fatal("IsInitialized before Init")
+			}
+			if err := s.Init(ctx); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			if err := s.Init(ctx); err != nil {
+				t.Fatalf("second Init: %v", err)
+			}
+			if cfg, err := s.ReadConfig(ctx); err != nil || cfg.HistoryMode != "squash" {
+				t.Errorf("ReadConfig = %+v, %v", cfg, err)
+			}
+
+			s.WriteIssue(ctx, "bt-2", []byte("two"))
+			s.WriteIssue(ctx, "bt-1", []byte("one"))
+			if ids, _ := s.ListIssueIDs(ctx); len(ids) != 0 {
+				t.Errorf("ListIssueIDs before Sync = %v, want none", ids)
+			}
+			if _, err := s.ReadIssue(ctx, "bt-1"); err == nil {
+				t.Error("ReadIssue saw an unsynced write")
+			}
+			if err := s.Sync(ctx); err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+			if ids, _ := s.ListIssueIDs(ctx); strings.Join(ids, " ") != "bt-1 bt-2" {
+				t.Errorf("ListIssueIDs = %v", ids)
+			}
+			if data, err := s.ReadIssue(ctx, "bt-1"); err != nil || string(data) != "one" {
+				t.Errorf("ReadIssue = %q, %v", data, err)
+			}
+
+			if err := s.DeleteIssue(ctx, "bt-1"); err != nil {
+				t.Fatalf("DeleteIssue: %v", err)
+			}
+			if err := s.DeleteIssue(ctx, "bt-1"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("second DeleteIssue = %v, want not found", err)
+			}
+			if err := s.DeleteIssue(ctx, "bt-9"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("DeleteIssue(missing) = %v, want not found", err)
+			}
+			if err := s.Sync(ctx); err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+			if ids, _ := s.ListIssueIDs(ctx); strings.Join(ids, " ") != "bt-2" {
+				t.Errorf("ListIssueIDs after delete = %v", ids)
+			}
+		})
+	}
+}
+
+func TestIssueStore_RejectsPathIDs(t *testing.T) {
+	for name, s := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := s.Init(ctx); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			for _, id := range []string{"", "../config", "../../victim", `a\b`, "x..y"} {
+				if err := s.WriteIssue(ctx, id, []byte("{}")); !errors.Is(err, ErrInvalidIssueID) {
+					t.Errorf("WriteIssue(%q) = %v, want ErrInvalidIssueID", id, err)
+				}
+				if _, err := s.ReadIssue(ctx, id); !errors.Is(err, ErrInvalidIssueID) {
+					t.Errorf("ReadIssue(%q) = %v, want ErrInvalidIssueID", id, err)
+				}
+				if err := s.DeleteIssue(ctx, id); !errors.Is(err, ErrInvalidIssueID) {
+					t.Errorf("DeleteIssue(%q) = %v, want ErrInvalidIssueID", id, err)
+				}
+			}
+			if err := s.Sync(ctx); err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+			if cfg, err := s.ReadConfig(ctx); err != nil || cfg.HistoryMode != "squash" {
+				t.Errorf("ReadConfig after rejected writes = %+v, %v", cfg, err)
+			}
+		})
+	}
+}
+
+func TestIssueStore_PlanModeKeepsPending(t *testing.T) {
+	for name, s := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := s.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			s.WriteIssue(ctx, "bt-1", []byte("one"))
+			plan, err := vcs.DryRun(ctx, s.Sync)
+			if err != nil {
+				t.Fatalf("dry-run Sync: %v", err)
+			}
+			if len(plan.Steps) == 0 {
+				t.Error("plan is empty")
+			}
+			if ids, _ := s.ListIssueIDs(ctx); len(ids) != 0 {
+				t.Errorf("dry run synced %v", ids)
+			}
+			if err := s.Sync(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if ids, _ := s.ListIssueIDs(ctx); strings.Join(ids, " ") != "bt-1" {
+				t.Errorf("ListIssueIDs after real Sync = %v", ids)
+			}
+		})
+	}
+}
+
+func TestFSStore_Layout(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := NewFSStore(dir)
+	if err := s.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s.WriteIssue(ctx, "bt-1", []byte("one"))
+	// With no remote, Push just syncs and Pull does nothing.
+	if err := s.Push(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pull(ctx); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".wong", "issues", "bt-1.json"))
+	if err != nil || string(data) != "one" {
+		t.Errorf("issue file = %q, %v", data, err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, ".wong", "issues"))
+	if len(entries) != 1 {
+		t.Errorf("issues dir has %d entries, want no temp files left", len(entries))
+	}
+
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	if _, ok := store.(*FSStore); !ok {
+		t.Errorf("OpenStore = %T, want *FSStore", store)
+	}
+	if _, err := OpenStore(t.TempDir()); err == nil {
+		t.Error("OpenStore on an empty directory succeeded")
+	}
+}
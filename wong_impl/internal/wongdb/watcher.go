@@ -0,0 +1,275 @@
+package wongdb
+
+// Watcher notifies subscribers when the wong-db commit changes, e.g. because an
+// agent in another workspace created or closed an issue.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/steveyegge/beads/internal/types"
+)
+
+const (
+	// defaultPollInterval is how often the watcher checks the wong-db commit
+	// when fsnotify is unavailable.
+	defaultPollInterval = 2 * time.Second
+
+	// watchDebounce coalesces bursts of op-head updates (a single jj command
+	// can write several operations) into one check.
+	watchDebounce = 100 * time.Millisecond
+)
+
+// Watcher monitors the wong-db bookmark and emits typed events for issues
+// that were created, updated, closed or deleted since the last check.
+//
+// It watches the canonical repo's op heads with fsnotify, so writes from any
+// workspace sharing the repo are seen. If fsnotify can't be set up, it falls
+// back to polling. Reads use --ignore-working-copy so that checking for
+// changes never snapshots the working copy (which would itself write a new
+// operation and wake the watcher again).
+type Watcher struct {
+	db           *WongDB
+	pollInterval time.Duration
+	events       eventHub
+
+	mu         sync.Mutex
+	lastCommit string
+	snapshot   map[string]*types.Issue
+}
+
+// NewWatcher creates a watcher for db. Call Run to start watching.
+func NewWatcher(db *WongDB) *Watcher {
+	return &Watcher{
+		db:           db,
+		pollInterval: defaultPollInterval,
+	}
+}
+
+// SetPollInterval sets how often the watcher polls when fsnotify is
+// unavailable. Non-positive values are ignored.
+func (w *Watcher) SetPollInterval(d time.Duration) {
+	if d > 0 {
+		w.pollInterval = d
+	}
+}
+
+// Subscribe returns a channel of issue events and a function that cancels the
+// subscription. Events are dropped for subscribers that don't keep up.
+func (w *Watcher) Subscribe() (<-chan *Event, func()) {
+	ch := w.events.subscribe()
+	return ch, func() { w.events.unsubscribe(ch) }
+}
+
+// Run watches for wong-db changes until ctx is cancelled. The state at start
+// is the baseline; only later changes produce events.
+func (w *Watcher) Run(ctx context.Context) error {
+	if err := w.Check(ctx); err != nil {
+		return err
+	}
+
+	fsw, err := w.newFSWatcher()
+	if err != nil {
+		return w.poll(ctx)
+	}
+	defer fsw.Close()
+	return w.watch(ctx, fsw)
+}
+
+// Check compares the current wong-db commit against the last one seen and
+// publishes an event for each issue that differs. The first call only records
+// the baseline. If the issues can't be read, nothing is published and the
+// last good snapshot is kept for the next check.
+func (w *Watcher) Check(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	commit, err := w.db.runJJ(ctx, "--ignore-working-copy", "log", "-r", wongDBBookmark, "--no-graph", "-T", "commit_id")
+	if err != nil {
+		return fmt.Errorf("wongdb: watch: %w", err)
+	}
+	if commit == w.lastCommit {
+		return nil
+	}
+
+	issues, err := w.loadIssuesAt(ctx, commit)
+	if err != nil {
+		return fmt.Errorf("wongdb: watch: %w", err)
+	}
+
+	if w.snapshot != nil {
+		for _, ev := range diffIssues(w.workflowAt(ctx, commit), w.snapshot, issues) {
+			w.events.publish(ev)
+		}
+	}
+	w.lastCommit = commit
+	w.snapshot = issues
+	return nil
+}
+
+// newFSWatcher watches the op heads directory of the canonical repo. Every jj
+// operation in any workspace adds a file there.
+func (w *Watcher) newFSWatcher() (*fsnotify.Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	repoPath := w.db.canonicalRepoPath()
+	if err := fsw.Add(filepath.Join(repoPath, "op_heads", "heads")); err != nil {
+		if err := fsw.Add(repoPath); err != nil {
+			fsw.Close()
+			return nil, err
+		}
+	}
+	return fsw, nil
+}
+
+// watch runs the fsnotify loop, debouncing bursts of events into one Check.
+// Errors from Check are transient (e.g. a concurrent jj command holding the
+// repo) and are retried on the next event or poll tick.
+func (w *Watcher) watch(ctx context.Context, fsw *fsnotify.Watcher) error {
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	// Poll as well, at a slower rate, in case an event is missed (e.g. on
+	// network filesystems).
+	ticker := time.NewTicker(w.pollInterval * 5)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-fsw.Events:
+			if !ok {
+				return w.poll(ctx)
+			}
+			debounce.Reset(watchDebounce)
+		case _, ok := <-fsw.Errors:
+			if !ok {
+				return w.poll(ctx)
+			}
+		case <-debounce.C:
+			w.Check(ctx)
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// poll checks for changes every pollInterval until ctx is cancelled.
+func (w *Watcher) poll(ctx context.Context) error {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// loadIssuesAt reads every issue in the given wong-db commit without touching
+// the working copy. All issue files are read with one "jj file show"; if
+// their concatenation doesn't decode, they are read one at a time so that a
+// single malformed file is skipped rather than hiding every issue.
+func (w *Watcher) loadIssuesAt(ctx context.Context, commit string) (map[string]*types.Issue, error) {
+	output, err := w.db.runJJ(ctx, "--ignore-working-copy", "file", "show", "-r", commit, wongIssuesDir+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make(map[string]*types.Issue)
+	dec := json.NewDecoder(strings.NewReader(output))
+	for {
+		var issue types.Issue
+		if err := dec.Decode(&issue); err == io.EOF {
+			return issues, nil
+		} else if err != nil {
+			return w.loadIssueFilesAt(ctx, commit)
+		}
+		issues[issue.ID] = &issue
+	}
+}
+
+// loadIssueFilesAt reads a commit's issue files one at a time, skipping
+// malformed ones.
+func (w *Watcher) loadIssueFilesAt(ctx context.Context, commit string) (map[string]*types.Issue, error) {
+	output, err := w.db.runJJ(ctx, "--ignore-working-copy", "file", "list", "-r", commit, wongIssuesDir+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make(map[string]*types.Issue)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasSuffix(line, ".json") {
+			continue
+		}
+		data, err := w.db.runJJ(ctx, "--ignore-working-copy", "file", "show", "-r", commit, line)
+		if err != nil {
+			return nil, err
+		}
+		var issue types.Issue
+		if err := json.Unmarshal([]byte(data), &issue); err != nil {
+			// Skip malformed files rather than stopping the watcher.
+			continue
+		}
+		issues[issue.ID] = &issue
+	}
+	return issues, nil
+}
+
+// workflowAt returns the workflow in a commit's config, or nil (the built-in
+// workflow) if the config cannot be read or its workflow is broken.
+func (w *Watcher) workflowAt(ctx context.Context, commit string) *Workflow {
+	data, err := w.db.runJJ(ctx, "--ignore-working-copy", "file", "show", "-r", commit, wongDir+"/config.json")
+	if err != nil {
+		return nil
+	}
+	var cfg Config
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil || cfg.Workflow.Validate() != nil {
+		return nil
+	}
+	return cfg.Workflow
+}
+
+// diffIssues returns events for every issue that differs between two
+// snapshots, ordered by issue ID. Closes are judged by wf.
+func diffIssues(wf *Workflow, before, after map[string]*types.Issue) []*Event {
+	ids := make(map[string]bool, len(before)+len(after))
+	for id := range before {
+		ids[id] = true
+	}
+	for id := range after {
+		ids[id] = true
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	var events []*Event
+	for _, id := range sorted {
+		b, a := before[id], after[id]
+		if b != nil && a != nil && reflect.DeepEqual(b, a) {
+			continue
+		}
+		if ev := NewEvent(wf, b, a); ev != nil {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
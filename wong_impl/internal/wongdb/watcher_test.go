@@ -0,0 +1,188 @@
+package wongdb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/steveyegge/beads/internal/types"
+	"github.com/steveyegge/beads/internal/vcs"
+)
+
+func TestDiffIssues(t *testing.T) {
+	unchanged := makeTestIssue("w-1", "Unchanged")
+	edited := makeTestIssue("w-2", "Before edit")
+	editedAfter := makeTestIssue("w-2", "After edit")
+	closing := makeTestIssue("w-3", "Closing")
+	closed := makeTestIssue("w-3", "Closing")
+	closed.Status = types.StatusClosed
+	deleted := makeTestIssue("w-4", "Deleted")
+	created := makeTestIssue("w-5", "Created")
+
+	before := map[string]*types.Issue{
+		"w-1": unchanged,
+		"w-2": edited,
+		"w-3": closing,
+		"w-4": deleted,
+	}
+	after := map[string]*types.Issue{
+		"w-1": makeTestIssue("w-1", "Unchanged"),
+		"w-2": editedAfter,
+		"w-3": closed,
+		"w-5": created,
+	}
+	// Keep timestamps identical so the unchanged issue compares equal.
+	after["w-1"].CreatedAt = unchanged.CreatedAt
+	after["w-1"].UpdatedAt = unchanged.UpdatedAt
+
+	events := diffIssues(nil, before, after)
+	want := []struct {
+		id  string
+		typ EventType
+	}{
+		{"w-2", EventIssueUpdated},
+		{"w-3", EventIssueClosed},
+		{"w-4", EventIssueDeleted},
+		{"w-5", EventIssueCreated},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		if events[i].IssueID != w.id || events[i].Type != w.typ {
+			t.Errorf("event %d = %s %s, want %s %s", i, events[i].Type, events[i].IssueID, w.typ, w.id)
+		}
+	}
+	if events[0].Before.Title != "Before edit" || events[0].After.Title != "After edit" {
+		t.Errorf("update event payloads = %+v / %+v", events[0].Before, events[0].After)
+	}
+}
+
+func TestWatcher_CheckKeepsSnapshotOnReadError(t *testing.T) {
+	one := makeTestIssue("w-1", "One")
+	two := makeTestIssue("w-2", "Two")
+	twoEdited := makeTestIssue("w-2", "Two, edited")
+	twoEdited.CreatedAt, twoEdited.UpdatedAt = two.CreatedAt, two.UpdatedAt
+	issueJSON := func(issues ...*types.Issue) string {
+		var out string
+		for _, issue := range issues {
+			data, err := json.MarshalIndent(issue, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			out += string(data) + "\n"
+		}
+		return out
+	}
+	logArgs := []string{"--ignore-working-copy", "log", "-r", wongDBBookmark, "--no-graph", "-T", "commit_id"}
+	show := func(rev string, path string) []string {
+		return []string{"--ignore-working-copy", "file", "show", "-r", rev, path}
+	}
+	transcript := &vcs.Transcript{Entries: []vcs.TranscriptEntry{
+		{Bin: "jj", Args: logArgs, Stdout: "c1"},
+		{Bin: "jj", Args: show("c1", wongIssuesDir+"/"), Stdout: issueJSON(one, two)},
+		{Bin: "jj", Args: logArgs, Stdout: "c2"},
+		{Bin: "jj", Args: show("c2", wongIssuesDir+"/"), Stderr: "Error: transient failure", ExitCode: 1},
+		{Bin: "jj", Args: logArgs, Stdout: "c2"},
+		{Bin: "jj", Args: show("c2", wongIssuesDir+"/"), Stdout: issueJSON(one) + "{not json" + issueJSON(twoEdited)},
+		{Bin: "jj", Args: []string{"--ignore-working-copy", "file", "list", "-r", "c2", wongIssuesDir + "/"},
+			Stdout: ".wong/issues/bad.json\n.wong/issues/w-1.json\n.wong/issues/w-2.json\n"},
+		{Bin: "jj", Args: show("c2", ".wong/issues/bad.json"), Stdout: "{not json"},
+		{Bin: "jj", Args: show("c2", ".wong/issues/w-1.json"), Stdout: issueJSON(one)},
+		{Bin: "jj", Args: show("c2", ".wong/issues/w-2.json"), Stdout: issueJSON(twoEdited)},
+		{Bin: "jj", Args: show("c2", ".wong/config.json"), Stdout: `{"prefix":"","history_mode":"squash"}`},
+	}}
+	db := New(t.TempDir())
+	db.SetRunner(&vcs.Runner{Replay: transcript})
+	w := NewWatcher(db)
+	events, cancel := w.Subscribe()
+	defer cancel()
+	ctx := context.Background()
+
+	if err := w.Check(ctx); err != nil {
+		t.Fatalf("baseline Check: %v", err)
+	}
+	if err := w.Check(ctx); err == nil {
+		t.Fatal("Check succeeded although the issues could not be read")
+	}
+	if err := w.Check(ctx); err != nil {
+		t.Fatalf("Check after recovery: %v", err)
+	}
+	if unused := transcript.Unused(); len(unused) != 0 {
+		t.Errorf("commands not run: %+v", unused)
+	}
+
+	var got []*Event
+	for len(events) > 0 {
+		got = append(got, <-events)
+	}
+	if len(got) != 1 || got[0].Type != EventIssueUpdated || got[0].IssueID != "w-2" {
+		for _, ev := range got {
+			t.Logf("event: %s %s", ev.Type, ev.IssueID)
+		}
+		t.Fatalf("got %d events, want only the update of w-2", len(got))
+	}
+}
+
+func TestWatcher_DetectsOtherWriters(t *testing.T) {
+	dir := setupJJRepo(t)
+	db := newTestDB(t, dir)
+	ctx := context.Background()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := db.SaveIssue(ctx, makeTestIssue("watch-1", "Existing")); err != nil {
+		t.Fatalf("SaveIssue failed: %v", err)
+	}
+	if err := db.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	w := NewWatcher(newTestDB(t, dir))
+	w.SetPollInterval(50 * time.Millisecond)
+	events, cancelSub := w.Subscribe()
+	defer cancelSub()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- w.Run(runCtx) }()
+
+	// Wait for the baseline so the existing issue doesn't produce an event.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.mu.Lock()
+		ready := w.snapshot != nil
+		w.mu.Unlock()
+		if ready {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("watcher did not record a baseline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := db.SaveIssue(ctx, makeTestIssue("watch-2", "New")); err != nil {
+		t.Fatalf("SaveIssue failed: %v", err)
+	}
+	if err := db.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Type != EventIssueCreated || ev.IssueID != "watch-2" {
+			t.Errorf("event = %s %s, want issue.created watch-2", ev.Type, ev.IssueID)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for watcher event")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run returned error: %v", err)
+	}
+}
@@ -163,7 +163,7 @@ func runLeadAgent(t *testing.T, db *WongDB, ctx context.Context) []componentSpec
 				CreatedBy:   "lead-agent",
 			})
 		}
-		if err := SaveIssue(db, ctx, issue); err != nil {
+		if err := db.SaveIssue(ctx, issue); err != nil {
 			t.Fatalf("[lead] Failed to save component %s: %v", comp.issueID, err)
 		}
 	}
@@ -174,7 +174,7 @@ func runLeadAgent(t *testing.T, db *WongDB, ctx context.Context) []componentSpec
 	// Update project spec to in-progress
 	spec.Status = types.StatusInProgress
 	spec.UpdatedAt = time.Now()
-	if err := SaveIssue(db, ctx, &spec); err != nil {
+	if err := db.SaveIssue(ctx, &spec); err != nil {
 		t.Fatalf("[lead] Failed to update project spec: %v", err)
 	}
 	if err := db.Sync(ctx); err != nil {
@@ -238,7 +238,7 @@ func runSubAgent(t *testing.T, wsDB *WongDB, ctx context.Context, comp component
 				CreatedBy:   agentName,
 			}},
 		}
-		if err := SaveIssue(wsDB, ctx, subIssue); err != nil {
+		if err := wsDB.SaveIssue(ctx, subIssue); err != nil {
 			return fmt.Errorf("[%s] save subtask %s: %w", agentName, sub.id, err)
 		}
 	}
@@ -273,7 +273,7 @@ func runSubAgent(t *testing.T, wsDB *WongDB, ctx context.Context, comp component
 			CloseReason: "Completed by " + agentName,
 			CreatedBy:   agentName,
 		}
-		if err := SaveIssue(wsDB, ctx, closedSub); err != nil {
+		if err := wsDB.SaveIssue(ctx, closedSub); err != nil {
 			return fmt.Errorf("[%s] close subtask %s: %w", agentName, sub.id, err)
 		}
 		if err := wsDB.Sync(ctx); err != nil {
@@ -287,7 +287,7 @@ func runSubAgent(t *testing.T, wsDB *WongDB, ctx context.Context, comp component
 	myIssue.UpdatedAt = time.Now()
 	myIssue.ClosedAt = timePtr(time.Now())
 	myIssue.CloseReason = "All subtasks complete. Implemented by " + agentName
-	if err := SaveIssue(wsDB, ctx, &myIssue); err != nil {
+	if err := wsDB.SaveIssue(ctx, &myIssue); err != nil {
 		return fmt.Errorf("[%s] close parent: %w", agentName, err)
 	}
 	if err := wsDB.Sync(ctx); err != nil {
@@ -331,7 +331,7 @@ func TestE2E_WongWorkflow(t *testing.T) {
 		UpdatedAt:   now,
 		CreatedBy:   "user",
 	}
-	if err := SaveIssue(db, ctx, projectSpec); err != nil {
+	if err := db.SaveIssue(ctx, projectSpec); err != nil {
 		t.Fatalf("Failed to save project spec: %v", err)
 	}
 	if err := db.Sync(ctx); err != nil {
@@ -488,7 +488,7 @@ func TestE2E_WongWorkflow(t *testing.T) {
 	finalSpec.ClosedAt = timePtr(time.Now())
 	finalSpec.UpdatedAt = time.Now()
 	finalSpec.CloseReason = "All components implemented"
-	SaveIssue(db, ctx, &finalSpec)
+	db.SaveIssue(ctx, &finalSpec)
 	db.Sync(ctx)
 
 	// All 16 issues closed
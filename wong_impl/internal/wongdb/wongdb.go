@@ -5,9 +5,9 @@ package wongdb
 // synced via atomic jj squash with --config override.
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -16,6 +16,8 @@ import (
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/steveyegge/beads/internal/vcs"
 )
 
 const (
@@ -44,12 +46,26 @@ type WongDB struct {
 	// synced yet. Keys are relative paths (e.g., ".wong/issues/bt-1.json").
 	// This is used to preserve pending changes across jj workspace update-stale.
 	dirtyFiles map[string][]byte
+
+	// runner runs every jj command; nil means vcs.DefaultRunner.
+	runner *vcs.Runner
+
+	// capsOnce guards the jj version probe; see dialect.
+	capsOnce sync.Once
+	caps     vcs.JJCapabilities
+	capsErr  error
 }
 
 // Config represents .wong/config.yaml (stored as JSON for simplicity).
 type Config struct {
 	Prefix      string `json:"prefix"`
 	HistoryMode string `json:"history_mode"` // "squash" (default) or "chain"
+
+	// Schema, if set, is enforced by SaveIssue, Batch and Sync.
+	Schema *Schema `json:"schema,omitempty"`
+
+	// Workflow, if set, governs status changes and readiness.
+	Workflow *Workflow `json:"workflow,omitempty"`
 }
 
 // Metadata represents .wong/metadata.json.
@@ -72,12 +88,24 @@ func New(repoRoot string) *WongDB {
 	}
 }
 
-// jjCmd creates an exec.Cmd for running jj with the given arguments.
-// The command's working directory is set to the repo root.
-func (db *WongDB) jjCmd(ctx context.Context, args ...string) *exec.Cmd {
-	cmd := exec.CommandContext(ctx, db.jjBin, args...)
-	cmd.Dir = db.repoRoot
-	return cmd
+// dialect returns the capabilities of db.jjBin, probing it through db.runner
+// on first use. A release older than vcs.MinJJVersion is reported as
+// vcs.ErrUnsupportedJJVersion every time.
+func (db *WongDB) dialect(ctx context.Context) (vcs.JJCapabilities, error) {
+	db.capsOnce.Do(func() {
+		db.caps, db.capsErr = vcs.ProbeJJCapabilitiesWithRunner(ctx, db.runner, db.jjBin)
+	})
+	return db.caps, db.capsErr
+}
+
+// SetRunner makes db run its jj commands through r.
+func (db *WongDB) SetRunner(r *vcs.Runner) {
+	db.runner = r
+}
+
+// jjInvocation describes a jj command run from the repo root.
+func (db *WongDB) jjInvocation(args ...string) vcs.Invocation {
+	return vcs.Invocation{Bin: db.jjBin, Args: args, Dir: db.repoRoot}
 }
 
 // runJJ executes a jj command and returns its stdout output.
@@ -87,17 +115,13 @@ func (db *WongDB) jjCmd(ctx context.Context, args ...string) *exec.Cmd {
 // the .wong/ files, and retries the command once. This prevents update-stale
 // from overwriting pending .wong/ modifications.
 func (db *WongDB) runJJ(ctx context.Context, args ...string) (string, error) {
-	cmd := db.jjCmd(ctx, args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		errMsg := stderr.String()
+	res, err := db.runner.Run(ctx, db.jjInvocation(args...))
+	if err != nil {
+		cmdErr := jjError(args, err, string(res.Stderr))
 		// Auto-recover from stale working copy (don't retry update-stale itself)
-		if strings.Contains(errMsg, "working copy is stale") &&
+		if errors.Is(cmdErr, vcs.ErrStaleWorkingCopy) &&
 			!(len(args) >= 2 && args[0] == "workspace" && args[1] == "update-stale") {
-			updateCmd := db.jjCmd(ctx, "workspace", "update-stale")
-			updateCmd.Run() // best-effort
+			db.runner.Run(ctx, db.jjInvocation("workspace", "update-stale")) // best-effort
 
 			// Restore only files that THIS instance wrote (dirty files),
 			// which update-stale may have overwritten
@@ -105,36 +129,64 @@ func (db *WongDB) runJJ(ctx context.Context, args ...string) (string, error) {
 				db.restoreWongFiles(snap)
 			}
 
-			cmd2 := db.jjCmd(ctx, args...)
-			var stdout2, stderr2 bytes.Buffer
-			cmd2.Stdout = &stdout2
-			cmd2.Stderr = &stderr2
-			if err2 := cmd2.Run(); err2 != nil {
-				return "", fmt.Errorf("wongdb: jj %s: %w\n%s", strings.Join(args, " "), err2, stderr2.String())
+			res2, err2 := db.runner.Run(ctx, db.jjInvocation(args...))
+			if err2 != nil {
+				return "", jjError(args, err2, string(res2.Stderr))
 			}
-			return strings.TrimSpace(stdout2.String()), nil
+			return strings.TrimSpace(string(res2.Stdout)), nil
 		}
-		return "", fmt.Errorf("wongdb: jj %s: %w\n%s", strings.Join(args, " "), err, errMsg)
+		return "", cmdErr
 	}
-	return strings.TrimSpace(stdout.String()), nil
+	return strings.TrimSpace(string(res.Stdout)), nil
+}
+
+// jjError wraps a failed jj invocation in a vcs.CommandError so callers can
+// classify it with errors.Is (e.g. vcs.ErrStaleWorkingCopy).
+func jjError(args []string, err error, stderr string) error {
+	command := "jj"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	return fmt.Errorf("wongdb: jj %s: %w", strings.Join(args, " "), &vcs.CommandError{
+		VCS:     vcs.VCSTypeJujutsu,
+		Command: command,
+		Args:    args,
+		Stderr:  stderr,
+		Err:     err,
+	})
 }
 
 // Init performs the full initialization flow for wong-db storage.
 // It creates a dedicated jj change off root(), sets up the .wong/ directory
 // structure, creates the wong-db bookmark, sets immutability, and creates
 // a merge working copy with wong-db as a parent.
+//
+// In plan mode (vcs.WithPlan) nothing is written; the plan lists the jj
+// commands and file writes, the working-copy change that would be
+// reparented, and the .wong/ files that would be created.
 func (db *WongDB) Init(ctx context.Context) error {
 	// Detect jj repo
 	jjDir := filepath.Join(db.repoRoot, ".jj")
 	if _, err := os.Stat(jjDir); os.IsNotExist(err) {
 		return fmt.Errorf("wongdb: not a jj repository (no .jj/ directory in %s)", db.repoRoot)
 	}
+	if _, err := db.dialect(ctx); err != nil {
+		return fmt.Errorf("wongdb: %w", err)
+	}
 
 	// Check if already initialized
 	if db.IsInitialized(ctx) {
 		return nil
 	}
 
+	if plan := vcs.PlanFromContext(ctx); plan != nil {
+		current, err := db.runJJ(ctx, "log", "-r", "@", "--no-graph", "-T", "change_id")
+		if err != nil {
+			return err
+		}
+		plan.AddChanges(current)
+	}
+
 	// Check if the current working copy has any content (non-empty tree).
 	// If it does, we need to preserve it. If empty (fresh repo), we can
 	// just create the merge working copy from scratch.
@@ -163,8 +215,7 @@ func (db *WongDB) Init(ctx context.Context) error {
 	}
 
 	// Create .wong/ directory structure in the working copy
-	issuesDir := filepath.Join(db.repoRoot, wongIssuesDir)
-	if err := os.MkdirAll(issuesDir, 0o755); err != nil {
+	if err := db.mkdirWong(ctx, wongIssuesDir); err != nil {
 		return fmt.Errorf("wongdb: failed to create issues directory: %w", err)
 	}
 
@@ -177,8 +228,7 @@ func (db *WongDB) Init(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("wongdb: failed to marshal config: %w", err)
 	}
-	cfgPath := filepath.Join(db.repoRoot, wongDir, "config.json")
-	if err := os.WriteFile(cfgPath, cfgData, 0o644); err != nil {
+	if err := db.writeWongFile(ctx, wongDir+"/config.json", cfgData); err != nil {
 		return fmt.Errorf("wongdb: failed to write config: %w", err)
 	}
 
@@ -192,8 +242,7 @@ func (db *WongDB) Init(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("wongdb: failed to marshal metadata: %w", err)
 	}
-	metaPath := filepath.Join(db.repoRoot, wongDir, "metadata.json")
-	if err := os.WriteFile(metaPath, metaData, 0o644); err != nil {
+	if err := db.writeWongFile(ctx, wongDir+"/metadata.json", metaData); err != nil {
 		return fmt.Errorf("wongdb: failed to write metadata: %w", err)
 	}
 
@@ -235,6 +284,25 @@ func (db *WongDB) Init(ctx context.Context) error {
 	return nil
 }
 
+// mkdirWong creates rel under the repo root, or records it in plan mode.
+func (db *WongDB) mkdirWong(ctx context.Context, rel string) error {
+	if plan := vcs.PlanFromContext(ctx); plan != nil {
+		plan.AddNote("create directory " + rel)
+		return nil
+	}
+	return os.MkdirAll(filepath.Join(db.repoRoot, rel), 0o755)
+}
+
+// writeWongFile writes rel under the repo root, or records it in plan mode.
+func (db *WongDB) writeWongFile(ctx context.Context, rel string, data []byte) error {
+	if plan := vcs.PlanFromContext(ctx); plan != nil {
+		plan.AddNote("write " + rel)
+		plan.AddFiles(rel)
+		return nil
+	}
+	return os.WriteFile(filepath.Join(db.repoRoot, rel), data, 0o644)
+}
+
 // IsInitialized checks if the wong-db bookmark exists in the repository.
 func (db *WongDB) IsInitialized(ctx context.Context) bool {
 	output, err := db.runJJ(ctx, "bookmark", "list")
@@ -292,6 +360,14 @@ func (db *WongDB) snapshotDirtyFiles() map[string][]byte {
 	return snap
 }
 
+// stagedIssue returns the data this instance wrote for id and has not synced.
+func (db *WongDB) stagedIssue(id string) ([]byte, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	data, ok := db.dirtyFiles[filepath.Join(wongIssuesDir, id+".json")]
+	return data, ok
+}
+
 // restoreWongFiles writes saved .wong/ file contents back to disk.
 func (db *WongDB) restoreWongFiles(files map[string][]byte) error {
 	for rel, data := range files {
@@ -316,7 +392,58 @@ func (db *WongDB) restoreWongFiles(files map[string][]byte) error {
 // Important: jj workspace update-stale may overwrite on-disk files without
 // snapshotting pending changes first. To prevent data loss, Sync saves the
 // .wong/ file contents before update-stale and restores them afterward.
+//
+// If the config has a schema, Sync refuses to squash while any changed
+// issue file breaks it, so a bad file written by hand or by wong-write
+// never reaches wong-db.
 func (db *WongDB) Sync(ctx context.Context) error {
+	unlock, err := db.lockSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := db.validateWorkingCopy(ctx); err != nil {
+		return err
+	}
+	return db.squashLocked(ctx, wongDir+"/")
+}
+
+// validateWorkingCopy checks the issue files that differ from wong-db,
+// whoever wrote them, against the schema before they are squashed.
+func (db *WongDB) validateWorkingCopy(ctx context.Context) error {
+	sch, err := configuredSchema(ctx, db)
+	if err != nil {
+		return fmt.Errorf("wongdb: sync failed: %w", err)
+	}
+	if sch == nil {
+		return nil
+	}
+	out, err := db.runJJ(ctx, "diff", "--name-only", "--from", wongDBBookmark, "--to", "@", wongIssuesDir+"/")
+	if err != nil {
+		return fmt.Errorf("wongdb: sync failed: %w", err)
+	}
+	changes := make(map[string][]byte)
+	for _, line := range strings.Split(out, "\n") {
+		rel := strings.TrimSpace(line)
+		if !strings.HasSuffix(rel, ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(db.repoRoot, rel))
+		if err != nil {
+			continue // deleted
+		}
+		changes[strings.TrimSuffix(filepath.Base(rel), ".json")] = data
+	}
+	if err := validatePending(ctx, db, changes); err != nil {
+		return fmt.Errorf("wongdb: sync failed: %w", err)
+	}
+	return nil
+}
+
+// lockSync brings the working copy up to date, keeping this instance's
+// pending .wong/ files, and takes the exclusive sync lock. The caller must
+// call the returned function to release it.
+func (db *WongDB) lockSync(ctx context.Context) (func(), error) {
 	// Update stale working copy (needed when another workspace modified the repo)
 	db.runJJ(ctx, "workspace", "update-stale")
 
@@ -331,14 +458,16 @@ func (db *WongDB) Sync(ctx context.Context) error {
 	lockPath := db.syncLockPath()
 	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
 	if err != nil {
-		return fmt.Errorf("wongdb: failed to open sync lock %s: %w", lockPath, err)
+		return nil, fmt.Errorf("wongdb: failed to open sync lock %s: %w", lockPath, err)
 	}
-	defer lockFile.Close()
-
 	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
-		return fmt.Errorf("wongdb: failed to acquire sync lock: %w", err)
+		lockFile.Close()
+		return nil, fmt.Errorf("wongdb: failed to acquire sync lock: %w", err)
+	}
+	unlock := func() {
+		syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		lockFile.Close()
 	}
-	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
 
 	// After acquiring lock, update stale again (the lock holder before us
 	// may have modified wong-db, making our working copy stale again)
@@ -346,28 +475,154 @@ func (db *WongDB) Sync(ctx context.Context) error {
 	if snap := db.snapshotDirtyFiles(); snap != nil {
 		db.restoreWongFiles(snap)
 	}
+	return unlock, nil
+}
 
-	_, err = db.runJJ(ctx, "squash", "--into", wongDBBookmark, wongDir+"/",
-		"-u", "--config", `revset-aliases."immutable_heads()"="none()"`)
+// squashLocked squashes the changes to paths, which are relative to the
+// repo root, into wong-db and clears their dirty-tracking entries. The
+// caller must hold the sync lock.
+func (db *WongDB) squashLocked(ctx context.Context, paths ...string) error {
+	_, err := db.runJJ(ctx, squashArgs(paths)...)
 	if err != nil {
 		// Tolerate errors from no changes to squash
-		if strings.Contains(err.Error(), "Nothing changed") || strings.Contains(err.Error(), "no changes") {
+		if errors.Is(err, vcs.ErrNothingChanged) {
 			return nil
 		}
 		return fmt.Errorf("wongdb: sync failed: %w", err)
 	}
 
-	// Clear dirty files after successful sync
+	// Clear the squashed dirty files after successful sync
 	db.mu.Lock()
-	db.dirtyFiles = nil
+	for rel := range db.dirtyFiles {
+		for _, p := range paths {
+			if rel == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(rel, p)) {
+				delete(db.dirtyFiles, rel)
+				break
+			}
+		}
+	}
 	db.mu.Unlock()
 	return nil
 }
 
+// commitBatch writes a batch's issue files and squashes them into wong-db
+// under one hold of the sync lock. Only the batch's own files are squashed;
+// other pending .wong/ changes stay in the working copy for the next Sync.
+// If anything fails, the files and their dirty-tracking entries are put back
+// as they were before the batch.
+func (db *WongDB) commitBatch(ctx context.Context, changes map[string][]byte) error {
+	unlock, err := db.lockSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// prior holds each file's content before the batch; nil means absent.
+	prior := make(map[string][]byte, len(changes))
+	db.mu.Lock()
+	priorDirty := make(map[string][]byte)
+	for id := range changes {
+		rel := filepath.Join(wongIssuesDir, id+".json")
+		data, err := os.ReadFile(filepath.Join(db.repoRoot, rel))
+		if err != nil && !os.IsNotExist(err) {
+			db.mu.Unlock()
+			return fmt.Errorf("wongdb: failed to read issue %s: %w", id, err)
+		}
+		prior[rel] = data
+		if dirty, ok := db.dirtyFiles[rel]; ok {
+			priorDirty[rel] = dirty
+		}
+	}
+	db.mu.Unlock()
+
+	err = db.applyBatchFiles(changes)
+	if err == nil {
+		err = db.squashLocked(ctx, sortedKeys(prior)...)
+	}
+	if err != nil {
+		if rerr := db.rollbackBatchFiles(prior, priorDirty); rerr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// applyBatchFiles writes and removes the batch's files in the working copy,
+// tracking the writes as dirty like WriteIssue does.
+func (db *WongDB) applyBatchFiles(changes map[string][]byte) error {
+	if err := os.MkdirAll(filepath.Join(db.repoRoot, wongIssuesDir), 0o755); err != nil {
+		return fmt.Errorf("wongdb: failed to create issues directory: %w", err)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for id, data := range changes {
+		rel := filepath.Join(wongIssuesDir, id+".json")
+		path := filepath.Join(db.repoRoot, rel)
+		if data == nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("wongdb: failed to delete issue %s: %w", id, err)
+			}
+			delete(db.dirtyFiles, rel)
+			continue
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return fmt.Errorf("wongdb: failed to write issue %s: %w", id, err)
+		}
+		if db.dirtyFiles == nil {
+			db.dirtyFiles = make(map[string][]byte)
+		}
+		db.dirtyFiles[rel] = data
+	}
+	return nil
+}
+
+// rollbackBatchFiles restores the files and dirty entries saved before a
+// batch.
+func (db *WongDB) rollbackBatchFiles(prior, priorDirty map[string][]byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var errs []error
+	for rel, data := range prior {
+		path := filepath.Join(db.repoRoot, rel)
+		if data == nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		} else if err := os.WriteFile(path, data, 0o644); err != nil {
+			errs = append(errs, err)
+		}
+		if dirty, ok := priorDirty[rel]; ok {
+			if db.dirtyFiles == nil {
+				db.dirtyFiles = make(map[string][]byte)
+			}
+			db.dirtyFiles[rel] = dirty
+		} else {
+			delete(db.dirtyFiles, rel)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// squashArgs returns the command that moves the pending changes to paths
+// into the wong-db change, keeping its description.
+func squashArgs(paths []string) []string {
+	args := append([]string{"squash", "--into", wongDBBookmark}, paths...)
+	return append(args, "-u", "--config", `revset-aliases."immutable_heads()"="none()"`)
+}
+
 // ReadIssue reads a single issue's raw JSON bytes from the wong-db change.
 func (db *WongDB) ReadIssue(ctx context.Context, id string) ([]byte, error) {
+	return db.readIssueAt(ctx, wongDBBookmark, id)
+}
+
+// readIssueAt reads an issue's raw JSON bytes as of revision rev.
+func (db *WongDB) readIssueAt(ctx context.Context, rev, id string) ([]byte, error) {
+	if err := validateIssueID(id); err != nil {
+		return nil, err
+	}
 	issuePath := filepath.Join(wongIssuesDir, id+".json")
-	output, err := db.runJJ(ctx, "file", "show", "-r", wongDBBookmark, issuePath)
+	output, err := db.runJJ(ctx, "file", "show", "-r", rev, issuePath)
 	if err != nil {
 		return nil, fmt.Errorf("wongdb: failed to read issue %s: %w", id, err)
 	}
@@ -377,7 +632,12 @@ func (db *WongDB) ReadIssue(ctx context.Context, id string) ([]byte, error) {
 // ListIssueIDs returns the IDs of all issues stored in wong-db.
 // It lists files in .wong/issues/ and extracts IDs from filenames.
 func (db *WongDB) ListIssueIDs(ctx context.Context) ([]string, error) {
-	output, err := db.runJJ(ctx, "file", "list", "-r", wongDBBookmark, wongIssuesDir+"/")
+	return db.listIssueIDsAt(ctx, wongDBBookmark)
+}
+
+// listIssueIDsAt returns the IDs of the issues that existed at revision rev.
+func (db *WongDB) listIssueIDsAt(ctx context.Context, rev string) ([]string, error) {
+	output, err := db.runJJ(ctx, "file", "list", "-r", rev, wongIssuesDir+"/")
 	if err != nil {
 		// No issues directory or empty - return empty list
 		return nil, nil
@@ -399,9 +659,29 @@ func (db *WongDB) ListIssueIDs(ctx context.Context) ([]string, error) {
 	return ids, nil
 }
 
+// issueHistory returns the changes in rev's ancestry that touched an issue's
+// file, newest first. In squash history mode that is usually just the
+// wong-db change itself.
+func (db *WongDB) issueHistory(ctx context.Context, rev, id string) ([]HistoryEntry, error) {
+	if err := validateIssueID(id); err != nil {
+		return nil, err
+	}
+	template := `change_id.short() ++ "\x00" ++ author.name() ++ "\x00" ++ ` +
+		`author.timestamp().format("%Y-%m-%dT%H:%M:%S%:z") ++ "\x00" ++ description.first_line() ++ "` + linkRecordSep + `"`
+	output, err := db.runJJ(ctx, "log", "-r", "::("+rev+")", "--no-graph", "-T", template,
+		filepath.Join(wongIssuesDir, id+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: history of issue %s: %w", id, err)
+	}
+	return parseHistory(output), nil
+}
+
 // WriteIssue writes an issue's raw JSON data to the working copy filesystem.
 // The caller should call Sync() afterward to persist the change to wong-db.
 func (db *WongDB) WriteIssue(ctx context.Context, id string, data []byte) error {
+	if err := validateIssueID(id); err != nil {
+		return err
+	}
 	issuesDir := filepath.Join(db.repoRoot, wongIssuesDir)
 	if err := os.MkdirAll(issuesDir, 0o755); err != nil {
 		return fmt.Errorf("wongdb: failed to create issues directory: %w", err)
@@ -426,6 +706,9 @@ func (db *WongDB) WriteIssue(ctx context.Context, id string, data []byte) error
 // DeleteIssue removes an issue file from the working copy filesystem.
 // The caller should call Sync() afterward to persist the deletion to wong-db.
 func (db *WongDB) DeleteIssue(ctx context.Context, id string) error {
+	if err := validateIssueID(id); err != nil {
+		return err
+	}
 	issuePath := filepath.Join(db.repoRoot, wongIssuesDir, id+".json")
 	if err := os.Remove(issuePath); err != nil {
 		if os.IsNotExist(err) {
@@ -462,12 +745,19 @@ func (db *WongDB) Push(ctx context.Context) error {
 	_, err := db.runJJ(ctx, "git", "push", "-b", wongDBBookmark)
 	if err != nil {
 		// If bookmark not tracked, try tracking it first
-		if strings.Contains(err.Error(), "Refusing to create") {
+		if errors.Is(err, vcs.ErrNewRemoteBookmark) {
 			if _, trackErr := db.runJJ(ctx, "bookmark", "track",
 				wongDBBookmark+"@origin"); trackErr != nil {
 				// Tracking failed - might be first push, try with --allow-new
-				if _, err2 := db.runJJ(ctx, "git", "push", "-b", wongDBBookmark,
-					"--allow-new"); err2 != nil {
+				caps, err := db.dialect(ctx)
+				if err != nil {
+					return fmt.Errorf("wongdb: push failed: %w", err)
+				}
+				args := []string{"git", "push", "-b", wongDBBookmark}
+				if caps.PushAllowNew {
+					args = append(args, "--allow-new")
+				}
+				if _, err2 := db.runJJ(ctx, args...); err2 != nil {
 					return fmt.Errorf("wongdb: push failed: %w", err2)
 				}
 				return nil
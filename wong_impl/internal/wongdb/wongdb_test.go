@@ -3,6 +3,7 @@ package wongdb
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/steveyegge/beads/internal/types"
+	"github.com/steveyegge/beads/internal/vcs"
 )
 
 // setupJJRepo creates a temporary directory with a colocated jj+git repo.
@@ -919,6 +921,38 @@ func TestWongDB_NewSetsRepoRoot(t *testing.T) {
 	_ = db
 }
 
+// TestWongDB_DialectProbesThroughRunner verifies that the jj version probe
+// goes through the runner set with SetRunner, like every other jj command.
+func TestWongDB_DialectProbesThroughRunner(t *testing.T) {
+	transcript := &vcs.Transcript{Entries: []vcs.TranscriptEntry{
+		{Bin: "jj", Args: []string{"--version"}, Stdout: "jj 0.23.0\n"},
+	}}
+	db := New(t.TempDir())
+	db.SetRunner(&vcs.Runner{Replay: transcript})
+
+	caps, err := db.dialect(context.Background())
+	if err != nil || caps.Version.String() != "0.23.0" || caps.PushAllowNew {
+		t.Errorf("dialect = %+v, %v; want jj 0.23 without --allow-new", caps, err)
+	}
+	if unused := transcript.Unused(); len(unused) != 0 {
+		t.Errorf("version probe did not use the runner: %+v unused", unused)
+	}
+}
+
+// TestWongDB_UnsupportedJJIsReported verifies that methods needing the jj
+// dialect fail on releases older than vcs.MinJJVersion, not just Init.
+func TestWongDB_UnsupportedJJIsReported(t *testing.T) {
+	transcript := &vcs.Transcript{Entries: []vcs.TranscriptEntry{
+		{Bin: "jj", Args: []string{"--version"}, Stdout: "jj 0.21.0\n"},
+	}}
+	db := New(t.TempDir())
+	db.SetRunner(&vcs.Runner{Replay: transcript})
+
+	if _, err := db.IssuesForChange(context.Background(), "qpvuntsmwlqt"); !errors.Is(err, vcs.ErrUnsupportedJJVersion) {
+		t.Errorf("IssuesForChange = %v, want ErrUnsupportedJJVersion", err)
+	}
+}
+
 // TestWongDB_DeleteIssue_NotFound tests deleting an issue that does not exist.
 func TestWongDB_DeleteIssue_NotFound(t *testing.T) {
 	dir := setupJJRepo(t)
@@ -1100,3 +1134,17 @@ func TestWongDB_Init_SubdirectoryPath(t *testing.T) {
 		t.Error("expected IsInitialized to return true after Init")
 	}
 }
+
+func TestJJError_Classifies(t *testing.T) {
+	err := jjError([]string{"git", "push", "-b", "wong-db"}, errors.New("exit status 1"),
+		"Error: Refusing to create new remote bookmark wong-db@origin\n")
+	if !errors.Is(err, vcs.ErrNewRemoteBookmark) {
+		t.Errorf("errors.Is(%v, ErrNewRemoteBookmark) = false", err)
+	}
+	if !strings.HasPrefix(err.Error(), "wongdb: jj git push -b wong-db: ") {
+		t.Errorf("error message = %q", err.Error())
+	}
+	if !strings.Contains(err.Error(), "Refusing to create") {
+		t.Errorf("error message lost stderr: %q", err.Error())
+	}
+}
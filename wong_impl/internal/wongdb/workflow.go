@@ -0,0 +1,360 @@
+package wongdb
+
+// Workflow is the issue state machine configured under "workflow" in
+// .wong/config.json, for example:
+//
+//	"workflow": {
+//	  "states": [
+//	    {"name": "open"}, {"name": "in_progress"}, {"name": "in_review"},
+//	    {"name": "blocked_external", "hold": true}, {"name": "deferred", "hold": true},
+//	    {"name": "closed", "done": true}
+//	  ],
+//	  "transitions": [
+//	    {"from": ["open", "deferred"], "to": ["in_progress", "deferred", "blocked_external"]},
+//	    {"from": ["in_progress", "blocked_external"], "to": ["in_review", "blocked_external", "open"]},
+//	    {"from": ["in_review"], "to": ["closed"], "hooks": ["require_linked_change"]},
+//	    {"from": ["closed"], "to": ["open"], "hooks": ["reset_claim"]}
+//	  ]
+//	}
+//
+// A nil or empty Workflow is the built-in one: any status may follow any
+// other, "closed" is done and "tombstone" is held.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/steveyegge/beads/internal/types"
+)
+
+var (
+	// ErrTransitionNotAllowed is returned when the workflow has no rule
+	// for a status change, or the target status is not one of its states.
+	ErrTransitionNotAllowed = errors.New("transition not allowed")
+
+	// ErrTransitionRejected is returned when a transition hook refuses a
+	// status change.
+	ErrTransitionRejected = errors.New("transition rejected")
+)
+
+// WorkflowState is one issue status.
+type WorkflowState struct {
+	Name string `json:"name"`
+
+	// Done states count as finished: issues in them are not ready, and
+	// they no longer block the issues that depend on them.
+	Done bool `json:"done,omitempty"`
+
+	// Hold states are parked: issues in them are not ready, but they still
+	// block their dependents.
+	Hold bool `json:"hold,omitempty"`
+}
+
+// WorkflowTransition allows moving from any of From to any of To, running
+// Hooks in order first. "*" in From or To matches every state.
+type WorkflowTransition struct {
+	From  []string `json:"from"`
+	To    []string `json:"to"`
+	Hooks []string `json:"hooks,omitempty"`
+}
+
+// Workflow lists the states issues can be in and the transitions between
+// them. With no States any status is accepted; with no Transitions any
+// change is allowed.
+type Workflow struct {
+	States      []WorkflowState      `json:"states,omitempty"`
+	Transitions []WorkflowTransition `json:"transitions,omitempty"`
+}
+
+// state returns the configured state called name.
+func (wf *Workflow) state(name string) (WorkflowState, bool) {
+	if wf != nil {
+		for _, st := range wf.States {
+			if st.Name == name {
+				return st, true
+			}
+		}
+	}
+	return WorkflowState{}, false
+}
+
+// IsDone reports whether status is a done state. Statuses the workflow does
+// not list fall back to the built-in rule: only "closed" is done.
+func (wf *Workflow) IsDone(status types.Status) bool {
+	if st, ok := wf.state(string(status)); ok {
+		return st.Done
+	}
+	return status == types.StatusClosed
+}
+
+// IsHeld reports whether status is a hold state. Statuses the workflow does
+// not list fall back to the built-in rule: only "tombstone" is held.
+func (wf *Workflow) IsHeld(status types.Status) bool {
+	if st, ok := wf.state(string(status)); ok {
+		return st.Hold
+	}
+	return status == types.StatusTombstone
+}
+
+// CloseState is the state issues are closed into: the first done state, or
+// "closed".
+func (wf *Workflow) CloseState() types.Status {
+	if wf != nil {
+		for _, st := range wf.States {
+			if st.Done {
+				return types.Status(st.Name)
+			}
+		}
+	}
+	return types.StatusClosed
+}
+
+// Validate checks that state names are unique and that transitions name
+// known states and registered hooks.
+func (wf *Workflow) Validate() error {
+	if wf == nil {
+		return nil
+	}
+	known := make(map[string]bool, len(wf.States))
+	for _, st := range wf.States {
+		if st.Name == "" {
+			return fmt.Errorf("wongdb: workflow: state with no name")
+		}
+		if known[st.Name] {
+			return fmt.Errorf("wongdb: workflow: state %s defined twice", st.Name)
+		}
+		if st.Done && st.Hold {
+			return fmt.Errorf("wongdb: workflow: state %s cannot be both done and hold", st.Name)
+		}
+		known[st.Name] = true
+	}
+	for i, tr := range wf.Transitions {
+		for _, name := range append(append([]string{}, tr.From...), tr.To...) {
+			if name != "*" && len(known) > 0 && !known[name] {
+				return fmt.Errorf("wongdb: workflow: transition %d names unknown state %s", i, name)
+			}
+		}
+		for _, h := range tr.Hooks {
+			if lookupTransitionHook(h) == nil {
+				return fmt.Errorf("wongdb: workflow: transition %d uses unknown hook %s", i, h)
+			}
+		}
+	}
+	return nil
+}
+
+// hooksFor returns the hooks of every rule allowing from -> to, and whether
+// any rule does.
+func (wf *Workflow) hooksFor(from, to string) ([]string, bool) {
+	if wf == nil || len(wf.Transitions) == 0 {
+		return nil, true
+	}
+	var hooks []string
+	allowed := false
+	for _, tr := range wf.Transitions {
+		if matchesState(tr.From, from) && matchesState(tr.To, to) {
+			allowed = true
+			hooks = append(hooks, tr.Hooks...)
+		}
+	}
+	return hooks, allowed
+}
+
+func matchesState(names []string, state string) bool {
+	for _, n := range names {
+		if n == "*" || n == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply moves issue to status to: it checks the workflow allows the
+// change, runs the transition's hooks, and then sets the status. Entering a
+// done state sets ClosedAt and, if reason is given, CloseReason; leaving
+// one clears both. Apply changes issue in memory only; Transition also
+// saves it. Moving to the current status does nothing.
+func (wf *Workflow) Apply(ctx context.Context, s IssueStore, issue *types.Issue, to types.Status, reason string) error {
+	from := issue.Status
+	if from == to {
+		return nil
+	}
+	if _, ok := wf.state(string(to)); !ok && wf != nil && len(wf.States) > 0 {
+		return fmt.Errorf("wongdb: issue %s: %s is not a workflow state: %w", issue.ID, to, ErrTransitionNotAllowed)
+	}
+	hooks, ok := wf.hooksFor(string(from), string(to))
+	if !ok {
+		return fmt.Errorf("wongdb: issue %s: %s -> %s: %w", issue.ID, from, to, ErrTransitionNotAllowed)
+	}
+
+	ev := &TransitionEvent{Issue: issue, From: from, To: to, Reason: reason}
+	for _, name := range hooks {
+		hook := lookupTransitionHook(name)
+		if hook == nil {
+			return fmt.Errorf("wongdb: issue %s: unknown transition hook %s", issue.ID, name)
+		}
+		if err := hook(ctx, s, ev); err != nil {
+			return fmt.Errorf("wongdb: issue %s: %s -> %s: %s: %w", issue.ID, from, to, name, err)
+		}
+	}
+
+	now := time.Now()
+	issue.Status = to
+	issue.UpdatedAt = now
+	switch {
+	case wf.IsDone(to) && !wf.IsDone(from):
+		issue.ClosedAt = &now
+		if reason != "" {
+			issue.CloseReason = reason
+		}
+	case !wf.IsDone(to) && wf.IsDone(from):
+		issue.ClosedAt = nil
+		issue.CloseReason = ""
+	}
+	return nil
+}
+
+// LoadWorkflow returns the workflow in s's config, validated, or nil if it
+// has none.
+func LoadWorkflow(ctx context.Context, s IssueStore) (*Workflow, error) {
+	cfg, err := s.ReadConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Workflow.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg.Workflow, nil
+}
+
+// configuredWorkflow is LoadWorkflow for readiness: a store whose config
+// cannot be read or has a broken workflow uses the built-in one.
+func configuredWorkflow(ctx context.Context, s IssueStore) *Workflow {
+	wf, err := LoadWorkflow(ctx, s)
+	if err != nil {
+		return nil
+	}
+	return wf
+}
+
+// Transition moves an issue to status to under s's workflow, then saves
+// and syncs it. reason is recorded as the close reason when to is done.
+func Transition(ctx context.Context, s IssueStore, id string, to types.Status, reason string) (*types.Issue, error) {
+	wf, err := LoadWorkflow(ctx, s)
+	if err != nil {
+		return nil, fmt.Errorf("wongdb: transition %s: %w", id, err)
+	}
+	issue, err := LoadIssue(ctx, s, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := wf.Apply(ctx, s, issue, to, reason); err != nil {
+		return nil, err
+	}
+	if err := SaveIssue(ctx, s, issue); err != nil {
+		return nil, err
+	}
+	if err := s.Sync(ctx); err != nil {
+		return nil, fmt.Errorf("wongdb: transition %s sync: %w", id, err)
+	}
+	return issue, nil
+}
+
+// TransitionEvent is what a hook sees. Hooks may change Issue; the new
+// status is set after every hook has succeeded.
+type TransitionEvent struct {
+	Issue  *types.Issue
+	From   types.Status
+	To     types.Status
+	Reason string
+}
+
+// TransitionHook checks or adjusts an issue during a transition. Returning
+// an error stops the transition.
+type TransitionHook func(ctx context.Context, s IssueStore, ev *TransitionEvent) error
+
+var (
+	transitionHooksMu sync.RWMutex
+	transitionHooks   = map[string]TransitionHook{
+		"require_linked_change": requireLinkedChange,
+		"require_assignee":      requireAssignee,
+		"require_reason":        requireReason,
+		"reset_claim":           resetClaim,
+	}
+)
+
+// RegisterTransitionHook makes hook available to workflows as name,
+// replacing any hook of that name.
+func RegisterTransitionHook(name string, hook TransitionHook) {
+	transitionHooksMu.Lock()
+	defer transitionHooksMu.Unlock()
+	transitionHooks[name] = hook
+}
+
+// TransitionHookNames returns the registered hook names in sorted order.
+func TransitionHookNames() []string {
+	transitionHooksMu.RLock()
+	defer transitionHooksMu.RUnlock()
+	names := make([]string, 0, len(transitionHooks))
+	for name := range transitionHooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupTransitionHook(name string) TransitionHook {
+	transitionHooksMu.RLock()
+	defer transitionHooksMu.RUnlock()
+	return transitionHooks[name]
+}
+
+// changeLinker is implemented by stores that can find the changes whose
+// descriptions reference an issue.
+type changeLinker interface {
+	LinkedChanges(ctx context.Context, id string) ([]ChangeLink, error)
+}
+
+// requireLinkedChange rejects the transition unless some change links the
+// issue with a "Wong:" trailer.
+func requireLinkedChange(ctx context.Context, s IssueStore, ev *TransitionEvent) error {
+	linker, ok := s.(changeLinker)
+	if !ok {
+		return fmt.Errorf("store cannot look up linked changes: %w", ErrTransitionRejected)
+	}
+	links, err := linker.LinkedChanges(ctx, ev.Issue.ID)
+	if err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		return fmt.Errorf("no change is linked to %s (add %q to a change description): %w",
+			ev.Issue.ID, FormatIssueTrailer(ev.Issue.ID), ErrTransitionRejected)
+	}
+	return nil
+}
+
+// requireAssignee rejects the transition for unassigned issues.
+func requireAssignee(ctx context.Context, s IssueStore, ev *TransitionEvent) error {
+	if ev.Issue.Assignee == "" {
+		return fmt.Errorf("issue has no assignee: %w", ErrTransitionRejected)
+	}
+	return nil
+}
+
+// requireReason rejects the transition when no reason is given.
+func requireReason(ctx context.Context, s IssueStore, ev *TransitionEvent) error {
+	if ev.Reason == "" {
+		return fmt.Errorf("a reason is required: %w", ErrTransitionRejected)
+	}
+	return nil
+}
+
+// resetClaim clears the assignee so the issue can be claimed again.
+func resetClaim(ctx context.Context, s IssueStore, ev *TransitionEvent) error {
+	ev.Issue.Assignee = ""
+	return nil
+}
@@ -0,0 +1,209 @@
+package wongdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/steveyegge/beads/internal/types"
+)
+
+// teamWorkflow is the example from the Workflow doc comment.
+func teamWorkflow() *Workflow {
+	return &Workflow{
+		States: []WorkflowState{
+			{Name: "open"}, {Name: "in_progress"}, {Name: "in_review"},
+			{Name: "blocked_external", Hold: true}, {Name: "deferred", Hold: true},
+			{Name: "closed", Done: true},
+		},
+		Transitions: []WorkflowTransition{
+			{From: []string{"open", "deferred"}, To: []string{"in_progress", "deferred", "blocked_external"}},
+			{From: []string{"in_progress", "blocked_external"}, To: []string{"in_review", "blocked_external", "open"}},
+			{From: []string{"in_review"}, To: []string{"closed"}, Hooks: []string{"require_reason"}},
+			{From: []string{"closed"}, To: []string{"open"}, Hooks: []string{"reset_claim"}},
+		},
+	}
+}
+
+func newWorkflowStore(t *testing.T, issues ...*types.Issue) *MemStore {
+	t.Helper()
+	s := newMemStoreWith(t, issues...)
+	s.SetConfig(Config{HistoryMode: "squash", Workflow: teamWorkflow()})
+	return s
+}
+
+func withStatus(issue *types.Issue, status string) *types.Issue {
+	issue.Status = types.Status(status)
+	return issue
+}
+
+func TestWorkflow_Readiness(t *testing.T) {
+	ctx := context.Background()
+	s := newWorkflowStore(t,
+		withStatus(makeTestIssue("review", "In review"), "in_review"),
+		withStatus(makeTestIssue("parked", "Deferred"), "deferred"),
+		withStatus(makeTestIssue("waiting", "Blocked externally"), "blocked_external"),
+		withStatus(makeTestIssue("shipped", "Closed"), "closed"),
+		blockedBy(makeTestIssue("after-shipped", "After closed"), types.DepBlocks, "shipped"),
+		blockedBy(makeTestIssue("after-parked", "After deferred"), types.DepBlocks, "parked"),
+	)
+
+	ready, err := ReadyIssues(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := issueIDs(ready); got != "after-shipped review" {
+		t.Errorf("ReadyIssues = %q", got)
+	}
+	if ok, _ := IsReady(ctx, s, "waiting"); ok {
+		t.Error("held issue is ready")
+	}
+
+	// Mark in_review done: its dependents unblock, and it leaves the list.
+	wf := teamWorkflow()
+	wf.States[2].Done = true
+	s.SetConfig(Config{Workflow: wf})
+	ready, _ = QueryIssues(ctx, s, Query{Ready: true})
+	if got := issueIDs(ready); got != "after-shipped" {
+		t.Errorf("ready with in_review done = %q", got)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	ctx := context.Background()
+	claimed := makeTestIssue("bt-1", "One")
+	claimed.Assignee = "alice"
+	s := newWorkflowStore(t, claimed)
+
+	if _, err := Transition(ctx, s, "bt-1", "closed", "done"); !errors.Is(err, ErrTransitionNotAllowed) {
+		t.Fatalf("open -> closed = %v, want ErrTransitionNotAllowed", err)
+	}
+	if _, err := Transition(ctx, s, "bt-1", "wontfix", ""); !errors.Is(err, ErrTransitionNotAllowed) {
+		t.Fatalf("unknown state = %v, want ErrTransitionNotAllowed", err)
+	}
+	for _, to := range []types.Status{"in_progress", "in_review"} {
+		if _, err := Transition(ctx, s, "bt-1", to, ""); err != nil {
+			t.Fatalf("-> %s: %v", to, err)
+		}
+	}
+	if _, err := Transition(ctx, s, "bt-1", "closed", ""); !errors.Is(err, ErrTransitionRejected) {
+		t.Fatalf("close without reason = %v, want ErrTransitionRejected", err)
+	}
+	issue, err := Transition(ctx, s, "bt-1", "closed", "shipped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issue.ClosedAt == nil || issue.CloseReason != "shipped" {
+		t.Errorf("closed issue = %+v", issue)
+	}
+
+	// Reopening resets the claim and the close bookkeeping.
+	if _, err := Transition(ctx, s, "bt-1", "open", ""); err != nil {
+		t.Fatal(err)
+	}
+	issue, _ = LoadIssue(ctx, s, "bt-1")
+	if issue.Status != "open" || issue.Assignee != "" || issue.ClosedAt != nil || issue.CloseReason != "" {
+		t.Errorf("reopened issue = %+v", issue)
+	}
+}
+
+func TestTransition_Hooks(t *testing.T) {
+	ctx := context.Background()
+	var seen []string
+	RegisterTransitionHook("test_record", func(ctx context.Context, s IssueStore, ev *TransitionEvent) error {
+		seen = append(seen, fmt.Sprintf("%s:%s->%s", ev.Issue.ID, ev.From, ev.To))
+		if ev.Issue.Title == "veto" {
+			return fmt.Errorf("vetoed: %w", ErrTransitionRejected)
+		}
+		return nil
+	})
+	wf := &Workflow{Transitions: []WorkflowTransition{
+		{From: []string{"*"}, To: []string{"closed"}, Hooks: []string{"test_record", "require_linked_change"}},
+		{From: []string{"*"}, To: []string{"in_progress"}, Hooks: []string{"test_record"}},
+	}}
+	if err := wf.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	s := newMemStoreWith(t, makeTestIssue("ok", "Fine"), makeTestIssue("no", "veto"))
+	s.SetConfig(Config{Workflow: wf})
+
+	if _, err := Transition(ctx, s, "ok", "in_progress", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Transition(ctx, s, "no", "in_progress", ""); !errors.Is(err, ErrTransitionRejected) {
+		t.Errorf("vetoed transition = %v", err)
+	}
+	// A MemStore has no changes to link, so require_linked_change refuses.
+	if _, err := Transition(ctx, s, "ok", "closed", ""); !errors.Is(err, ErrTransitionRejected) {
+		t.Errorf("close without linked change = %v", err)
+	}
+	if got := strings.Join(seen, " "); got != "ok:open->in_progress no:open->in_progress ok:in_progress->closed" {
+		t.Errorf("hook calls = %q", got)
+	}
+	if issue, _ := LoadIssue(ctx, s, "no"); issue.Status != types.StatusOpen {
+		t.Errorf("vetoed issue status = %s", issue.Status)
+	}
+}
+
+func TestWorkflow_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		wf   *Workflow
+		want string
+	}{
+		{"nil", nil, ""},
+		{"example", teamWorkflow(), ""},
+		{"duplicate state", &Workflow{States: []WorkflowState{{Name: "a"}, {Name: "a"}}}, "defined twice"},
+		{"done and hold", &Workflow{States: []WorkflowState{{Name: "a", Done: true, Hold: true}}}, "both done and hold"},
+		{"unknown state", &Workflow{
+			States:      []WorkflowState{{Name: "a"}},
+			Transitions: []WorkflowTransition{{From: []string{"a"}, To: []string{"b"}}},
+		}, "unknown state b"},
+		{"unknown hook", &Workflow{Transitions: []WorkflowTransition{{From: []string{"*"}, To: []string{"*"}, Hooks: []string{"nope"}}}}, "unknown hook nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.wf.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate = %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_Transition(t *testing.T) {
+	ts := httptest.NewServer(NewServer(newWorkflowStore(t, makeTestIssue("api-1", "API"))))
+	t.Cleanup(ts.Close)
+
+	if status := doJSON(t, http.MethodPatch, ts.URL+"/issues/api-1", map[string]string{"status": "closed"}, nil); status != http.StatusConflict {
+		t.Errorf("PATCH open -> closed status = %d, want 409", status)
+	}
+	var claimed types.Issue
+	if status := doJSON(t, http.MethodPost, ts.URL+"/issues/api-1/claim", claimRequest{Assignee: "alice"}, &claimed); status != http.StatusOK {
+		t.Fatalf("claim status = %d", status)
+	}
+	if status := doJSON(t, http.MethodPost, ts.URL+"/issues/api-1/transition", transitionRequest{Status: "in_review"}, nil); status != http.StatusOK {
+		t.Fatalf("transition to in_review status = %d", status)
+	}
+	if status := doJSON(t, http.MethodPost, ts.URL+"/issues/api-1/transition", transitionRequest{Status: "closed"}, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("close without reason status = %d, want 422", status)
+	}
+	var closed types.Issue
+	if status := doJSON(t, http.MethodPost, ts.URL+"/issues/api-1/transition", transitionRequest{Status: "closed", Reason: "merged"}, &closed); status != http.StatusOK {
+		t.Fatalf("close status = %d", status)
+	}
+	if closed.CloseReason != "merged" || closed.Assignee != "alice" {
+		t.Errorf("closed = %+v", closed)
+	}
+	if status := doJSON(t, http.MethodPost, ts.URL+"/issues/api-1/claim", claimRequest{Assignee: "bob"}, nil); status != http.StatusConflict {
+		t.Errorf("claim of closed issue status = %d, want 409", status)
+	}
+}
@@ -337,7 +337,7 @@ func (m *Manager) NumPieces() int {
 			CreatedAt: now,
 			UpdatedAt: now,
 		}
-		if err := SaveIssue(db, ctx, issue); err != nil {
+		if err := db.SaveIssue(ctx, issue); err != nil {
 			t.Fatalf("Failed to save issue %s: %v", task.issueID, err)
 		}
 	}
@@ -495,7 +495,7 @@ func runAgentInWorkspace(t *testing.T, repoDir string, wsDB *WongDB, ctx context
 				},
 			},
 		}
-		if err := SaveIssue(wsDB, ctx, subIssue); err != nil {
+		if err := wsDB.SaveIssue(ctx, subIssue); err != nil {
 			return fmt.Errorf("save subtask %s: %w", sub.id, err)
 		}
 	}
@@ -528,7 +528,7 @@ func runAgentInWorkspace(t *testing.T, repoDir string, wsDB *WongDB, ctx context
 			UpdatedAt: time.Now(),
 			ClosedAt:  timePtr(time.Now()),
 		}
-		if err := SaveIssue(wsDB, ctx, closedIssue); err != nil {
+		if err := wsDB.SaveIssue(ctx, closedIssue); err != nil {
 			return fmt.Errorf("close subtask %s: %w", sub.id, err)
 		}
 		if err := wsDB.Sync(ctx); err != nil {
@@ -546,7 +546,7 @@ func runAgentInWorkspace(t *testing.T, repoDir string, wsDB *WongDB, ctx context
 	parentIssue.UpdatedAt = time.Now()
 	parentIssue.ClosedAt = timePtr(time.Now())
 	parentIssue.CloseReason = "Completed by agent in workspace " + wsName
-	if err := SaveIssue(wsDB, ctx, &parentIssue); err != nil {
+	if err := wsDB.SaveIssue(ctx, &parentIssue); err != nil {
 		return fmt.Errorf("close parent %s: %w", task.issueID, err)
 	}
 	if err := wsDB.Sync(ctx); err != nil {
@@ -560,15 +560,6 @@ func runAgentInWorkspace(t *testing.T, repoDir string, wsDB *WongDB, ctx context
 	return nil
 }
 
-// SaveIssue is a helper to marshal and write a types.Issue via WongDB
-func SaveIssue(db *WongDB, ctx context.Context, issue *types.Issue) error {
-	data, err := json.MarshalIndent(issue, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal issue %s: %w", issue.ID, err)
-	}
-	return db.WriteIssue(ctx, issue.ID, data)
-}
-
 func timePtr(t time.Time) *time.Time {
 	return &t
 }
@@ -603,10 +594,10 @@ func TestE2E_WorkspaceDependencyChain(t *testing.T) {
 		},
 	}
 
-	if err := SaveIssue(db, ctx, issueA); err != nil {
+	if err := db.SaveIssue(ctx, issueA); err != nil {
 		t.Fatal(err)
 	}
-	if err := SaveIssue(db, ctx, issueB); err != nil {
+	if err := db.SaveIssue(ctx, issueB); err != nil {
 		t.Fatal(err)
 	}
 	if err := db.Sync(ctx); err != nil {
@@ -641,7 +632,7 @@ func TestE2E_WorkspaceDependencyChain(t *testing.T) {
 		// Close issue
 		issueA.Status = types.StatusClosed
 		issueA.ClosedAt = timePtr(time.Now())
-		if err := SaveIssue(wsADB, ctx, issueA); err != nil {
+		if err := wsADB.SaveIssue(ctx, issueA); err != nil {
 			t.Errorf("[agent-a] SaveIssue failed: %v", err)
 			return
 		}
@@ -682,7 +673,7 @@ func TestE2E_WorkspaceDependencyChain(t *testing.T) {
 		issueB.Status = types.StatusClosed
 		issueB.ClosedAt = timePtr(time.Now())
 		issueB.UpdatedAt = time.Now()
-		if err := SaveIssue(wsBDB, ctx, issueB); err != nil {
+		if err := wsBDB.SaveIssue(ctx, issueB); err != nil {
 			t.Errorf("[agent-b] SaveIssue failed: %v", err)
 			return
 		}